@@ -1,11 +1,10 @@
 package main
 
 import (
-	"crypto/tls"
-	"crypto/x509"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,9 +17,11 @@ import (
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	"github.com/mainflux/agent/pkg/agent"
 	"github.com/mainflux/agent/pkg/agent/api"
+	grpcapi "github.com/mainflux/agent/pkg/agent/api/grpc"
 	"github.com/mainflux/agent/pkg/bootstrap"
 	"github.com/mainflux/agent/pkg/conn"
 	"github.com/mainflux/agent/pkg/edgex"
+	"github.com/mainflux/agent/pkg/encoder"
 	"github.com/mainflux/mainflux"
 	"github.com/mainflux/mainflux/errors"
 	"github.com/mainflux/mainflux/logger"
@@ -38,12 +39,20 @@ const (
 	defBootstrapRetryDelaySeconds = "10"
 	defLogLevel                   = "info"
 	defEdgexURL                   = "http://localhost:48090/api/v1/"
+	defEdgexAllowedOperations     = ""
+	defEdgexMaxLogLines           = "100"
+	defEdgexStreamInterval        = "1s"
+	defEdgexStreamMaxDuration     = "10m"
+	defEdgexJobPollInterval       = "2s"
+	defEdgexJobTimeout            = "5m"
+	defEdgexInstances             = ""
 	defMqttURL                    = "localhost:1883"
 	defCtrlChan                   = ""
 	defDataChan                   = ""
 	defEncryption                 = "false"
 	defMqttUsername               = ""
 	defMqttPassword               = ""
+	defMqttPasswordFile           = ""
 	defMqttChannel                = ""
 	defMqttSkipTLSVer             = "true"
 	defMqttMTLS                   = "false"
@@ -52,13 +61,102 @@ const (
 	defMqttRetain                 = "false"
 	defMqttCert                   = "thing.cert"
 	defMqttPrivKey                = "thing.key"
+	defMqttTopicPrefix            = ""
+	defMqttMaxInflight            = "0"
+	defMqttSerialize              = "false"
+	defMqttThrottleBackoff        = "100ms"
+	defMqttThrottleMaxBackoff     = "5s"
+	defMqttMaxPayload             = "0"
+	defMqttOverflow               = "truncate"
+	defMqttInflightFailFast       = "false"
+	defMqttGzipThreshold          = "1024"
+	defMqttDedup                  = ""
 	defConfigFile                 = "config.toml"
+	defConfigURL                  = ""
+	defConfigURLAuth              = ""
 	defNatsURL                    = nats.DefaultURL
+	defNatsCredentials            = ""
+	defNatsToken                  = ""
+	defNatsCACert                 = ""
+	defNatsClientCert             = ""
+	defNatsClientKey              = ""
 	defHeartbeatInterval          = "10s"
+	defHeartbeatDurable           = ""
+	defHeartbeatSubjects          = "heartbeat.>"
+	defHeartbeatWorkers           = "1"
+	defHeartbeatBuffer            = "1000"
+	defHeartbeatTokens            = "type"
+	defHeartbeatNotifyWindow      = "1s"
+	defHeartbeatPause             = "1h"
 	defTermSessionTimeout         = "60s"
+	defAuditEnabled               = "false"
+	defAuditMaxEntries            = "10000"
+	defExecMaxOutputSize          = "0"
+	defExecMaxOutputHardCap       = "1048576"
+	defExecMaxCommandLength       = "65536"
+	defExecDefaultRetries         = "0"
+	defExecRetryDelay             = "1s"
+	defExecOutputCharset          = ""
+	defExecDefaultNice            = "0"
+	defExecShell                  = "false"
+	defExecAllowlist              = ""
+	defExecAllowlistKey           = ""
+	defExecAllowlistPersist       = "false"
+	defExecOutputHash             = "false"
+	defExecAllowedWorkDirs        = ""
+	defExecHistorySize            = "100"
+	defExecMaxLines               = "0"
+	defExecTemplateEnv            = ""
+	defExecTimeout                = "0s"
+	defExecTimeouts               = ""
+	defExecIdleTimeout            = "0s"
+	defExecOutputDir              = ""
+	defExecOutputMaxAge           = "24h"
+	defExecOutputMaxSize          = "104857600"
+	defDeviceID                   = ""
+	defSenMLBaseName              = ""
+	defSenMLNamePrefix            = ""
+	defSenMLErrorVerbosity        = "full"
+	defGRPCPort                   = ""
+	defSocketPath                 = ""
+	defSocketMode                 = "0600"
+	defApplyTimeout               = "0s"
+	defDeadLetterTopic            = ""
+	defCommandFormat              = "senml"
+	defResponseFormat             = "senml"
+	defCommandAck                 = "false"
+	defRoutePattern               = ""
+	defSafeMode                   = "false"
+	defSafeModeFile               = "safemode"
+	defDeadManTimeout             = "0s"
+	defDeadManCommand             = ""
+	defBeaconInterval             = "10s"
+	defBeaconSubject              = ""
+	defBeaconTopic                = ""
+	defReadyTopic                 = ""
+	defRebootDelay                = "5s"
+	defRebootCommand              = "shutdown,-r,now"
+	defRebootPreHook              = ""
+	defMaintenanceQueueSize       = "100"
+	defArtifactsPort              = ""
+	defArtifactsRoot              = "artifacts"
+	defArtifactsToken             = ""
+	defArtifactsURL               = ""
+	defStoreBackend               = "memory"
+	defStorePath                  = "store"
+	defDisabledFeatures           = ""
 	envConfigFile                 = "MF_AGENT_CONFIG_FILE"
+	envConfigURL                  = "MF_AGENT_CONFIG_URL"
+	envConfigURLAuth              = "MF_AGENT_CONFIG_URL_AUTH"
 	envLogLevel                   = "MF_AGENT_LOG_LEVEL"
 	envEdgexURL                   = "MF_AGENT_EDGEX_URL"
+	envEdgexAllowedOperations     = "MF_AGENT_EDGEX_ALLOWED_OPERATIONS"
+	envEdgexMaxLogLines           = "MF_AGENT_EDGEX_MAX_LOG_LINES"
+	envEdgexStreamInterval        = "MF_AGENT_EDGEX_STREAM_INTERVAL"
+	envEdgexStreamMaxDuration     = "MF_AGENT_EDGEX_STREAM_MAX_DURATION"
+	envEdgexJobPollInterval       = "MF_AGENT_EDGEX_JOB_POLL_INTERVAL"
+	envEdgexJobTimeout            = "MF_AGENT_EDGEX_JOB_TIMEOUT"
+	envEdgexInstances             = "MF_AGENT_EDGEX_INSTANCES"
 	envMqttURL                    = "MF_AGENT_MQTT_URL"
 	envHTTPPort                   = "MF_AGENT_HTTP_PORT"
 	envBootstrapURL               = "MF_AGENT_BOOTSTRAP_URL"
@@ -71,18 +169,97 @@ const (
 	envDataChan                   = "MF_AGENT_DATA_CHANNEL"
 	envEncryption                 = "MF_AGENT_ENCRYPTION"
 	envNatsURL                    = "MF_AGENT_NATS_URL"
+	envNatsCredentials            = "MF_AGENT_NATS_CREDENTIALS"
+	envNatsToken                  = "MF_AGENT_NATS_TOKEN"
+	envNatsCACert                 = "MF_AGENT_NATS_CA_CERT"
+	envNatsClientCert             = "MF_AGENT_NATS_CLIENT_CERT"
+	envNatsClientKey              = "MF_AGENT_NATS_CLIENT_KEY"
+	envHeartbeatNotifyWindow      = "MF_AGENT_HEARTBEAT_NOTIFY_WINDOW"
+	envHeartbeatPause             = "MF_AGENT_HEARTBEAT_PAUSE"
 
-	envMqttUsername       = "MF_AGENT_MQTT_USERNAME"
-	envMqttPassword       = "MF_AGENT_MQTT_PASSWORD"
-	envMqttSkipTLSVer     = "MF_AGENT_MQTT_SKIP_TLS"
-	envMqttMTLS           = "MF_AGENT_MQTT_MTLS"
-	envMqttCA             = "MF_AGENT_MQTT_CA"
-	envMqttQoS            = "MF_AGENT_MQTT_QOS"
-	envMqttRetain         = "MF_AGENT_MQTT_RETAIN"
-	envMqttCert           = "MF_AGENT_MQTT_CLIENT_CERT"
-	envMqttPrivKey        = "MF_AGENT_MQTT_CLIENT_PK"
-	envHeartbeatInterval  = "MF_AGENT_HEARTBEAT_INTERVAL"
-	envTermSessionTimeout = "MF_AGENT_TERMINAL_SESSION_TIMEOUT"
+	envMqttUsername         = "MF_AGENT_MQTT_USERNAME"
+	envMqttPassword         = "MF_AGENT_MQTT_PASSWORD"
+	envMqttPasswordFile     = "MF_AGENT_MQTT_PASSWORD_FILE"
+	envMqttSkipTLSVer       = "MF_AGENT_MQTT_SKIP_TLS"
+	envMqttMTLS             = "MF_AGENT_MQTT_MTLS"
+	envMqttCA               = "MF_AGENT_MQTT_CA"
+	envMqttQoS              = "MF_AGENT_MQTT_QOS"
+	envMqttRetain           = "MF_AGENT_MQTT_RETAIN"
+	envMqttCert             = "MF_AGENT_MQTT_CLIENT_CERT"
+	envMqttPrivKey          = "MF_AGENT_MQTT_CLIENT_PK"
+	envMqttTopicPrefix      = "MF_AGENT_MQTT_TOPIC_PREFIX"
+	envMqttMaxInflight      = "MF_AGENT_MQTT_MAX_INFLIGHT"
+	envMqttSerialize        = "MF_AGENT_MQTT_SERIALIZE"
+	envMqttThrottleBackoff  = "MF_AGENT_MQTT_THROTTLE_BACKOFF"
+	envMqttThrottleMax      = "MF_AGENT_MQTT_THROTTLE_MAX_BACKOFF"
+	envMqttMaxPayload       = "MF_AGENT_MQTT_MAX_PAYLOAD"
+	envMqttOverflow         = "MF_AGENT_MQTT_OVERFLOW"
+	envMqttInflightFailFast = "MF_AGENT_MQTT_INFLIGHT_FAIL_FAST"
+	envMqttGzipThreshold    = "MF_AGENT_MQTT_GZIP_THRESHOLD"
+	envMqttDedup            = "MF_AGENT_MQTT_DEDUP"
+	envHeartbeatInterval    = "MF_AGENT_HEARTBEAT_INTERVAL"
+	envHeartbeatDurable     = "MF_AGENT_HEARTBEAT_DURABLE"
+	envHeartbeatSubjects    = "MF_AGENT_HEARTBEAT_SUBJECTS"
+	envHeartbeatWorkers     = "MF_AGENT_HEARTBEAT_WORKERS"
+	envHeartbeatBuffer      = "MF_AGENT_HEARTBEAT_BUFFER"
+	envHeartbeatTokens      = "MF_AGENT_HEARTBEAT_TOKENS"
+	envTermSessionTimeout   = "MF_AGENT_TERMINAL_SESSION_TIMEOUT"
+	envAuditEnabled         = "MF_AGENT_AUDIT_ENABLED"
+	envAuditMaxEntries      = "MF_AGENT_AUDIT_MAX_ENTRIES"
+	envExecMaxOutputSize    = "MF_AGENT_EXEC_MAX_OUTPUT_SIZE"
+	envExecMaxOutputHardCap = "MF_AGENT_EXEC_MAX_OUTPUT_HARD_CAP"
+	envExecMaxCommandLength = "MF_AGENT_EXEC_MAX_COMMAND_LENGTH"
+	envExecDefaultRetries   = "MF_AGENT_EXEC_DEFAULT_RETRIES"
+	envExecRetryDelay       = "MF_AGENT_EXEC_RETRY_DELAY"
+	envExecOutputCharset    = "MF_AGENT_EXEC_OUTPUT_CHARSET"
+	envExecDefaultNice      = "MF_AGENT_EXEC_DEFAULT_NICE"
+	envExecShell            = "MF_AGENT_EXEC_SHELL"
+	envExecAllowlist        = "MF_AGENT_EXEC_ALLOWLIST"
+	envExecAllowlistKey     = "MF_AGENT_EXEC_ALLOWLIST_KEY"
+	envExecAllowlistPersist = "MF_AGENT_EXEC_ALLOWLIST_PERSIST"
+	envExecOutputHash       = "MF_AGENT_EXEC_OUTPUT_HASH"
+	envExecAllowedWorkDirs  = "MF_AGENT_EXEC_ALLOWED_WORK_DIRS"
+	envExecHistorySize      = "MF_AGENT_EXEC_HISTORY_SIZE"
+	envExecMaxLines         = "MF_AGENT_EXEC_MAX_LINES"
+	envExecTemplateEnv      = "MF_AGENT_EXEC_TEMPLATE_ENV"
+	envExecTimeout          = "MF_AGENT_EXEC_TIMEOUT"
+	envExecTimeouts         = "MF_AGENT_EXEC_TIMEOUTS"
+	envExecIdleTimeout      = "MF_AGENT_EXEC_IDLE_TIMEOUT"
+	envExecOutputDir        = "MF_AGENT_EXEC_OUTPUT_DIR"
+	envExecOutputMaxAge     = "MF_AGENT_EXEC_OUTPUT_MAX_AGE"
+	envExecOutputMaxSize    = "MF_AGENT_EXEC_OUTPUT_MAX_SIZE"
+	envDeviceID             = "MF_AGENT_DEVICE_ID"
+	envSenMLBaseName        = "MF_AGENT_SENML_BASE_NAME"
+	envSenMLNamePrefix      = "MF_AGENT_SENML_NAME_PREFIX"
+	envSenMLErrorVerbosity  = "MF_AGENT_SENML_ERROR_VERBOSITY"
+	envGRPCPort             = "MF_AGENT_GRPC_PORT"
+	envSocketPath           = "MF_AGENT_SOCKET_PATH"
+	envSocketMode           = "MF_AGENT_SOCKET_MODE"
+	envApplyTimeout         = "MF_AGENT_APPLY_TIMEOUT"
+	envDeadLetterTopic      = "MF_AGENT_DEAD_LETTER_TOPIC"
+	envCommandFormat        = "MF_AGENT_COMMAND_FORMAT"
+	envResponseFormat       = "MF_AGENT_RESPONSE_FORMAT"
+	envCommandAck           = "MF_AGENT_COMMAND_ACK"
+	envRoutePattern         = "MF_AGENT_ROUTE_PATTERN"
+	envSafeMode             = "MF_AGENT_SAFE_MODE"
+	envSafeModeFile         = "MF_AGENT_SAFE_MODE_FILE"
+	envDeadManTimeout       = "MF_AGENT_DEAD_MAN_TIMEOUT"
+	envDeadManCommand       = "MF_AGENT_DEAD_MAN_COMMAND"
+	envBeaconInterval       = "MF_AGENT_BEACON_INTERVAL"
+	envBeaconSubject        = "MF_AGENT_BEACON_SUBJECT"
+	envBeaconTopic          = "MF_AGENT_BEACON_TOPIC"
+	envReadyTopic           = "MF_AGENT_READY_TOPIC"
+	envRebootDelay          = "MF_AGENT_REBOOT_DELAY"
+	envRebootCommand        = "MF_AGENT_REBOOT_COMMAND"
+	envRebootPreHook        = "MF_AGENT_REBOOT_PRE_HOOK"
+	envMaintenanceQueueSize = "MF_AGENT_MAINTENANCE_QUEUE_SIZE"
+	envArtifactsPort        = "MF_AGENT_ARTIFACTS_PORT"
+	envArtifactsRoot        = "MF_AGENT_ARTIFACTS_ROOT"
+	envArtifactsToken       = "MF_AGENT_ARTIFACTS_TOKEN"
+	envArtifactsURL         = "MF_AGENT_ARTIFACTS_URL"
+	envStoreBackend         = "MF_AGENT_STORE_BACKEND"
+	envStorePath            = "MF_AGENT_STORE_PATH"
+	envDisabledFeatures     = "MF_AGENT_DISABLED_FEATURES"
 )
 
 var (
@@ -90,9 +267,28 @@ var (
 	errFetchingBootstrapFailed = errors.New("Fetching bootstrap failed with error")
 	errFailedToReadConfig      = errors.New("Failed to read config")
 	errFailedToConfigHeartbeat = errors.New("Failed to configure heartbeat")
+	errFailedToConfigMQTT      = errors.New("Failed to configure MQTT")
+	errFailedToConfigEdgex     = errors.New("Failed to configure EdgeX")
+	errFailedToConfigAudit     = errors.New("Failed to configure audit log")
+	errFailedToConfigExec      = errors.New("Failed to configure command execution")
+	errFailedToConfigSafeMode  = errors.New("Failed to configure safe mode")
+	errFailedToConfigApply     = errors.New("Failed to configure config apply")
+	errFailedToConfigDeadMan   = errors.New("Failed to configure dead man switch")
+	errFailedToConfigMaint     = errors.New("Failed to configure maintenance mode")
+	errFailedToConfigBeacon    = errors.New("Failed to configure agent heartbeat")
+	errFailedToConfigReboot    = errors.New("Failed to configure host reboot")
+	errMissingConfigFile       = errors.New("Missing config file")
 )
 
 func main() {
+	initConfig := flag.Bool("init-config", false, "Generate config file with default values if it doesn't exist")
+	flag.Parse()
+
+	missing, err := missingConfig(*initConfig)
+	if err != nil {
+		log.Fatalf(err.Error())
+	}
+
 	cfg, err := loadEnvConfig()
 	if err != nil {
 		log.Fatalf(fmt.Sprintf("Failed to load config: %s", err))
@@ -103,26 +299,120 @@ func main() {
 		log.Fatalf(fmt.Sprintf("Failed to create logger: %s", err))
 	}
 
+	switch {
+	case !missing:
+		agent.SaveConfig(cfg)
+	case *initConfig:
+		if err := agent.InitConfig(cfg); err != nil {
+			logger.Error(fmt.Sprintf("Failed to generate config file: %s", err))
+			os.Exit(1)
+		}
+		logger.Info(fmt.Sprintf("Generated config file %s", cfg.File))
+	}
+
+	envCfg := cfg
 	cfg, err = loadBootConfig(cfg, logger)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to load config: %s", err))
 	}
 
-	nc, err := nats.Connect(cfg.Server.NatsURL)
+	if err := cfg.Validate(); err != nil {
+		logger.Error(fmt.Sprintf("Invalid config: %s", err))
+		os.Exit(1)
+	}
+
+	if err := conn.ValidateFormat(cfg.Channels.Format); err != nil {
+		logger.Error(fmt.Sprintf("Invalid command format: %s", err))
+		os.Exit(1)
+	}
+
+	if err := encoder.ValidateFormat(cfg.Channels.ResponseFormat); err != nil {
+		logger.Error(fmt.Sprintf("Invalid response format: %s", err))
+		os.Exit(1)
+	}
+
+	dm := agent.NewDeadMan(cfg.DeadMan, logger)
+	sn := agent.NewStateNotifier(logger, dm.Notify)
+
+	nc, err := agent.ConnectNATS(cfg,
+		nats.DisconnectErrHandler(func(_ *nats.Conn, _ error) {
+			sn.Notify(agent.SubsystemNATS, agent.StateLost)
+		}),
+		nats.ReconnectHandler(func(_ *nats.Conn) {
+			sn.Notify(agent.SubsystemNATS, agent.StateConnected)
+		}),
+	)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Failed to connect to NATS: %s %s", err, cfg.Server.NatsURL))
 		os.Exit(1)
 	}
 	defer nc.Close()
+	sn.Notify(agent.SubsystemNATS, agent.StateConnected)
+
+	var creds *agent.TLSCredentials
+	if cfg.MQTT.MTLS {
+		creds = agent.NewTLSCredentials(cfg.MQTT)
+	}
+
+	// Broker is set once agent service is created, subscriptions
+	// are renewed on every reconnect of MQTT client.
+	var b conn.MqttBroker
+	resubscribe := func() {
+		if b == nil {
+			return
+		}
+		if err := b.Subscribe(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to subscribe to MQTT topics: %s", err))
+		}
+	}
 
-	mqttClient, err := connectToMQTTBroker(cfg.MQTT, logger)
+	mqttClient, err := connectToMQTTBroker(cfg.MQTT, creds, sn, resubscribe, logger)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	edgexClient := edgex.NewClient(cfg.Edgex.URL, logger)
+	var edgexClient edgex.Client
+	if cfg.Features.Enabled(agent.FeatureEdgex) {
+		edgexClient = edgex.NewClient(cfg.Edgex.URL, logger)
+	}
 
-	svc, err := agent.New(mqttClient, &cfg, edgexClient, nc, logger)
+	tp := agent.Throughput{
+		Messages: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "agent",
+			Subsystem: "broker",
+			Name:      "message_count",
+			Help:      "Number of messages published and received.",
+		}, []string{"transport", "direction"}),
+		Bytes: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "agent",
+			Subsystem: "broker",
+			Name:      "message_bytes",
+			Help:      "Total size of messages published and received in bytes.",
+		}, []string{"transport", "direction"}),
+		Inflight: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "agent",
+			Subsystem: "broker",
+			Name:      "inflight_publishes",
+			Help:      "Number of MQTT publishes waiting for acknowledgement.",
+		}, []string{}),
+		Throttled: kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "agent",
+			Subsystem: "broker",
+			Name:      "throttled_publishes",
+			Help:      "Number of MQTT publishes throttled by the broker.",
+		}, []string{}),
+		Backoff: kitprometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: "agent",
+			Subsystem: "broker",
+			Name:      "publish_backoff_seconds",
+			Help:      "Current backoff of MQTT publishes throttled by the broker.",
+		}, []string{}),
+	}
+
+	sync := func() (agent.Config, error) {
+		return loadBootConfig(envCfg, logger)
+	}
+	svc, err := agent.New(mqttClient, &cfg, edgexClient, nc, tp, creds, sync, logger)
 	if err != nil {
 		logger.Error(fmt.Sprintf("Error in agent service: %s", err))
 		os.Exit(1)
@@ -144,10 +434,12 @@ func main() {
 			Help:      "Total duration of requests in microseconds.",
 		}, []string{"method"}),
 	)
-	b := conn.NewBroker(svc, mqttClient, cfg.Channels.Control, nc, logger)
+	sn.Start(svc)
+
+	b = conn.NewBroker(svc, mqttClient, cfg.Channels.Control, cfg.Channels.DeadLetter, cfg.Channels.Format, nc, tp, logger)
 	go b.Subscribe()
 
-	errs := make(chan error, 3)
+	errs := make(chan error, 4)
 
 	go func() {
 		p := fmt.Sprintf(":%s", cfg.Server.Port)
@@ -155,32 +447,116 @@ func main() {
 		errs <- http.ListenAndServe(p, api.MakeHandler(svc))
 	}()
 
+	if cfg.GRPC.Port != "" {
+		go startGRPCServer(svc, cfg.GRPC.Port, logger, errs)
+	}
+
+	if cfg.Socket.Path != "" {
+		go startSocketServer(svc, cfg.Socket, cfg.Channels.Format, logger, errs)
+	}
+
+	if cfg.Artifacts.Enabled() {
+		go func() {
+			p := fmt.Sprintf(":%s", cfg.Artifacts.Port)
+			logger.Info(fmt.Sprintf("Agent artifact server started, exposed port %s", cfg.Artifacts.Port))
+			errs <- http.ListenAndServe(p, agent.ArtifactsHandler(cfg.Artifacts))
+		}()
+	}
+
 	go func() {
 		c := make(chan os.Signal)
 		signal.Notify(c, syscall.SIGINT)
 		errs <- fmt.Errorf("%s", <-c)
 	}()
 
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGHUP)
+		for range c {
+			svc.ReloadCerts()
+		}
+	}()
+
 	err = <-errs
 	logger.Error(fmt.Sprintf("Agent terminated: %s", err))
 }
 
+func startGRPCServer(svc agent.Service, port string, logger logger.Logger, errs chan error) {
+	p := fmt.Sprintf(":%s", port)
+	listener, err := net.Listen("tcp", p)
+	if err != nil {
+		errs <- err
+		return
+	}
+	logger.Info(fmt.Sprintf("Agent gRPC service started, exposed port %s", port))
+	errs <- grpcapi.NewServer(svc).Serve(listener)
+}
+
+func startSocketServer(svc agent.Service, sc agent.SocketConfig, format string, logger logger.Logger, errs chan error) {
+	mode, err := sc.FileMode()
+	if err != nil {
+		errs <- err
+		return
+	}
+	listener, err := conn.ListenSocket(sc.Path, mode)
+	if err != nil {
+		errs <- err
+		return
+	}
+	logger.Info(fmt.Sprintf("Agent socket server started, listening on %s", sc.Path))
+	errs <- conn.NewSocketServer(svc, format, logger).Serve(listener)
+}
+
 func loadEnvConfig() (agent.Config, error) {
 	sc := agent.ServerConfig{
 		NatsURL: mainflux.Env(envNatsURL, defNatsURL),
 		Port:    mainflux.Env(envHTTPPort, defHTTPPort),
 	}
+	ack, err := strconv.ParseBool(mainflux.Env(envCommandAck, defCommandAck))
+	if err != nil {
+		ack = false
+	}
 	cc := agent.ChanConfig{
-		Control: mainflux.Env(envCtrlChan, defCtrlChan),
-		Data:    mainflux.Env(envDataChan, defDataChan),
+		Control:        mainflux.Env(envCtrlChan, defCtrlChan),
+		Data:           mainflux.Env(envDataChan, defDataChan),
+		DeadLetter:     mainflux.Env(envDeadLetterTopic, defDeadLetterTopic),
+		Format:         mainflux.Env(envCommandFormat, defCommandFormat),
+		ResponseFormat: mainflux.Env(envResponseFormat, defResponseFormat),
+		RoutePattern:   mainflux.Env(envRoutePattern, defRoutePattern),
+		Ack:            ack,
 	}
 	interval, err := time.ParseDuration(mainflux.Env(envHeartbeatInterval, defHeartbeatInterval))
 	if err != nil {
 		return agent.Config{}, errors.Wrap(errFailedToConfigHeartbeat, err)
 	}
+	hbWorkers, err := strconv.Atoi(mainflux.Env(envHeartbeatWorkers, defHeartbeatWorkers))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigHeartbeat, err)
+	}
+	hbBuffer, err := strconv.Atoi(mainflux.Env(envHeartbeatBuffer, defHeartbeatBuffer))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigHeartbeat, err)
+	}
+
+	notifyWindow, err := time.ParseDuration(mainflux.Env(envHeartbeatNotifyWindow, defHeartbeatNotifyWindow))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigHeartbeat, err)
+	}
+
+	hbPause, err := time.ParseDuration(mainflux.Env(envHeartbeatPause, defHeartbeatPause))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigHeartbeat, err)
+	}
 
 	ch := agent.HeartbeatConfig{
-		Interval: interval,
+		Interval:     interval,
+		Durable:      mainflux.Env(envHeartbeatDurable, defHeartbeatDurable),
+		Subjects:     splitList(mainflux.Env(envHeartbeatSubjects, defHeartbeatSubjects)),
+		Workers:      hbWorkers,
+		Buffer:       hbBuffer,
+		Tokens:       splitList(mainflux.Env(envHeartbeatTokens, defHeartbeatTokens)),
+		NotifyWindow: notifyWindow,
+		Pause:        hbPause,
 	}
 	termSessionTimeout, err := time.ParseDuration(mainflux.Env(envTermSessionTimeout, defTermSessionTimeout))
 	if err != nil {
@@ -189,7 +565,40 @@ func loadEnvConfig() (agent.Config, error) {
 	ct := agent.TerminalConfig{
 		SessionTimeout: termSessionTimeout,
 	}
-	ec := agent.EdgexConfig{URL: mainflux.Env(envEdgexURL, defEdgexURL)}
+	maxLogLines, err := strconv.Atoi(mainflux.Env(envEdgexMaxLogLines, defEdgexMaxLogLines))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigEdgex, err)
+	}
+	streamInterval, err := time.ParseDuration(mainflux.Env(envEdgexStreamInterval, defEdgexStreamInterval))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigEdgex, err)
+	}
+	streamMaxDuration, err := time.ParseDuration(mainflux.Env(envEdgexStreamMaxDuration, defEdgexStreamMaxDuration))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigEdgex, err)
+	}
+	instances, err := parseInstances(mainflux.Env(envEdgexInstances, defEdgexInstances))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigEdgex, err)
+	}
+	jobPollInterval, err := time.ParseDuration(mainflux.Env(envEdgexJobPollInterval, defEdgexJobPollInterval))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigEdgex, err)
+	}
+	jobTimeout, err := time.ParseDuration(mainflux.Env(envEdgexJobTimeout, defEdgexJobTimeout))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigEdgex, err)
+	}
+	ec := agent.EdgexConfig{
+		URL:               mainflux.Env(envEdgexURL, defEdgexURL),
+		AllowedOperations: splitList(mainflux.Env(envEdgexAllowedOperations, defEdgexAllowedOperations)),
+		MaxLogLines:       maxLogLines,
+		StreamInterval:    streamInterval,
+		StreamMaxDuration: streamMaxDuration,
+		Instances:         instances,
+		JobPollInterval:   jobPollInterval,
+		JobTimeout:        jobTimeout,
+	}
 	lc := agent.LogConfig{Level: mainflux.Env(envLogLevel, defLogLevel)}
 
 	mtls, err := strconv.ParseBool(mainflux.Env(envMqttMTLS, defMqttMTLS))
@@ -212,31 +621,315 @@ func loadEnvConfig() (agent.Config, error) {
 		retain = false
 	}
 
+	maxInflight, err := strconv.Atoi(mainflux.Env(envMqttMaxInflight, defMqttMaxInflight))
+	if err != nil {
+		maxInflight = 0
+	}
+
+	failFast, err := strconv.ParseBool(mainflux.Env(envMqttInflightFailFast, defMqttInflightFailFast))
+	if err != nil {
+		failFast = false
+	}
+
+	gzipThreshold, err := strconv.Atoi(mainflux.Env(envMqttGzipThreshold, defMqttGzipThreshold))
+	if err != nil {
+		gzipThreshold = 0
+	}
+
+	serialize, err := strconv.ParseBool(mainflux.Env(envMqttSerialize, defMqttSerialize))
+	if err != nil {
+		serialize = false
+	}
+
+	dedup, err := parseTimeouts(mainflux.Env(envMqttDedup, defMqttDedup))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigMQTT, err)
+	}
+
+	throttleBackoff, err := time.ParseDuration(mainflux.Env(envMqttThrottleBackoff, defMqttThrottleBackoff))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigMQTT, err)
+	}
+
+	throttleMax, err := time.ParseDuration(mainflux.Env(envMqttThrottleMax, defMqttThrottleMaxBackoff))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigMQTT, err)
+	}
+
+	maxPayload, err := strconv.Atoi(mainflux.Env(envMqttMaxPayload, defMqttMaxPayload))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigMQTT, err)
+	}
+
 	mc := agent.MQTTConfig{
-		URL:         mainflux.Env(envMqttURL, defMqttURL),
-		Username:    mainflux.Env(envMqttUsername, defMqttUsername),
-		Password:    mainflux.Env(envMqttPassword, defMqttPassword),
-		MTLS:        mtls,
-		CAPath:      mainflux.Env(envMqttCA, defMqttCA),
-		CertPath:    mainflux.Env(envMqttCert, defMqttCert),
-		PrivKeyPath: mainflux.Env(envMqttPrivKey, defMqttPrivKey),
-		SkipTLSVer:  skipTLSVer,
-		QoS:         byte(qos),
-		Retain:      retain,
+		URL:                mainflux.Env(envMqttURL, defMqttURL),
+		Username:           mainflux.Env(envMqttUsername, defMqttUsername),
+		Password:           mainflux.Env(envMqttPassword, defMqttPassword),
+		PasswordFile:       mainflux.Env(envMqttPasswordFile, defMqttPasswordFile),
+		MTLS:               mtls,
+		CAPath:             mainflux.Env(envMqttCA, defMqttCA),
+		CertPath:           mainflux.Env(envMqttCert, defMqttCert),
+		PrivKeyPath:        mainflux.Env(envMqttPrivKey, defMqttPrivKey),
+		SkipTLSVer:         skipTLSVer,
+		QoS:                byte(qos),
+		Retain:             retain,
+		TopicPrefix:        mainflux.Env(envMqttTopicPrefix, defMqttTopicPrefix),
+		MaxInflight:        maxInflight,
+		InflightFailFast:   failFast,
+		GzipThreshold:      gzipThreshold,
+		Dedup:              dedup,
+		Serialize:          serialize,
+		ThrottleBackoff:    throttleBackoff,
+		ThrottleMaxBackoff: throttleMax,
+		MaxPayload:         maxPayload,
+		Overflow:           mainflux.Env(envMqttOverflow, defMqttOverflow),
+	}
+
+	auditEnabled, err := strconv.ParseBool(mainflux.Env(envAuditEnabled, defAuditEnabled))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigAudit, err)
+	}
+
+	auditMaxEntries, err := strconv.Atoi(mainflux.Env(envAuditMaxEntries, defAuditMaxEntries))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigAudit, err)
+	}
+
+	maxOutputSize, err := strconv.Atoi(mainflux.Env(envExecMaxOutputSize, defExecMaxOutputSize))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	hardCap, err := strconv.Atoi(mainflux.Env(envExecMaxOutputHardCap, defExecMaxOutputHardCap))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	maxCommandLength, err := strconv.Atoi(mainflux.Env(envExecMaxCommandLength, defExecMaxCommandLength))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	retries, err := strconv.Atoi(mainflux.Env(envExecDefaultRetries, defExecDefaultRetries))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	retryDelay, err := time.ParseDuration(mainflux.Env(envExecRetryDelay, defExecRetryDelay))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	nice, err := strconv.Atoi(mainflux.Env(envExecDefaultNice, defExecDefaultNice))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	historySize, err := strconv.Atoi(mainflux.Env(envExecHistorySize, defExecHistorySize))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	maxLines, err := strconv.Atoi(mainflux.Env(envExecMaxLines, defExecMaxLines))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	execTimeout, err := time.ParseDuration(mainflux.Env(envExecTimeout, defExecTimeout))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	execTimeouts, err := parseTimeouts(mainflux.Env(envExecTimeouts, defExecTimeouts))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	idleTimeout, err := time.ParseDuration(mainflux.Env(envExecIdleTimeout, defExecIdleTimeout))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	outputMaxAge, err := time.ParseDuration(mainflux.Env(envExecOutputMaxAge, defExecOutputMaxAge))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	outputMaxSize, err := strconv.ParseInt(mainflux.Env(envExecOutputMaxSize, defExecOutputMaxSize), 10, 64)
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	shell, err := strconv.ParseBool(mainflux.Env(envExecShell, defExecShell))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	allowlistPersist, err := strconv.ParseBool(mainflux.Env(envExecAllowlistPersist, defExecAllowlistPersist))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	outputHash, err := strconv.ParseBool(mainflux.Env(envExecOutputHash, defExecOutputHash))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigExec, err)
+	}
+
+	applyTimeout, err := time.ParseDuration(mainflux.Env(envApplyTimeout, defApplyTimeout))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigApply, err)
+	}
+
+	safeMode, err := strconv.ParseBool(mainflux.Env(envSafeMode, defSafeMode))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigSafeMode, err)
+	}
+
+	deadManTimeout, err := time.ParseDuration(mainflux.Env(envDeadManTimeout, defDeadManTimeout))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigDeadMan, err)
+	}
+
+	maintQueueSize, err := strconv.Atoi(mainflux.Env(envMaintenanceQueueSize, defMaintenanceQueueSize))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigMaint, err)
+	}
+
+	beaconInterval, err := time.ParseDuration(mainflux.Env(envBeaconInterval, defBeaconInterval))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigBeacon, err)
+	}
+
+	rebootDelay, err := time.ParseDuration(mainflux.Env(envRebootDelay, defRebootDelay))
+	if err != nil {
+		return agent.Config{}, errors.Wrap(errFailedToConfigReboot, err)
 	}
 
 	file := mainflux.Env(envConfigFile, defConfigFile)
 	c := agent.NewConfig(sc, cc, ec, lc, mc, ch, ct, file)
-	mc, err = loadCertificate(c.MQTT)
+	c.Audit = agent.AuditConfig{
+		Enabled:    auditEnabled,
+		MaxEntries: auditMaxEntries,
+	}
+	c.Exec = agent.ExecConfig{
+		MaxOutputSize:    maxOutputSize,
+		MaxOutputHardCap: hardCap,
+		Shell:            shell,
+		Allowlist:        splitList(mainflux.Env(envExecAllowlist, defExecAllowlist)),
+		AllowlistKey:     mainflux.Env(envExecAllowlistKey, defExecAllowlistKey),
+		AllowlistPersist: allowlistPersist,
+		AllowedWorkDirs:  splitList(mainflux.Env(envExecAllowedWorkDirs, defExecAllowedWorkDirs)),
+		MaxLines:         maxLines,
+		TemplateEnv:      splitList(mainflux.Env(envExecTemplateEnv, defExecTemplateEnv)),
+		HistorySize:      historySize,
+		Timeout:          execTimeout,
+		Timeouts:         execTimeouts,
+		OutputDir:        mainflux.Env(envExecOutputDir, defExecOutputDir),
+		OutputMaxAge:     outputMaxAge,
+		OutputMaxSize:    outputMaxSize,
+		IdleTimeout:      idleTimeout,
+		MaxCommandLength: maxCommandLength,
+		DefaultRetries:   retries,
+		RetryDelay:       retryDelay,
+		OutputCharset:    mainflux.Env(envExecOutputCharset, defExecOutputCharset),
+		DefaultNice:      nice,
+		OutputHash:       outputHash,
+	}
+	c.SafeMode = agent.SafeModeConfig{
+		Enabled: safeMode,
+		File:    mainflux.Env(envSafeModeFile, defSafeModeFile),
+	}
+	c.DeadMan = agent.DeadManConfig{
+		Timeout: deadManTimeout,
+		Command: mainflux.Env(envDeadManCommand, defDeadManCommand),
+	}
+	c.Maintenance = agent.MaintenanceConfig{
+		QueueSize: maintQueueSize,
+	}
+	c.Beacon = agent.BeaconConfig{
+		Interval: beaconInterval,
+		Subject:  mainflux.Env(envBeaconSubject, defBeaconSubject),
+		Topic:    mainflux.Env(envBeaconTopic, defBeaconTopic),
+	}
+	c.Ready = agent.ReadyConfig{
+		Topic: mainflux.Env(envReadyTopic, defReadyTopic),
+	}
+	c.Reboot = agent.RebootConfig{
+		Delay:   rebootDelay,
+		Command: mainflux.Env(envRebootCommand, defRebootCommand),
+		PreHook: mainflux.Env(envRebootPreHook, defRebootPreHook),
+	}
+	c.Artifacts = agent.ArtifactsConfig{
+		Port:  mainflux.Env(envArtifactsPort, defArtifactsPort),
+		Root:  mainflux.Env(envArtifactsRoot, defArtifactsRoot),
+		Token: mainflux.Env(envArtifactsToken, defArtifactsToken),
+		URL:   mainflux.Env(envArtifactsURL, defArtifactsURL),
+	}
+	c.Device = agent.DeviceConfig{
+		ID: mainflux.Env(envDeviceID, defDeviceID),
+	}
+	c.Features = agent.FeaturesConfig{
+		Disabled: splitList(mainflux.Env(envDisabledFeatures, defDisabledFeatures)),
+	}
+	c.Nats = agent.NatsConfig{
+		Credentials: mainflux.Env(envNatsCredentials, defNatsCredentials),
+		Token:       mainflux.Env(envNatsToken, defNatsToken),
+		CACert:      mainflux.Env(envNatsCACert, defNatsCACert),
+		ClientCert:  mainflux.Env(envNatsClientCert, defNatsClientCert),
+		ClientKey:   mainflux.Env(envNatsClientKey, defNatsClientKey),
+	}
+	c.Store = agent.StoreConfig{
+		Backend: mainflux.Env(envStoreBackend, defStoreBackend),
+		Path:    mainflux.Env(envStorePath, defStorePath),
+	}
+	c.SenML = agent.SenMLConfig{
+		BaseName:       mainflux.Env(envSenMLBaseName, defSenMLBaseName),
+		NamePrefix:     mainflux.Env(envSenMLNamePrefix, defSenMLNamePrefix),
+		ErrorVerbosity: mainflux.Env(envSenMLErrorVerbosity, defSenMLErrorVerbosity),
+	}
+	c.GRPC = agent.GRPCConfig{
+		Port: mainflux.Env(envGRPCPort, defGRPCPort),
+	}
+	c.Socket = agent.SocketConfig{
+		Path: mainflux.Env(envSocketPath, defSocketPath),
+		Mode: mainflux.Env(envSocketMode, defSocketMode),
+	}
+	c.Apply = agent.ApplyConfig{
+		Timeout: applyTimeout,
+	}
+	mc, err = agent.LoadCertificate(c.MQTT)
 	if err != nil {
 		return c, errors.Wrap(errFailedToSetupMTLS, err)
 	}
 
 	c.MQTT = mc
-	agent.SaveConfig(c)
 	return c, nil
 }
 
+// missingConfig tells whether config file is missing. Missing file is an
+// error unless it's generated or fetched with bootstrap or from config URL.
+func missingConfig(initConfig bool) (bool, error) {
+	file := mainflux.Env(envConfigFile, defConfigFile)
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		return false, nil
+	}
+	if initConfig || fetchedConfig() {
+		return true, nil
+	}
+	return true, errors.Wrap(errMissingConfigFile, fmt.Errorf("%s doesn't exist, run agent with --init-config to generate it", file))
+}
+
+// fetchedConfig tells whether config is fetched from config URL, or with
+// bootstrap which is enabled and has thing credentials set.
+func fetchedConfig() bool {
+	if mainflux.Env(envConfigURL, defConfigURL) != "" {
+		return true
+	}
+	return mainflux.Env(envBootstrapRetries, defBootstrapRetries) != "0" &&
+		mainflux.Env(envBootstrapID, defBootstrapID) != "" &&
+		mainflux.Env(envBootstrapKey, defBootstrapKey) != ""
+}
+
 func loadBootConfig(c agent.Config, logger logger.Logger) (bsc agent.Config, err error) {
 	file := mainflux.Env(envConfigFile, defConfigFile)
 	skipTLS, err := strconv.ParseBool(mainflux.Env(envBootstrapSkipTLS, defBootstrapSkipTLS))
@@ -250,6 +943,16 @@ func loadBootConfig(c agent.Config, logger logger.Logger) (bsc agent.Config, err
 		SkipTLS:       skipTLS,
 	}
 
+	if u := mainflux.Env(envConfigURL, defConfigURL); u != "" {
+		rc := bootstrap.RemoteConfig{
+			URL:  u,
+			Auth: mainflux.Env(envConfigURLAuth, defConfigURLAuth),
+		}
+		if err := bootstrap.FetchConfig(rc, file, logger); err != nil {
+			logger.Warn(fmt.Sprintf("Continuing with local config: %s", err))
+		}
+	}
+
 	if err := bootstrap.Bootstrap(bsConfig, logger, file); err != nil {
 		return c, errors.Wrap(errFetchingBootstrapFailed, err)
 	}
@@ -258,7 +961,7 @@ func loadBootConfig(c agent.Config, logger logger.Logger) (bsc agent.Config, err
 		return c, errors.Wrap(errFailedToReadConfig, err)
 	}
 
-	mc, err := loadCertificate(bsc.MQTT)
+	mc, err := agent.LoadCertificate(bsc.MQTT)
 	if err != nil {
 		return bsc, errors.Wrap(errFailedToSetupMTLS, err)
 	}
@@ -267,22 +970,321 @@ func loadBootConfig(c agent.Config, logger logger.Logger) (bsc agent.Config, err
 		bsc.Heartbeat.Interval = c.Heartbeat.Interval
 	}
 
+	if len(bsc.Heartbeat.Subjects) == 0 {
+		bsc.Heartbeat.Subjects = c.Heartbeat.Subjects
+	}
+
+	if bsc.Heartbeat.Durable == "" {
+		bsc.Heartbeat.Durable = c.Heartbeat.Durable
+	}
+
+	if bsc.Heartbeat.Workers == 0 {
+		bsc.Heartbeat.Workers = c.Heartbeat.Workers
+	}
+
+	if bsc.Heartbeat.Buffer == 0 {
+		bsc.Heartbeat.Buffer = c.Heartbeat.Buffer
+	}
+
+	if len(bsc.Heartbeat.Tokens) == 0 {
+		bsc.Heartbeat.Tokens = c.Heartbeat.Tokens
+	}
+
+	if bsc.Heartbeat.NotifyWindow == 0 {
+		bsc.Heartbeat.NotifyWindow = c.Heartbeat.NotifyWindow
+	}
+
+	if bsc.Heartbeat.Pause == 0 {
+		bsc.Heartbeat.Pause = c.Heartbeat.Pause
+	}
+
 	if bsc.Terminal.SessionTimeout <= 0 {
 		bsc.Terminal.SessionTimeout = c.Terminal.SessionTimeout
 	}
 
+	if !bsc.Audit.Enabled {
+		bsc.Audit = c.Audit
+	}
+
+	if bsc.Audit.MaxEntries <= 0 {
+		bsc.Audit.MaxEntries = c.Audit.MaxEntries
+	}
+
+	if bsc.Exec.MaxOutputSize <= 0 {
+		bsc.Exec.MaxOutputSize = c.Exec.MaxOutputSize
+	}
+
+	if bsc.Exec.MaxOutputHardCap <= 0 {
+		bsc.Exec.MaxOutputHardCap = c.Exec.MaxOutputHardCap
+	}
+
+	if !bsc.Exec.Shell {
+		bsc.Exec.Shell = c.Exec.Shell
+	}
+
+	if len(bsc.Exec.Allowlist) == 0 {
+		bsc.Exec.Allowlist = c.Exec.Allowlist
+	}
+
+	if bsc.Exec.AllowlistKey == "" {
+		bsc.Exec.AllowlistKey = c.Exec.AllowlistKey
+	}
+
+	if !bsc.Exec.AllowlistPersist {
+		bsc.Exec.AllowlistPersist = c.Exec.AllowlistPersist
+	}
+
+	if !bsc.Exec.OutputHash {
+		bsc.Exec.OutputHash = c.Exec.OutputHash
+	}
+
+	if len(bsc.Exec.TemplateEnv) == 0 {
+		bsc.Exec.TemplateEnv = c.Exec.TemplateEnv
+	}
+
+	if bsc.Exec.MaxCommandLength <= 0 {
+		bsc.Exec.MaxCommandLength = c.Exec.MaxCommandLength
+	}
+
+	if bsc.Exec.DefaultRetries <= 0 {
+		bsc.Exec.DefaultRetries = c.Exec.DefaultRetries
+	}
+
+	if bsc.Exec.RetryDelay <= 0 {
+		bsc.Exec.RetryDelay = c.Exec.RetryDelay
+	}
+
+	if bsc.Exec.OutputCharset == "" {
+		bsc.Exec.OutputCharset = c.Exec.OutputCharset
+	}
+
+	if bsc.Exec.DefaultNice == 0 {
+		bsc.Exec.DefaultNice = c.Exec.DefaultNice
+	}
+
+	if bsc.Exec.MaxLines <= 0 {
+		bsc.Exec.MaxLines = c.Exec.MaxLines
+	}
+
+	if bsc.Exec.HistorySize <= 0 {
+		bsc.Exec.HistorySize = c.Exec.HistorySize
+	}
+
+	if bsc.Exec.Timeout <= 0 {
+		bsc.Exec.Timeout = c.Exec.Timeout
+	}
+
+	if len(bsc.Exec.Timeouts) == 0 {
+		bsc.Exec.Timeouts = c.Exec.Timeouts
+	}
+
+	if bsc.Exec.IdleTimeout <= 0 {
+		bsc.Exec.IdleTimeout = c.Exec.IdleTimeout
+	}
+
+	if len(bsc.Exec.AllowedWorkDirs) == 0 {
+		bsc.Exec.AllowedWorkDirs = c.Exec.AllowedWorkDirs
+	}
+
+	if bsc.Exec.OutputDir == "" {
+		bsc.Exec.OutputDir = c.Exec.OutputDir
+	}
+
+	if bsc.Exec.OutputMaxAge <= 0 {
+		bsc.Exec.OutputMaxAge = c.Exec.OutputMaxAge
+	}
+
+	if bsc.Exec.OutputMaxSize <= 0 {
+		bsc.Exec.OutputMaxSize = c.Exec.OutputMaxSize
+	}
+
+	if bsc.Device.ID == "" {
+		bsc.Device = c.Device
+	}
+
+	if bsc.SenML.BaseName == "" {
+		bsc.SenML.BaseName = c.SenML.BaseName
+	}
+
+	if bsc.SenML.NamePrefix == "" {
+		bsc.SenML.NamePrefix = c.SenML.NamePrefix
+	}
+
+	if bsc.SenML.ErrorVerbosity == "" {
+		bsc.SenML.ErrorVerbosity = c.SenML.ErrorVerbosity
+	}
+
+	if bsc.GRPC.Port == "" {
+		bsc.GRPC.Port = c.GRPC.Port
+	}
+
+	if bsc.Socket.Path == "" {
+		bsc.Socket.Path = c.Socket.Path
+	}
+
+	if bsc.Socket.Mode == "" {
+		bsc.Socket.Mode = c.Socket.Mode
+	}
+
+	if bsc.Apply.Timeout <= 0 {
+		bsc.Apply.Timeout = c.Apply.Timeout
+	}
+
+	if !bsc.SafeMode.Enabled {
+		bsc.SafeMode.Enabled = c.SafeMode.Enabled
+	}
+
+	if bsc.SafeMode.File == "" {
+		bsc.SafeMode.File = c.SafeMode.File
+	}
+
+	if !bsc.DeadMan.Enabled() {
+		bsc.DeadMan = c.DeadMan
+	}
+
+	if bsc.Maintenance.QueueSize <= 0 {
+		bsc.Maintenance.QueueSize = c.Maintenance.QueueSize
+	}
+
+	if !bsc.Beacon.Enabled() {
+		bsc.Beacon = c.Beacon
+	}
+
+	if bsc.Ready.Topic == "" {
+		bsc.Ready.Topic = c.Ready.Topic
+	}
+
+	if bsc.Reboot.Delay <= 0 {
+		bsc.Reboot.Delay = c.Reboot.Delay
+	}
+
+	if bsc.Reboot.Command == "" {
+		bsc.Reboot.Command = c.Reboot.Command
+	}
+
+	if bsc.Reboot.PreHook == "" {
+		bsc.Reboot.PreHook = c.Reboot.PreHook
+	}
+
+	if !bsc.Artifacts.Enabled() {
+		bsc.Artifacts = c.Artifacts
+	}
+
+	if len(bsc.Features.Disabled) == 0 {
+		bsc.Features.Disabled = c.Features.Disabled
+	}
+
+	if bsc.Nats == (agent.NatsConfig{}) {
+		bsc.Nats = c.Nats
+	}
+
+	if len(bsc.Edgex.AllowedOperations) == 0 {
+		bsc.Edgex.AllowedOperations = c.Edgex.AllowedOperations
+	}
+
+	if bsc.Edgex.MaxLogLines <= 0 {
+		bsc.Edgex.MaxLogLines = c.Edgex.MaxLogLines
+	}
+
+	if bsc.Edgex.StreamInterval <= 0 {
+		bsc.Edgex.StreamInterval = c.Edgex.StreamInterval
+	}
+
+	if bsc.Edgex.StreamMaxDuration <= 0 {
+		bsc.Edgex.StreamMaxDuration = c.Edgex.StreamMaxDuration
+	}
+
+	if len(bsc.Edgex.Instances) == 0 {
+		bsc.Edgex.Instances = c.Edgex.Instances
+	}
+
+	if bsc.Edgex.JobPollInterval <= 0 {
+		bsc.Edgex.JobPollInterval = c.Edgex.JobPollInterval
+	}
+
+	if bsc.Edgex.JobTimeout <= 0 {
+		bsc.Edgex.JobTimeout = c.Edgex.JobTimeout
+	}
+
+	if bsc.Store.Backend == "" {
+		bsc.Store.Backend = c.Store.Backend
+	}
+
+	if bsc.Store.Path == "" {
+		bsc.Store.Path = c.Store.Path
+	}
+
+	if bsc.Channels.DeadLetter == "" {
+		bsc.Channels.DeadLetter = c.Channels.DeadLetter
+	}
+
+	if bsc.Channels.Format == "" {
+		bsc.Channels.Format = c.Channels.Format
+	}
+
+	if bsc.Channels.ResponseFormat == "" {
+		bsc.Channels.ResponseFormat = c.Channels.ResponseFormat
+	}
+
+	if bsc.Channels.RoutePattern == "" {
+		bsc.Channels.RoutePattern = c.Channels.RoutePattern
+	}
+
+	if !bsc.Channels.Ack {
+		bsc.Channels.Ack = c.Channels.Ack
+	}
+
+	if mc.TopicPrefix == "" {
+		mc.TopicPrefix = c.MQTT.TopicPrefix
+	}
+
+	if mc.MaxInflight <= 0 {
+		mc.MaxInflight = c.MQTT.MaxInflight
+	}
+
+	if !mc.InflightFailFast {
+		mc.InflightFailFast = c.MQTT.InflightFailFast
+	}
+
+	if mc.GzipThreshold <= 0 {
+		mc.GzipThreshold = c.MQTT.GzipThreshold
+	}
+
+	if !mc.Serialize {
+		mc.Serialize = c.MQTT.Serialize
+	}
+
+	if mc.ThrottleBackoff == 0 {
+		mc.ThrottleBackoff = c.MQTT.ThrottleBackoff
+	}
+
+	if mc.ThrottleMaxBackoff == 0 {
+		mc.ThrottleMaxBackoff = c.MQTT.ThrottleMaxBackoff
+	}
+
+	if mc.MaxPayload == 0 {
+		mc.MaxPayload = c.MQTT.MaxPayload
+	}
+
+	if mc.Overflow == "" {
+		mc.Overflow = c.MQTT.Overflow
+	}
+
 	bsc.MQTT = mc
 	return bsc, nil
 }
 
-func connectToMQTTBroker(conf agent.MQTTConfig, logger logger.Logger) (mqtt.Client, error) {
+func connectToMQTTBroker(conf agent.MQTTConfig, creds *agent.TLSCredentials, sn agent.StateNotifier, onConnect func(), logger logger.Logger) (mqtt.Client, error) {
 	name := fmt.Sprintf("agent-%s", conf.Username)
 	conn := func(client mqtt.Client) {
 		logger.Info(fmt.Sprintf("Client %s connected", name))
+		sn.Notify(agent.SubsystemMQTT, agent.StateConnected)
+		onConnect()
 	}
 
 	lost := func(client mqtt.Client, err error) {
 		logger.Info(fmt.Sprintf("Client %s disconnected", name))
+		sn.Notify(agent.SubsystemMQTT, agent.StateLost)
 	}
 
 	opts := mqtt.NewClientOptions().
@@ -298,21 +1300,8 @@ func connectToMQTTBroker(conf agent.MQTTConfig, logger logger.Logger) (mqtt.Clie
 		opts.SetPassword(conf.Password)
 	}
 
-	if conf.MTLS {
-		cfg := &tls.Config{
-			InsecureSkipVerify: conf.SkipTLSVer,
-		}
-
-		if conf.CA != nil {
-			cfg.RootCAs = x509.NewCertPool()
-			cfg.RootCAs.AppendCertsFromPEM(conf.CA)
-		}
-		if conf.Cert.Certificate != nil {
-			cfg.Certificates = []tls.Certificate{conf.Cert}
-		}
-
-		cfg.BuildNameToCertificate()
-		opts.SetTLSConfig(cfg)
+	if creds != nil {
+		opts.SetTLSConfig(creds.TLSConfig())
 		opts.SetProtocolVersion(4)
 	}
 	client := mqtt.NewClient(opts)
@@ -325,79 +1314,43 @@ func connectToMQTTBroker(conf agent.MQTTConfig, logger logger.Logger) (mqtt.Clie
 	return client, nil
 }
 
-func loadCertificate(cnfg agent.MQTTConfig) (c agent.MQTTConfig, err error) {
-	var caByte []byte
-	var cc []byte
-	var pk []byte
-	c = cnfg
-
-	cert := tls.Certificate{}
-	if !c.MTLS {
-		return c, nil
-	}
-	// Load CA cert from file
-	if c.CAPath != "" {
-		caFile, err := os.Open(c.CAPath)
-		defer caFile.Close()
-		if err != nil {
-			return c, err
-		}
-		caByte, err = ioutil.ReadAll(caFile)
-		if err != nil {
-			return c, err
-		}
-	}
-	// Load CA cert from string if file not present
-	if len(caByte) == 0 && c.CaCert != "" {
-		caByte, err = ioutil.ReadAll(strings.NewReader(c.CaCert))
-		if err != nil {
-			return c, err
+// splitList splits comma separated list, skipping empty elements.
+func splitList(s string) []string {
+	list := []string{}
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
 		}
 	}
-	// Load client certificate from file if present
-	if c.CertPath != "" {
-		clientCert, err := os.Open(c.CertPath)
-		defer clientCert.Close()
-		if err != nil {
-			return c, err
-		}
-		cc, err = ioutil.ReadAll(clientCert)
-		if err != nil {
-			return c, err
-		}
-	}
-	// Load client certificate from string if file not present
-	if len(cc) == 0 && c.ClientCert != "" {
-		cc, err = ioutil.ReadAll(strings.NewReader(c.ClientCert))
-		if err != nil {
-			return c, err
+	return list
+}
+
+// parseInstances parses comma separated `name=url` pairs.
+func parseInstances(s string) (map[string]string, error) {
+	instances := map[string]string{}
+	for _, e := range splitList(s) {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid instance %s", e)
 		}
+		instances[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 	}
-	// Load private key of client certificate from file
-	if c.PrivKeyPath != "" {
-		privKey, err := os.Open(c.PrivKeyPath)
-		defer privKey.Close()
-		if err != nil {
-			return c, err
-		}
-		pk, err = ioutil.ReadAll((privKey))
-		if err != nil {
-			return c, err
+	return instances, nil
+}
+
+// parseTimeouts parses comma separated `prefix:duration` pairs.
+func parseTimeouts(s string) (map[string]time.Duration, error) {
+	timeouts := map[string]time.Duration{}
+	for _, e := range splitList(s) {
+		kv := strings.SplitN(e, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid timeout %s", e)
 		}
-	}
-	// Load private key of client certificate from string
-	if len(pk) == 0 && c.ClientKey != "" {
-		pk, err = ioutil.ReadAll(strings.NewReader(c.ClientKey))
+		d, err := time.ParseDuration(strings.TrimSpace(kv[1]))
 		if err != nil {
-			return c, err
+			return nil, err
 		}
+		timeouts[strings.TrimSpace(kv[0])] = d
 	}
-
-	cert, err = tls.X509KeyPair([]byte(c.ClientCert), []byte(c.ClientKey))
-	if err != nil {
-		return c, err
-	}
-	c.Cert = cert
-	c.CA = caByte
-	return c, nil
+	return timeouts, nil
 }
@@ -0,0 +1,71 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMissingConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "agent-config")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	existing := filepath.Join(dir, "config.toml")
+	if err := ioutil.WriteFile(existing, []byte{}, 0644); err != nil {
+		t.Fatalf("unexpected error writing config file: %s", err)
+	}
+	missing := filepath.Join(dir, "missing.toml")
+
+	bootstrap := map[string]string{envBootstrapID: "id", envBootstrapKey: "key"}
+	cases := []struct {
+		desc    string
+		file    string
+		init    bool
+		env     map[string]string
+		missing bool
+		err     error
+	}{
+		{"existing config", existing, false, nil, false, nil},
+		{"existing config with init", existing, true, nil, false, nil},
+		{"missing config", missing, false, nil, true, errMissingConfigFile},
+		{"missing config with init", missing, true, nil, true, nil},
+		{"missing config with bootstrap", missing, false, bootstrap, true, nil},
+		{"missing config with bootstrap without key", missing, false, map[string]string{envBootstrapID: "id"}, true, errMissingConfigFile},
+		{"missing config with bootstrap disabled", missing, false, map[string]string{envBootstrapID: "id", envBootstrapKey: "key", envBootstrapRetries: "0"}, true, errMissingConfigFile},
+		{"missing config with bootstrap disabled and init", missing, true, map[string]string{envBootstrapRetries: "0"}, true, nil},
+		{"missing config with config URL", missing, false, map[string]string{envConfigURL: "http://localhost/config.toml"}, true, nil},
+	}
+
+	for _, tc := range cases {
+		os.Setenv(envConfigFile, tc.file)
+		for k, v := range tc.env {
+			os.Setenv(k, v)
+		}
+		missing, err := missingConfig(tc.init)
+		for k := range tc.env {
+			os.Unsetenv(k)
+		}
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.missing, missing, fmt.Sprintf("%s: expected missing %t got %t", tc.desc, tc.missing, missing))
+	}
+	os.Unsetenv(envConfigFile)
+}
+
+func TestDefaultConfigValid(t *testing.T) {
+	os.Setenv(envCtrlChan, "control")
+	defer os.Unsetenv(envCtrlChan)
+	cfg, err := loadEnvConfig()
+	assert.Nil(t, err, fmt.Sprintf("unexpected error loading config: %s", err))
+	err = cfg.Validate()
+	assert.Nil(t, err, fmt.Sprintf("default config: unexpected error: %s", err))
+}
@@ -15,5 +15,7 @@ require (
 	github.com/pelletier/go-toml v1.8.0
 	github.com/prometheus/client_golang v1.7.1
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/text v0.3.2
+	google.golang.org/grpc v1.29.1
 	robpike.io/filter v0.0.0-20150108201509-2984852a2183
 )
@@ -0,0 +1,35 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+
+	"github.com/mainflux/senml"
+)
+
+const (
+	ackRecord = "ack"
+	received  = "received"
+)
+
+// ack publishes acknowledgement that the command was received, before it
+// is run, if acks are enabled. Ack has no result code record, which tells
+// it apart from the response published once the command is done.
+func (a *agent) ack(uuid string) {
+	if !a.cfg().Channels.Ack {
+		return
+	}
+	v := received
+	records := a.prefixRecords(uuid, []senml.Record{{Name: ackRecord, StringValue: &v}})
+	records = a.routeRecords(uuid, records)
+	payload, err := a.encodeResponse(uuid, records)
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to encode ack of %s: %s", uuid, err))
+		return
+	}
+	if err := a.Publish(control, string(payload)); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to publish ack of %s: %s", uuid, err))
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingClient records topics and payloads of publishes.
+type recordingClient struct {
+	paho.Client
+	topics   []string
+	payloads []string
+}
+
+func (c *recordingClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.topics = append(c.topics, topic)
+	c.payloads = append(c.payloads, payload.(string))
+	return doneToken{}
+}
+
+func TestAck(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+
+	cases := []struct {
+		desc   string
+		ack    bool
+		route  string
+		values map[string]string
+	}{
+		{"ack disabled", false, "", nil},
+		{"ack enabled", true, "", map[string]string{ackRecord: received}},
+		{"ack with route", true, "route42", map[string]string{ackRecord: received, routeRecord: "route42"}},
+	}
+
+	for _, tc := range cases {
+		client := &recordingClient{}
+		a := &agent{
+			config:     &Config{Channels: ChanConfig{Control: "ctrl", Ack: tc.ack}},
+			mqttClient: client,
+			logger:     logger,
+		}
+		if tc.route != "" {
+			a.routes.Store("1", tc.route)
+		}
+		a.ack("1")
+		if tc.values == nil {
+			assert.Empty(t, client.payloads, fmt.Sprintf("%s: unexpected ack published", tc.desc))
+			continue
+		}
+		if !assert.Len(t, client.payloads, 1, fmt.Sprintf("%s: expected single ack", tc.desc)) {
+			continue
+		}
+		assert.Equal(t, "channels/ctrl/messages/res", client.topics[0], fmt.Sprintf("%s: unexpected ack topic %s", tc.desc, client.topics[0]))
+		pack, err := senml.Decode([]byte(client.payloads[0]), senml.JSON)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding ack: %s", tc.desc, err))
+		assert.Equal(t, "1", pack.Records[0].BaseName, fmt.Sprintf("%s: expected command UUID as base name got %s", tc.desc, pack.Records[0].BaseName))
+		values := map[string]string{}
+		for _, r := range pack.Records {
+			values[r.Name] = *r.StringValue
+		}
+		assert.Equal(t, tc.values, values, fmt.Sprintf("%s: expected records %v got %v", tc.desc, tc.values, values))
+	}
+}
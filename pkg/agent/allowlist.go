@@ -0,0 +1,125 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	agentAllowlist = "agent-allowlist"
+
+	allowSafeMode = "safe_mode"
+	allowAll      = "allow_all"
+)
+
+// errInvalidAllowRule indicates allowlist rule with malformed argument pattern.
+var errInvalidAllowRule = errors.New("invalid allowlist rule")
+
+// allowRule is allowlist entry, binary optionally followed by pattern
+// which arguments joined by space have to match as a whole. Pattern is
+// regular expression if it is enclosed in slashes, i.e. `/^restart (a|b)$/`,
+// otherwise it is glob where `*` matches any text and `?` single character.
+type allowRule struct {
+	rule    string
+	name    string
+	pattern string
+	args    *regexp.Regexp
+}
+
+func parseAllowRule(rule string) (allowRule, error) {
+	rule = strings.TrimSpace(rule)
+	parts := strings.SplitN(rule, " ", 2)
+	r := allowRule{rule: rule, name: parts[0]}
+	if len(parts) == 1 {
+		return r, nil
+	}
+
+	pattern := strings.TrimSpace(parts[1])
+	r.pattern = pattern
+	expr := globExpr(pattern)
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		expr = pattern[1 : len(pattern)-1]
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return allowRule{}, errors.Wrap(errInvalidAllowRule, fmt.Errorf("%s: %s", rule, err))
+	}
+	r.args = re
+	return r, nil
+}
+
+// globExpr returns regular expression matching whole text against glob.
+func globExpr(glob string) string {
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+	return "^" + expr + "$"
+}
+
+// match checks whether the rule allows the binary with the arguments.
+func (r allowRule) match(args []string) bool {
+	return r.args == nil || r.args.MatchString(strings.Join(args, " "))
+}
+
+// checkAllowed checks binary and its arguments against the allowlist, empty
+// allowlist allows all. Command is allowed if any rule for its binary matches,
+// error names the binary or the rules its arguments violate.
+func (a *agent) checkAllowed(name string, args []string) error {
+	allowlist := a.cfg().Exec.Allowlist
+	if len(allowlist) == 0 {
+		return nil
+	}
+	violated := []string{}
+	for _, entry := range allowlist {
+		r, err := parseAllowRule(entry)
+		if err != nil {
+			return err
+		}
+		if r.name != name {
+			continue
+		}
+		if r.match(args) {
+			return nil
+		}
+		violated = append(violated, r.rule)
+	}
+	if len(violated) == 0 {
+		return errors.Wrap(errCommandNotAllowed, fmt.Errorf("%s", name))
+	}
+	return errors.Wrap(errCommandNotAllowed, fmt.Errorf("%s %s doesn't match %s", name, strings.Join(args, " "), strings.Join(violated, "; ")))
+}
+
+// allowlist returns the effective allowlist of the running config. Safe
+// mode record tells whether execution is disabled, in which case rules
+// are omitted since nothing can run. Otherwise it's followed by record
+// telling whether all commands are allowed and a record per rule, named
+// by its binary and holding its argument pattern, empty if any arguments
+// are allowed.
+func (a *agent) allowlist() []senml.Record {
+	safe := a.safeMode.Enabled()
+	records := []senml.Record{
+		{Name: allowSafeMode, BoolValue: &safe},
+	}
+	if safe {
+		return records
+	}
+	rules := a.cfg().Exec.Allowlist
+	all := len(rules) == 0
+	records = append(records, senml.Record{Name: allowAll, BoolValue: &all})
+	for _, entry := range rules {
+		r, err := parseAllowRule(entry)
+		if err != nil {
+			continue
+		}
+		pattern := r.pattern
+		records = append(records, senml.Record{Name: r.name, StringValue: &pattern})
+	}
+	return records
+}
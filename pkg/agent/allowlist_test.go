@@ -0,0 +1,92 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckAllowed(t *testing.T) {
+	allowlist := []string{
+		"ls",
+		"systemctl restart foo",
+		"systemctl status *",
+		"journalctl /^-u [a-z]+ -n [0-9]+$/",
+	}
+
+	cases := []struct {
+		desc      string
+		allowlist []string
+		name      string
+		args      []string
+		err       error
+		msg       string
+	}{
+		{"empty allowlist", nil, "rm", []string{"-rf", "/"}, nil, ""},
+		{"binary without pattern", allowlist, "ls", []string{"-la", "/tmp"}, nil, ""},
+		{"exact arguments", allowlist, "systemctl", []string{"restart", "foo"}, nil, ""},
+		{"glob arguments", allowlist, "systemctl", []string{"status", "bar"}, nil, ""},
+		{"regexp arguments", allowlist, "journalctl", []string{"-u", "agent", "-n", "100"}, nil, ""},
+		{"binary not allowed", allowlist, "rm", []string{"-rf", "/"}, errCommandNotAllowed, "rm"},
+		{"arguments not allowed", allowlist, "systemctl", []string{"stop", "bar"}, errCommandNotAllowed, "systemctl restart foo; systemctl status *"},
+		{"partial match not allowed", allowlist, "systemctl", []string{"restart", "foo", "bar"}, errCommandNotAllowed, "systemctl restart foo"},
+		{"regexp not matched", allowlist, "journalctl", []string{"-u", "agent", "-f"}, errCommandNotAllowed, "journalctl /^-u [a-z]+ -n [0-9]+$/"},
+		{"invalid rule", []string{"ls /[/"}, "ls", nil, errInvalidAllowRule, "ls /[/"},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: ExecConfig{Allowlist: tc.allowlist}}}
+		err := a.checkAllowed(tc.name, tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			assert.True(t, strings.Contains(err.Error(), tc.msg), fmt.Sprintf("%s: expected error naming %s got %s", tc.desc, tc.msg, err))
+		}
+	}
+}
+
+func TestAllowlist(t *testing.T) {
+	allowlist := []string{
+		"ls",
+		"systemctl status *",
+		"journalctl /^-u [a-z]+$/",
+	}
+
+	cases := []struct {
+		desc      string
+		allowlist []string
+		safeMode  bool
+		records   map[string]string
+		all       bool
+	}{
+		{"empty allowlist", nil, false, map[string]string{}, true},
+		{"allowlist rules", allowlist, false, map[string]string{"ls": "", "systemctl": "status *", "journalctl": "/^-u [a-z]+$/"}, false},
+		{"safe mode", allowlist, true, nil, false},
+	}
+
+	for _, tc := range cases {
+		a := &agent{
+			config:   &Config{Exec: ExecConfig{Allowlist: tc.allowlist}},
+			safeMode: &safeMode{enabled: tc.safeMode},
+		}
+		records := a.allowlist()
+		assert.Equal(t, allowSafeMode, records[0].Name, fmt.Sprintf("%s: expected %s record got %s", tc.desc, allowSafeMode, records[0].Name))
+		assert.Equal(t, tc.safeMode, *records[0].BoolValue, fmt.Sprintf("%s: expected safe mode %t", tc.desc, tc.safeMode))
+		if tc.safeMode {
+			assert.Len(t, records, 1, fmt.Sprintf("%s: expected no rules in safe mode", tc.desc))
+			continue
+		}
+		assert.Equal(t, allowAll, records[1].Name, fmt.Sprintf("%s: expected %s record got %s", tc.desc, allowAll, records[1].Name))
+		assert.Equal(t, tc.all, *records[1].BoolValue, fmt.Sprintf("%s: expected allow all %t", tc.desc, tc.all))
+		rules := map[string]string{}
+		for _, r := range records[2:] {
+			rules[r.Name] = *r.StringValue
+		}
+		assert.Equal(t, tc.records, rules, fmt.Sprintf("%s: expected rules %v got %v", tc.desc, tc.records, rules))
+	}
+}
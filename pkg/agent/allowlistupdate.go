@@ -0,0 +1,174 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	allowlistAdd    = "allowlist-add"
+	allowlistRemove = "allowlist-remove"
+
+	// allowlistSigWindow is how far signed allowlist update time can be
+	// from agent time, so captured updates can't be replayed later.
+	allowlistSigWindow = 5 * time.Minute
+
+	// allowlistBucket holds time of the last accepted allowlist update
+	// under allowlistLast key.
+	allowlistBucket = "allowlist"
+	allowlistLast   = "last"
+)
+
+var (
+	// errAllowlistUpdateDisabled indicates that allowlist updates key is not set
+	errAllowlistUpdateDisabled = errors.New("allowlist updates are disabled")
+
+	// errInvalidSignature indicates allowlist update with wrong or expired signature
+	errInvalidSignature = errors.New("invalid signature")
+
+	// errAllowAll indicates allowlist update which would turn empty allowlist, allowing all commands, on or off
+	errAllowAll = errors.New("empty allowlist allows all commands")
+
+	// errNoSuchAllowRule indicates removal of rule which isn't in the allowlist
+	errNoSuchAllowRule = errors.New("no such allowlist rule")
+)
+
+// allowlistSignature returns hex encoded HMAC-SHA256 of the update command,
+// its time and the rule, joined by commas.
+func allowlistSignature(key, cmd, ts, rule string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strings.Join([]string{cmd, ts, rule}, ",")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// updateAllowlist handles `allowlist-add,<time>,<signature>,<rule>` and
+// `allowlist-remove,<time>,<signature>,<rule>` commands. Time is Unix time
+// in milliseconds and signature is made with AllowlistKey. Time has to be
+// later than the time of the last accepted update, so that captured update
+// can't be replayed within the signature window, i.e. to grant the rule
+// again right after it's revoked. Time of the update is kept in the store
+// once the update is accepted, so failed updates don't consume it.
+func (a *agent) updateAllowlist(cmd, args string) error {
+	parts := strings.SplitN(args, ",", 3)
+	if len(parts) < 3 {
+		return ErrInvalidCommand
+	}
+	ts, sig, rule := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), strings.TrimSpace(parts[2])
+	ms, err := a.checkAllowlistSignature(cmd, ts, sig, rule)
+	if err != nil {
+		return err
+	}
+	if _, err := parseAllowRule(rule); err != nil {
+		return err
+	}
+
+	a.allowlistMu.Lock()
+	defer a.allowlistMu.Unlock()
+	if ms <= a.allowlistTS {
+		return errors.Wrap(errInvalidSignature, fmt.Errorf("signed at %d, not after the last update", ms))
+	}
+	if err := a.applyAllowlistUpdate(cmd, rule); err != nil {
+		return err
+	}
+	a.allowlistTS = ms
+	if err := a.store.Put(allowlistBucket, allowlistLast, []byte(ts)); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to persist time of allowlist update: %s", err))
+	}
+	return nil
+}
+
+// applyAllowlistUpdate replaces running config with the one holding
+// allowlist updated with the rule, which is saved if AllowlistPersist is
+// set. Rule can't be added to empty allowlist nor can the last rule be
+// removed, since empty allowlist allows all commands.
+func (a *agent) applyAllowlistUpdate(cmd, rule string) error {
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+	c := *a.config
+	current := c.Exec.Allowlist
+	if len(current) == 0 {
+		return errors.Wrap(errAllowAll, fmt.Errorf("set allowlist in config first"))
+	}
+	rules := []string{}
+	found := false
+	for _, r := range current {
+		if strings.TrimSpace(r) == rule {
+			found = true
+			if cmd == allowlistRemove {
+				continue
+			}
+		}
+		rules = append(rules, r)
+	}
+	switch {
+	case cmd == allowlistAdd && found:
+		return nil
+	case cmd == allowlistAdd:
+		rules = append(rules, rule)
+	case !found:
+		return errors.Wrap(errNoSuchAllowRule, fmt.Errorf("%s", rule))
+	case len(rules) == 0:
+		return errors.Wrap(errAllowAll, fmt.Errorf("can't remove the last rule"))
+	}
+	c.Exec.Allowlist = rules
+	if c.Exec.AllowlistPersist {
+		if err := SaveConfig(c); err != nil {
+			return errors.Wrap(errFailedSaveConfig, err)
+		}
+	}
+	a.config = &c
+	a.logger.Info(fmt.Sprintf("Allowlist updated with %s %s", cmd, rule))
+	return nil
+}
+
+// checkAllowlistSignature checks that update is signed with the key and
+// that its time is within the window, and returns the time.
+func (a *agent) checkAllowlistSignature(cmd, ts, sig, rule string) (int64, error) {
+	key := a.cfg().Exec.AllowlistKey
+	if key == "" {
+		return 0, errAllowlistUpdateDisabled
+	}
+	ms, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidCommand, fmt.Errorf("invalid time %s", ts))
+	}
+	if !hmac.Equal([]byte(sig), []byte(allowlistSignature(key, cmd, ts, rule))) {
+		return 0, errInvalidSignature
+	}
+	d := a.clk().Now().Sub(time.Unix(0, ms*int64(time.Millisecond)))
+	if d > allowlistSigWindow || d < -allowlistSigWindow {
+		return 0, errors.Wrap(errInvalidSignature, fmt.Errorf("signed %s from agent time", d))
+	}
+	return ms, nil
+}
+
+// restoreAllowlistTS restores time of the last accepted allowlist update
+// from the store, so that updates accepted before restart can't be replayed.
+func (a *agent) restoreAllowlistTS() error {
+	v, err := a.store.Get(allowlistBucket, allowlistLast)
+	switch {
+	case errors.Contains(err, store.ErrNotFound):
+		return nil
+	case err != nil:
+		return err
+	}
+	ms, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		return err
+	}
+	a.allowlistMu.Lock()
+	a.allowlistTS = ms
+	a.allowlistMu.Unlock()
+	return nil
+}
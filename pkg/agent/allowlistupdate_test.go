@@ -0,0 +1,136 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateAllowlist(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	const key = "allowlist-key"
+	now := time.Unix(1600000000, 0)
+	signed := func(cmd string, at time.Time, rule string) string {
+		ts := strconv.FormatInt(at.UnixNano()/int64(time.Millisecond), 10)
+		return fmt.Sprintf("%s,%s,%s", ts, allowlistSignature(key, cmd, ts, rule), rule)
+	}
+	current := []string{"ls", "systemctl status *"}
+
+	cases := []struct {
+		desc      string
+		key       string
+		allowlist []string
+		cmd       string
+		args      string
+		expected  []string
+		err       error
+	}{
+		{"add rule", key, current, allowlistAdd, signed(allowlistAdd, now, "systemctl restart foo"), []string{"ls", "systemctl status *", "systemctl restart foo"}, nil},
+		{"add existing rule", key, current, allowlistAdd, signed(allowlistAdd, now, "ls"), current, nil},
+		{"remove rule", key, current, allowlistRemove, signed(allowlistRemove, now, "systemctl status *"), []string{"ls"}, nil},
+		{"remove missing rule", key, current, allowlistRemove, signed(allowlistRemove, now, "rm"), current, errNoSuchAllowRule},
+		{"remove last rule", key, []string{"ls"}, allowlistRemove, signed(allowlistRemove, now, "ls"), []string{"ls"}, errAllowAll},
+		{"add to empty allowlist", key, nil, allowlistAdd, signed(allowlistAdd, now, "ls"), nil, errAllowAll},
+		{"updates disabled", "", current, allowlistAdd, signed(allowlistAdd, now, "rm"), current, errAllowlistUpdateDisabled},
+		{"wrong signature", key, current, allowlistAdd, fmt.Sprintf("1600000000000,%s,rm", allowlistSignature("other", allowlistAdd, "1600000000000", "rm")), current, errInvalidSignature},
+		{"signature of other command", key, current, allowlistAdd, signed(allowlistRemove, now, "rm"), current, errInvalidSignature},
+		{"expired signature", key, current, allowlistAdd, signed(allowlistAdd, now.Add(-time.Hour), "rm"), current, errInvalidSignature},
+		{"invalid rule", key, current, allowlistAdd, signed(allowlistAdd, now, "ls /[/"), current, errInvalidAllowRule},
+		{"missing rule", key, current, allowlistAdd, "1600000000000,abc", current, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		a := &agent{
+			config: &Config{Exec: ExecConfig{Allowlist: tc.allowlist, AllowlistKey: tc.key}},
+			clock:  mocks.NewClock(now),
+			store:  store.NewMemory(),
+			logger: logger,
+		}
+		err := a.updateAllowlist(tc.cmd, tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		allowlist := a.cfg().Exec.Allowlist
+		assert.Equal(t, tc.expected, allowlist, fmt.Sprintf("%s: expected allowlist %v got %v", tc.desc, tc.expected, allowlist))
+	}
+
+	// Replayed and older updates are rejected, while failed updates don't
+	// consume their time.
+	st := store.NewMemory()
+	a := &agent{
+		config: &Config{Exec: ExecConfig{Allowlist: current, AllowlistKey: key}},
+		clock:  mocks.NewClock(now),
+		store:  st,
+		logger: logger,
+	}
+	grant := signed(allowlistAdd, now.Add(-time.Minute), "rm")
+	revoke := signed(allowlistRemove, now, "rm")
+	replays := []struct {
+		desc     string
+		cmd      string
+		args     string
+		expected []string
+		err      error
+	}{
+		{"grant rule", allowlistAdd, grant, []string{"ls", "systemctl status *", "rm"}, nil},
+		{"replay grant", allowlistAdd, grant, []string{"ls", "systemctl status *", "rm"}, errInvalidSignature},
+		{"revoke rule", allowlistRemove, revoke, current, nil},
+		{"replay grant after revoke", allowlistAdd, grant, current, errInvalidSignature},
+		{"replay revoke", allowlistRemove, revoke, current, errInvalidSignature},
+		{"grant signed at the same time as revoke", allowlistAdd, signed(allowlistAdd, now, "rm"), current, errInvalidSignature},
+		{"failed revoke", allowlistRemove, signed(allowlistRemove, now.Add(time.Millisecond), "rm"), current, errNoSuchAllowRule},
+		{"grant signed at the time of failed revoke", allowlistAdd, signed(allowlistAdd, now.Add(time.Millisecond), "rm"), []string{"ls", "systemctl status *", "rm"}, nil},
+		{"revoke signed in the same second", allowlistRemove, signed(allowlistRemove, now.Add(2*time.Millisecond), "rm"), current, nil},
+	}
+	for _, tc := range replays {
+		err := a.updateAllowlist(tc.cmd, tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		allowlist := a.cfg().Exec.Allowlist
+		assert.Equal(t, tc.expected, allowlist, fmt.Sprintf("%s: expected allowlist %v got %v", tc.desc, tc.expected, allowlist))
+	}
+
+	// Time of the last accepted update is restored after restart.
+	a = &agent{
+		config: &Config{Exec: ExecConfig{Allowlist: current, AllowlistKey: key}},
+		clock:  mocks.NewClock(now),
+		store:  st,
+		logger: logger,
+	}
+	err = a.restoreAllowlistTS()
+	assert.Nil(t, err, fmt.Sprintf("unexpected error restoring allowlist update time: %s", err))
+	err = a.updateAllowlist(allowlistAdd, grant)
+	assert.True(t, errors.Contains(err, errInvalidSignature), fmt.Sprintf("replay after restart: expected error %s got %s", errInvalidSignature, err))
+
+	// Persisted update is saved to config file.
+	dir, err := ioutil.TempDir("", "allowlist")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.toml")
+	a = &agent{
+		config: &Config{Exec: ExecConfig{Allowlist: current, AllowlistKey: key, AllowlistPersist: true}, File: file},
+		clock:  mocks.NewClock(now),
+		store:  store.NewMemory(),
+		logger: logger,
+	}
+	err = a.updateAllowlist(allowlistAdd, signed(allowlistAdd, now, "uptime"))
+	assert.Nil(t, err, fmt.Sprintf("unexpected error updating allowlist: %s", err))
+	saved, err := ReadConfig(file)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error reading saved config: %s", err))
+	assert.Equal(t, []string{"ls", "systemctl status *", "uptime"}, saved.Exec.Allowlist, fmt.Sprintf("updated allowlist wasn't saved, got %v", saved.Exec.Allowlist))
+}
@@ -64,28 +64,19 @@ func addConfigEndpoint(svc agent.Service) endpoint.Endpoint {
 			return nil, err
 		}
 
-		sc := agent.ServerConfig{Port: req.agent.server.port}
-		cc := agent.ChanConfig{
-			Control: req.agent.channels.control,
-			Data:    req.agent.channels.data,
-		}
-		ec := agent.EdgexConfig{URL: req.agent.edgex.url}
-		lc := agent.LogConfig{Level: req.agent.log.level}
-		mc := agent.MQTTConfig{
-			URL:      req.agent.mqtt.url,
-			Username: req.agent.mqtt.username,
-			Password: req.agent.mqtt.password,
-		}
-		c := agent.Config{
-			Server:   sc,
-			Channels: cc,
-			Edgex:    ec,
-			Log:      lc,
-			MQTT:     mc,
-		}
+		// Sections which are not part of the request are kept as they are.
+		c := svc.Config()
+		c.Server.Port = req.agent.server.port
+		c.Channels.Control = req.agent.channels.control
+		c.Channels.Data = req.agent.channels.data
+		c.Edgex.URL = req.agent.edgex.url
+		c.Log.Level = req.agent.log.level
+		c.MQTT.URL = req.agent.mqtt.url
+		c.MQTT.Username = req.agent.mqtt.username
+		c.MQTT.Password = req.agent.mqtt.password
 
 		if err := svc.AddConfig(c); err != nil {
-			return genericRes{}, nil
+			return nil, err
 		}
 
 		return genericRes{
@@ -19,6 +19,7 @@ import (
 	"github.com/mainflux/agent/pkg/agent/mocks"
 
 	"github.com/mainflux/mainflux/logger"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -44,13 +45,18 @@ func newService() agent.Service {
 	opts := paho.NewClientOptions()
 	mqttClient := paho.NewClient(opts)
 	edgexClient := mocks.NewEdgexClient()
-	config := agent.Config{}
+	// Heartbeat subsystem is disabled, so that NATS connection isn't used.
+	config := agent.Config{Features: agent.FeaturesConfig{Disabled: []string{agent.FeatureHeartbeat}}}
 	logger, err := logger.New(os.Stdout, "debug")
 	if err != nil {
 		fmt.Println(fmt.Sprintf("Failed to create logger: %s", err.Error()))
 	}
 
-	return agent.New(mqttClient, &config, edgexClient, logger)
+	svc, err := agent.New(mqttClient, &config, edgexClient, &nats.Conn{}, agent.Throughput{}, nil, nil, logger)
+	if err != nil {
+		fmt.Println(fmt.Sprintf("Failed to create service: %s", err.Error()))
+	}
+	return svc
 }
 
 func newServer(svc agent.Service) *httptest.Server {
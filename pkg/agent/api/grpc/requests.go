@@ -0,0 +1,21 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package grpc
+
+import "github.com/mainflux/agent/pkg/agent"
+
+type commandReq struct {
+	UUID    string `json:"uuid"`
+	Command string `json:"command"`
+}
+
+func (req commandReq) validate() error {
+	if req.UUID == "" || req.Command == "" {
+		return agent.ErrMalformedEntity
+	}
+
+	return nil
+}
+
+type servicesReq struct{}
@@ -0,0 +1,20 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package grpc
+
+import "github.com/mainflux/agent/pkg/agent"
+
+// commandRes holds SenML payload published as command response.
+type commandRes struct {
+	Payload string `json:"payload"`
+}
+
+type servicesRes struct {
+	Services []agent.Info `json:"services"`
+}
+
+// outputRes holds chunk of command output.
+type outputRes struct {
+	Output string `json:"output"`
+}
@@ -0,0 +1,186 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package grpc
+
+import (
+	"context"
+
+	"github.com/mainflux/agent/pkg/agent"
+	"github.com/mainflux/mainflux/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const serviceName = "mainflux.agent.Agent"
+
+var _ agentServer = (*server)(nil)
+
+// agentServer is the server API for Agent service.
+type agentServer interface {
+	execute(context.Context, commandReq) (interface{}, error)
+	control(context.Context, commandReq) (interface{}, error)
+	serviceConfig(context.Context, commandReq) (interface{}, error)
+	services(context.Context, servicesReq) (interface{}, error)
+	executeStream(commandReq, grpc.ServerStream) error
+}
+
+type server struct {
+	svc agent.Service
+}
+
+// NewServer returns gRPC server exposing agent service. Messages are
+// JSON encoded, so clients have to use `json` content subtype.
+func NewServer(svc agent.Service, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	s.RegisterService(&serviceDesc, &server{svc: svc})
+	return s
+}
+
+func (s *server) execute(_ context.Context, req commandReq) (interface{}, error) {
+	if err := req.validate(); err != nil {
+		return nil, encodeError(err)
+	}
+	payload, err := s.svc.Execute(req.UUID, req.Command)
+	if err != nil {
+		return nil, encodeError(err)
+	}
+	return commandRes{Payload: payload}, nil
+}
+
+func (s *server) control(_ context.Context, req commandReq) (interface{}, error) {
+	if err := req.validate(); err != nil {
+		return nil, encodeError(err)
+	}
+	payload, err := s.svc.Control(req.UUID, req.Command)
+	if err != nil {
+		return nil, encodeError(err)
+	}
+	return commandRes{Payload: payload}, nil
+}
+
+func (s *server) serviceConfig(_ context.Context, req commandReq) (interface{}, error) {
+	if err := req.validate(); err != nil {
+		return nil, encodeError(err)
+	}
+	payload, err := s.svc.ServiceConfig(req.UUID, req.Command)
+	if err != nil {
+		return nil, encodeError(err)
+	}
+	return commandRes{Payload: payload}, nil
+}
+
+func (s *server) services(_ context.Context, _ servicesReq) (interface{}, error) {
+	return servicesRes{Services: s.svc.Services()}, nil
+}
+
+func (s *server) executeStream(req commandReq, stream grpc.ServerStream) error {
+	if err := req.validate(); err != nil {
+		return encodeError(err)
+	}
+	if err := s.svc.ExecuteStream(req.UUID, req.Command, streamWriter{stream}); err != nil {
+		return encodeError(err)
+	}
+	return nil
+}
+
+// streamWriter sends every write as a separate stream message.
+type streamWriter struct {
+	stream grpc.ServerStream
+}
+
+func (sw streamWriter) Write(p []byte) (int, error) {
+	if err := sw.stream.SendMsg(outputRes{Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func encodeError(err error) error {
+	switch {
+	case errors.Contains(err, agent.ErrMalformedEntity):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*agentServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Execute",
+			Handler:    commandHandler("Execute", agentServer.execute),
+		},
+		{
+			MethodName: "Control",
+			Handler:    commandHandler("Control", agentServer.control),
+		},
+		{
+			MethodName: "ServiceConfig",
+			Handler:    commandHandler("ServiceConfig", agentServer.serviceConfig),
+		},
+		{
+			MethodName: "Services",
+			Handler:    servicesHandler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExecuteStream",
+			Handler:       executeStreamHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "agent",
+}
+
+type commandFunc func(agentServer, context.Context, commandReq) (interface{}, error)
+
+func commandHandler(method string, fn commandFunc) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		var req commandReq
+		if err := dec(&req); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if interceptor == nil {
+			return fn(srv.(agentServer), ctx, req)
+		}
+		info := &grpc.UnaryServerInfo{
+			Server:     srv,
+			FullMethod: "/" + serviceName + "/" + method,
+		}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return fn(srv.(agentServer), ctx, req.(commandReq))
+		}
+		return interceptor(ctx, req, info, handler)
+	}
+}
+
+func servicesHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	var req servicesReq
+	if err := dec(&req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if interceptor == nil {
+		return srv.(agentServer).services(ctx, req)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/" + serviceName + "/Services",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(agentServer).services(ctx, req.(servicesReq))
+	}
+	return interceptor(ctx, req, info, handler)
+}
+
+func executeStreamHandler(srv interface{}, stream grpc.ServerStream) error {
+	var req commandReq
+	if err := stream.RecvMsg(&req); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return srv.(agentServer).executeStream(req, stream)
+}
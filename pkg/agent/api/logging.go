@@ -5,6 +5,7 @@ package api
 
 import (
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/mainflux/agent/pkg/agent"
@@ -49,7 +50,20 @@ func (lm loggingMiddleware) Execute(uuid, cmd string) (str string, err error) {
 	return lm.svc.Execute(uuid, cmd)
 }
 
-func (lm loggingMiddleware) Control(uuid, cmd string) (err error) {
+func (lm loggingMiddleware) ExecuteStream(uuid, cmd string, w io.Writer) (err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method exec_stream for uuid %s and cmd %s took %s to complete", uuid, cmd, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.ExecuteStream(uuid, cmd, w)
+}
+
+func (lm loggingMiddleware) Control(uuid, cmd string) (str string, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method control for uuid %s and cmd %s took %s to complete", uuid, cmd, time.Since(begin))
 		if err != nil {
@@ -84,7 +98,7 @@ func (lm loggingMiddleware) Config() agent.Config {
 	return lm.svc.Config()
 }
 
-func (lm loggingMiddleware) ServiceConfig(uuid, cmdStr string) (err error) {
+func (lm loggingMiddleware) ServiceConfig(uuid, cmdStr string) (str string, err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method service_config took %s to complete", time.Since(begin))
 		if err != nil {
@@ -106,6 +120,19 @@ func (lm loggingMiddleware) Services() []agent.Info {
 	return lm.svc.Services()
 }
 
+func (lm loggingMiddleware) ServiceInfo(name string) (info agent.Info, err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method service_info for service %s took %s to complete", name, time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.ServiceInfo(name)
+}
+
 func (lm loggingMiddleware) Terminal(uuid, cmdStr string) (err error) {
 	defer func(begin time.Time) {
 		message := fmt.Sprintf("Method terminal for uuid %s and payload %s took %s to complete", uuid, cmdStr, time.Since(begin))
@@ -118,3 +145,40 @@ func (lm loggingMiddleware) Terminal(uuid, cmdStr string) (err error) {
 
 	return lm.svc.Terminal(uuid, cmdStr)
 }
+
+func (lm loggingMiddleware) ReloadCerts() (err error) {
+	defer func(begin time.Time) {
+		message := fmt.Sprintf("Method reload_certs took %s to complete", time.Since(begin))
+		if err != nil {
+			lm.logger.Warn(fmt.Sprintf("%s with error: %s.", message, err))
+			return
+		}
+		lm.logger.Info(fmt.Sprintf("%s without errors.", message))
+	}(time.Now())
+
+	return lm.svc.ReloadCerts()
+}
+
+func (lm loggingMiddleware) OnResponse(fn func(topic, payload string)) {
+	lm.svc.OnResponse(fn)
+}
+
+func (lm loggingMiddleware) AcceptEncoding(uuid, encoding string) {
+	lm.svc.AcceptEncoding(uuid, encoding)
+}
+
+func (lm loggingMiddleware) ResponseFormat(uuid, format string) {
+	lm.svc.ResponseFormat(uuid, format)
+}
+
+func (lm loggingMiddleware) Ready() bool {
+	return lm.svc.Ready()
+}
+
+func (lm loggingMiddleware) BaseName(uuid string) string {
+	return lm.svc.BaseName(uuid)
+}
+
+func (lm loggingMiddleware) ErrorMessage(uuid string, err error) string {
+	return lm.svc.ErrorMessage(uuid, err)
+}
@@ -6,6 +6,7 @@
 package api
 
 import (
+	"io"
 	"time"
 
 	"github.com/go-kit/kit/metrics"
@@ -38,7 +39,16 @@ func (ms *metricsMiddleware) Execute(uuid, cmdStr string) (string, error) {
 	return ms.svc.Execute(uuid, cmdStr)
 }
 
-func (ms *metricsMiddleware) Control(uuid, cmdStr string) error {
+func (ms *metricsMiddleware) ExecuteStream(uuid, cmdStr string, w io.Writer) error {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "execute_stream").Add(1)
+		ms.latency.With("method", "execute_stream").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.ExecuteStream(uuid, cmdStr, w)
+}
+
+func (ms *metricsMiddleware) Control(uuid, cmdStr string) (string, error) {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "control").Add(1)
 		ms.latency.With("method", "control").Observe(time.Since(begin).Seconds())
@@ -56,7 +66,7 @@ func (ms *metricsMiddleware) AddConfig(ec agent.Config) error {
 	return ms.svc.AddConfig(ec)
 }
 
-func (ms *metricsMiddleware) ServiceConfig(uuid, cmdStr string) error {
+func (ms *metricsMiddleware) ServiceConfig(uuid, cmdStr string) (string, error) {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "service_config").Add(1)
 		ms.latency.With("method", "service_config").Observe(time.Since(begin).Seconds())
@@ -83,6 +93,15 @@ func (ms *metricsMiddleware) Services() []agent.Info {
 	return ms.svc.Services()
 }
 
+func (ms *metricsMiddleware) ServiceInfo(name string) (agent.Info, error) {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "service_info").Add(1)
+		ms.latency.With("method", "service_info").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.ServiceInfo(name)
+}
+
 func (ms *metricsMiddleware) Publish(topic, payload string) error {
 	defer func(begin time.Time) {
 		ms.counter.With("method", "publish").Add(1)
@@ -100,3 +119,36 @@ func (ms *metricsMiddleware) Terminal(topic, payload string) error {
 
 	return ms.svc.Terminal(topic, payload)
 }
+
+func (ms *metricsMiddleware) ReloadCerts() error {
+	defer func(begin time.Time) {
+		ms.counter.With("method", "reload_certs").Add(1)
+		ms.latency.With("method", "reload_certs").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+
+	return ms.svc.ReloadCerts()
+}
+
+func (ms *metricsMiddleware) OnResponse(fn func(topic, payload string)) {
+	ms.svc.OnResponse(fn)
+}
+
+func (ms *metricsMiddleware) AcceptEncoding(uuid, encoding string) {
+	ms.svc.AcceptEncoding(uuid, encoding)
+}
+
+func (ms *metricsMiddleware) ResponseFormat(uuid, format string) {
+	ms.svc.ResponseFormat(uuid, format)
+}
+
+func (ms *metricsMiddleware) Ready() bool {
+	return ms.svc.Ready()
+}
+
+func (ms *metricsMiddleware) BaseName(uuid string) string {
+	return ms.svc.BaseName(uuid)
+}
+
+func (ms *metricsMiddleware) ErrorMessage(uuid string, err error) string {
+	return ms.svc.ErrorMessage(uuid, err)
+}
@@ -52,11 +52,23 @@ func MakeHandler(svc agent.Service) http.Handler {
 	))
 
 	r.GetFunc("/version", mainflux.Version("agent"))
+	r.GetFunc("/ready", readyHandler(svc))
 	r.Handle("/metrics", promhttp.Handler())
 
 	return r
 }
 
+// readyHandler responds with 200 once agent is ready and 503 until then.
+func readyHandler(svc agent.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !svc.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func decodeRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	return nil, nil
 }
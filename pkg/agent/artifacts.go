@@ -0,0 +1,82 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const outputURL = "output_url"
+
+// errArtifactsDisabled indicates that artifact server is not configured
+var errArtifactsDisabled = errors.New("artifact server is disabled")
+
+// saveArtifact writes full command output to the artifact root and
+// returns URL from which the output can be downloaded.
+func (a *agent) saveArtifact(uuid string, out []byte) (string, error) {
+	cfg := a.cfg().Artifacts
+	id, err := a.saveOutput(cfg.Root, uuid, out)
+	if err != nil {
+		return "", err
+	}
+	return artifactURL(cfg, id+outputExt), nil
+}
+
+// artifactURL returns URL of the named artifact. Host name of the
+// device is used if artifact server URL is not configured.
+func artifactURL(cfg ArtifactsConfig, name string) string {
+	base := strings.TrimRight(cfg.URL, "/")
+	if base == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "localhost"
+		}
+		base = fmt.Sprintf("http://%s:%s", host, cfg.Port)
+	}
+	return fmt.Sprintf("%s/%s", base, name)
+}
+
+// ArtifactsHandler returns HTTP handler serving outputs kept in the
+// artifact root. Requests must carry the token in Authorization header,
+// optionally prefixed with `Bearer `. Directory listing is not served.
+func ArtifactsHandler(cfg ArtifactsConfig) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		name := strings.TrimPrefix(r.URL.Path, "/")
+		id := strings.TrimSuffix(name, outputExt)
+		if id == name || id == "" || id != outputID(id) {
+			http.NotFound(w, r)
+			return
+		}
+		f, err := os.Open(filepath.Join(cfg.Root, name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+	})
+}
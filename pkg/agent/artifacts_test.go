@@ -0,0 +1,62 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArtifacts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := ArtifactsConfig{Port: "9001", Root: dir, Token: "secret", URL: "http://10.0.0.5:9001/"}
+	a := &agent{config: &Config{Artifacts: cfg}}
+	url, err := a.saveArtifact("1/2", []byte("full output"))
+	assert.Nil(t, err, fmt.Sprintf("unexpected error saving artifact: %s", err))
+	assert.Equal(t, "http://10.0.0.5:9001/1_2.out", url, fmt.Sprintf("unexpected artifact url %s", url))
+
+	ts := httptest.NewServer(ArtifactsHandler(cfg))
+	defer ts.Close()
+
+	cases := []struct {
+		desc   string
+		path   string
+		token  string
+		status int
+		body   string
+	}{
+		{"download artifact", "/1_2.out", "secret", http.StatusOK, "full output"},
+		{"download artifact with bearer token", "/1_2.out", "Bearer secret", http.StatusOK, "full output"},
+		{"download artifact without token", "/1_2.out", "", http.StatusUnauthorized, ""},
+		{"download artifact with invalid token", "/1_2.out", "wrong", http.StatusUnauthorized, ""},
+		{"download missing artifact", "/3.out", "secret", http.StatusNotFound, ""},
+		{"list artifacts", "/", "secret", http.StatusNotFound, ""},
+		{"download file outside root", "/..%2Fpasswd.out", "secret", http.StatusNotFound, ""},
+	}
+
+	for _, tc := range cases {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+tc.path, nil)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error creating request: %s", tc.desc, err))
+		req.Header.Set("Authorization", tc.token)
+		res, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, tc.status, res.StatusCode, fmt.Sprintf("%s: expected status %d got %d", tc.desc, tc.status, res.StatusCode))
+		if tc.status == http.StatusOK {
+			assert.Equal(t, tc.body, string(body), fmt.Sprintf("%s: expected body %s got %s", tc.desc, tc.body, body))
+		}
+	}
+}
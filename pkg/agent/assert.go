@@ -0,0 +1,50 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	execAssert   = "exec-assert"
+	assertOutput = "output"
+)
+
+// assertExec handles `exec-assert,<cmd>,<expected>` command, expected output
+// is base64 encoded and follows the last comma. Command is run as `exec`
+// command and returns record telling whether its output matched expected one,
+// leading and trailing white space ignored, followed by the actual output on
+// mismatch.
+func (a *agent) assertExec(uuid, args string) ([]senml.Record, error) {
+	i := strings.LastIndex(args, ",")
+	if i < 0 {
+		return nil, ErrInvalidCommand
+	}
+	cmd, enc := args[:i], strings.TrimSpace(args[i+1:])
+	expected, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidCommand, fmt.Errorf("expected output: %s", err))
+	}
+
+	var buf bytes.Buffer
+	if _, _, _, err := a.execute(uuid, strings.TrimSpace(cmd), &buf); err != nil {
+		return nil, err
+	}
+	out := bytes.TrimSpace(buf.Bytes())
+	match := bytes.Equal(out, bytes.TrimSpace(expected))
+	records := []senml.Record{
+		{Name: execAssert, BoolValue: &match},
+	}
+	if !match {
+		records = append(records, outputRecords(assertOutput, out, a.cfg().Exec.MaxOutputSize)...)
+	}
+	return records, nil
+}
@@ -0,0 +1,55 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssertExec(t *testing.T) {
+	encode := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	cases := []struct {
+		desc   string
+		args   string
+		match  bool
+		output string
+		err    error
+	}{
+		{"matching output", "echo,hello," + encode("hello"), true, "", nil},
+		{"matching output with trailing newline", "echo,hello," + encode("hello\n"), true, "", nil},
+		{"mismatching output", "echo,hello," + encode("world"), false, "hello", nil},
+		{"command with hints", "maxbytes=3;echo,hello," + encode("hello"), true, "", nil},
+		{"malformed expected output", "echo,hello,not base64", false, "", ErrInvalidCommand},
+		{"missing expected output", "echo", false, "", ErrInvalidCommand},
+		{"command not allowed", "rm,-rf,/tmp/x," + encode(""), false, "", errCommandNotAllowed},
+	}
+
+	for _, tc := range cases {
+		a := &agent{
+			config:   &Config{Exec: ExecConfig{Allowlist: []string{"echo"}}},
+			safeMode: &safeMode{},
+			procs:    make(map[int]*process),
+		}
+		records, err := a.assertExec("1", tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		assert.Equal(t, execAssert, records[0].Name, fmt.Sprintf("%s: expected %s record got %s", tc.desc, execAssert, records[0].Name))
+		assert.Equal(t, tc.match, *records[0].BoolValue, fmt.Sprintf("%s: expected match %t", tc.desc, tc.match))
+		if tc.match {
+			assert.Len(t, records, 1, fmt.Sprintf("%s: expected no output on match", tc.desc))
+			continue
+		}
+		assert.Equal(t, tc.output, *records[1].StringValue, fmt.Sprintf("%s: expected output %s got %s", tc.desc, tc.output, *records[1].StringValue))
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/senml"
+)
+
+const (
+	beaconVersion = "version"
+	beaconUptime  = "uptime"
+	beaconStatus  = "status"
+)
+
+// Version is version of the agent, set at build time with
+// `-ldflags "-X github.com/mainflux/agent/pkg/agent.Version=v1.2.3"`.
+var Version = "dev"
+
+// beacon publishes agent heartbeat every configured interval.
+func (a *agent) beacon(cfg BeaconConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		a.publishBeacon(cfg)
+		<-ticker.C
+	}
+}
+
+// publishBeacon publishes agent heartbeat to NATS subject and MQTT topic,
+// whichever is configured. Failures are logged and the next beat retried.
+func (a *agent) publishBeacon(cfg BeaconConfig) {
+	payload, err := encoder.EncodeRecords(a.BaseName(""), a.beaconRecords())
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to encode agent heartbeat: %s", err))
+		return
+	}
+	if cfg.Subject != "" && a.nats != nil {
+		if err := a.nats.Publish(cfg.Subject, payload); err != nil {
+			a.logger.Warn(fmt.Sprintf("Failed to publish agent heartbeat to %s: %s", cfg.Subject, err))
+		} else {
+			a.throughput.Add(TransportNATS, DirectionPublished, len(payload))
+		}
+	}
+	if cfg.Topic != "" {
+		if err := a.Publish(cfg.Topic, string(payload)); err != nil {
+			a.logger.Warn(fmt.Sprintf("Failed to publish agent heartbeat to %s: %s", cfg.Topic, err))
+		}
+	}
+}
+
+// beaconRecords returns agent heartbeat with its version and uptime in seconds.
+func (a *agent) beaconRecords() []senml.Record {
+	version, status := Version, online
+	return []senml.Record{
+		{Name: beaconStatus, StringValue: &status},
+		{Name: beaconVersion, StringValue: &version},
+		gauge(beaconUptime, secondsUnit, a.clk().Now().Sub(a.started).Seconds()),
+	}
+}
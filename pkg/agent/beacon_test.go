@@ -0,0 +1,60 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBeaconRecords(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := mocks.NewClock(start)
+	a := &agent{clock: clock, started: start}
+	clock.Advance(90 * time.Second)
+
+	records := a.beaconRecords()
+	values := map[string]interface{}{}
+	for _, r := range records {
+		switch {
+		case r.StringValue != nil:
+			values[r.Name] = *r.StringValue
+		case r.Value != nil:
+			values[r.Name] = *r.Value
+		}
+	}
+	expected := map[string]interface{}{
+		beaconStatus:  online,
+		beaconVersion: Version,
+		beaconUptime:  90.0,
+	}
+	assert.Equal(t, expected, values, fmt.Sprintf("expected heartbeat %v got %v", expected, values))
+}
+
+func TestBeaconConfig(t *testing.T) {
+	cases := []struct {
+		desc    string
+		data    string
+		cfg     BeaconConfig
+		enabled bool
+	}{
+		{"subject", `{"interval":"5s","subject":"heartbeat.agent.service"}`, BeaconConfig{Interval: 5 * time.Second, Subject: "heartbeat.agent.service"}, true},
+		{"topic", `{"interval":1000000000,"topic":"heartbeat"}`, BeaconConfig{Interval: time.Second, Topic: "heartbeat"}, true},
+		{"neither subject nor topic", `{"interval":"5s"}`, BeaconConfig{Interval: 5 * time.Second}, false},
+		{"zero interval", `{"subject":"heartbeat.agent.service"}`, BeaconConfig{Subject: "heartbeat.agent.service"}, false},
+	}
+
+	for _, tc := range cases {
+		var cfg BeaconConfig
+		err := json.Unmarshal([]byte(tc.data), &cfg)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.cfg, cfg, fmt.Sprintf("%s: expected config %v got %v", tc.desc, tc.cfg, cfg))
+		assert.Equal(t, tc.enabled, cfg.Enabled(), fmt.Sprintf("%s: expected enabled %t", tc.desc, tc.enabled))
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	agentBootstrapSync = "agent-bootstrap-sync"
+	unchanged          = "unchanged"
+	restartRequired    = "restart"
+)
+
+var (
+	// errBootstrapDisabled indicates that agent wasn't given a way to fetch bootstrap config
+	errBootstrapDisabled = errors.New("bootstrap sync is disabled")
+
+	// errBootstrapSync indicates failure to fetch config from bootstrap
+	errBootstrapSync = errors.New("failed to sync config from bootstrap")
+)
+
+// ConfigSync fetches the config from bootstrap service, the same
+// way as on start.
+type ConfigSync func() (Config, error)
+
+// runtimeSections are config sections read on every use, so their
+// changes are applied without restart. Other sections are used only
+// while starting the agent.
+var runtimeSections = map[string]func(dst *Config, src Config){
+	"apply":     func(dst *Config, src Config) { dst.Apply = src.Apply },
+	"artifacts": func(dst *Config, src Config) { dst.Artifacts = src.Artifacts },
+	"channels":  func(dst *Config, src Config) { dst.Channels = src.Channels },
+	"edgex":     func(dst *Config, src Config) { dst.Edgex = src.Edgex },
+	"exec":      func(dst *Config, src Config) { dst.Exec = src.Exec },
+	"features":  func(dst *Config, src Config) { dst.Features = src.Features },
+	"ready":     func(dst *Config, src Config) { dst.Ready = src.Ready },
+	"reboot":    func(dst *Config, src Config) { dst.Reboot = src.Reboot },
+	"senml":     func(dst *Config, src Config) { dst.SenML = src.SenML },
+	"terminal":  func(dst *Config, src Config) { dst.Terminal = src.Terminal },
+}
+
+// bootstrapSync fetches the config from bootstrap and saves it. Changed
+// runtime sections replace the running ones, while other changed
+// sections take effect after restart. Returns record per changed
+// section with `applied` or `restart` value.
+func (a *agent) bootstrapSync() ([]senml.Record, error) {
+	if a.sync == nil {
+		return nil, errBootstrapDisabled
+	}
+	fetched, err := a.sync()
+	if err != nil {
+		return nil, errors.Wrap(errBootstrapSync, err)
+	}
+
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	if fetched.File == "" {
+		fetched.File = a.config.File
+	}
+	if err := fetched.Validate(); err != nil {
+		return nil, errors.Wrap(errInvalidConfig, err)
+	}
+	if err := SaveConfig(fetched); err != nil {
+		return nil, errors.Wrap(errFailedSaveConfig, err)
+	}
+
+	running := *a.config
+	records := []senml.Record{}
+	for _, section := range configChanges(running, fetched) {
+		res := restartRequired
+		if apply, ok := runtimeSections[section]; ok {
+			apply(&running, fetched)
+			res = applied
+		}
+		records = append(records, senml.Record{
+			Name:        section,
+			StringValue: &res,
+		})
+	}
+	a.config = &running
+	return records, nil
+}
+
+// configChanges returns names of config sections which differ,
+// in the order of Config fields.
+func configChanges(running, fetched Config) []string {
+	changes := []string{}
+	rv, fv := reflect.ValueOf(running), reflect.ValueOf(fetched)
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("toml"), ",")[0]
+		if name == "" {
+			continue
+		}
+		if !reflect.DeepEqual(rv.Field(i).Interface(), fv.Field(i).Interface()) {
+			changes = append(changes, name)
+		}
+	}
+	return changes
+}
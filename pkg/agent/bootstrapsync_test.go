@@ -0,0 +1,78 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBootstrapSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.toml")
+	running := Config{
+		Channels:  ChanConfig{Control: "ctrl"},
+		Heartbeat: HeartbeatConfig{Interval: time.Second},
+		Log:       LogConfig{Level: "info"},
+		File:      file,
+	}
+	changed := running
+	changed.Log = LogConfig{Level: "debug"}
+	changed.Exec = ExecConfig{Allowlist: []string{"ls"}}
+
+	cases := []struct {
+		desc    string
+		sync    ConfigSync
+		changes map[string]string
+		exec    []string
+		err     error
+	}{
+		{"sync disabled", nil, nil, nil, errBootstrapDisabled},
+		{
+			desc: "failed fetch",
+			sync: func() (Config, error) { return Config{}, errors.New("connection refused") },
+			err:  errBootstrapSync,
+		},
+		{
+			desc:    "unchanged config",
+			sync:    func() (Config, error) { return running, nil },
+			changes: map[string]string{},
+		},
+		{
+			desc:    "runtime and restart changes",
+			sync:    func() (Config, error) { return changed, nil },
+			changes: map[string]string{"log": restartRequired, "exec": applied},
+			exec:    []string{"ls"},
+		},
+	}
+
+	for _, tc := range cases {
+		cfg := running
+		a := &agent{config: &cfg, sync: tc.sync}
+		records, err := a.bootstrapSync()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if tc.err != nil {
+			continue
+		}
+		changes := map[string]string{}
+		for _, r := range records {
+			changes[r.Name] = *r.StringValue
+		}
+		assert.Equal(t, tc.changes, changes, fmt.Sprintf("%s: expected changes %v got %v", tc.desc, tc.changes, changes))
+		assert.Equal(t, tc.exec, a.cfg().Exec.Allowlist, fmt.Sprintf("%s: expected allowlist %v got %v", tc.desc, tc.exec, a.cfg().Exec.Allowlist))
+		assert.Equal(t, "info", a.cfg().Log.Level, fmt.Sprintf("%s: expected log level to change only after restart", tc.desc))
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	agentReloadCerts  = "agent-reload-certs"
+	reloaded          = "reloaded"
+	disconnectTimeout = 250
+)
+
+var (
+	// errTLSDisabled indicates that MQTT client doesn't use mTLS
+	errTLSDisabled = errors.New("mtls is disabled")
+
+	// errFailedReloadCerts indicates error in loading certificates
+	errFailedReloadCerts = errors.New("failed to reload certificates")
+)
+
+// LoadCertificate loads CA and client certificate with its private key
+// from files, falling back to PEM strings from config if files are not set.
+func LoadCertificate(cnfg MQTTConfig) (c MQTTConfig, err error) {
+	var caByte []byte
+	var cc []byte
+	var pk []byte
+	c = cnfg
+
+	if !c.MTLS {
+		return c, nil
+	}
+	// Load CA cert from file
+	if c.CAPath != "" {
+		if caByte, err = ioutil.ReadFile(c.CAPath); err != nil {
+			return c, err
+		}
+	}
+	// Load CA cert from string if file not present
+	if len(caByte) == 0 && c.CaCert != "" {
+		caByte = []byte(c.CaCert)
+	}
+	// Load client certificate from file if present
+	if c.CertPath != "" {
+		if cc, err = ioutil.ReadFile(c.CertPath); err != nil {
+			return c, err
+		}
+	}
+	// Load client certificate from string if file not present
+	if len(cc) == 0 && c.ClientCert != "" {
+		cc = []byte(c.ClientCert)
+	}
+	// Load private key of client certificate from file
+	if c.PrivKeyPath != "" {
+		if pk, err = ioutil.ReadFile(c.PrivKeyPath); err != nil {
+			return c, err
+		}
+	}
+	// Load private key of client certificate from string
+	if len(pk) == 0 && c.ClientKey != "" {
+		pk = []byte(c.ClientKey)
+	}
+
+	cert, err := tls.X509KeyPair(cc, pk)
+	if err != nil {
+		return c, err
+	}
+	c.Cert = cert
+	c.CA = caByte
+	return c, nil
+}
+
+// TLSCredentials holds MQTT client TLS credentials which can be
+// reloaded from disk without recreating the MQTT client.
+type TLSCredentials struct {
+	mu    sync.RWMutex
+	cfg   MQTTConfig
+	cert  tls.Certificate
+	roots *x509.CertPool
+}
+
+// NewTLSCredentials returns credentials initialized with certificates
+// already loaded into the config.
+func NewTLSCredentials(cfg MQTTConfig) *TLSCredentials {
+	c := &TLSCredentials{cfg: cfg}
+	c.set(cfg)
+	return c
+}
+
+// TLSConfig returns TLS config which reads current credentials on every
+// handshake. Server certificate is verified against current CA unless
+// verification is disabled in config.
+func (c *TLSCredentials) TLSConfig() *tls.Config {
+	host := brokerHost(c.cfg.URL)
+	return &tls.Config{
+		// Verification is done in VerifyPeerCertificate with current CA.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			cert := c.cert
+			return &cert, nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if c.cfg.SkipTLSVer {
+				return nil
+			}
+			return c.verify(host, rawCerts)
+		},
+	}
+}
+
+// Reload loads certificates from disk and replaces current credentials.
+func (c *TLSCredentials) Reload() error {
+	if !c.cfg.MTLS {
+		return errTLSDisabled
+	}
+	cfg, err := LoadCertificate(c.cfg)
+	if err != nil {
+		return errors.Wrap(errFailedReloadCerts, err)
+	}
+	c.set(cfg)
+	return nil
+}
+
+func (c *TLSCredentials) set(cfg MQTTConfig) {
+	var roots *x509.CertPool
+	if cfg.CA != nil {
+		roots = x509.NewCertPool()
+		roots.AppendCertsFromPEM(cfg.CA)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = cfg.Cert
+	c.roots = roots
+}
+
+func (c *TLSCredentials) verify(host string, rawCerts [][]byte) error {
+	c.mu.RLock()
+	roots := c.roots
+	c.mu.RUnlock()
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("no server certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       host,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(opts)
+	return err
+}
+
+// brokerHost extracts host from broker URL, i.e. `ssl://localhost:8883`.
+func brokerHost(url string) string {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+	}
+	if host, _, err := net.SplitHostPort(url); err == nil {
+		return host
+	}
+	return url
+}
+
+func (a *agent) ReloadCerts() error {
+	if a.creds == nil {
+		return errTLSDisabled
+	}
+	if err := a.creds.Reload(); err != nil {
+		return err
+	}
+
+	a.mqttClient.Disconnect(disconnectTimeout)
+	token := a.mqttClient.Connect()
+	token.Wait()
+	if err := token.Error(); err != nil {
+		return errors.Wrap(errFailedReloadCerts, err)
+	}
+	a.logger.Info("MQTT certificates reloaded")
+	return nil
+}
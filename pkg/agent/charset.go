@@ -0,0 +1,67 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+	"golang.org/x/text/transform"
+)
+
+// errUnknownCharset indicates that output charset has no decoder.
+var errUnknownCharset = errors.New("unknown output charset")
+
+// charset returns encoding registered under IANA name or alias of the
+// charset, i.e. `latin1` or `windows-1252`. Nil is returned for empty
+// charset, so that output is passed through as is.
+func charset(name string) (encoding.Encoding, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil
+	}
+	enc, err := ianaindex.IANA.Encoding(name)
+	if err != nil || enc == nil {
+		return nil, errors.Wrap(errUnknownCharset, fmt.Errorf("%s", name))
+	}
+	return enc, nil
+}
+
+// transcode converts command output from output charset to UTF-8. Output
+// is returned as is if charset is not set or output can't be converted.
+func (a *agent) transcode(out []byte) []byte {
+	enc, err := charset(a.cfg().Exec.OutputCharset)
+	if enc == nil || err != nil {
+		return out
+	}
+	res, err := enc.NewDecoder().Bytes(out)
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to convert output from %s: %s", a.cfg().Exec.OutputCharset, err))
+		return out
+	}
+	return res
+}
+
+// transcoder wraps writer of streamed output so that output is converted
+// from output charset to UTF-8. Returned writer must be closed to flush
+// incomplete characters. Writer is returned as is if charset is not set.
+func (a *agent) transcoder(w io.Writer) io.WriteCloser {
+	enc, err := charset(a.cfg().Exec.OutputCharset)
+	if enc == nil || err != nil {
+		return nopCloser{w}
+	}
+	return transform.NewWriter(w, enc.NewDecoder())
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
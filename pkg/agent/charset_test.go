@@ -0,0 +1,66 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTranscode(t *testing.T) {
+	cases := []struct {
+		desc    string
+		charset string
+		out     []byte
+		res     string
+	}{
+		{"passthrough", "", []byte("caf\xe9"), "caf\xe9"},
+		{"latin1", "latin1", []byte("caf\xe9"), "café"},
+		{"windows-1252", "windows-1252", []byte("\x80 5"), "€ 5"},
+		{"shift_jis", "Shift_JIS", []byte("\x93\xfa\x96\x7b"), "日本"},
+		{"utf-8", "utf-8", []byte("café"), "café"},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: ExecConfig{OutputCharset: tc.charset}}}
+		res := a.transcode(tc.out)
+		assert.Equal(t, tc.res, string(res), fmt.Sprintf("%s: expected %q got %q", tc.desc, tc.res, res))
+	}
+}
+
+func TestTranscoder(t *testing.T) {
+	a := &agent{config: &Config{Exec: ExecConfig{OutputCharset: "Shift_JIS"}}}
+	var buf bytes.Buffer
+	w := a.transcoder(&buf)
+	// Character split across writes is converted once it is complete.
+	for _, chunk := range []string{"\x93", "\xfa\x96", "\x7b\n"} {
+		_, err := w.Write([]byte(chunk))
+		assert.Nil(t, err, fmt.Sprintf("unexpected error writing %q: %s", chunk, err))
+	}
+	err := w.Close()
+	assert.Nil(t, err, fmt.Sprintf("unexpected error closing transcoder: %s", err))
+	assert.Equal(t, "日本\n", buf.String(), fmt.Sprintf("expected %q got %q", "日本\n", buf.String()))
+}
+
+func TestExecConfigValidate(t *testing.T) {
+	cases := []struct {
+		desc    string
+		charset string
+		err     error
+	}{
+		{"no charset", "", nil},
+		{"iana name", "ISO-8859-1", nil},
+		{"alias", "latin1", nil},
+		{"unknown charset", "klingon", errUnknownCharset},
+	}
+
+	for _, tc := range cases {
+		err := ExecConfig{OutputCharset: tc.charset}.Validate()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+}
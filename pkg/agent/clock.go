@@ -0,0 +1,74 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"os/exec"
+	"time"
+)
+
+// Timer is timer started by Clock. It is an alias of interface literal,
+// so that fakes can implement Clock without importing this package.
+type Timer = interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// Clock provides time to time dependent features, such as timeouts and
+// notify windows, so that tests can control it.
+type Clock interface {
+	// Now returns current time.
+	Now() time.Time
+
+	// AfterFunc calls f in its own goroutine after duration d.
+	AfterFunc(d time.Duration, f func()) Timer
+
+	// Sleep pauses the current goroutine for duration d.
+	Sleep(d time.Duration)
+}
+
+// Executor creates commands run by the agent, so that tests can replace
+// executed processes.
+type Executor interface {
+	// CommandContext returns command running the named binary with the
+	// arguments, which is killed once the context is done.
+	CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+type osExecutor struct{}
+
+func (osExecutor) CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
+
+// clk returns agent clock, real clock is used if it is not set.
+func (a *agent) clk() Clock {
+	if a.clock == nil {
+		return realClock{}
+	}
+	return a.clock
+}
+
+// exe returns agent executor, commands are run with os/exec if it is not set.
+func (a *agent) exe() Executor {
+	if a.executor == nil {
+		return osExecutor{}
+	}
+	return a.executor
+}
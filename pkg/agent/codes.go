@@ -0,0 +1,85 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import "github.com/mainflux/mainflux/errors"
+
+// codeRecord is name of the record holding result code of the command.
+const codeRecord = "code"
+
+// Result codes sent in `code` record of every response.
+const (
+	// CodeSuccess indicates that command succeeded.
+	CodeSuccess = iota
+	// CodeFailure indicates failure which doesn't fall into other categories.
+	CodeFailure
+	// CodeInvalidCommand indicates malformed command or arguments.
+	CodeInvalidCommand
+	// CodeUnknownCommand indicates command agent doesn't know about.
+	CodeUnknownCommand
+	// CodeNotAllowed indicates command rejected by an allowlist.
+	CodeNotAllowed
+	// CodeTimeout indicates command killed after timeout.
+	CodeTimeout
+	// CodeKilled indicates command killed by `exec-kill`.
+	CodeKilled
+	// CodeDisabled indicates command handled by disabled or unconfigured subsystem.
+	CodeDisabled
+	// CodeNotFound indicates that requested resource doesn't exist.
+	CodeNotFound
+)
+
+// resultCodes maps errors to result codes, the first matching error wins.
+var resultCodes = []struct {
+	err  error
+	code int
+}{
+	{ErrInvalidCommand, CodeInvalidCommand},
+	{ErrMalformedEntity, CodeInvalidCommand},
+	{errCommandTooLong, CodeInvalidCommand},
+	{errRebootNotScheduled, CodeInvalidCommand},
+	{errRebootScheduled, CodeInvalidCommand},
+	{errInvalidHint, CodeInvalidCommand},
+	{errInvalidConfig, CodeInvalidCommand},
+	{errInvalidMerge, CodeInvalidCommand},
+	{errAllowAll, CodeInvalidCommand},
+	{ErrUnknownCommand, CodeUnknownCommand},
+	{errCommandNotAllowed, CodeNotAllowed},
+	{errInvalidAllowRule, CodeNotAllowed},
+	{errWorkDirNotAllowed, CodeNotAllowed},
+	{errEdgexOperationNotAllowed, CodeNotAllowed},
+	{errInvalidSignature, CodeNotAllowed},
+	{errExecTimeout, CodeTimeout},
+	{errExecIdle, CodeTimeout},
+	{errEdgexJobTimeout, CodeTimeout},
+	{errExecKilled, CodeKilled},
+	{errFeatureDisabled, CodeDisabled},
+	{errSafeMode, CodeDisabled},
+	{errMaintenanceQueueFull, CodeDisabled},
+	{errMaintenanceStream, CodeDisabled},
+	{errEdgeXNotConfigured, CodeDisabled},
+	{errAuditDisabled, CodeDisabled},
+	{errBootstrapDisabled, CodeDisabled},
+	{errHistoryDisabled, CodeDisabled},
+	{errOutputDisabled, CodeDisabled},
+	{errAllowlistUpdateDisabled, CodeDisabled},
+	{errOutputNotFound, CodeNotFound},
+	{errNoConfigToMerge, CodeNotFound},
+	{errEdgexMetricNotFound, CodeNotFound},
+	{errNoSuchTerminalSession, CodeNotFound},
+	{errNoSuchAllowRule, CodeNotFound},
+}
+
+// ResultCode categorizes command error, CodeSuccess is returned for nil error.
+func ResultCode(err error) int {
+	if err == nil {
+		return CodeSuccess
+	}
+	for _, rc := range resultCodes {
+		if errors.Contains(err, rc.err) {
+			return rc.code
+		}
+	}
+	return CodeFailure
+}
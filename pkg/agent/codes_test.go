@@ -0,0 +1,37 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultCode(t *testing.T) {
+	cases := []struct {
+		desc string
+		err  error
+		code int
+	}{
+		{"success", nil, CodeSuccess},
+		{"invalid command", ErrInvalidCommand, CodeInvalidCommand},
+		{"wrapped unknown command", errors.Wrap(errEdgexFailed, ErrUnknownCommand), CodeUnknownCommand},
+		{"binary not allowed", errors.Wrap(errCommandNotAllowed, fmt.Errorf("rm")), CodeNotAllowed},
+		{"edgex operation not allowed", errors.Wrap(errEdgexOperationNotAllowed, fmt.Errorf("stop")), CodeNotAllowed},
+		{"timeout", errors.Wrap(errExecTimeout, fmt.Errorf("signal: killed")), CodeTimeout},
+		{"killed", errors.Wrap(errExecKilled, fmt.Errorf("signal: killed")), CodeKilled},
+		{"safe mode", errSafeMode, CodeDisabled},
+		{"feature disabled", errors.Wrap(errFeatureDisabled, fmt.Errorf("%s", FeatureExec)), CodeDisabled},
+		{"output not found", errOutputNotFound, CodeNotFound},
+		{"other failure", errors.Wrap(errFailedExecute, fmt.Errorf("exit status 1")), CodeFailure},
+	}
+
+	for _, tc := range cases {
+		code := ResultCode(tc.err)
+		assert.Equal(t, tc.code, code, fmt.Sprintf("%s: expected code %d got %d", tc.desc, tc.code, code))
+	}
+}
@@ -5,11 +5,17 @@ package agent
 
 import (
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mainflux/agent/pkg/encoder"
 	"github.com/mainflux/mainflux/errors"
 	"github.com/pelletier/go-toml"
 )
@@ -19,54 +25,556 @@ type ServerConfig struct {
 	NatsURL string `toml:"nats_url" json:"nats_url"`
 }
 
+// Validate checks that NATS URL, which can be comma separated list of
+// servers, holds only `nats` or `tls` URLs with host. Empty URL is valid,
+// NATS client connects to its default URL.
+func (sc ServerConfig) Validate() error {
+	if sc.NatsURL == "" {
+		return nil
+	}
+	for _, s := range strings.Split(sc.NatsURL, ",") {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "://") {
+			s = "nats://" + s
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Hostname() == "" || (u.Scheme != "nats" && u.Scheme != "tls") {
+			return errors.New(fmt.Sprintf("invalid NATS URL %q", sc.NatsURL))
+		}
+	}
+	return nil
+}
+
+// NatsConfig - Credentials is path to NATS user credentials file and
+// Token is authentication token. Connection uses TLS if CACert or
+// ClientCert is set, certificates and ClientKey are paths to PEM files.
+type NatsConfig struct {
+	Credentials string `toml:"credentials" json:"credentials"`
+	Token       string `toml:"token" json:"token"`
+	CACert      string `toml:"ca_cert" json:"ca_cert"`
+	ClientCert  string `toml:"client_cert" json:"client_cert"`
+	ClientKey   string `toml:"client_key" json:"client_key"`
+}
+
+// Validate checks that client certificate is set together with its key.
+func (nc NatsConfig) Validate() error {
+	if (nc.ClientCert == "") != (nc.ClientKey == "") {
+		return errors.New("NATS client certificate and key must be set together")
+	}
+	return nil
+}
+
+// ChanConfig - failed commands are published to DeadLetter
+// subtopic of the control channel, disabled if empty.
+// Format is default payload format of commands and ResponseFormat default
+// format of responses, which command can override. Routing token matching
+// RoutePattern at the start of the command is stripped before the command
+// is parsed and echoed in the response, disabled if empty. If Ack is set,
+// receipt of each command is acknowledged before the command is run.
 type ChanConfig struct {
-	Control string `toml:"control"`
-	Data    string `toml:"data"`
+	Control        string `toml:"control"`
+	Data           string `toml:"data"`
+	DeadLetter     string `toml:"dead_letter"`
+	Format         string `toml:"format"`
+	ResponseFormat string `toml:"response_format"`
+	RoutePattern   string `toml:"route_pattern"`
+	Ack            bool   `toml:"ack"`
 }
 
+// Validate trims whitespace from channel ids and checks that control
+// channel is set and that ids can be used as MQTT topic level.
+func (cc *ChanConfig) Validate() error {
+	cc.Control = strings.TrimSpace(cc.Control)
+	cc.Data = strings.TrimSpace(cc.Data)
+	if cc.Control == "" {
+		return errors.New("control channel is not set")
+	}
+	for _, id := range []string{cc.Control, cc.Data} {
+		if strings.ContainsAny(id, "/+# \t") {
+			return errors.New(fmt.Sprintf("invalid channel id %q", id))
+		}
+	}
+	return nil
+}
+
+// EdgexConfig - AllowedOperations restricts EdgeX operation actions,
+// i.e. `restart`, which can be requested. All actions are allowed if empty.
+// MaxLogLines caps number of log entries returned by `edgex-logs`.
+// Readings stream polls EdgeX core data every StreamInterval and runs
+// for at most StreamMaxDuration. Instances maps names of additional EdgeX
+// deployments to their URLs, commands target the one at URL unless they
+// name another instance. Services of async operations are polled every
+// JobPollInterval for up to JobTimeout, disabled if JobTimeout <= 0.
 type EdgexConfig struct {
-	URL string `toml:"url"`
+	URL               string            `toml:"url"`
+	AllowedOperations []string          `toml:"allowed_operations" json:"allowed_operations"`
+	MaxLogLines       int               `toml:"max_log_lines" json:"max_log_lines"`
+	StreamInterval    time.Duration     `toml:"stream_interval" json:"stream_interval"`
+	StreamMaxDuration time.Duration     `toml:"stream_max_duration" json:"stream_max_duration"`
+	Instances         map[string]string `toml:"instances" json:"instances"`
+	JobPollInterval   time.Duration     `toml:"job_poll_interval" json:"job_poll_interval"`
+	JobTimeout        time.Duration     `toml:"job_timeout" json:"job_timeout"`
+}
+
+// Allowed checks whether EdgeX operation action is allowed.
+func (ec EdgexConfig) Allowed(action string) bool {
+	if len(ec.AllowedOperations) == 0 {
+		return true
+	}
+	for _, op := range ec.AllowedOperations {
+		if op == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that only known EdgeX operation actions are allowed
+// and that named instances have URLs.
+func (ec EdgexConfig) Validate() error {
+	for _, op := range ec.AllowedOperations {
+		switch op {
+		case "start", "stop", "restart":
+		default:
+			return errors.New(fmt.Sprintf("unknown edgex operation %q", op))
+		}
+	}
+	for name, url := range ec.Instances {
+		if name == "" || strings.ContainsAny(name, ", \t") {
+			return errors.New(fmt.Sprintf("invalid edgex instance name %q", name))
+		}
+		if url == "" {
+			return errors.New(fmt.Sprintf("missing url of edgex instance %q", name))
+		}
+	}
+	return nil
 }
 
 type LogConfig struct {
 	Level string `toml:"level"`
 }
 
+// MQTTConfig - Password is read from PasswordFile if it is set. At most
+// MaxInflight publishes wait for acknowledgement at the same time, limit is
+// disabled if MaxInflight <= 0. When the limit is reached Publish blocks, or
+// fails if InflightFailFast is set. Responses larger than GzipThreshold bytes
+// are gzip compressed if the command sender accepts gzip, compression is
+// disabled if GzipThreshold <= 0.
+// Dedup maps topic, `control` for responses or subtopic name, to window
+// within which records same as the last published ones aren't published.
+// If Serialize is set, publishes are made one at a time in the order they
+// were requested, instead of concurrently. Publishes throttled by the broker
+// are retried with backoff starting at ThrottleBackoff and doubled until it
+// exceeds ThrottleMaxBackoff, retrying is disabled if ThrottleBackoff <= 0.
+// Payloads larger than MaxPayload bytes are handled according to Overflow
+// policy, one of `truncate`, `compress`, `chunk` or `store`, instead of
+// being rejected by the broker. Limit is disabled if MaxPayload <= 0.
 type MQTTConfig struct {
-	URL         string          `json:"url" toml:"url"`
-	Username    string          `json:"username" toml:"username" mapstructure:"username"`
-	Password    string          `json:"password" toml:"password" mapstructure:"password"`
-	MTLS        bool            `json:"mtls" toml:"mtls" mapstructure:"mtls"`
-	SkipTLSVer  bool            `json:"skip_tls_ver" toml:"skip_tls_ver" mapstructure:"skip_tls_ver"`
-	Retain      bool            `json:"retain" toml:"retain" mapstructure:"retain"`
-	QoS         byte            `json:"qos" toml:"qos" mapstructure:"qos"`
-	CAPath      string          `json:"ca_path" toml:"ca_path" mapstructure:"ca_path"`
-	CertPath    string          `json:"cert_path" toml:"cert_path" mapstructure:"cert_path"`
-	PrivKeyPath string          `json:"priv_key_path" toml:"priv_key_path" mapstructure:"priv_key_path"`
-	CA          []byte          `json:"-" toml:"-"`
-	Cert        tls.Certificate `json:"-" toml:"-"`
-	ClientCert  string          `json:"client_cert" toml:"client_cert"`
-	ClientKey   string          `json:"client_key" toml:"client_key"`
-	CaCert      string          `json:"ca_cert" toml:"ca_cert"`
+	URL                string                   `json:"url" toml:"url"`
+	Username           string                   `json:"username" toml:"username" mapstructure:"username"`
+	Password           string                   `json:"password" toml:"password" mapstructure:"password"`
+	PasswordFile       string                   `json:"password_file" toml:"password_file"`
+	MTLS               bool                     `json:"mtls" toml:"mtls" mapstructure:"mtls"`
+	SkipTLSVer         bool                     `json:"skip_tls_ver" toml:"skip_tls_ver" mapstructure:"skip_tls_ver"`
+	Retain             bool                     `json:"retain" toml:"retain" mapstructure:"retain"`
+	QoS                byte                     `json:"qos" toml:"qos" mapstructure:"qos"`
+	CAPath             string                   `json:"ca_path" toml:"ca_path" mapstructure:"ca_path"`
+	CertPath           string                   `json:"cert_path" toml:"cert_path" mapstructure:"cert_path"`
+	PrivKeyPath        string                   `json:"priv_key_path" toml:"priv_key_path" mapstructure:"priv_key_path"`
+	CA                 []byte                   `json:"-" toml:"-"`
+	Cert               tls.Certificate          `json:"-" toml:"-"`
+	ClientCert         string                   `json:"client_cert" toml:"client_cert"`
+	ClientKey          string                   `json:"client_key" toml:"client_key"`
+	CaCert             string                   `json:"ca_cert" toml:"ca_cert"`
+	TopicPrefix        string                   `json:"topic_prefix" toml:"topic_prefix"`
+	MaxInflight        int                      `json:"max_inflight" toml:"max_inflight"`
+	InflightFailFast   bool                     `json:"inflight_fail_fast" toml:"inflight_fail_fast"`
+	GzipThreshold      int                      `json:"gzip_threshold" toml:"gzip_threshold"`
+	Dedup              map[string]time.Duration `json:"dedup" toml:"dedup"`
+	Serialize          bool                     `json:"serialize" toml:"serialize"`
+	ThrottleBackoff    time.Duration            `json:"throttle_backoff" toml:"throttle_backoff"`
+	ThrottleMaxBackoff time.Duration            `json:"throttle_max_backoff" toml:"throttle_max_backoff"`
+	MaxPayload         int                      `json:"max_payload" toml:"max_payload"`
+	Overflow           string                   `json:"overflow" toml:"overflow"`
 }
 
+// Validate checks that topic prefix doesn't start or end with `/`
+// and that overflow policy is known.
+func (mc MQTTConfig) Validate() error {
+	if strings.HasPrefix(mc.TopicPrefix, "/") || strings.HasSuffix(mc.TopicPrefix, "/") {
+		return errors.New(fmt.Sprintf("invalid topic prefix %q", mc.TopicPrefix))
+	}
+	if mc.MaxPayload > 0 && !overflowPolicies[mc.Overflow] {
+		return errors.New(fmt.Sprintf("invalid overflow policy %q", mc.Overflow))
+	}
+	return nil
+}
+
+// HeartbeatConfig - if Durable is set heartbeats are consumed with JetStream
+// durable consumer of that name, so heartbeats published while NATS was
+// disconnected are replayed. Plain subscription is used if JetStream isn't available.
+// Subjects holds heartbeat subject patterns, service name is the token matched
+// by the first wildcard and service type the token after it.
+// Heartbeats are processed by Workers goroutines reading from a queue of
+// Buffer heartbeats, heartbeats which don't fit the queue are dropped.
+// Heartbeats are processed in subscription callback if Workers <= 0.
+// Tokens maps subject tokens following service name to `type`, `version`
+// or `-` to skip the token. Version takes all the remaining tokens.
+// Service status transitions within NotifyWindow are published together,
+// every transition is published on its own if NotifyWindow <= 0.
+// Offline detection paused without duration is resumed after Pause,
+// it stays paused until resumed if Pause <= 0.
 type HeartbeatConfig struct {
-	Interval time.Duration `toml:"interval"`
+	Interval     time.Duration `toml:"interval"`
+	Durable      string        `toml:"durable" json:"durable"`
+	Subjects     []string      `toml:"subjects" json:"subjects"`
+	Workers      int           `toml:"workers" json:"workers"`
+	Buffer       int           `toml:"buffer" json:"buffer"`
+	Tokens       []string      `toml:"tokens" json:"tokens"`
+	NotifyWindow time.Duration `toml:"notify_window" json:"notify_window"`
+	Pause        time.Duration `toml:"pause" json:"pause"`
 }
 
 type TerminalConfig struct {
 	SessionTimeout time.Duration `toml:"session_timeout" json:"session_timeout"`
 }
 
+// AuditConfig - audit log is kept in the agent store if Enabled is set.
+// Oldest entries are removed once there are more than MaxEntries entries.
+type AuditConfig struct {
+	Enabled    bool `toml:"enabled" json:"enabled"`
+	MaxEntries int  `toml:"max_entries" json:"max_entries"`
+}
+
+// ExecConfig - output of executed command is truncated
+// to MaxOutputSize bytes, truncation is disabled if MaxOutputSize <= 0.
+// Limit set per command with `maxbytes=` hint is capped to MaxOutputHardCap
+// bytes, disabled if MaxOutputHardCap <= 0.
+// TemplateEnv holds environment variables available in command templates.
+// Output is truncated to MaxLines lines, disabled if MaxLines <= 0.
+// Last HistorySize executed commands are kept in memory, disabled if HistorySize <= 0.
+// Commands are killed after Timeout, or after timeout mapped to the longest
+// matching command prefix in Timeouts. Timeout is disabled if <= 0.
+// If Shell is set commands are run with `sh -c` by default.
+// Allowlist holds binaries permitted to run, each optionally followed by
+// glob or `/regexp/` its arguments have to match, empty allows all.
+// AllowedWorkDirs holds directories, including their subdirectories,
+// which can be set as working directory with `cwd=` hint, empty allows any.
+// Full output of truncated responses is kept in OutputDir, disabled if empty.
+// Kept outputs older than OutputMaxAge are removed, as well as the oldest ones
+// once they exceed OutputMaxSize bytes in total, each limit disabled if <= 0.
+// Commands which don't write any output for IdleTimeout are killed,
+// disabled if IdleTimeout <= 0. Exec and control commands longer than
+// MaxCommandLength bytes are rejected, disabled if MaxCommandLength <= 0.
+// Commands which exit with non-zero status are run again after RetryDelay
+// up to DefaultRetries times. Output is converted from OutputCharset, IANA
+// name of the charset such as `latin1`, to UTF-8, passed through if empty.
+// Allowlist can be updated at runtime with commands signed with AllowlistKey,
+// updates are disabled if it's empty and saved if AllowlistPersist is set.
+// If OutputHash is set, responses carry SHA-256 of the complete output.
+type ExecConfig struct {
+	MaxOutputSize    int                      `toml:"max_output_size" json:"max_output_size"`
+	MaxOutputHardCap int                      `toml:"max_output_hard_cap" json:"max_output_hard_cap"`
+	Shell            bool                     `toml:"shell" json:"shell"`
+	Allowlist        []string                 `toml:"allowlist" json:"allowlist"`
+	AllowlistKey     string                   `toml:"allowlist_key" json:"allowlist_key"`
+	AllowlistPersist bool                     `toml:"allowlist_persist" json:"allowlist_persist"`
+	AllowedWorkDirs  []string                 `toml:"allowed_work_dirs" json:"allowed_work_dirs"`
+	MaxLines         int                      `toml:"max_lines" json:"max_lines"`
+	TemplateEnv      []string                 `toml:"template_env" json:"template_env"`
+	HistorySize      int                      `toml:"history_size" json:"history_size"`
+	Timeout          time.Duration            `toml:"timeout" json:"timeout"`
+	Timeouts         map[string]time.Duration `toml:"timeouts" json:"timeouts"`
+	OutputDir        string                   `toml:"output_dir" json:"output_dir"`
+	OutputMaxAge     time.Duration            `toml:"output_max_age" json:"output_max_age"`
+	OutputMaxSize    int64                    `toml:"output_max_size" json:"output_max_size"`
+	IdleTimeout      time.Duration            `toml:"idle_timeout" json:"idle_timeout"`
+	MaxCommandLength int                      `toml:"max_command_length" json:"max_command_length"`
+	DefaultRetries   int                      `toml:"default_retries" json:"default_retries"`
+	RetryDelay       time.Duration            `toml:"retry_delay" json:"retry_delay"`
+	OutputCharset    string                   `toml:"output_charset" json:"output_charset"`
+	DefaultNice      int                      `toml:"default_nice" json:"default_nice"`
+	OutputHash       bool                     `toml:"output_hash" json:"output_hash"`
+}
+
+// Validate checks that allowlist rules are well formed, default niceness
+// is within range and output charset is known.
+func (ec ExecConfig) Validate() error {
+	for _, rule := range ec.Allowlist {
+		if _, err := parseAllowRule(rule); err != nil {
+			return err
+		}
+	}
+	if err := validNice(ec.DefaultNice); err != nil {
+		return err
+	}
+	_, err := charset(ec.OutputCharset)
+	return err
+}
+
+// SafeModeConfig - command execution is disabled if Enabled is set.
+// State changed with `agent-safemode` command is persisted in File
+// and takes precedence over Enabled on restart.
+type SafeModeConfig struct {
+	Enabled bool   `toml:"enabled" json:"enabled"`
+	File    string `toml:"file" json:"file"`
+}
+
+// MaintenanceConfig - in maintenance mode up to QueueSize commands
+// are held and run once maintenance is turned off.
+type MaintenanceConfig struct {
+	QueueSize int `toml:"queue_size" json:"queue_size"`
+}
+
+// DeadManConfig - Command, comma separated binary and arguments, is run
+// once MQTT connection is lost for Timeout. Disabled if Command is empty
+// or Timeout <= 0.
+type DeadManConfig struct {
+	Timeout time.Duration `toml:"timeout" json:"timeout"`
+	Command string        `toml:"command" json:"command"`
+}
+
+// Enabled checks whether dead man switch is configured.
+func (dc DeadManConfig) Enabled() bool {
+	return dc.Timeout > 0 && strings.TrimSpace(dc.Command) != ""
+}
+
+// RebootConfig - `host-reboot` runs Command, comma separated binary and
+// arguments, after Delay, so that the acknowledgement is delivered first.
+// PreHook, if set, is run before the reboot is scheduled.
+type RebootConfig struct {
+	Delay   time.Duration `toml:"delay" json:"delay"`
+	Command string        `toml:"command" json:"command"`
+	PreHook string        `toml:"pre_hook" json:"pre_hook"`
+}
+
+// StartupCommand - Command, as sent in `exec` request, is run once
+// Delay after the agent started.
+type StartupCommand struct {
+	Delay   time.Duration `toml:"delay" json:"delay"`
+	Command string        `toml:"command" json:"command"`
+}
+
+// StartupConfig - Commands are run once per agent start, each after
+// its delay, and their results published to the control channel.
+type StartupConfig struct {
+	Commands []StartupCommand `toml:"commands" json:"commands"`
+}
+
+// Validate checks that startup commands are set and their delays aren't negative.
+func (sc StartupConfig) Validate() error {
+	for _, c := range sc.Commands {
+		if strings.TrimSpace(c.Command) == "" || c.Delay < 0 {
+			return errors.Wrap(errInvalidStartup, fmt.Errorf("%s after %s", c.Command, c.Delay))
+		}
+	}
+	return nil
+}
+
+// BeaconConfig - agent publishes its own heartbeat every Interval to NATS
+// Subject and to Topic subtopic of the control channel, so it is tracked
+// like the services it manages. Disabled if Interval <= 0 or both Subject
+// and Topic are empty.
+type BeaconConfig struct {
+	Interval time.Duration `toml:"interval" json:"interval"`
+	Subject  string        `toml:"subject" json:"subject"`
+	Topic    string        `toml:"topic" json:"topic"`
+}
+
+// Enabled checks whether agent heartbeat is configured.
+func (bc BeaconConfig) Enabled() bool {
+	return bc.Interval > 0 && (bc.Subject != "" || bc.Topic != "")
+}
+
+// ReadyConfig - once agent is ready, retained ready message is published
+// to Topic subtopic of the control channel, disabled if empty.
+type ReadyConfig struct {
+	Topic string `toml:"topic" json:"topic"`
+}
+
+// DeviceConfig - ID identifies physical device independently of channels,
+// it is available as `{{.DeviceID}}` in SenML base name and topic prefix.
+type DeviceConfig struct {
+	ID string `toml:"id" json:"id"`
+}
+
+// StoreConfig - Backend is one of `memory` or `file`.
+// Path is directory used by persistent backends.
+type StoreConfig struct {
+	Backend string `toml:"backend" json:"backend"`
+	Path    string `toml:"path" json:"path"`
+}
+
+// FeaturesConfig - Disabled holds names of disabled subsystems,
+// one of FeatureEdgex, FeatureExec, FeatureTerminal or FeatureHeartbeat.
+type FeaturesConfig struct {
+	Disabled []string `toml:"disabled" json:"disabled"`
+}
+
+// Enabled checks whether the subsystem is enabled.
+func (fc FeaturesConfig) Enabled(feature string) bool {
+	for _, f := range fc.Disabled {
+		if f == feature {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that only known subsystems are disabled.
+func (fc FeaturesConfig) Validate() error {
+	for _, f := range fc.Disabled {
+		switch f {
+		case FeatureEdgex, FeatureExec, FeatureTerminal, FeatureHeartbeat:
+		default:
+			return errors.New(fmt.Sprintf("unknown feature %q", f))
+		}
+	}
+	return nil
+}
+
+// SenMLConfig - BaseName is template applied to base name of
+// all responses, i.e. `{{.DeviceID}}:{{.UUID}}:`, uuid is used if empty.
+// NamePrefix is template, i.e. `{{.Type}}:{{.Command}}:`, prepended to
+// names of response records, records aren't prefixed if it is empty.
+// ErrorVerbosity is `full` or `minimal`, with minimal verbosity error
+// responses hold only generic message of the result code.
+type SenMLConfig struct {
+	BaseName       string `toml:"base_name" json:"base_name"`
+	NamePrefix     string `toml:"name_prefix" json:"name_prefix"`
+	ErrorVerbosity string `toml:"error_verbosity" json:"error_verbosity"`
+}
+
+// Validate checks that name prefix template is well formed
+// and that error verbosity is known.
+func (sc SenMLConfig) Validate() error {
+	if err := validVerbosity(sc.ErrorVerbosity); err != nil {
+		return err
+	}
+	if sc.NamePrefix == "" {
+		return nil
+	}
+	_, err := namePrefixTemplate(sc.NamePrefix)
+	return err
+}
+
+// GRPCConfig - gRPC server is disabled if Port is empty.
+type GRPCConfig struct {
+	Port string `toml:"port" json:"port"`
+}
+
+// SocketConfig - Unix socket server is disabled if Path is empty. Mode is
+// octal permissions of the socket file, i.e. `0600`, which restrict who
+// can send commands over the socket.
+type SocketConfig struct {
+	Path string `toml:"path" json:"path"`
+	Mode string `toml:"mode" json:"mode"`
+}
+
+// FileMode returns permissions of the socket file.
+func (sc SocketConfig) FileMode() (os.FileMode, error) {
+	m, err := strconv.ParseUint(sc.Mode, 8, 32)
+	if err != nil || m > 0777 {
+		return 0, errors.New(fmt.Sprintf("invalid socket mode %s", sc.Mode))
+	}
+	return os.FileMode(m), nil
+}
+
+// Validate checks that enabled socket server has valid mode.
+func (sc SocketConfig) Validate() error {
+	if sc.Path == "" {
+		return nil
+	}
+	_, err := sc.FileMode()
+	return err
+}
+
+// ArtifactsConfig - if Port is set, full output of truncated responses is
+// written to Root and served over HTTP, the response carries the output URL
+// built from URL, i.e. `http://192.168.0.10:9001`. Requests must carry Token.
+type ArtifactsConfig struct {
+	Port  string `toml:"port" json:"port"`
+	Root  string `toml:"root" json:"root"`
+	Token string `toml:"token" json:"token"`
+	URL   string `toml:"url" json:"url"`
+}
+
+// Enabled checks whether artifact server is configured.
+func (ac ArtifactsConfig) Enabled() bool {
+	return ac.Port != ""
+}
+
+// Validate checks that enabled artifact server has root and token.
+func (ac ArtifactsConfig) Validate() error {
+	if !ac.Enabled() {
+		return nil
+	}
+	if ac.Root == "" || ac.Token == "" {
+		return errors.New("artifact server requires root and token")
+	}
+	return nil
+}
+
+// ApplyConfig - after saving service config agent waits up to
+// Timeout for the service to acknowledge that the config is applied.
+// Agent doesn't wait for acknowledgement if Timeout <= 0. Reload maps
+// service name or type to the way the service is notified.
+type ApplyConfig struct {
+	Timeout time.Duration           `toml:"timeout" json:"timeout"`
+	Reload  map[string]ReloadConfig `toml:"reload" json:"reload"`
+}
+
+// ReloadConfig - Command, comma separated binary and arguments, i.e.
+// `systemctl,restart,{{.Service}}`, is run once service config is saved.
+// If Command is empty, Payload is published to NATS Subject, which is
+// `commands.<service>.config` if empty. All three are templates with
+// `.Service`, `.Type` and `.File` of the saved config.
+type ReloadConfig struct {
+	Subject string `toml:"subject" json:"subject"`
+	Payload string `toml:"payload" json:"payload"`
+	Command string `toml:"command" json:"command"`
+}
+
+// Validate checks that reload templates are well formed.
+func (ac ApplyConfig) Validate() error {
+	for _, rc := range ac.Reload {
+		for _, tmpl := range append([]string{rc.Subject, rc.Payload}, strings.Split(rc.Command, ",")...) {
+			if _, err := reloadTemplate(strings.TrimSpace(tmpl)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 type Config struct {
-	Server    ServerConfig    `toml:"server" json:"server"`
-	Terminal  TerminalConfig  `toml:"terminal" json:"terminal"`
-	Heartbeat HeartbeatConfig `toml:"heartbeat" json:"heartbeat"`
-	Channels  ChanConfig      `toml:"channels" json:"channels"`
-	Edgex     EdgexConfig     `toml:"edgex" json:"edgex"`
-	Log       LogConfig       `toml:"log" json:"log"`
-	MQTT      MQTTConfig      `toml:"mqtt" json:"mqtt"`
-	File      string
+	Server      ServerConfig      `toml:"server" json:"server"`
+	Terminal    TerminalConfig    `toml:"terminal" json:"terminal"`
+	Heartbeat   HeartbeatConfig   `toml:"heartbeat" json:"heartbeat"`
+	Channels    ChanConfig        `toml:"channels" json:"channels"`
+	Edgex       EdgexConfig       `toml:"edgex" json:"edgex"`
+	Log         LogConfig         `toml:"log" json:"log"`
+	MQTT        MQTTConfig        `toml:"mqtt" json:"mqtt"`
+	Audit       AuditConfig       `toml:"audit" json:"audit"`
+	Exec        ExecConfig        `toml:"exec" json:"exec"`
+	SafeMode    SafeModeConfig    `toml:"safe_mode" json:"safe_mode"`
+	Device      DeviceConfig      `toml:"device" json:"device"`
+	Store       StoreConfig       `toml:"store" json:"store"`
+	Features    FeaturesConfig    `toml:"features" json:"features"`
+	SenML       SenMLConfig       `toml:"senml" json:"senml"`
+	GRPC        GRPCConfig        `toml:"grpc" json:"grpc"`
+	Socket      SocketConfig      `toml:"socket" json:"socket"`
+	Apply       ApplyConfig       `toml:"apply" json:"apply"`
+	Nats        NatsConfig        `toml:"nats" json:"nats"`
+	DeadMan     DeadManConfig     `toml:"dead_man" json:"dead_man"`
+	Artifacts   ArtifactsConfig   `toml:"artifacts" json:"artifacts"`
+	Maintenance MaintenanceConfig `toml:"maintenance" json:"maintenance"`
+	Beacon      BeaconConfig      `toml:"beacon" json:"beacon"`
+	Ready       ReadyConfig       `toml:"ready" json:"ready"`
+	Reboot      RebootConfig      `toml:"reboot" json:"reboot"`
+	Startup     StartupConfig     `toml:"startup" json:"startup"`
+	File        string
+	secrets     map[string]secretRef
 }
 
 func NewConfig(sc ServerConfig, cc ChanConfig, ec EdgexConfig, lc LogConfig, mc MQTTConfig, hc HeartbeatConfig, tc TerminalConfig, file string) Config {
@@ -84,6 +592,7 @@ func NewConfig(sc ServerConfig, cc ChanConfig, ec EdgexConfig, lc LogConfig, mc
 
 // Save - store config in a file
 func SaveConfig(c Config) error {
+	unresolveSecrets(&c)
 	b, err := toml.Marshal(c)
 	if err != nil {
 		return errors.New(fmt.Sprintf("Error reading config file: %s", err))
@@ -94,6 +603,79 @@ func SaveConfig(c Config) error {
 	return nil
 }
 
+// Validate checks config sections which can be validated on their own.
+func (c *Config) Validate() error {
+	if err := c.Server.Validate(); err != nil {
+		return err
+	}
+	if err := c.Nats.Validate(); err != nil {
+		return err
+	}
+	if err := c.Channels.Validate(); err != nil {
+		return err
+	}
+	if err := c.MQTT.Validate(); err != nil {
+		return err
+	}
+	if err := c.Features.Validate(); err != nil {
+		return err
+	}
+	if err := c.Edgex.Validate(); err != nil {
+		return err
+	}
+	if err := c.Artifacts.Validate(); err != nil {
+		return err
+	}
+	if c.MQTT.MaxPayload > 0 && c.MQTT.Overflow == OverflowStore && !c.Artifacts.Enabled() {
+		return errors.New("store overflow policy requires artifact server")
+	}
+	if err := c.Exec.Validate(); err != nil {
+		return err
+	}
+	if err := c.Apply.Validate(); err != nil {
+		return err
+	}
+	if err := c.SenML.Validate(); err != nil {
+		return err
+	}
+	if err := encoder.ValidateBaseName(c.SenML.BaseName, c.Device.ID); err != nil {
+		return err
+	}
+	if err := c.Startup.Validate(); err != nil {
+		return err
+	}
+	if err := c.Socket.Validate(); err != nil {
+		return err
+	}
+	if c.Heartbeat.Interval <= 0 {
+		return errors.New(fmt.Sprintf("invalid heartbeat interval %s", c.Heartbeat.Interval))
+	}
+	return nil
+}
+
+// redacted is placeholder for secrets in exported config.
+const redacted = "<redacted>"
+
+// Redact returns copy of the config with secrets, such as MQTT
+// password, TLS keys and NATS credentials, replaced with a placeholder.
+func Redact(c Config) Config {
+	for _, v := range []*string{&c.MQTT.Password, &c.MQTT.ClientKey, &c.MQTT.PrivKeyPath, &c.Nats.Token, &c.Nats.ClientKey, &c.Nats.Credentials, &c.Artifacts.Token, &c.Exec.AllowlistKey} {
+		if *v != "" {
+			*v = redacted
+		}
+	}
+	return c
+}
+
+// ExportConfig returns config with secrets redacted as base64 encoded TOML.
+func ExportConfig(c Config) (string, error) {
+	b, err := toml.Marshal(Redact(c))
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Error marshaling toml: %s", err))
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
 // Read - retrieve config from a file
 func ReadConfig(file string) (Config, error) {
 	data, err := ioutil.ReadFile(file)
@@ -105,6 +687,9 @@ func ReadConfig(file string) (Config, error) {
 	if err := toml.Unmarshal(data, &c); err != nil {
 		return Config{}, errors.New(fmt.Sprintf("Error unmarshaling toml: %s", err))
 	}
+	if err := resolveSecrets(&c); err != nil {
+		return Config{}, err
+	}
 	return c, nil
 }
 
@@ -118,20 +703,42 @@ func (d *HeartbeatConfig) UnmarshalJSON(b []byte) error {
 	if !ok {
 		return errors.New("missing value")
 	}
-	switch value := interval.(type) {
-	case float64:
-		d.Interval = time.Duration(value)
-		return nil
-	case string:
-		var err error
-		d.Interval, err = time.ParseDuration(value)
-		if err != nil {
+	if durable, ok := v["durable"].(string); ok {
+		d.Durable = durable
+	}
+	if subjects, ok := v["subjects"].([]interface{}); ok {
+		for _, s := range subjects {
+			if s, ok := s.(string); ok {
+				d.Subjects = append(d.Subjects, s)
+			}
+		}
+	}
+	if tokens, ok := v["tokens"].([]interface{}); ok {
+		for _, t := range tokens {
+			if t, ok := t.(string); ok {
+				d.Tokens = append(d.Tokens, t)
+			}
+		}
+	}
+	if workers, ok := v["workers"].(float64); ok {
+		d.Workers = int(workers)
+	}
+	if buffer, ok := v["buffer"].(float64); ok {
+		d.Buffer = int(buffer)
+	}
+	var err error
+	if window, ok := v["notify_window"]; ok {
+		if d.NotifyWindow, err = parseDuration(window); err != nil {
 			return err
 		}
-		return nil
-	default:
-		return errors.New("invalid duration")
 	}
+	if pause, ok := v["pause"]; ok {
+		if d.Pause, err = parseDuration(pause); err != nil {
+			return err
+		}
+	}
+	d.Interval, err = parseDuration(interval)
+	return err
 }
 
 // UnmarshalJSON parses the duration from JSON
@@ -144,18 +751,244 @@ func (d *TerminalConfig) UnmarshalJSON(b []byte) error {
 	if !ok {
 		return errors.New("missing value")
 	}
-	switch value := session_timeout.(type) {
-	case float64:
-		d.SessionTimeout = time.Duration(value)
+	var err error
+	d.SessionTimeout, err = parseDuration(session_timeout)
+	return err
+}
+
+// UnmarshalJSON parses the duration from JSON
+func (d *ApplyConfig) UnmarshalJSON(b []byte) error {
+	type applyConfig ApplyConfig
+	v := struct {
+		*applyConfig
+		Timeout interface{} `json:"timeout"`
+	}{
+		applyConfig: (*applyConfig)(d),
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Timeout == nil {
 		return nil
-	case string:
-		var err error
-		d.SessionTimeout, err = time.ParseDuration(value)
+	}
+	var err error
+	d.Timeout, err = parseDuration(v.Timeout)
+	return err
+}
+
+// UnmarshalJSON parses the duration from JSON
+func (d *DeadManConfig) UnmarshalJSON(b []byte) error {
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if command, ok := v["command"].(string); ok {
+		d.Command = command
+	}
+	timeout, ok := v["timeout"]
+	if !ok {
+		return nil
+	}
+	var err error
+	d.Timeout, err = parseDuration(timeout)
+	return err
+}
+
+// UnmarshalJSON parses the dedup windows and throttle backoff from JSON
+func (mc *MQTTConfig) UnmarshalJSON(b []byte) error {
+	type mqttConfig MQTTConfig
+	v := struct {
+		*mqttConfig
+		Dedup              map[string]interface{} `json:"dedup"`
+		ThrottleBackoff    interface{}            `json:"throttle_backoff"`
+		ThrottleMaxBackoff interface{}            `json:"throttle_max_backoff"`
+	}{
+		mqttConfig: (*mqttConfig)(mc),
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	if v.ThrottleBackoff != nil {
+		if mc.ThrottleBackoff, err = parseDuration(v.ThrottleBackoff); err != nil {
+			return err
+		}
+	}
+	if v.ThrottleMaxBackoff != nil {
+		if mc.ThrottleMaxBackoff, err = parseDuration(v.ThrottleMaxBackoff); err != nil {
+			return err
+		}
+	}
+	for topic, window := range v.Dedup {
+		d, err := parseDuration(window)
 		if err != nil {
 			return err
 		}
+		if mc.Dedup == nil {
+			mc.Dedup = map[string]time.Duration{}
+		}
+		mc.Dedup[topic] = d
+	}
+	return nil
+}
+
+// UnmarshalJSON parses the stream and job durations from JSON
+func (ec *EdgexConfig) UnmarshalJSON(b []byte) error {
+	type edgexConfig EdgexConfig
+	v := struct {
+		*edgexConfig
+		StreamInterval    interface{} `json:"stream_interval"`
+		StreamMaxDuration interface{} `json:"stream_max_duration"`
+		JobPollInterval   interface{} `json:"job_poll_interval"`
+		JobTimeout        interface{} `json:"job_timeout"`
+	}{
+		edgexConfig: (*edgexConfig)(ec),
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	var err error
+	if v.StreamInterval != nil {
+		if ec.StreamInterval, err = parseDuration(v.StreamInterval); err != nil {
+			return err
+		}
+	}
+	if v.StreamMaxDuration != nil {
+		if ec.StreamMaxDuration, err = parseDuration(v.StreamMaxDuration); err != nil {
+			return err
+		}
+	}
+	if v.JobPollInterval != nil {
+		if ec.JobPollInterval, err = parseDuration(v.JobPollInterval); err != nil {
+			return err
+		}
+	}
+	if v.JobTimeout != nil {
+		if ec.JobTimeout, err = parseDuration(v.JobTimeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalJSON parses the delay from JSON
+func (rc *RebootConfig) UnmarshalJSON(b []byte) error {
+	type rebootConfig RebootConfig
+	v := struct {
+		*rebootConfig
+		Delay interface{} `json:"delay"`
+	}{
+		rebootConfig: (*rebootConfig)(rc),
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Delay == nil {
+		return nil
+	}
+	var err error
+	rc.Delay, err = parseDuration(v.Delay)
+	return err
+}
+
+// UnmarshalJSON parses the delay from JSON
+func (sc *StartupCommand) UnmarshalJSON(b []byte) error {
+	type startupCommand StartupCommand
+	v := struct {
+		*startupCommand
+		Delay interface{} `json:"delay"`
+	}{
+		startupCommand: (*startupCommand)(sc),
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Delay == nil {
+		return nil
+	}
+	var err error
+	sc.Delay, err = parseDuration(v.Delay)
+	return err
+}
+
+// UnmarshalJSON parses the interval from JSON
+func (bc *BeaconConfig) UnmarshalJSON(b []byte) error {
+	type beaconConfig BeaconConfig
+	v := struct {
+		*beaconConfig
+		Interval interface{} `json:"interval"`
+	}{
+		beaconConfig: (*beaconConfig)(bc),
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Interval == nil {
 		return nil
+	}
+	var err error
+	bc.Interval, err = parseDuration(v.Interval)
+	return err
+}
+
+// UnmarshalJSON parses the timeouts from JSON
+func (d *ExecConfig) UnmarshalJSON(b []byte) error {
+	type execConfig ExecConfig
+	v := struct {
+		*execConfig
+		Timeout      interface{}            `json:"timeout"`
+		Timeouts     map[string]interface{} `json:"timeouts"`
+		OutputMaxAge interface{}            `json:"output_max_age"`
+		IdleTimeout  interface{}            `json:"idle_timeout"`
+		RetryDelay   interface{}            `json:"retry_delay"`
+	}{
+		execConfig: (*execConfig)(d),
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	var err error
+	if v.Timeout != nil {
+		if d.Timeout, err = parseDuration(v.Timeout); err != nil {
+			return err
+		}
+	}
+	if v.OutputMaxAge != nil {
+		if d.OutputMaxAge, err = parseDuration(v.OutputMaxAge); err != nil {
+			return err
+		}
+	}
+	if v.IdleTimeout != nil {
+		if d.IdleTimeout, err = parseDuration(v.IdleTimeout); err != nil {
+			return err
+		}
+	}
+	if v.RetryDelay != nil {
+		if d.RetryDelay, err = parseDuration(v.RetryDelay); err != nil {
+			return err
+		}
+	}
+	for prefix, timeout := range v.Timeouts {
+		if d.Timeouts == nil {
+			d.Timeouts = map[string]time.Duration{}
+		}
+		if d.Timeouts[prefix], err = parseDuration(timeout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseDuration parses duration given either as number of nanoseconds
+// or as duration string, i.e. "10s".
+func parseDuration(v interface{}) (time.Duration, error) {
+	switch value := v.(type) {
+	case float64:
+		return time.Duration(value), nil
+	case string:
+		return time.ParseDuration(value)
 	default:
-		return errors.New("invalid duration")
+		return 0, errors.New("invalid duration")
 	}
 }
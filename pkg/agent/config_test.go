@@ -0,0 +1,197 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportConfig(t *testing.T) {
+	c := Config{
+		MQTT: MQTTConfig{
+			URL:         "localhost:1883",
+			Username:    "thing",
+			Password:    "secret-password",
+			ClientKey:   "secret-key",
+			PrivKeyPath: "/etc/agent/thing.key",
+		},
+		Nats: NatsConfig{
+			Credentials: "/etc/agent/nats.creds",
+			ClientCert:  "/etc/agent/nats.crt",
+			ClientKey:   "/etc/agent/nats.key",
+		},
+	}
+
+	res, err := ExportConfig(c)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error exporting config: %s", err))
+	b, err := base64.StdEncoding.DecodeString(res)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error decoding exported config: %s", err))
+	exported := string(b)
+
+	for _, secret := range []string{"secret-password", "secret-key", "/etc/agent/thing.key", "/etc/agent/nats.creds", "/etc/agent/nats.key"} {
+		assert.False(t, strings.Contains(exported, secret), fmt.Sprintf("exported config contains secret %s", secret))
+	}
+	assert.True(t, strings.Contains(exported, "localhost:1883"), "exported config doesn't contain MQTT URL")
+	assert.True(t, strings.Contains(exported, "/etc/agent/nats.crt"), "exported config doesn't contain NATS client certificate")
+	assert.Equal(t, redacted, Redact(c).Nats.ClientKey, "NATS client key is not redacted")
+	assert.Equal(t, "secret-password", c.MQTT.Password, "exporting config changed the original config")
+}
+
+func TestAddConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.toml")
+	current := Config{
+		Channels:  ChanConfig{Control: "ctrl"},
+		Heartbeat: HeartbeatConfig{Interval: time.Second},
+		File:      file,
+	}
+	a := &agent{config: &current}
+
+	invalid := current
+	invalid.Channels.Control = ""
+	err = a.AddConfig(invalid)
+	assert.True(t, errors.Contains(err, errInvalidConfig), fmt.Sprintf("expected error %s got %s", errInvalidConfig, err))
+	assert.Equal(t, "ctrl", a.Config().Channels.Control, "invalid config replaced the running one")
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err), "invalid config was saved")
+
+	valid := current
+	valid.Channels.Control = "ctrl-2"
+	valid.File = ""
+	err = a.AddConfig(valid)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error adding config: %s", err))
+	assert.Equal(t, "ctrl-2", a.Config().Channels.Control, "running config wasn't replaced")
+	saved, err := ReadConfig(file)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error reading saved config: %s", err))
+	assert.Equal(t, "ctrl-2", saved.Channels.Control, "config wasn't saved")
+}
+
+func TestNatsConfigValidate(t *testing.T) {
+	cases := []struct {
+		desc   string
+		server ServerConfig
+		nats   NatsConfig
+		valid  bool
+	}{
+		{"default URL", ServerConfig{}, NatsConfig{}, true},
+		{"URL without scheme", ServerConfig{NatsURL: "localhost:4222"}, NatsConfig{}, true},
+		{"TLS URL", ServerConfig{NatsURL: "tls://nats.example.com:4222"}, NatsConfig{}, true},
+		{"list of URLs", ServerConfig{NatsURL: "nats://nats1:4222, nats://nats2:4222"}, NatsConfig{}, true},
+		{"unsupported scheme", ServerConfig{NatsURL: "http://localhost:4222"}, NatsConfig{}, false},
+		{"URL without host", ServerConfig{NatsURL: "nats://:4222"}, NatsConfig{}, false},
+		{"client certificate with key", ServerConfig{}, NatsConfig{ClientCert: "cert.pem", ClientKey: "key.pem"}, true},
+		{"client certificate without key", ServerConfig{}, NatsConfig{ClientCert: "cert.pem"}, false},
+	}
+
+	for _, tc := range cases {
+		err := tc.server.Validate()
+		if err == nil {
+			err = tc.nats.Validate()
+		}
+		assert.Equal(t, tc.valid, err == nil, fmt.Sprintf("%s: unexpected validation result %s", tc.desc, err))
+	}
+}
+
+func TestReadConfigSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	secretFile := filepath.Join(dir, "mqtt")
+	if err := ioutil.WriteFile(secretFile, []byte("file-password\n"), 0600); err != nil {
+		t.Fatalf("failed to write secret file: %s", err)
+	}
+	os.Setenv("MF_AGENT_TEST_NATS_TOKEN", "env-token")
+	defer os.Unsetenv("MF_AGENT_TEST_NATS_TOKEN")
+
+	cases := []struct {
+		desc     string
+		config   string
+		password string
+		token    string
+		err      error
+	}{
+		{"plain values", "[mqtt]\npassword = \"plain\"\n[nats]\ntoken = \"plain-token\"\n", "plain", "plain-token", nil},
+		{"env reference", "[nats]\ntoken = \"${env:MF_AGENT_TEST_NATS_TOKEN}\"\n", "", "env-token", nil},
+		{"file reference", fmt.Sprintf("[mqtt]\npassword = \"${file:%s}\"\n", secretFile), "file-password", "", nil},
+		{"password file", fmt.Sprintf("[mqtt]\npassword_file = %q\n", secretFile), "file-password", "", nil},
+		{"missing env", "[nats]\ntoken = \"${env:MF_AGENT_TEST_MISSING}\"\n", "", "", errResolveSecret},
+		{"missing file", fmt.Sprintf("[mqtt]\npassword_file = %q\n", filepath.Join(dir, "missing")), "", "", errResolveSecret},
+		{"password and password file", fmt.Sprintf("[mqtt]\npassword = \"plain\"\npassword_file = %q\n", secretFile), "", "", errResolveSecret},
+	}
+
+	for _, tc := range cases {
+		file := filepath.Join(dir, "config.toml")
+		if err := ioutil.WriteFile(file, []byte(tc.config), 0644); err != nil {
+			t.Fatalf("failed to write config: %s", err)
+		}
+		c, err := ReadConfig(file)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, tc.password, c.MQTT.Password, fmt.Sprintf("%s: expected password %s got %s", tc.desc, tc.password, c.MQTT.Password))
+		assert.Equal(t, tc.token, c.Nats.Token, fmt.Sprintf("%s: expected token %s got %s", tc.desc, tc.token, c.Nats.Token))
+
+		// Saved config holds references instead of the secrets.
+		c.File = file
+		err = SaveConfig(c)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error saving config: %s", tc.desc, err))
+		b, err := ioutil.ReadFile(file)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error reading saved config: %s", tc.desc, err))
+		for _, secret := range []string{"file-password", "env-token"} {
+			assert.False(t, strings.Contains(string(b), secret), fmt.Sprintf("%s: saved config contains secret %s", tc.desc, secret))
+		}
+		saved, err := ReadConfig(file)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error reading saved config: %s", tc.desc, err))
+		assert.Equal(t, c.MQTT.Password, saved.MQTT.Password, fmt.Sprintf("%s: expected saved password %s got %s", tc.desc, c.MQTT.Password, saved.MQTT.Password))
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "init")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.toml")
+	c := Config{
+		Channels:  ChanConfig{Control: "ctrl"},
+		Heartbeat: HeartbeatConfig{Interval: 10 * time.Second},
+		MQTT:      MQTTConfig{URL: "localhost:1883", QoS: 1},
+		File:      file,
+	}
+	err = InitConfig(c)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error generating config: %s", err))
+
+	b, err := ioutil.ReadFile(file)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error reading generated config: %s", err))
+	for _, comment := range []string{templateHeader, "# " + sectionComments["mqtt"] + "\n[mqtt]"} {
+		assert.True(t, strings.Contains(string(b), comment), fmt.Sprintf("generated config doesn't contain comment %q", comment))
+	}
+
+	generated, err := ReadConfig(file)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error parsing generated config: %s", err))
+	assert.Equal(t, c.Channels, generated.Channels, fmt.Sprintf("expected channels %v got %v", c.Channels, generated.Channels))
+	assert.Equal(t, c.Heartbeat.Interval, generated.Heartbeat.Interval, fmt.Sprintf("expected heartbeat interval %s got %s", c.Heartbeat.Interval, generated.Heartbeat.Interval))
+	assert.Equal(t, c.MQTT.QoS, generated.MQTT.QoS, fmt.Sprintf("expected QoS %d got %d", c.MQTT.QoS, generated.MQTT.QoS))
+}
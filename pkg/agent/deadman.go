@@ -0,0 +1,82 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/mainflux/mainflux/logger"
+)
+
+// deadManRunTimeout limits how long dead man command runs.
+const deadManRunTimeout = time.Minute
+
+// DeadMan runs configured local command once MQTT connection is lost for
+// longer than the timeout, i.e. to put actuators into a safe state. Timer
+// is started when connection is lost and stopped when it is restored.
+type DeadMan struct {
+	cfg    DeadManConfig
+	timer  *time.Timer
+	logger log.Logger
+	mu     sync.Mutex
+}
+
+// NewDeadMan returns dead man switch, its Notify method is meant to be
+// passed to NewStateNotifier as observer.
+func NewDeadMan(cfg DeadManConfig, logger log.Logger) *DeadMan {
+	return &DeadMan{
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Notify starts the timer when MQTT connection is lost and stops it
+// when connection is restored. Other subsystems are ignored.
+func (dm *DeadMan) Notify(subsystem, state string) {
+	if subsystem != SubsystemMQTT || !dm.cfg.Enabled() {
+		return
+	}
+
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
+	switch state {
+	case StateLost:
+		if dm.timer == nil {
+			dm.timer = time.AfterFunc(dm.cfg.Timeout, dm.fire)
+		}
+	case StateConnected:
+		if dm.timer != nil {
+			dm.timer.Stop()
+			dm.timer = nil
+		}
+	}
+}
+
+func (dm *DeadMan) fire() {
+	dm.logger.Warn(fmt.Sprintf("MQTT connection lost for %s, running dead man command", dm.cfg.Timeout))
+	out, err := dm.run()
+	if err != nil {
+		dm.logger.Error(fmt.Sprintf("Dead man command failed: %s %s", err, out))
+		return
+	}
+	dm.logger.Info(fmt.Sprintf("Dead man command finished: %s", out))
+}
+
+// run runs comma separated binary and arguments of the dead man command.
+func (dm *DeadMan) run() (string, error) {
+	args := strings.Split(dm.cfg.Command, ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), deadManRunTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,65 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadMan(t *testing.T) {
+	dir, err := ioutil.TempDir("", "deadman")
+	if err != nil {
+		t.Fatalf("unexpected error creating dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+
+	cases := []struct {
+		desc      string
+		subsystem string
+		states    []string
+		fired     bool
+	}{
+		{
+			desc:      "connection lost for longer than timeout",
+			subsystem: SubsystemMQTT,
+			states:    []string{StateLost},
+			fired:     true,
+		},
+		{
+			desc:      "connection restored before timeout",
+			subsystem: SubsystemMQTT,
+			states:    []string{StateLost, StateConnected},
+			fired:     false,
+		},
+		{
+			desc:      "other subsystem lost",
+			subsystem: SubsystemNATS,
+			states:    []string{StateLost},
+			fired:     false,
+		},
+	}
+
+	for i, tc := range cases {
+		file := filepath.Join(dir, fmt.Sprintf("fired%d", i))
+		dm := NewDeadMan(DeadManConfig{Timeout: 50 * time.Millisecond, Command: "touch," + file}, logger)
+		for _, s := range tc.states {
+			dm.Notify(tc.subsystem, s)
+		}
+		time.Sleep(200 * time.Millisecond)
+		_, err := os.Stat(file)
+		assert.Equal(t, tc.fired, err == nil, fmt.Sprintf("%s: expected command run %t", tc.desc, tc.fired))
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"time"
+
+	"github.com/mainflux/senml"
+)
+
+// sentRecords is digest of records last published to a topic.
+type sentRecords struct {
+	sum  [sha256.Size]byte
+	time time.Time
+}
+
+// recordsSum returns digest of the records content, their base name and
+// times are left out, so that responses to repeated commands compare equal.
+func recordsSum(records []senml.Record) ([sha256.Size]byte, bool) {
+	stripped := make([]senml.Record, len(records))
+	for i, r := range records {
+		r.BaseName, r.BaseTime, r.Time = "", 0, 0
+		stripped[i] = r
+	}
+	b, err := json.Marshal(stripped)
+	if err != nil {
+		return [sha256.Size]byte{}, false
+	}
+	return sha256.Sum256(b), true
+}
+
+// duplicate checks whether the records are the same as the ones published
+// to the topic within its dedup window. Topic is `control` for responses
+// and subtopic name otherwise, dedup is disabled for topics without window.
+func (a *agent) duplicate(topic string, records []senml.Record) bool {
+	window := a.cfg().MQTT.Dedup[topic]
+	if window <= 0 {
+		return false
+	}
+	sum, ok := recordsSum(records)
+	if !ok {
+		return false
+	}
+	a.sentMu.Lock()
+	defer a.sentMu.Unlock()
+	last, ok := a.sent[topic]
+	return ok && last.sum == sum && a.clk().Now().Sub(last.time) < window
+}
+
+// markSent remembers the records as the last ones published to the topic.
+func (a *agent) markSent(topic string, records []senml.Record) {
+	if a.cfg().MQTT.Dedup[topic] <= 0 {
+		return
+	}
+	sum, ok := recordsSum(records)
+	if !ok {
+		return
+	}
+	a.sentMu.Lock()
+	defer a.sentMu.Unlock()
+	if a.sent == nil {
+		a.sent = map[string]sentRecords{}
+	}
+	a.sent[topic] = sentRecords{sum: sum, time: a.clk().Now()}
+}
@@ -0,0 +1,54 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuplicate(t *testing.T) {
+	out, other := "up 3 days", "up 4 days"
+	sent := []senml.Record{{BaseName: "1", Name: "uptime", StringValue: &out, Time: 1588091188}}
+
+	cases := []struct {
+		desc    string
+		topic   string
+		records []senml.Record
+		after   time.Duration
+		dup     bool
+	}{
+		{"same records", control, []senml.Record{{BaseName: "2", Name: "uptime", StringValue: &out, Time: 1588091190}}, time.Second, true},
+		{"different value", control, []senml.Record{{Name: "uptime", StringValue: &other}}, time.Second, false},
+		{"window passed", control, []senml.Record{{Name: "uptime", StringValue: &out}}, time.Minute, false},
+		{"topic without window", servicesTopic, []senml.Record{{Name: "uptime", StringValue: &out}}, time.Second, false},
+	}
+
+	for _, tc := range cases {
+		clock := mocks.NewClock(time.Unix(1588091188, 0))
+		a := &agent{
+			config: &Config{MQTT: MQTTConfig{Dedup: map[string]time.Duration{control: time.Minute}}},
+			clock:  clock,
+		}
+		a.markSent(control, sent)
+		a.markSent(servicesTopic, sent)
+		clock.Advance(tc.after)
+		dup := a.duplicate(tc.topic, tc.records)
+		assert.Equal(t, tc.dup, dup, fmt.Sprintf("%s: expected duplicate %t got %t", tc.desc, tc.dup, dup))
+	}
+}
+
+func TestMQTTConfigDedupJSON(t *testing.T) {
+	var mc MQTTConfig
+	err := json.Unmarshal([]byte(`{"url":"localhost:1883","dedup":{"control":"1m","services":"10s"}}`), &mc)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "localhost:1883", mc.URL, fmt.Sprintf("expected url localhost:1883 got %s", mc.URL))
+	assert.Equal(t, map[string]time.Duration{control: time.Minute, servicesTopic: 10 * time.Second}, mc.Dedup, fmt.Sprintf("unexpected dedup windows %v", mc.Dedup))
+}
@@ -0,0 +1,230 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mainflux/agent/pkg/edgex"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	up   = "up"
+	down = "down"
+
+	edgexStart   = "edgex-start"
+	edgexStop    = "edgex-stop"
+	edgexRestart = "edgex-restart"
+	edgexLogs    = "edgex-logs"
+	edgexMetrics = "edgex-metrics"
+)
+
+// errEdgexMetricNotFound indicates that none of requested metrics is in EdgeX response
+var errEdgexMetricNotFound = errors.New("edgex metric not found")
+
+// edgexActions maps convenience commands to EdgeX operation actions.
+var edgexActions = map[string]string{
+	edgexStart:   "start",
+	edgexStop:    "stop",
+	edgexRestart: "restart",
+}
+
+// edgexServiceName matches EdgeX service keys, i.e. `edgex-core-data`.
+var edgexServiceName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// edgexOperationAllowed checks that action of EdgeX operation arguments
+// is allowed by config.
+func (a *agent) edgexOperationAllowed(op []string) error {
+	if len(op) == 0 {
+		return ErrInvalidCommand
+	}
+	if !a.cfg().Edgex.Allowed(op[0]) {
+		return errors.Wrap(errEdgexOperationNotAllowed, fmt.Errorf("%s", op[0]))
+	}
+	return nil
+}
+
+// edgexOperation builds EdgeX operation arguments, action followed by
+// services, for convenience command. Service names are validated.
+func edgexOperation(cmd string, services []string) ([]string, error) {
+	action, ok := edgexActions[cmd]
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+	for _, svc := range services {
+		if !edgexServiceName.MatchString(svc) {
+			return nil, ErrInvalidCommand
+		}
+	}
+	return append([]string{action}, services...), nil
+}
+
+// edgexInstance returns client of EdgeX instance the command targets. If the
+// first argument names an instance, its client is returned and the name is
+// removed from arguments, default instance is used otherwise.
+func (a *agent) edgexInstance(cmdArgs []string) (edgex.Client, []string) {
+	if len(cmdArgs) > 1 {
+		if ec, ok := a.edgexInsts[cmdArgs[1]]; ok {
+			return ec, append([]string{cmdArgs[0]}, cmdArgs[2:]...)
+		}
+	}
+	return a.edgexClient, cmdArgs
+}
+
+// edgexHealthcheck pings every EdgeX service and returns record
+// with up or down status per service. Failures are not fatal.
+func (a *agent) edgexHealthcheck(ec edgex.Client) []senml.Record {
+	records := []senml.Record{}
+	for _, svc := range edgex.Services {
+		st := up
+		if _, err := ec.PingService(svc); err != nil {
+			a.logger.Warn(fmt.Sprintf("EdgeX service %s is down: %s", svc, err))
+			st = down
+		}
+		records = append(records, senml.Record{
+			Name:        svc,
+			StringValue: &st,
+		})
+	}
+	return records
+}
+
+// edgexLogsArgs parses `edgex-logs` arguments `<service>,<lines>`, lines
+// are capped to max if max > 0.
+func edgexLogsArgs(args []string, max int) (string, int, error) {
+	if len(args) < 2 || !edgexServiceName.MatchString(args[0]) {
+		return "", 0, ErrInvalidCommand
+	}
+	lines, err := strconv.Atoi(args[1])
+	if err != nil || lines <= 0 {
+		return "", 0, ErrInvalidCommand
+	}
+	if max > 0 && lines > max {
+		lines = max
+	}
+	return args[0], lines, nil
+}
+
+// edgexLogRecords converts EdgeX support logging response, which is JSON
+// array of log entries, into one record per entry named by the command and
+// service, i.e. `edgex-logs:edgex-core-data`. Record value is log level
+// followed by the message. Returns false if response isn't a JSON array.
+func edgexLogRecords(service, resp string) ([]senml.Record, bool) {
+	var entries []struct {
+		LogLevel string `json:"logLevel"`
+		Message  string `json:"message"`
+		Created  int64  `json:"created"`
+	}
+	if err := json.Unmarshal([]byte(resp), &entries); err != nil {
+		return nil, false
+	}
+	name := edgexLogs + ":" + service
+	records := []senml.Record{}
+	for _, e := range entries {
+		msg := strings.TrimSpace(e.LogLevel + " " + e.Message)
+		records = append(records, senml.Record{
+			Name:        name,
+			Time:        float64(e.Created) / 1000,
+			StringValue: &msg,
+		})
+	}
+	return records, true
+}
+
+// edgexMetricsArgs parses `edgex-metrics` arguments, each either service or
+// `service:metric`, into services to fetch and requested metrics per service.
+func edgexMetricsArgs(args []string) ([]string, map[string][]string, error) {
+	services := []string{}
+	filters := map[string][]string{}
+	for _, arg := range args {
+		p := strings.SplitN(arg, ":", 2)
+		svc := p[0]
+		if !edgexServiceName.MatchString(svc) {
+			return nil, nil, ErrInvalidCommand
+		}
+		if _, ok := filters[svc]; !ok {
+			services = append(services, svc)
+			filters[svc] = []string{}
+		}
+		if len(p) == 2 {
+			if p[1] == "" {
+				return nil, nil, ErrInvalidCommand
+			}
+			filters[svc] = append(filters[svc], p[1])
+		}
+	}
+	return services, filters, nil
+}
+
+// filterMetrics keeps all records of services without requested metrics and
+// records of requested metrics otherwise, records of other services are dropped. Metric matches the end of the path
+// to the field, i.e. `CpuBusyAvg` or `Memory:Alloc`.
+func filterMetrics(records []senml.Record, filters map[string][]string) []senml.Record {
+	filtered := []senml.Record{}
+	for _, r := range records {
+		p := strings.SplitN(strings.TrimPrefix(r.Name, edgexMetrics+":"), ":", 2)
+		metrics, ok := filters[p[0]]
+		if !ok {
+			continue
+		}
+		if len(metrics) == 0 {
+			filtered = append(filtered, r)
+			continue
+		}
+		if len(p) < 2 {
+			continue
+		}
+		for _, m := range metrics {
+			if p[1] == m || strings.HasSuffix(p[1], ":"+m) {
+				filtered = append(filtered, r)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// edgexRecords breaks EdgeX metrics or config response, which is JSON object
+// keyed by service name, into one record per field. Record name is the path
+// to the field prefixed with the command, i.e. `edgex-metrics:edgex-core-data:Metrics:CpuBusyAvg`.
+// Returns false if response isn't a JSON object.
+func edgexRecords(cmd, resp string) ([]senml.Record, bool) {
+	var v map[string]interface{}
+	if err := json.Unmarshal([]byte(resp), &v); err != nil || len(v) == 0 {
+		return nil, false
+	}
+	return flatten(cmd, v, []senml.Record{}), true
+}
+
+func flatten(name string, v interface{}, records []senml.Record) []senml.Record {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			records = flatten(fmt.Sprintf("%s:%s", name, k), val[k], records)
+		}
+	case []interface{}:
+		for i, e := range val {
+			records = flatten(fmt.Sprintf("%s:%s", name, strconv.Itoa(i)), e, records)
+		}
+	case float64:
+		records = append(records, senml.Record{Name: name, Value: &val})
+	case bool:
+		records = append(records, senml.Record{Name: name, BoolValue: &val})
+	case string:
+		records = append(records, senml.Record{Name: name, StringValue: &val})
+	}
+	return records
+}
@@ -0,0 +1,230 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/edgex"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEdgexRecords(t *testing.T) {
+	cases := []struct {
+		desc  string
+		resp  string
+		names []string
+		ok    bool
+	}{
+		{
+			desc:  "metrics response",
+			resp:  `{"edgex-core-data":{"Success":true,"Metrics":{"CpuBusyAvg":2.5,"Memory":{"Alloc":1024}}}}`,
+			names: []string{"m:edgex-core-data:Metrics:CpuBusyAvg", "m:edgex-core-data:Metrics:Memory:Alloc", "m:edgex-core-data:Success"},
+			ok:    true,
+		},
+		{
+			desc:  "config response with list",
+			resp:  `{"edgex-core-data":{"Config":{"Hosts":["a","b"]}}}`,
+			names: []string{"m:edgex-core-data:Config:Hosts:0", "m:edgex-core-data:Config:Hosts:1"},
+			ok:    true,
+		},
+		{
+			desc: "unrecognized response",
+			resp: `not json`,
+			ok:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		records, ok := edgexRecords("m", tc.resp)
+		assert.Equal(t, tc.ok, ok, fmt.Sprintf("%s: expected %t got %t", tc.desc, tc.ok, ok))
+		names := []string{}
+		for _, r := range records {
+			names = append(names, r.Name)
+		}
+		if !tc.ok {
+			continue
+		}
+		assert.Equal(t, tc.names, names, fmt.Sprintf("%s: expected names %v got %v", tc.desc, tc.names, names))
+	}
+}
+
+func TestEdgexOperation(t *testing.T) {
+	cases := []struct {
+		desc     string
+		cmd      string
+		services []string
+		op       []string
+		err      error
+	}{
+		{"start service", edgexStart, []string{"edgex-core-data"}, []string{"start", "edgex-core-data"}, nil},
+		{"stop services", edgexStop, []string{"edgex-core-data", "edgex-core-command"}, []string{"stop", "edgex-core-data", "edgex-core-command"}, nil},
+		{"restart service", edgexRestart, []string{"edgex-core-metadata"}, []string{"restart", "edgex-core-metadata"}, nil},
+		{"invalid service name", edgexStart, []string{"edgex core/data"}, nil, ErrInvalidCommand},
+		{"empty service name", edgexStop, []string{""}, nil, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		op, err := edgexOperation(tc.cmd, tc.services)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.op, op, fmt.Sprintf("%s: expected operation %v got %v", tc.desc, tc.op, op))
+	}
+}
+
+func TestEdgexOperationAllowed(t *testing.T) {
+	cases := []struct {
+		desc    string
+		allowed []string
+		op      []string
+		err     error
+	}{
+		{"all allowed by default", nil, []string{"stop", "edgex-core-data"}, nil},
+		{"allowed action", []string{"restart"}, []string{"restart", "edgex-core-data"}, nil},
+		{"disallowed action", []string{"restart"}, []string{"stop", "edgex-core-data"}, errEdgexOperationNotAllowed},
+		{"missing action", []string{"restart"}, []string{}, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Edgex: EdgexConfig{AllowedOperations: tc.allowed}}}
+		err := a.edgexOperationAllowed(tc.op)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+}
+
+// namedClient is EdgeX client told apart by its name.
+type namedClient struct {
+	edgex.Client
+	name string
+}
+
+func TestEdgexInstance(t *testing.T) {
+	def := &namedClient{name: "default"}
+	a := &agent{
+		edgexClient: def,
+		edgexInsts:  map[string]edgex.Client{"line2": &namedClient{name: "line2"}},
+	}
+
+	cases := []struct {
+		desc     string
+		cmdArgs  []string
+		instance string
+		args     []string
+	}{
+		{"default instance", []string{"edgex-ping"}, "default", []string{"edgex-ping"}},
+		{"default instance with arguments", []string{"edgex-restart", "edgex-core-data"}, "default", []string{"edgex-restart", "edgex-core-data"}},
+		{"named instance", []string{"edgex-ping", "line2"}, "line2", []string{"edgex-ping"}},
+		{"named instance with arguments", []string{"edgex-restart", "line2", "edgex-core-data"}, "line2", []string{"edgex-restart", "edgex-core-data"}},
+		{"unknown instance", []string{"edgex-config", "line3"}, "default", []string{"edgex-config", "line3"}},
+	}
+
+	for _, tc := range cases {
+		ec, args := a.edgexInstance(tc.cmdArgs)
+		name := ec.(*namedClient).name
+		assert.Equal(t, tc.instance, name, fmt.Sprintf("%s: expected instance %s got %s", tc.desc, tc.instance, name))
+		assert.Equal(t, tc.args, args, fmt.Sprintf("%s: expected arguments %v got %v", tc.desc, tc.args, args))
+	}
+}
+
+func TestEdgexConfigValidate(t *testing.T) {
+	cases := []struct {
+		desc      string
+		config    EdgexConfig
+		expectErr bool
+	}{
+		{"no instances", EdgexConfig{}, false},
+		{"named instance", EdgexConfig{Instances: map[string]string{"line2": "http://10.0.0.2:48090/api/v1/"}}, false},
+		{"instance without url", EdgexConfig{Instances: map[string]string{"line2": ""}}, true},
+		{"instance without name", EdgexConfig{Instances: map[string]string{"": "http://10.0.0.2:48090/api/v1/"}}, true},
+		{"unknown operation", EdgexConfig{AllowedOperations: []string{"reboot"}}, true},
+	}
+
+	for _, tc := range cases {
+		err := tc.config.Validate()
+		assert.Equal(t, tc.expectErr, err != nil, fmt.Sprintf("%s: unexpected error %v", tc.desc, err))
+	}
+}
+
+func TestEdgexLogsArgs(t *testing.T) {
+	cases := []struct {
+		desc    string
+		args    []string
+		max     int
+		service string
+		lines   int
+		err     error
+	}{
+		{"logs of service", []string{"edgex-core-data", "10"}, 100, "edgex-core-data", 10, nil},
+		{"lines over the cap", []string{"edgex-core-data", "500"}, 100, "edgex-core-data", 100, nil},
+		{"lines without cap", []string{"edgex-core-data", "500"}, 0, "edgex-core-data", 500, nil},
+		{"missing lines", []string{"edgex-core-data"}, 100, "", 0, ErrInvalidCommand},
+		{"invalid lines", []string{"edgex-core-data", "-1"}, 100, "", 0, ErrInvalidCommand},
+		{"invalid service name", []string{"../edgex", "10"}, 100, "", 0, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		service, lines, err := edgexLogsArgs(tc.args, tc.max)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.service, service, fmt.Sprintf("%s: expected service %s got %s", tc.desc, tc.service, service))
+		assert.Equal(t, tc.lines, lines, fmt.Sprintf("%s: expected %d lines got %d", tc.desc, tc.lines, lines))
+	}
+}
+
+func TestEdgexLogRecords(t *testing.T) {
+	resp := `[{"logLevel":"ERROR","message":"failed to connect","created":1588091188500},{"logLevel":"INFO","message":"started","created":1588091189000}]`
+	records, ok := edgexLogRecords("edgex-core-data", resp)
+	assert.True(t, ok, "expected log entries to be parsed")
+	assert.Len(t, records, 2, fmt.Sprintf("expected 2 records got %d", len(records)))
+	assert.Equal(t, "edgex-logs:edgex-core-data", records[0].Name, fmt.Sprintf("unexpected record name %s", records[0].Name))
+	assert.Equal(t, "ERROR failed to connect", *records[0].StringValue, fmt.Sprintf("unexpected record value %s", *records[0].StringValue))
+	assert.Equal(t, 1588091188.5, records[0].Time, fmt.Sprintf("unexpected record time %f", records[0].Time))
+
+	_, ok = edgexLogRecords("edgex-core-data", "not found")
+	assert.False(t, ok, "expected non JSON response not to be parsed")
+}
+
+func TestFilterMetrics(t *testing.T) {
+	resp := `{"edgex-core-data":{"Metrics":{"CpuBusyAvg":2.5,"Memory":{"Alloc":1024,"Frees":10}}},"edgex-core-command":{"Metrics":{"CpuBusyAvg":1.5}}}`
+	cases := []struct {
+		desc  string
+		args  []string
+		names []string
+		err   error
+	}{
+		{"all metrics of services", []string{"edgex-core-data", "edgex-core-command"}, []string{
+			"edgex-metrics:edgex-core-command:Metrics:CpuBusyAvg",
+			"edgex-metrics:edgex-core-data:Metrics:CpuBusyAvg",
+			"edgex-metrics:edgex-core-data:Metrics:Memory:Alloc",
+			"edgex-metrics:edgex-core-data:Metrics:Memory:Frees",
+		}, nil},
+		{"metric by name", []string{"edgex-core-data:CpuBusyAvg"}, []string{
+			"edgex-metrics:edgex-core-data:Metrics:CpuBusyAvg",
+		}, nil},
+		{"metrics by path", []string{"edgex-core-data:Memory:Alloc", "edgex-core-data:Frees"}, []string{
+			"edgex-metrics:edgex-core-data:Metrics:Memory:Alloc",
+			"edgex-metrics:edgex-core-data:Metrics:Memory:Frees",
+		}, nil},
+		{"filter of one service", []string{"edgex-core-data:Alloc", "edgex-core-command"}, []string{
+			"edgex-metrics:edgex-core-command:Metrics:CpuBusyAvg",
+			"edgex-metrics:edgex-core-data:Metrics:Memory:Alloc",
+		}, nil},
+		{"missing metric name", []string{"edgex-core-data:"}, nil, ErrInvalidCommand},
+		{"invalid service name", []string{"Core Data:Alloc"}, nil, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		_, filters, err := edgexMetricsArgs(tc.args)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		records, _ := edgexRecords(edgexMetrics, resp)
+		names := []string{}
+		for _, r := range filterMetrics(records, filters) {
+			names = append(names, r.Name)
+		}
+		assert.Equal(t, tc.names, names, fmt.Sprintf("%s: expected records %v got %v", tc.desc, tc.names, names))
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mainflux/agent/pkg/edgex"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	edgexJobs = "edgex-jobs"
+
+	// asyncArg makes `edgex-operation` run in the background.
+	asyncArg = "async"
+
+	// defEdgexJobPollInterval is used if job poll interval isn't configured.
+	defEdgexJobPollInterval = 2 * time.Second
+
+	jobRecord      = "job"
+	jobStatus      = "status"
+	jobResponse    = "response"
+	jobError       = "error"
+	jobRunning     = "running"
+	jobPolling     = "polling"
+	jobDone        = "done"
+	jobFailed      = "failed"
+	edgexStopOp    = "stop"
+	edgexJobPrefix = "edgex-"
+)
+
+// errEdgexJobTimeout indicates EdgeX operation whose services didn't reach expected state in time
+var errEdgexJobTimeout = errors.New("edgex operation timed out")
+
+// edgexJob is EdgeX operation running in the background. It is tracked
+// until services it started or stopped are confirmed to be up or down.
+type edgexJob struct {
+	ID      string    `json:"id"`
+	UUID    string    `json:"uuid"`
+	Command string    `json:"command"`
+	Status  string    `json:"status"`
+	Started time.Time `json:"started"`
+	Elapsed string    `json:"elapsed"`
+}
+
+// edgexJobRegistry holds running EdgeX jobs keyed by id, which is made of
+// sequence number.
+type edgexJobRegistry struct {
+	mu   sync.Mutex
+	seq  uint64
+	jobs map[string]*edgexJob
+}
+
+// startEdgexJob handles `edgex-operation,async,<action>,<services>` command,
+// it starts the operation in the background and returns job id. Once the
+// operation is pushed, services are polled until they are up, or down for
+// `stop`, and the final status is published as response to the command.
+func (a *agent) startEdgexJob(uuid string, ec edgex.Client, op []string) []senml.Record {
+	r := &a.jobs
+	r.mu.Lock()
+	r.seq++
+	job := &edgexJob{
+		ID:      edgexJobPrefix + strconv.FormatUint(r.seq, 10),
+		UUID:    uuid,
+		Command: strings.Join(op, " "),
+		Status:  jobRunning,
+		Started: a.clk().Now(),
+	}
+	if r.jobs == nil {
+		r.jobs = map[string]*edgexJob{}
+	}
+	r.jobs[job.ID] = job
+	r.mu.Unlock()
+
+	go a.runEdgexJob(job, ec, op)
+	a.logger.Info(fmt.Sprintf("EdgeX operation %s started as job %s", job.Command, job.ID))
+	id, status := job.ID, jobRunning
+	return []senml.Record{
+		{Name: jobRecord, StringValue: &id},
+		{Name: jobStatus, StringValue: &status},
+	}
+}
+
+// runEdgexJob pushes the operation, waits for its services and publishes
+// the final status of the job.
+func (a *agent) runEdgexJob(job *edgexJob, ec edgex.Client, op []string) {
+	defer func() {
+		a.jobs.mu.Lock()
+		delete(a.jobs.jobs, job.ID)
+		a.jobs.mu.Unlock()
+	}()
+
+	resp, err := ec.PushOperation(op)
+	if err != nil {
+		err = errors.Wrap(errEdgexFailed, err)
+	} else {
+		a.setJobStatus(job, jobPolling)
+		err = a.awaitEdgexServices(ec, op[0] != edgexStopOp, op[1:], job.Started)
+	}
+
+	id, status := job.ID, jobDone
+	records := []senml.Record{{Name: jobRecord, StringValue: &id}}
+	if err != nil {
+		status = jobFailed
+		e := err.Error()
+		records = append(records, senml.Record{Name: jobError, StringValue: &e})
+		a.logger.Warn(fmt.Sprintf("EdgeX job %s failed: %s", job.ID, err))
+	}
+	records = append(records,
+		senml.Record{Name: jobStatus, StringValue: &status},
+		senml.Record{Name: jobResponse, StringValue: &resp},
+	)
+	if _, err := a.publishRecords(job.UUID, records, ResultCode(err)); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to publish status of EdgeX job %s: %s", job.ID, err))
+	}
+}
+
+// awaitEdgexServices polls services which can be pinged until they are all
+// up, or all down if up is false, or the job timeout since start passes.
+// Services which can't be pinged are not waited for.
+func (a *agent) awaitEdgexServices(ec edgex.Client, up bool, services []string, start time.Time) error {
+	pending := []string{}
+	for _, s := range services {
+		for _, p := range edgex.Services {
+			if s == p {
+				pending = append(pending, s)
+			}
+		}
+	}
+	cfg := a.cfg().Edgex
+	interval := cfg.JobPollInterval
+	if interval <= 0 {
+		interval = defEdgexJobPollInterval
+	}
+	for {
+		waiting := []string{}
+		for _, s := range pending {
+			if _, err := ec.PingService(s); (err == nil) != up {
+				waiting = append(waiting, s)
+			}
+		}
+		if pending = waiting; len(pending) == 0 {
+			return nil
+		}
+		if cfg.JobTimeout > 0 && a.clk().Now().Sub(start) >= cfg.JobTimeout {
+			return errors.Wrap(errEdgexJobTimeout, fmt.Errorf("waiting for %s", strings.Join(pending, ", ")))
+		}
+		a.clk().Sleep(interval)
+	}
+}
+
+func (a *agent) setJobStatus(job *edgexJob, status string) {
+	a.jobs.mu.Lock()
+	job.Status = status
+	a.jobs.mu.Unlock()
+}
+
+// edgexJobList returns JSON encoded list of running EdgeX jobs ordered by start time.
+func (a *agent) edgexJobList() (string, error) {
+	a.jobs.mu.Lock()
+	jobs := []edgexJob{}
+	for _, j := range a.jobs.jobs {
+		job := *j
+		job.Elapsed = a.clk().Now().Sub(j.Started).Round(time.Millisecond).String()
+		jobs = append(jobs, job)
+	}
+	a.jobs.mu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Started.Before(jobs[j].Started)
+	})
+	b, err := json.Marshal(jobs)
+	if err != nil {
+		return "", errors.Wrap(errFailedEncode, err)
+	}
+	return string(b), nil
+}
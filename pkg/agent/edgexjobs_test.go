@@ -0,0 +1,129 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/agent/pkg/edgex"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// operationClient is EdgeX client whose services come up, or go down,
+// after the given number of pings.
+type operationClient struct {
+	edgex.Client
+	pushErr error
+	pings   int
+	count   int
+}
+
+func (oc *operationClient) PushOperation(op []string) (string, error) {
+	return "ok", oc.pushErr
+}
+
+func (oc *operationClient) PingService(service string) (string, error) {
+	oc.count++
+	if oc.count > oc.pings {
+		return "pong", nil
+	}
+	return "", errors.New("connection refused")
+}
+
+// stoppingClient is EdgeX client whose services are down after the first ping.
+type stoppingClient struct {
+	operationClient
+}
+
+func (sc *stoppingClient) PingService(service string) (string, error) {
+	if _, err := sc.operationClient.PingService(service); err != nil {
+		return "pong", nil
+	}
+	return "", errors.New("connection refused")
+}
+
+func TestEdgexJob(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+
+	cases := []struct {
+		desc   string
+		client edgex.Client
+		op     []string
+		status string
+		code   float64
+	}{
+		{"services up", &operationClient{pings: 2}, []string{"start", edgex.CoreData}, jobDone, CodeSuccess},
+		{"service not pingable", &operationClient{pings: 100}, []string{"start", "edgex-export-distro"}, jobDone, CodeSuccess},
+		{"failed push", &operationClient{pushErr: errors.New("refused")}, []string{"start", edgex.CoreData}, jobFailed, float64(ResultCode(errEdgexFailed))},
+		{"timeout", &operationClient{pings: 100}, []string{"restart", edgex.CoreData}, jobFailed, CodeTimeout},
+		{"services down", &stoppingClient{operationClient{pings: 1}}, []string{edgexStopOp, edgex.CoreData}, jobDone, CodeSuccess},
+	}
+
+	for _, tc := range cases {
+		client := &recordingClient{}
+		a := &agent{
+			config: &Config{
+				Channels: ChanConfig{Control: "ctrl"},
+				Edgex:    EdgexConfig{JobPollInterval: time.Second, JobTimeout: 10 * time.Second},
+			},
+			clock:      mocks.NewClock(time.Unix(1588091188, 0)),
+			mqttClient: client,
+			logger:     logger,
+		}
+		job := &edgexJob{ID: "edgex-1", UUID: "1", Status: jobRunning, Started: a.clk().Now()}
+		a.jobs.jobs = map[string]*edgexJob{job.ID: job}
+		a.runEdgexJob(job, tc.client, tc.op)
+
+		assert.Empty(t, a.jobs.jobs, fmt.Sprintf("%s: expected job to be removed", tc.desc))
+		if !assert.Len(t, client.payloads, 1, fmt.Sprintf("%s: expected single final status", tc.desc)) {
+			continue
+		}
+		pack, err := senml.Decode([]byte(client.payloads[0]), senml.JSON)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding status: %s", tc.desc, err))
+		values := map[string]string{}
+		var code float64
+		for _, r := range pack.Records {
+			if r.StringValue != nil {
+				values[r.Name] = *r.StringValue
+			}
+			if r.Name == codeRecord {
+				code = *r.Value
+			}
+		}
+		assert.Equal(t, "edgex-1", values[jobRecord], fmt.Sprintf("%s: expected job id got %s", tc.desc, values[jobRecord]))
+		assert.Equal(t, tc.status, values[jobStatus], fmt.Sprintf("%s: expected status %s got %s", tc.desc, tc.status, values[jobStatus]))
+		assert.Equal(t, tc.code, code, fmt.Sprintf("%s: expected code %v got %v", tc.desc, tc.code, code))
+	}
+}
+
+func TestEdgexJobList(t *testing.T) {
+	clock := mocks.NewClock(time.Unix(1588091188, 0))
+	a := &agent{clock: clock}
+	a.jobs.jobs = map[string]*edgexJob{
+		"edgex-2": {ID: "edgex-2", Command: "stop edgex-core-data", Status: jobPolling, Started: clock.Now().Add(time.Second)},
+		"edgex-1": {ID: "edgex-1", Command: "start edgex-core-data", Status: jobRunning, Started: clock.Now()},
+	}
+	clock.Advance(3 * time.Second)
+
+	list, err := a.edgexJobList()
+	assert.Nil(t, err, fmt.Sprintf("unexpected error listing jobs: %s", err))
+	jobs := []edgexJob{}
+	assert.Nil(t, json.Unmarshal([]byte(list), &jobs), "unexpected error decoding jobs")
+	if assert.Len(t, jobs, 2, "expected 2 jobs") {
+		assert.Equal(t, "edgex-1", jobs[0].ID, "expected jobs ordered by start time")
+		assert.Equal(t, "3s", jobs[0].Elapsed, fmt.Sprintf("expected elapsed 3s got %s", jobs[0].Elapsed))
+		assert.Equal(t, jobPolling, jobs[1].Status, fmt.Sprintf("expected status %s got %s", jobPolling, jobs[1].Status))
+	}
+}
@@ -0,0 +1,221 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/senml"
+)
+
+const (
+	edgexStreamStart = "edgex-stream-start"
+	edgexStreamStop  = "edgex-stream-stop"
+
+	// edgexReadingsTopic is control channel subtopic of streamed EdgeX readings.
+	edgexReadingsTopic = "edgex-readings"
+
+	// edgexStreamLimit caps number of readings fetched at once.
+	edgexStreamLimit = 1000
+
+	// defEdgexStreamInterval is used if stream interval isn't configured.
+	defEdgexStreamInterval = time.Second
+
+	streaming = "streaming"
+	stopped   = "stopped"
+)
+
+// edgexStream holds state of EdgeX readings stream. Readings created
+// after since are fetched on every poll until the stream is stopped or
+// its time is up. Sequence number identifies current stream, so that
+// polls of a stopped or replaced stream are dropped.
+type edgexStream struct {
+	mu    sync.Mutex
+	seq   uint64
+	since int64
+	until time.Time
+	timer Timer
+}
+
+// startEdgexStream handles `edgex-stream-start` command, optional argument
+// is stream duration, which is capped to configured max duration. Running
+// stream is replaced.
+func (a *agent) startEdgexStream(args []string) (string, error) {
+	max := a.cfg().Edgex.StreamMaxDuration
+	d := max
+	if len(args) > 0 && strings.TrimSpace(args[0]) != "" {
+		var err error
+		if d, err = time.ParseDuration(strings.TrimSpace(args[0])); err != nil || d <= 0 {
+			return "", ErrInvalidCommand
+		}
+		if max > 0 && d > max {
+			d = max
+		}
+	}
+	if d <= 0 {
+		return "", ErrInvalidCommand
+	}
+
+	s := &a.stream
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a.stopStream()
+	now := a.clk().Now()
+	s.since = millis(now)
+	s.until = now.Add(d)
+	a.schedulePoll(s.seq)
+	a.logger.Info(fmt.Sprintf("EdgeX readings stream started for %s", d))
+	return streaming, nil
+}
+
+// stopEdgexStream handles `edgex-stream-stop` command.
+func (a *agent) stopEdgexStream() string {
+	a.stream.mu.Lock()
+	defer a.stream.mu.Unlock()
+	a.stopStream()
+	return stopped
+}
+
+// stopStream stops running stream, it must be called with stream lock held.
+func (a *agent) stopStream() {
+	s := &a.stream
+	s.seq++
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+}
+
+// schedulePoll schedules the next poll of the stream, it must be called
+// with stream lock held.
+func (a *agent) schedulePoll(seq uint64) {
+	interval := a.cfg().Edgex.StreamInterval
+	if interval <= 0 {
+		interval = defEdgexStreamInterval
+	}
+	a.stream.timer = a.clk().AfterFunc(interval, func() {
+		a.pollEdgexStream(seq)
+	})
+}
+
+// pollEdgexStream fetches readings created since the last poll and
+// publishes them to the readings subtopic. Failed fetch is retried on
+// the next poll.
+func (a *agent) pollEdgexStream(seq uint64) {
+	s := &a.stream
+	s.mu.Lock()
+	if s.seq != seq {
+		s.mu.Unlock()
+		return
+	}
+	start, now := s.since, a.clk().Now()
+	s.mu.Unlock()
+
+	next := start
+	resp, err := a.edgexClient.FetchReadings(start, millis(now), edgexStreamLimit)
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to fetch EdgeX readings: %s", err))
+	} else {
+		var records []senml.Record
+		records, next = edgexReadingRecords(resp, start)
+		if err := a.publishReadings(records); err != nil {
+			a.logger.Warn(fmt.Sprintf("Failed to publish EdgeX readings: %s", err))
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seq != seq {
+		return
+	}
+	s.since = next
+	if !now.Before(s.until) {
+		a.stopStream()
+		a.logger.Info("EdgeX readings stream ended")
+		return
+	}
+	a.schedulePoll(seq)
+}
+
+func (a *agent) publishReadings(records []senml.Record) error {
+	if len(records) == 0 || a.duplicate(edgexReadingsTopic, records) {
+		return nil
+	}
+	payload, err := encoder.EncodeRecords(a.BaseName(""), records)
+	if err != nil {
+		return err
+	}
+	if err := a.Publish(edgexReadingsTopic, string(payload)); err != nil {
+		return err
+	}
+	a.markSent(edgexReadingsTopic, records)
+	return nil
+}
+
+// edgexReadingRecords converts EdgeX core data response, which is JSON
+// array of readings, into one record per reading named by the device and
+// the reading, i.e. `thermostat:temperature`, ordered by creation time.
+// Numeric and boolean readings are published as such, others as strings.
+// Returns start of the next fetch, which is after the latest reading.
+func edgexReadingRecords(resp string, since int64) ([]senml.Record, int64) {
+	var readings []struct {
+		Device    string `json:"device"`
+		Name      string `json:"name"`
+		Value     string `json:"value"`
+		ValueType string `json:"valueType"`
+		Created   int64  `json:"created"`
+	}
+	if err := json.Unmarshal([]byte(resp), &readings); err != nil {
+		return nil, since
+	}
+	sort.SliceStable(readings, func(i, j int) bool {
+		return readings[i].Created < readings[j].Created
+	})
+
+	next := since
+	records := []senml.Record{}
+	for _, r := range readings {
+		rec := senml.Record{
+			Name: r.Device + ":" + r.Name,
+			Time: float64(r.Created) / 1e3,
+		}
+		setReadingValue(&rec, r.ValueType, r.Value)
+		records = append(records, rec)
+		if r.Created >= next {
+			next = r.Created + 1
+		}
+	}
+	return records, next
+}
+
+// setReadingValue sets record value by EdgeX value type, i.e. `Int32`
+// or `Bool`. Value which can't be parsed is kept as string.
+func setReadingValue(rec *senml.Record, typ, value string) {
+	switch {
+	case typ == "Bool":
+		if b, err := strconv.ParseBool(value); err == nil {
+			rec.BoolValue = &b
+			return
+		}
+	case strings.HasPrefix(typ, "Int"), strings.HasPrefix(typ, "Uint"), strings.HasPrefix(typ, "Float"):
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			rec.Value = &f
+			return
+		}
+	}
+	rec.StringValue = &value
+}
+
+// millis returns time in milliseconds since epoch, as used by EdgeX.
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
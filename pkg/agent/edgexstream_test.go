@@ -0,0 +1,120 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/agent/pkg/edgex"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// readingsClient records time ranges of fetched readings.
+type readingsClient struct {
+	edgex.Client
+	mu     sync.Mutex
+	ranges [][2]int64
+}
+
+func (rc *readingsClient) FetchReadings(start, end int64, limit int) (string, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.ranges = append(rc.ranges, [2]int64{start, end})
+	return "[]", nil
+}
+
+func TestEdgexReadingRecords(t *testing.T) {
+	resp := `[
+		{"device":"thermostat","name":"heating","value":"true","valueType":"Bool","created":1588091189000},
+		{"device":"thermostat","name":"temperature","value":"21.5","valueType":"Float64","created":1588091188500},
+		{"device":"camera","name":"status","value":"idle","valueType":"String","created":1588091188000},
+		{"device":"meter","name":"power","value":"QUAAAA==","valueType":"Float32","created":1588091188000}
+	]`
+	records, next := edgexReadingRecords(resp, 1588091187000)
+	assert.Equal(t, int64(1588091189001), next, fmt.Sprintf("expected next fetch from 1588091189001 got %d", next))
+	assert.Len(t, records, 4, fmt.Sprintf("expected 4 records got %d", len(records)))
+	if len(records) != 4 {
+		return
+	}
+	assert.Equal(t, "camera:status", records[0].Name, fmt.Sprintf("expected oldest reading first got %s", records[0].Name))
+	assert.Equal(t, "idle", *records[0].StringValue, "expected string reading")
+	assert.Equal(t, "QUAAAA==", *records[1].StringValue, "expected unparsable reading to be kept as string")
+	assert.Equal(t, 21.5, *records[2].Value, "expected numeric reading")
+	assert.Equal(t, 1588091188.5, records[2].Time, fmt.Sprintf("expected reading time in seconds got %v", records[2].Time))
+	assert.True(t, *records[3].BoolValue, "expected boolean reading")
+
+	records, next = edgexReadingRecords("not json", 42)
+	assert.Empty(t, records, "expected no records for invalid response")
+	assert.Equal(t, int64(42), next, "expected next fetch not to move for invalid response")
+}
+
+func TestEdgexStream(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	start := time.Unix(1588091188, 0)
+
+	cases := []struct {
+		desc  string
+		args  []string
+		polls int
+		err   error
+	}{
+		{"configured max duration", nil, 10, nil},
+		{"duration from argument", []string{"3s"}, 3, nil},
+		{"duration capped", []string{"1h"}, 10, nil},
+		{"invalid duration", []string{"-1s"}, 0, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		clock := mocks.NewClock(start)
+		client := &readingsClient{}
+		a := &agent{
+			config:      &Config{Edgex: EdgexConfig{StreamInterval: time.Second, StreamMaxDuration: 10 * time.Second}},
+			clock:       clock,
+			logger:      logger,
+			edgexClient: client,
+		}
+		_, err := a.startEdgexStream(tc.args)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		for i := 0; i < 20; i++ {
+			clock.Advance(time.Second)
+		}
+		assert.Len(t, client.ranges, tc.polls, fmt.Sprintf("%s: expected %d polls got %d", tc.desc, tc.polls, len(client.ranges)))
+		if len(client.ranges) > 0 {
+			assert.Equal(t, millis(start), client.ranges[0][0], fmt.Sprintf("%s: expected readings since stream start", tc.desc))
+		}
+	}
+}
+
+func TestEdgexStreamStop(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	clock := mocks.NewClock(time.Unix(1588091188, 0))
+	client := &readingsClient{}
+	a := &agent{
+		config:      &Config{Edgex: EdgexConfig{StreamInterval: time.Second, StreamMaxDuration: time.Minute}},
+		clock:       clock,
+		logger:      logger,
+		edgexClient: client,
+	}
+	if _, err := a.startEdgexStream(nil); err != nil {
+		t.Fatalf("unexpected error starting stream: %s", err)
+	}
+	clock.Advance(time.Second)
+	clock.Advance(time.Second)
+	assert.Equal(t, stopped, a.stopEdgexStream(), "expected stream to be stopped")
+	clock.Advance(time.Second)
+	assert.Len(t, client.ranges, 2, fmt.Sprintf("expected 2 polls before stop got %d", len(client.ranges)))
+	assert.Equal(t, 0, clock.Timers(), fmt.Sprintf("expected no pending polls got %d", clock.Timers()))
+}
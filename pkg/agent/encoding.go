@@ -0,0 +1,154 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"strings"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	encodeErrorRecord = "encode_error"
+	encodingRecord    = "encoding"
+	encodingGzip      = "gzip"
+	encodingIdentity  = "identity"
+)
+
+// AcceptEncoding sets encodings, i.e. `gzip`, accepted by the sender of
+// the command with the uuid. Empty encoding clears accepted encodings.
+func (a *agent) AcceptEncoding(uuid, encoding string) {
+	if encoding == "" {
+		a.encodings.Delete(uuid)
+		return
+	}
+	a.encodings.Store(uuid, encoding)
+}
+
+// ResponseFormat sets format, i.e. `json`, of responses to the command
+// with the uuid. Empty format clears it.
+func (a *agent) ResponseFormat(uuid, format string) {
+	if format == "" {
+		a.formats.Delete(uuid)
+		return
+	}
+	a.formats.Store(uuid, format)
+}
+
+// BaseName renders configured base name template for the uuid. Uuid is
+// used as is if the template can't be rendered.
+func (a *agent) BaseName(uuid string) string {
+	cfg := a.cfg()
+	bn, err := encoder.BaseName(cfg.SenML.BaseName, uuid, cfg.Device.ID)
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to render base name: %s", err))
+		return uuid
+	}
+	return bn
+}
+
+// responseFormat returns format of responses to the command with the uuid,
+// format requested by the command takes precedence over configured one.
+func (a *agent) responseFormat(uuid string) string {
+	if format, ok := a.formats.Load(uuid); ok {
+		return format.(string)
+	}
+	if format := a.cfg().Channels.ResponseFormat; format != "" {
+		return format
+	}
+	return encoder.FormatSenML
+}
+
+// acceptsGzip checks whether comma separated list of accepted encodings,
+// i.e. `gzip, deflate`, allows gzip. Parameters such as `;q=0.5` are ignored.
+func acceptsGzip(encoding string) bool {
+	for _, e := range strings.Split(encoding, ",") {
+		e = strings.TrimSpace(strings.SplitN(e, ";", 2)[0])
+		if strings.EqualFold(e, encodingGzip) || e == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeResponse encodes response records in the response format. If the sender of the command
+// told which encodings it accepts, the records carry marker of the chosen
+// encoding and payload is gzip compressed if sender accepts gzip and the
+// payload exceeds GzipThreshold bytes.
+func (a *agent) encodeResponse(uuid string, records []senml.Record) ([]byte, error) {
+	format, bn := a.responseFormat(uuid), a.BaseName(uuid)
+	accepted, ok := a.encodings.Load(uuid)
+	if !ok {
+		return encoder.Encode(format, bn, records)
+	}
+
+	payload, err := encoder.Encode(format, bn, encodingRecords(records, encodingIdentity))
+	if err != nil {
+		return nil, err
+	}
+	threshold := a.cfg().MQTT.GzipThreshold
+	if threshold <= 0 || len(payload) <= threshold || !acceptsGzip(accepted.(string)) {
+		return payload, nil
+	}
+
+	if payload, err = encoder.Encode(format, bn, encodingRecords(records, encodingGzip)); err != nil {
+		return nil, err
+	}
+	return gzipPayload(payload)
+}
+
+// gzipPayload returns gzip compressed payload.
+func gzipPayload(payload []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(payload); err != nil {
+		return nil, errors.New(err.Error())
+	}
+	if err := zw.Close(); err != nil {
+		return nil, errors.New(err.Error())
+	}
+	return buf.Bytes(), nil
+}
+
+// encodingRecords returns copy of the records with encoding marker appended.
+func encodingRecords(records []senml.Record, encoding string) []senml.Record {
+	return append(append([]senml.Record{}, records...), senml.Record{
+		Name:        encodingRecord,
+		StringValue: &encoding,
+	})
+}
+
+// encodeErrorRecords returns minimal records describing failure to encode
+// the records, named after the first of them, and failure result code.
+func encodeErrorRecords(records []senml.Record, cause error) []senml.Record {
+	name := encodeErrorRecord
+	if len(records) > 0 && records[0].Name != "" {
+		name = records[0].Name
+	}
+	msg := fmt.Sprintf("%s: %s", errFailedEncode, strings.ToValidUTF8(cause.Error(), "\uFFFD"))
+	code := float64(CodeFailure)
+	return []senml.Record{
+		{Name: name, StringValue: &msg},
+		{Name: codeRecord, Value: &code},
+	}
+}
+
+// valuesLen returns total length of string and data values of the records.
+func valuesLen(records []senml.Record) int {
+	n := 0
+	for _, r := range records {
+		if r.StringValue != nil {
+			n += len(*r.StringValue)
+		}
+		if r.DataValue != nil {
+			n += len(*r.DataValue)
+		}
+	}
+	return n
+}
@@ -0,0 +1,169 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeResponse(t *testing.T) {
+	out := strings.Repeat("a", 100)
+	records := []senml.Record{{Name: "ls", StringValue: &out}}
+
+	cases := []struct {
+		desc      string
+		accepted  string
+		threshold int
+		encoding  string
+	}{
+		{"encoding not negotiated", "", 10, ""},
+		{"payload below threshold", "gzip", 1000, encodingIdentity},
+		{"payload above threshold", "gzip", 10, encodingGzip},
+		{"gzip among accepted encodings", "deflate, gzip;q=0.5", 10, encodingGzip},
+		{"gzip not accepted", "deflate", 10, encodingIdentity},
+		{"compression disabled", "gzip", 0, encodingIdentity},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{MQTT: MQTTConfig{GzipThreshold: tc.threshold}}}
+		if tc.accepted != "" {
+			a.AcceptEncoding("1", tc.accepted)
+		}
+		payload, err := a.encodeResponse("1", records)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		compressed := bytes.HasPrefix(payload, gzipMagic)
+		assert.Equal(t, tc.encoding == encodingGzip, compressed, fmt.Sprintf("%s: expected compressed %t", tc.desc, !compressed))
+		if compressed {
+			zr, err := gzip.NewReader(bytes.NewReader(payload))
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decompressing: %s", tc.desc, err))
+			payload, _ = ioutil.ReadAll(zr)
+		}
+		pack, err := senml.Decode(payload, senml.JSON)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding: %s", tc.desc, err))
+		last := pack.Records[len(pack.Records)-1]
+		if tc.encoding == "" {
+			assert.NotEqual(t, encodingRecord, last.Name, fmt.Sprintf("%s: unexpected encoding marker", tc.desc))
+			continue
+		}
+		assert.Equal(t, encodingRecord, last.Name, fmt.Sprintf("%s: expected encoding marker", tc.desc))
+		assert.Equal(t, tc.encoding, *last.StringValue, fmt.Sprintf("%s: expected encoding %s got %s", tc.desc, tc.encoding, *last.StringValue))
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	out, code := "hi\n", 0.0
+	records := func() []senml.Record {
+		return []senml.Record{
+			{Name: "echo", StringValue: &out, Time: 1},
+			{Name: codeRecord, Value: &code, Time: 1},
+		}
+	}
+
+	cases := []struct {
+		desc       string
+		configured string
+		requested  string
+		payload    string
+	}{
+		{"default format", "", "", `[{"bn":"1","n":"echo","t":1,"vs":"hi\n"},{"n":"code","t":1,"v":0}]`},
+		{"configured format", encoder.FormatJSON, "", `{"bn":"1","t":1,"records":{"code":0,"echo":"hi\n"}}`},
+		{"requested format", encoder.FormatJSON, encoder.FormatText, "bn: 1\necho: hi\ncode: 0\n"},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Channels: ChanConfig{ResponseFormat: tc.configured}}}
+		a.ResponseFormat("1", tc.requested)
+		payload, err := a.encodeResponse("1", records())
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error: %s", tc.desc, err))
+		assert.Equal(t, tc.payload, string(payload), fmt.Sprintf("%s: expected payload %s got %s", tc.desc, tc.payload, payload))
+	}
+
+	a := &agent{config: &Config{Channels: ChanConfig{ResponseFormat: encoder.FormatSenMLCBOR}}}
+	payload, err := a.encodeResponse("1", records())
+	assert.Nil(t, err, fmt.Sprintf("senml cbor: unexpected error: %s", err))
+	pack, err := senml.Decode(payload, senml.CBOR)
+	assert.Nil(t, err, fmt.Sprintf("senml cbor: unexpected error decoding: %s", err))
+	assert.Equal(t, 2, len(pack.Records), fmt.Sprintf("senml cbor: expected 2 records got %d", len(pack.Records)))
+}
+
+func TestBaseName(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+
+	cases := []struct {
+		desc   string
+		senml  SenMLConfig
+		device DeviceConfig
+		uuid   string
+		bn     string
+	}{
+		{"template not set", SenMLConfig{}, DeviceConfig{}, "1", "1"},
+		{"default template", SenMLConfig{BaseName: encoder.DefaultBaseName}, DeviceConfig{}, "1", "1"},
+		{"device template", SenMLConfig{BaseName: "urn:dev:{{.DeviceID}}:{{.UUID}}"}, DeviceConfig{ID: "gw"}, "1", "urn:dev:gw:1"},
+		{"missing device id", SenMLConfig{BaseName: "urn:dev:{{.DeviceID}}:{{.UUID}}"}, DeviceConfig{}, "1", "1"},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{SenML: tc.senml, Device: tc.device}, logger: logger}
+		bn := a.BaseName(tc.uuid)
+		assert.Equal(t, tc.bn, bn, fmt.Sprintf("%s: expected base name %s got %s", tc.desc, tc.bn, bn))
+	}
+
+	a := &agent{config: &Config{}, logger: logger}
+	a.config = &Config{SenML: SenMLConfig{BaseName: "{{.DeviceID}}/{{.UUID}}"}, Device: DeviceConfig{ID: "gw"}}
+	out := "hi"
+	payload, err := a.encodeResponse("1", []senml.Record{{Name: "echo", StringValue: &out}})
+	assert.Nil(t, err, fmt.Sprintf("changed config: unexpected error: %s", err))
+	assert.Contains(t, string(payload), `"bn":"gw/1"`, fmt.Sprintf("changed config: expected base name gw/1 in %s", payload))
+}
+
+func TestEncodeErrorRecords(t *testing.T) {
+	nan := math.NaN()
+	records := []senml.Record{{Name: "cat", Value: &nan}}
+	a := &agent{config: &Config{}}
+	_, cause := a.encodeResponse("1", records)
+	if cause == nil {
+		t.Fatalf("expected error encoding NaN value")
+	}
+
+	cases := []struct {
+		desc    string
+		records []senml.Record
+		name    string
+	}{
+		{"named after first record", records, "cat"},
+		{"no records", nil, encodeErrorRecord},
+	}
+
+	for _, tc := range cases {
+		fallback := encodeErrorRecords(tc.records, cause)
+		payload, err := a.encodeResponse("1", fallback)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error encoding fallback: %s", tc.desc, err))
+		decoded, err := senml.Decode(payload, senml.JSON)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding fallback: %s", tc.desc, err))
+		assert.Len(t, decoded.Records, 2, fmt.Sprintf("%s: expected 2 records got %d", tc.desc, len(decoded.Records)))
+		assert.Equal(t, tc.name, fallback[0].Name, fmt.Sprintf("%s: expected name %s got %s", tc.desc, tc.name, fallback[0].Name))
+		assert.Contains(t, *fallback[0].StringValue, cause.Error(), fmt.Sprintf("%s: expected encode error in message", tc.desc))
+		assert.Equal(t, float64(CodeFailure), *fallback[1].Value, fmt.Sprintf("%s: expected failure code", tc.desc))
+	}
+}
+
+func TestValuesLen(t *testing.T) {
+	s, d := "abc", "de"
+	records := []senml.Record{{Name: "a", StringValue: &s}, {Name: "b", DataValue: &d}, {Name: "c"}}
+	assert.Equal(t, 5, valuesLen(records), fmt.Sprintf("expected length 5 got %d", valuesLen(records)))
+}
@@ -0,0 +1,645 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	truncatedBytes = "truncated_bytes"
+	totalBytes     = "total_bytes"
+	truncatedLines = "truncated_lines"
+	outputSHA256   = "output_sha256"
+
+	shell     = "sh"
+	shellHint = "shell"
+	grepHint  = "grep"
+	cwdHint   = "cwd"
+	maxHint   = "maxbytes"
+	linesHint = "maxlines"
+	idleHint  = "idle"
+	retryHint = "retries"
+
+	execAttempts = "attempts"
+
+	execValidate   = "exec-validate"
+	validateReason = "reason"
+	validateCode   = "reason_code"
+)
+
+// rejectedPrefixLen is number of characters of too long command kept in
+// audit, history and error response.
+const rejectedPrefixLen = 64
+
+var (
+	// errCommandTooLong indicates command longer than configured maximum length
+	errCommandTooLong = errors.New("command too long")
+
+	// errCommandNotAllowed indicates that command binary or its arguments are not in the allowlist
+	errCommandNotAllowed = errors.New("command not allowed")
+
+	// errInvalidHint indicates malformed command hint
+	errInvalidHint = errors.New("invalid command hint")
+
+	// errWorkDirNotAllowed indicates that working directory is not in the allowlist
+	errWorkDirNotAllowed = errors.New("working directory not allowed")
+
+	// errExecTimeout indicates that command was killed after the timeout
+	errExecTimeout = errors.New("command timed out")
+
+	// errExecIdle indicates that command was killed because it didn't write output for idle timeout
+	errExecIdle = errors.New("command idle timed out")
+
+	// errInvalidTemplate indicates that command template can't be rendered
+	errInvalidTemplate = errors.New("invalid command template")
+)
+
+// safeValue matches values which can be rendered into command
+// without changing its arguments or shell command line.
+var safeValue = regexp.MustCompile(`^[A-Za-z0-9._:@%+=/-]*$`)
+
+// templateData is data available in command templates.
+type templateData struct {
+	Device   DeviceConfig
+	Channels ChanConfig
+	Env      map[string]string
+}
+
+// hintRegExp matches leading `key=value;` command hint.
+var hintRegExp = regexp.MustCompile(`^\s*([a-z]+)=([^;]*);`)
+
+// execOpts holds per-command execution options,
+// set from config defaults and overridden by command hints.
+type execOpts struct {
+	shell    bool
+	grep     *regexp.Regexp
+	dir      string
+	maxBytes int
+	maxLines int
+	idle     time.Duration
+	retries  int
+	delay    time.Duration
+	nice     int
+	mime     string
+	watch    *idleWatch
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// parseHints strips leading `key=value;` hints from the command
+// and returns them together with the remaining command string.
+func parseHints(cmd string) (map[string]string, string) {
+	hints := map[string]string{}
+	for {
+		m := hintRegExp.FindStringSubmatch(cmd)
+		if m == nil {
+			return hints, cmd
+		}
+		hints[m[1]] = strings.TrimSpace(m[2])
+		cmd = cmd[len(m[0]):]
+	}
+}
+
+func (a *agent) execOpts(hints map[string]string) (execOpts, error) {
+	opts := execOpts{
+		shell:    a.cfg().Exec.Shell,
+		maxBytes: a.cfg().Exec.MaxOutputSize,
+		maxLines: a.cfg().Exec.MaxLines,
+		idle:     a.cfg().Exec.IdleTimeout,
+		retries:  a.cfg().Exec.DefaultRetries,
+		delay:    a.cfg().Exec.RetryDelay,
+		nice:     a.cfg().Exec.DefaultNice,
+	}
+	for k, v := range hints {
+		switch k {
+		case shellHint:
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return opts, errors.Wrap(errInvalidHint, fmt.Errorf("%s=%s", k, v))
+			}
+			opts.shell = b
+		case grepHint:
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return opts, errors.Wrap(errInvalidHint, err)
+			}
+			opts.grep = re
+		case cwdHint:
+			dir, err := a.workDir(v)
+			if err != nil {
+				return opts, err
+			}
+			opts.dir = dir
+		case maxHint:
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return opts, errors.Wrap(errInvalidHint, fmt.Errorf("%s=%s", k, v))
+			}
+			opts.maxBytes = n
+			if hc := a.cfg().Exec.MaxOutputHardCap; hc > 0 && (n == 0 || n > hc) {
+				opts.maxBytes = hc
+			}
+		case linesHint:
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return opts, errors.Wrap(errInvalidHint, fmt.Errorf("%s=%s", k, v))
+			}
+			opts.maxLines = n
+		case idleHint:
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return opts, errors.Wrap(errInvalidHint, fmt.Errorf("%s=%s", k, v))
+			}
+			opts.idle = d
+		case retryHint:
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return opts, errors.Wrap(errInvalidHint, fmt.Errorf("%s=%s", k, v))
+			}
+			opts.retries = n
+		case niceHint:
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return opts, errors.Wrap(errInvalidHint, fmt.Errorf("%s=%s", k, v))
+			}
+			if err := validNice(n); err != nil {
+				return opts, errors.Wrap(errInvalidHint, err)
+			}
+			opts.nice = n
+		case mimeHint:
+			mt, err := parseMime(v)
+			if err != nil {
+				return opts, errors.Wrap(errInvalidHint, err)
+			}
+			opts.mime = mt
+		default:
+			return opts, errors.Wrap(errInvalidHint, fmt.Errorf("unknown hint %s", k))
+		}
+	}
+	return opts, nil
+}
+
+// checkLength rejects commands longer than MaxCommandLength. Short copy of
+// rejected command is returned, so that audit and history don't keep it.
+func (a *agent) checkLength(cmd string) (string, error) {
+	max := a.cfg().Exec.MaxCommandLength
+	if max <= 0 || len(cmd) <= max {
+		return cmd, nil
+	}
+	return fmt.Sprintf("%.*s...", rejectedPrefixLen, cmd), errCommandTooLong
+}
+
+// prepare runs checks done before execution, feature and safe mode checks
+// followed by checks done while creating the command, and creates the command.
+// Options cancel func has to be called once command is done.
+func (a *agent) prepare(cmd string) (*exec.Cmd, execOpts, error) {
+	if !a.cfg().Features.Enabled(FeatureExec) {
+		return nil, execOpts{}, errors.Wrap(errFeatureDisabled, fmt.Errorf("%s", FeatureExec))
+	}
+	if a.safeMode.Enabled() {
+		return nil, execOpts{}, errSafeMode
+	}
+	return a.command(cmd)
+}
+
+// execute runs the command writing its output to buf. Command which exits
+// with non-zero status is run again after retry delay, up to retries times.
+// Commands rejected before start, killed or timed out are not retried.
+// Returns the last run command, its options and number of attempts.
+func (a *agent) execute(uuid, cmd string, buf *bytes.Buffer) (*exec.Cmd, execOpts, int, error) {
+	for attempt := 1; ; attempt++ {
+		c, opts, err := a.prepare(cmd)
+		if err != nil {
+			return nil, opts, attempt, err
+		}
+		buf.Reset()
+		w := opts.writer(buf)
+		c.Stdout = w
+		c.Stderr = w
+		err = a.run(uuid, c, opts)
+		if err == nil {
+			opts.cancel()
+			return c, opts, attempt, nil
+		}
+		retry := attempt <= opts.retries && retryable(opts, err)
+		err = execError(opts, err)
+		opts.cancel()
+		if !retry {
+			if attempt > 1 {
+				err = errors.Wrap(fmt.Errorf("%d attempts", attempt), err)
+			}
+			return c, opts, attempt, err
+		}
+		a.clk().Sleep(opts.delay)
+	}
+}
+
+// retryable checks whether command exited by itself with non-zero status.
+func retryable(opts execOpts, err error) bool {
+	_, exited := err.(*exec.ExitError)
+	return exited && opts.ctx.Err() == nil && (opts.watch == nil || !opts.watch.fired())
+}
+
+// validateExec checks whether command would be accepted for execution,
+// including whether its binary can be found, without running it.
+// Returns record with the result, followed by the reason and its result
+// code if command would be rejected.
+func (a *agent) validateExec(uuid, cmd string) []senml.Record {
+	c, opts, err := a.prepare(strings.TrimSpace(cmd))
+	if err == nil {
+		opts.cancel()
+		if _, lerr := exec.LookPath(c.Path); lerr != nil {
+			err = errors.Wrap(errFailedExecute, lerr)
+		}
+	}
+	valid := err == nil
+	records := []senml.Record{
+		{Name: execValidate, BoolValue: &valid},
+	}
+	if err != nil {
+		reason, code := a.ErrorMessage(uuid, err), float64(ResultCode(err))
+		records = append(records,
+			senml.Record{Name: validateReason, StringValue: &reason},
+			senml.Record{Name: validateCode, Value: &code},
+		)
+	}
+	return records
+}
+
+// command creates command from the command string. Command string is
+// either comma separated binary and arguments or, in shell mode,
+// a command line passed to `sh -c`. Returns created command and its options,
+// options cancel func has to be called once command is done.
+func (a *agent) command(cmd string) (*exec.Cmd, execOpts, error) {
+	hints, cmd := parseHints(cmd)
+	opts, err := a.execOpts(hints)
+	if err != nil {
+		return nil, opts, err
+	}
+	if cmd, err = a.render(cmd); err != nil {
+		return nil, opts, err
+	}
+
+	name, args := shell, []string{"-c", strings.TrimSpace(cmd)}
+	if !opts.shell {
+		cmdArr := strings.Split(strings.Replace(cmd, " ", "", -1), ",")
+		if len(cmdArr) < 2 {
+			return nil, opts, ErrInvalidCommand
+		}
+		name, args = cmdArr[0], cmdArr[1:]
+	}
+	if name == "" || (opts.shell && args[1] == "") {
+		return nil, opts, ErrInvalidCommand
+	}
+
+	if err := a.checkAllowed(name, args); err != nil {
+		return nil, opts, err
+	}
+
+	opts.ctx, opts.cancel = context.WithCancel(context.Background())
+	key := name
+	if opts.shell {
+		key = strings.Fields(args[1])[0]
+	}
+	if timeout := a.timeout(key); timeout > 0 {
+		opts.ctx, opts.cancel = context.WithTimeout(context.Background(), timeout)
+	}
+	if opts.idle > 0 {
+		opts.watch = &idleWatch{timeout: opts.idle, cancel: opts.cancel, clock: a.clk()}
+	}
+
+	c := a.exe().CommandContext(opts.ctx, name, args...)
+	c.Dir = opts.dir
+	return c, opts, nil
+}
+
+// render renders command template, i.e. `backup,--device,{{.Device.ID}}`,
+// with device and channels config and allowed environment variables.
+// Values containing characters which could inject arguments are rejected.
+func (a *agent) render(cmd string) (string, error) {
+	if !strings.Contains(cmd, "{{") {
+		return cmd, nil
+	}
+
+	data := templateData{
+		Device:   a.cfg().Device,
+		Channels: a.cfg().Channels,
+		Env:      map[string]string{},
+	}
+	for _, v := range []string{data.Device.ID, data.Channels.Control, data.Channels.Data} {
+		if !safeValue.MatchString(v) {
+			return "", errors.Wrap(errInvalidTemplate, fmt.Errorf("unsafe value %q", v))
+		}
+	}
+	for _, name := range a.cfg().Exec.TemplateEnv {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if !safeValue.MatchString(v) {
+			return "", errors.Wrap(errInvalidTemplate, fmt.Errorf("unsafe value of %s", name))
+		}
+		data.Env[name] = v
+	}
+
+	t, err := template.New("cmd").Option("missingkey=error").Parse(cmd)
+	if err != nil {
+		return "", errors.Wrap(errInvalidTemplate, err)
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", errors.Wrap(errInvalidTemplate, err)
+	}
+	return sb.String(), nil
+}
+
+// timeout returns timeout for the command, set by the longest matching
+// command prefix from configured timeouts or the default timeout.
+func (a *agent) timeout(name string) time.Duration {
+	timeout, match := a.cfg().Exec.Timeout, ""
+	for prefix, t := range a.cfg().Exec.Timeouts {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(match) {
+			timeout, match = t, prefix
+		}
+	}
+	return timeout
+}
+
+// execError wraps command error, distinguishing commands killed after timeout.
+func execError(opts execOpts, err error) error {
+	if opts.watch != nil && opts.watch.fired() {
+		return errors.Wrap(errExecIdle, err)
+	}
+	if opts.ctx.Err() == context.DeadlineExceeded {
+		return errors.Wrap(errExecTimeout, err)
+	}
+	// Context is canceled before command exits only by exec-kill.
+	if opts.ctx.Err() == context.Canceled {
+		return errors.Wrap(errExecKilled, err)
+	}
+	return errors.Wrap(errFailedExecute, err)
+}
+
+// idleWatch cancels command which doesn't write output for the timeout.
+type idleWatch struct {
+	timeout time.Duration
+	cancel  func()
+	clock   Clock
+	timer   Timer
+	idle    bool
+	mu      sync.Mutex
+}
+
+// start starts the timer, it is reset on every write of wrapped writers.
+func (iw *idleWatch) start() {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	iw.timer = iw.clock.AfterFunc(iw.timeout, func() {
+		iw.mu.Lock()
+		iw.idle = true
+		iw.mu.Unlock()
+		iw.cancel()
+	})
+}
+
+func (iw *idleWatch) stop() {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	if iw.timer != nil {
+		iw.timer.Stop()
+	}
+}
+
+func (iw *idleWatch) touch() {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	if iw.timer != nil && !iw.idle {
+		iw.timer.Reset(iw.timeout)
+	}
+}
+
+// fired checks whether command was canceled for being idle.
+func (iw *idleWatch) fired() bool {
+	iw.mu.Lock()
+	defer iw.mu.Unlock()
+	return iw.idle
+}
+
+// writer wraps command output writer so that writes reset idle
+// timer, w is returned as is if idle timeout is disabled.
+func (o execOpts) writer(w io.Writer) io.Writer {
+	if o.watch == nil {
+		return w
+	}
+	return idleWriter{w: w, watch: o.watch}
+}
+
+type idleWriter struct {
+	w     io.Writer
+	watch *idleWatch
+}
+
+func (iw idleWriter) Write(p []byte) (int, error) {
+	iw.watch.touch()
+	return iw.w.Write(p)
+}
+
+// workDir cleans requested working directory and checks that it is an
+// existing directory within one of allowed work dirs, empty list allows any.
+// Symlinks are resolved, so that they can't lead out of allowed work dirs,
+// and allowlist is checked first, so that errors don't tell which paths
+// outside of it exist.
+func (a *agent) workDir(dir string) (string, error) {
+	if dir == "" {
+		return "", errors.Wrap(errInvalidHint, fmt.Errorf("%s is empty", cwdHint))
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", errors.Wrap(errInvalidHint, err)
+	}
+	dir = abs
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	if !a.allowedWorkDir(dir) {
+		return "", errors.Wrap(errWorkDirNotAllowed, fmt.Errorf("%s", abs))
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return "", errors.Wrap(errInvalidHint, err)
+	}
+	if !fi.IsDir() {
+		return "", errors.Wrap(errInvalidHint, fmt.Errorf("%s is not a directory", abs))
+	}
+	return dir, nil
+}
+
+// allowedWorkDir checks whether resolved dir is within one of allowed work dirs.
+func (a *agent) allowedWorkDir(dir string) bool {
+	allowed := a.cfg().Exec.AllowedWorkDirs
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, d := range allowed {
+		d, err := filepath.Abs(d)
+		if err != nil {
+			continue
+		}
+		if real, err := filepath.EvalSymlinks(d); err == nil {
+			d = real
+		}
+		if dir == d || strings.HasPrefix(dir, d+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// outputRecords creates SenML records for command output.
+// If output is longer than max bytes it is truncated and records
+// with number of dropped bytes and original size are appended.
+// Truncation is disabled if max <= 0.
+func outputRecords(name string, out []byte, max int) []senml.Record {
+	total := len(out)
+	out = truncate(out, max)
+	val := string(out)
+	records := []senml.Record{
+		senml.Record{
+			Name:        name,
+			StringValue: &val,
+		},
+	}
+
+	if dropped := total - len(out); dropped > 0 {
+		d, t := float64(dropped), float64(total)
+		records = append(records,
+			senml.Record{
+				Name:  truncatedBytes,
+				Unit:  "B",
+				Value: &d,
+			},
+			senml.Record{
+				Name:  totalBytes,
+				Unit:  "B",
+				Value: &t,
+			},
+		)
+	}
+	return records
+}
+
+// outputHashRecord creates SenML record with hex encoded SHA-256 of the
+// complete output, so that consumers can verify the output and tell
+// whether it is truncated.
+func outputHashRecord(out []byte) senml.Record {
+	sum := sha256.Sum256(out)
+	h := hex.EncodeToString(sum[:])
+	return senml.Record{
+		Name:        outputSHA256,
+		StringValue: &h,
+	}
+}
+
+// truncateLines cuts output to at most max lines and returns it together
+// with number of dropped lines. Truncation is disabled if max <= 0.
+func truncateLines(out []byte, max int) ([]byte, int) {
+	if max <= 0 {
+		return out, 0
+	}
+	n, i := 0, 0
+	for n < max {
+		j := bytes.IndexByte(out[i:], '\n')
+		if j < 0 {
+			return out, 0
+		}
+		i += j + 1
+		n++
+	}
+	rest := out[i:]
+	if len(rest) == 0 {
+		return out, 0
+	}
+	dropped := bytes.Count(rest, []byte{'\n'})
+	if rest[len(rest)-1] != '\n' {
+		dropped++
+	}
+	return out[:i], dropped
+}
+
+// truncate cuts output to at most max bytes without splitting multi-byte characters.
+func truncate(out []byte, max int) []byte {
+	if max <= 0 || len(out) <= max {
+		return out
+	}
+	n := max
+	for n > 0 && !utf8.RuneStart(out[n]) {
+		n--
+	}
+	return out[:n]
+}
+
+// filterLines returns lines of output matching the regular expression.
+func filterLines(out []byte, re *regexp.Regexp) []byte {
+	var b bytes.Buffer
+	lf := &lineFilter{w: &b, re: re}
+	lf.Write(out)
+	lf.Flush()
+	return b.Bytes()
+}
+
+// lineFilter writes only lines matching the regular expression
+// to the underlying writer. Incomplete line is kept until Flush.
+type lineFilter struct {
+	w   io.Writer
+	re  *regexp.Regexp
+	buf []byte
+}
+
+func (lf *lineFilter) Write(p []byte) (int, error) {
+	lf.buf = append(lf.buf, p...)
+	for {
+		i := bytes.IndexByte(lf.buf, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := lf.buf[:i+1]
+		lf.buf = lf.buf[i+1:]
+		if lf.re.Match(line[:i]) {
+			if _, err := lf.w.Write(line); err != nil {
+				return len(p), err
+			}
+		}
+	}
+}
+
+// Flush writes remaining incomplete line if it matches.
+func (lf *lineFilter) Flush() error {
+	line := lf.buf
+	lf.buf = nil
+	if len(line) == 0 || !lf.re.Match(line) {
+		return nil
+	}
+	_, err := lf.w.Write(line)
+	return err
+}
@@ -0,0 +1,644 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputRecords(t *testing.T) {
+	cases := []struct {
+		desc    string
+		out     string
+		max     int
+		value   string
+		dropped float64
+	}{
+		{"output shorter than limit", "hello", 10, "hello", 0},
+		{"output equal to limit", "hello", 5, "hello", 0},
+		{"output longer than limit", "hello world", 5, "hello", 6},
+		{"truncation disabled", strings.Repeat("a", 100), 0, strings.Repeat("a", 100), 0},
+		{"multi-byte character on limit", "abcč", 4, "abc", 2},
+	}
+
+	for _, tc := range cases {
+		records := outputRecords("cmd", []byte(tc.out), tc.max)
+		assert.Equal(t, "cmd", records[0].Name, fmt.Sprintf("%s: expected name %s got %s", tc.desc, "cmd", records[0].Name))
+		assert.Equal(t, tc.value, *records[0].StringValue, fmt.Sprintf("%s: expected value %s got %s", tc.desc, tc.value, *records[0].StringValue))
+		if tc.dropped == 0 {
+			assert.Len(t, records, 1, fmt.Sprintf("%s: expected no truncation records", tc.desc))
+			continue
+		}
+		assert.Len(t, records, 3, fmt.Sprintf("%s: expected truncation records", tc.desc))
+		assert.Equal(t, truncatedBytes, records[1].Name, fmt.Sprintf("%s: expected name %s got %s", tc.desc, truncatedBytes, records[1].Name))
+		assert.Equal(t, tc.dropped, *records[1].Value, fmt.Sprintf("%s: expected %v dropped bytes got %v", tc.desc, tc.dropped, *records[1].Value))
+		assert.Equal(t, totalBytes, records[2].Name, fmt.Sprintf("%s: expected name %s got %s", tc.desc, totalBytes, records[2].Name))
+		assert.Equal(t, float64(len(tc.out)), *records[2].Value, fmt.Sprintf("%s: expected %d total bytes got %v", tc.desc, len(tc.out), *records[2].Value))
+	}
+}
+
+func TestOutputHashRecord(t *testing.T) {
+	cases := []struct {
+		desc string
+		out  string
+		hash string
+	}{
+		{"empty output", "", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{"output", "test", "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+	}
+
+	for _, tc := range cases {
+		r := outputHashRecord([]byte(tc.out))
+		assert.Equal(t, outputSHA256, r.Name, fmt.Sprintf("%s: expected name %s got %s", tc.desc, outputSHA256, r.Name))
+		assert.Equal(t, tc.hash, *r.StringValue, fmt.Sprintf("%s: expected hash %s got %s", tc.desc, tc.hash, *r.StringValue))
+	}
+}
+
+func TestCommand(t *testing.T) {
+	cases := []struct {
+		desc      string
+		shell     bool
+		allowlist []string
+		cmd       string
+		name      string
+		out       string
+		err       error
+	}{
+		{"piped command with shell hint", false, nil, "shell=true;echo hello | tr a-z A-Z", shell, "HELLO\n", nil},
+		{"piped command with shell default", true, nil, "echo hello | tr a-z A-Z", shell, "HELLO\n", nil},
+		{"piped command with shell disabled by hint", true, nil, "shell=false;echo, hello", "echo", "hello\n", nil},
+		{"command without shell", false, nil, "echo, hello", "echo", "hello\n", nil},
+		{"piped command with allowed shell", false, []string{shell}, "shell=true;echo hello | tr a-z A-Z", shell, "HELLO\n", nil},
+		{"piped command with shell not allowed", false, []string{"echo"}, "shell=true;echo hello | tr a-z A-Z", "", "", errCommandNotAllowed},
+		{"empty shell command", false, nil, "shell=true; ", "", "", ErrInvalidCommand},
+		{"invalid shell hint", false, nil, "shell=maybe;echo hello", "", "", errInvalidHint},
+		{"unknown hint", false, nil, "foo=bar;echo hello", "", "", errInvalidHint},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: ExecConfig{Shell: tc.shell, Allowlist: tc.allowlist}}}
+		c, _, err := a.command(tc.cmd)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		name := c.Args[0]
+		assert.Equal(t, tc.name, name, fmt.Sprintf("%s: expected name %s got %s", tc.desc, tc.name, name))
+		out, err := c.CombinedOutput()
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		assert.Equal(t, tc.out, string(out), fmt.Sprintf("%s: expected output %s got %s", tc.desc, tc.out, string(out)))
+	}
+}
+
+func TestWorkDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(root)
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		t.Fatalf("failed to resolve temp dir: %s", err)
+	}
+	sub := filepath.Join(root, "sub")
+	sibling := filepath.Join(root, "submarine")
+	for _, d := range []string{sub, sibling} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatalf("failed to create dir: %s", err)
+		}
+	}
+	file := filepath.Join(root, "file")
+	if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	escape := filepath.Join(sub, "escape")
+	inner := filepath.Join(root, "inner")
+	link := filepath.Join(root, "link")
+	for target, l := range map[string]string{"/": escape, sub: inner, root: link} {
+		if err := os.Symlink(target, l); err != nil {
+			t.Fatalf("failed to create symlink: %s", err)
+		}
+	}
+
+	cases := []struct {
+		desc    string
+		allowed []string
+		dir     string
+		res     string
+		err     error
+	}{
+		{"any dir allowed", nil, sub, sub, nil},
+		{"allowed dir", []string{root}, root, root, nil},
+		{"allowed subdir", []string{root}, sub, sub, nil},
+		{"traversal out of allowed dir", []string{sub}, sub + "/..", "", errWorkDirNotAllowed},
+		{"dir with allowed prefix", []string{sub}, sibling, "", errWorkDirNotAllowed},
+		{"symlink out of allowed dir", []string{sub}, escape, "", errWorkDirNotAllowed},
+		{"symlink out of allowed dir in path", []string{sub}, filepath.Join(escape, "etc"), "", errWorkDirNotAllowed},
+		{"symlink within allowed dir", []string{root}, inner, sub, nil},
+		{"symlinked allowed dir", []string{link}, sub, sub, nil},
+		{"non existing dir", nil, filepath.Join(root, "none"), "", errInvalidHint},
+		{"non existing dir out of allowed dir", []string{sub}, filepath.Join(root, "none"), "", errWorkDirNotAllowed},
+		{"file out of allowed dir", []string{sub}, file, "", errWorkDirNotAllowed},
+		{"file", nil, file, "", errInvalidHint},
+		{"empty dir", nil, "", "", errInvalidHint},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: ExecConfig{AllowedWorkDirs: tc.allowed}}}
+		dir, err := a.workDir(tc.dir)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, dir, fmt.Sprintf("%s: expected dir %s got %s", tc.desc, tc.res, dir))
+	}
+
+	a := &agent{config: &Config{Exec: ExecConfig{AllowedWorkDirs: []string{root}}}}
+	c, _, err := a.command(fmt.Sprintf("cwd=%s;pwd, -P", sub))
+	assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	out, err := c.Output()
+	assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	real, _ := filepath.EvalSymlinks(sub)
+	assert.Equal(t, real+"\n", string(out), fmt.Sprintf("expected output %s got %s", real, string(out)))
+}
+
+func TestMaxBytesHint(t *testing.T) {
+	cases := []struct {
+		desc    string
+		max     int
+		hardCap int
+		cmd     string
+		res     int
+		err     error
+	}{
+		{"global limit", 100, 1000, "echo, hello", 100, nil},
+		{"limit from hint", 100, 1000, "maxbytes=500;echo, hello", 500, nil},
+		{"hint over hard cap", 100, 1000, "maxbytes=5000;echo, hello", 1000, nil},
+		{"hint disabling truncation with hard cap", 100, 1000, "maxbytes=0;echo, hello", 1000, nil},
+		{"hint without hard cap", 100, 0, "maxbytes=5000;echo, hello", 5000, nil},
+		{"invalid hint", 100, 1000, "maxbytes=-1;echo, hello", 0, errInvalidHint},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: ExecConfig{MaxOutputSize: tc.max, MaxOutputHardCap: tc.hardCap}}}
+		_, opts, err := a.command(tc.cmd)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, tc.res, opts.maxBytes, fmt.Sprintf("%s: expected limit %d got %d", tc.desc, tc.res, opts.maxBytes))
+	}
+}
+
+func TestNiceHint(t *testing.T) {
+	cases := []struct {
+		desc string
+		nice int
+		cmd  string
+		res  int
+		err  error
+	}{
+		{"default niceness", 5, "echo, hello", 5, nil},
+		{"niceness from hint", 5, "nice=10;echo, hello", 10, nil},
+		{"negative niceness", 0, "nice=-5;echo, hello", -5, nil},
+		{"niceness out of range", 0, "nice=20;echo, hello", 0, errInvalidNice},
+		{"invalid hint", 0, "nice=low;echo, hello", 0, errInvalidHint},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: ExecConfig{DefaultNice: tc.nice}}}
+		_, opts, err := a.command(tc.cmd)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, tc.res, opts.nice, fmt.Sprintf("%s: expected niceness %d got %d", tc.desc, tc.res, opts.nice))
+	}
+}
+
+func TestRenice(t *testing.T) {
+	a := &agent{
+		config:   &Config{},
+		safeMode: &safeMode{},
+		procs:    make(map[int]*process),
+	}
+	var buf bytes.Buffer
+	_, _, _, err := a.execute("1", "nice=7;shell=true;sleep 0.2; nice", &buf)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, "7", strings.TrimSpace(buf.String()), fmt.Sprintf("expected niceness 7 got %s", buf.String()))
+}
+
+func TestTimeout(t *testing.T) {
+	exec := ExecConfig{
+		Timeout: time.Second,
+		Timeouts: map[string]time.Duration{
+			"sl":    time.Minute,
+			"sleep": 10 * time.Millisecond,
+		},
+	}
+	cases := []struct {
+		desc    string
+		shell   bool
+		cmd     string
+		timeout time.Duration
+		err     error
+	}{
+		{"default timeout", false, "echo, hello", time.Second, nil},
+		{"longest matching prefix", false, "sleep, 1", 10 * time.Millisecond, errExecTimeout},
+		{"matching prefix in shell mode", true, "sleep 1", 10 * time.Millisecond, errExecTimeout},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: exec}}
+		a.config.Exec.Shell = tc.shell
+		c, opts, err := a.command(tc.cmd)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		timeout := a.timeout(c.Args[0])
+		if tc.shell {
+			timeout = a.timeout(strings.Fields(c.Args[2])[0])
+		}
+		assert.Equal(t, tc.timeout, timeout, fmt.Sprintf("%s: expected timeout %s got %s", tc.desc, tc.timeout, timeout))
+		if err = c.Run(); err != nil {
+			err = execError(opts, err)
+		}
+		opts.cancel()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	cases := []struct {
+		desc string
+		idle time.Duration
+		cmd  string
+		err  error
+	}{
+		{"idle timeout disabled", 0, "shell=true;sleep 0.1", nil},
+		{"output resets idle timer", 0, "shell=true;idle=200ms;for i in 1 2 3; do echo $i; sleep 0.1; done", nil},
+		{"silent command killed", 0, "shell=true;idle=50ms;echo start; exec sleep 1", errExecIdle},
+		{"default idle timeout", 50 * time.Millisecond, "shell=true;exec sleep 1", errExecIdle},
+		{"invalid idle hint", 0, "shell=true;idle=-1s;sleep 1", errInvalidHint},
+	}
+
+	for _, tc := range cases {
+		a := &agent{
+			config: &Config{Exec: ExecConfig{IdleTimeout: tc.idle}},
+			procs:  make(map[int]*process),
+		}
+		c, opts, err := a.command(tc.cmd)
+		if err == nil {
+			var buf bytes.Buffer
+			w := opts.writer(&buf)
+			c.Stdout, c.Stderr = w, w
+			if err = a.run("1", c, opts); err != nil {
+				err = execError(opts, err)
+			}
+			opts.cancel()
+		}
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+}
+
+func TestCheckLength(t *testing.T) {
+	long := strings.Repeat("a", 100)
+	cases := []struct {
+		desc string
+		max  int
+		cmd  string
+		res  string
+		err  error
+	}{
+		{"limit disabled", 0, long, long, nil},
+		{"command shorter than limit", 200, long, long, nil},
+		{"command equal to limit", 100, long, long, nil},
+		{"command longer than limit", 10, long, long[:rejectedPrefixLen] + "...", errCommandTooLong},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Exec: ExecConfig{MaxCommandLength: tc.max}}}
+		res, err := a.checkLength(tc.cmd)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected command %s got %s", tc.desc, tc.res, res))
+	}
+}
+
+func TestRetries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "retries")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := []struct {
+		desc     string
+		exec     ExecConfig
+		cmd      string
+		attempts int
+		err      error
+	}{
+		{"success after retries", ExecConfig{}, "retries=2;shell=true;echo >> %s; test $(wc -l < %s) -ge 3", 3, nil},
+		{"failure after retries", ExecConfig{}, "retries=1;shell=true;echo >> %s; test $(wc -l < %s) -ge 3", 2, errFailedExecute},
+		{"default retries", ExecConfig{DefaultRetries: 3}, "shell=true;echo >> %s; test $(wc -l < %s) -ge 3", 3, nil},
+		{"retries disabled", ExecConfig{DefaultRetries: 3}, "retries=0;shell=true;echo >> %s; test $(wc -l < %s) -ge 3", 1, errFailedExecute},
+		{"timeout not retried", ExecConfig{Timeout: 10 * time.Millisecond}, "retries=3;shell=true;echo >> %s; exec sleep 1 # %s", 1, errExecTimeout},
+		{"invalid hint", ExecConfig{}, "retries=-1;shell=true;echo >> %s; test -f %s", 1, errInvalidHint},
+	}
+
+	for i, tc := range cases {
+		file := filepath.Join(dir, strconv.Itoa(i))
+		tc.exec.RetryDelay = time.Millisecond
+		a := &agent{
+			config:   &Config{Exec: tc.exec},
+			safeMode: &safeMode{},
+			procs:    make(map[int]*process),
+		}
+		var buf bytes.Buffer
+		_, _, attempts, err := a.execute("1", fmt.Sprintf(tc.cmd, file, file), &buf)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.attempts, attempts, fmt.Sprintf("%s: expected %d attempts got %d", tc.desc, tc.attempts, attempts))
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		desc     string
+		script   string
+		cmd      string
+		attempts int
+		elapsed  time.Duration
+		err      error
+	}{
+		{"no delay on success", "exit 0", "retries=2;backup,--full", 1, 0, nil},
+		{"delay between failed attempts", "exit 1", "retries=2;backup,--full", 3, 2 * time.Hour, errFailedExecute},
+	}
+
+	for _, tc := range cases {
+		clock := mocks.NewClock(start)
+		executor := mocks.NewExecutor(tc.script)
+		a := &agent{
+			config:   &Config{Exec: ExecConfig{RetryDelay: time.Hour}},
+			safeMode: &safeMode{},
+			procs:    make(map[int]*process),
+			clock:    clock,
+			executor: executor,
+		}
+		var buf bytes.Buffer
+		_, _, attempts, err := a.execute("1", tc.cmd, &buf)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.attempts, attempts, fmt.Sprintf("%s: expected %d attempts got %d", tc.desc, tc.attempts, attempts))
+		elapsed := clock.Now().Sub(start)
+		assert.Equal(t, tc.elapsed, elapsed, fmt.Sprintf("%s: expected %s delay got %s", tc.desc, tc.elapsed, elapsed))
+		calls := executor.Calls()
+		assert.Equal(t, tc.attempts, len(calls), fmt.Sprintf("%s: expected %d commands got %d", tc.desc, tc.attempts, len(calls)))
+		for _, c := range calls {
+			assert.Equal(t, []string{"backup", "--full"}, c, fmt.Sprintf("%s: unexpected command %v", tc.desc, c))
+		}
+	}
+}
+
+func TestIdleWatch(t *testing.T) {
+	clock := mocks.NewClock(time.Now())
+	canceled := false
+	iw := &idleWatch{timeout: time.Minute, cancel: func() { canceled = true }, clock: clock}
+	iw.start()
+
+	steps := []struct {
+		desc    string
+		advance time.Duration
+		touch   bool
+		fired   bool
+	}{
+		{"before timeout", 50 * time.Second, false, false},
+		{"output resets timer", 0, true, false},
+		{"timeout since start", 20 * time.Second, false, false},
+		{"timeout since output", 40 * time.Second, false, true},
+	}
+
+	for _, st := range steps {
+		if st.touch {
+			iw.touch()
+		}
+		clock.Advance(st.advance)
+		assert.Equal(t, st.fired, iw.fired(), fmt.Sprintf("%s: expected fired %t got %t", st.desc, st.fired, iw.fired()))
+		assert.Equal(t, st.fired, canceled, fmt.Sprintf("%s: expected canceled %t got %t", st.desc, st.fired, canceled))
+	}
+	iw.stop()
+	assert.Equal(t, 0, clock.Timers(), fmt.Sprintf("expected no active timers got %d", clock.Timers()))
+}
+
+func TestTruncateLines(t *testing.T) {
+	cases := []struct {
+		desc    string
+		out     string
+		max     int
+		res     string
+		dropped int
+	}{
+		{"truncation disabled", "a\nb\nc\n", 0, "a\nb\nc\n", 0},
+		{"output shorter than limit", "a\nb\n", 5, "a\nb\n", 0},
+		{"output equal to limit", "a\nb\n", 2, "a\nb\n", 0},
+		{"output longer than limit", "a\nb\nc\nd\n", 2, "a\nb\n", 2},
+		{"last line without newline", "a\nb\nc", 1, "a\n", 2},
+	}
+
+	for _, tc := range cases {
+		res, dropped := truncateLines([]byte(tc.out), tc.max)
+		assert.Equal(t, tc.res, string(res), fmt.Sprintf("%s: expected output %q got %q", tc.desc, tc.res, string(res)))
+		assert.Equal(t, tc.dropped, dropped, fmt.Sprintf("%s: expected %d dropped lines got %d", tc.desc, tc.dropped, dropped))
+	}
+}
+
+func TestRender(t *testing.T) {
+	os.Setenv("AGENT_TEST_SITE", "site-1")
+	os.Setenv("AGENT_TEST_UNSAFE", "a;rm -rf /")
+	defer os.Unsetenv("AGENT_TEST_SITE")
+	defer os.Unsetenv("AGENT_TEST_UNSAFE")
+
+	cases := []struct {
+		desc   string
+		device string
+		env    []string
+		cmd    string
+		res    string
+		err    error
+	}{
+		{"command without template", "dev-1", nil, "echo, hello", "echo, hello", nil},
+		{"device id", "dev-1", nil, "backup,--device,{{.Device.ID}}", "backup,--device,dev-1", nil},
+		{"allowed env", "dev-1", []string{"AGENT_TEST_SITE"}, "echo,{{.Env.AGENT_TEST_SITE}}", "echo,site-1", nil},
+		{"env not allowed", "dev-1", nil, "echo,{{.Env.AGENT_TEST_SITE}}", "", errInvalidTemplate},
+		{"unsafe env", "dev-1", []string{"AGENT_TEST_UNSAFE"}, "echo,{{.Env.AGENT_TEST_UNSAFE}}", "", errInvalidTemplate},
+		{"unsafe device id", "dev,1", nil, "echo,{{.Device.ID}}", "", errInvalidTemplate},
+		{"invalid template", "dev-1", nil, "echo,{{.Device.ID", "", errInvalidTemplate},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{Device: DeviceConfig{ID: tc.device}, Exec: ExecConfig{TemplateEnv: tc.env}}}
+		res, err := a.render(tc.cmd)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected command %s got %s", tc.desc, tc.res, res))
+	}
+}
+
+func TestOutputRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	a := &agent{config: &Config{Exec: ExecConfig{OutputDir: dir, OutputMaxSize: 10}}}
+	old := filepath.Join(dir, "old"+outputExt)
+	if err := ioutil.WriteFile(old, []byte("old output"), 0600); err != nil {
+		t.Fatalf("failed to write output: %s", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(old, past, past)
+
+	id, err := a.saveOutput(dir, "1/../2", []byte("full output"))
+	assert.Nil(t, err, fmt.Sprintf("unexpected error saving output: %s", err))
+	assert.Equal(t, "1____2", id, fmt.Sprintf("expected id 1____2 got %s", id))
+	_, err = os.Stat(old)
+	assert.True(t, os.IsNotExist(err), "expected the oldest output to be pruned")
+
+	cases := []struct {
+		desc string
+		args []string
+		res  string
+		err  error
+	}{
+		{"whole output", []string{id}, "full output", nil},
+		{"output from offset", []string{id, "5"}, "output", nil},
+		{"output range", []string{id, "0", "4"}, "full", nil},
+		{"pruned output", []string{"old"}, "", errOutputNotFound},
+		{"invalid id", []string{"../" + id}, "", errOutputNotFound},
+		{"invalid offset", []string{id, "-1"}, "", ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		res, err := a.getOutput(tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected output %s got %s", tc.desc, tc.res, res))
+	}
+}
+
+func TestExecKill(t *testing.T) {
+	a := &agent{
+		config: &Config{},
+		procs:  make(map[int]*process),
+	}
+	c, opts, err := a.command("sleep, 10")
+	if err != nil {
+		t.Fatalf("failed to create command: %s", err)
+	}
+	defer opts.cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- a.run("1", c, opts)
+	}()
+
+	var procs []process
+	for i := 0; i < 100 && len(procs) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		list, err := a.execList()
+		assert.Nil(t, err, fmt.Sprintf("unexpected error listing processes: %s", err))
+		json.Unmarshal([]byte(list), &procs)
+	}
+	if !assert.Equal(t, 1, len(procs), "expected one running process") {
+		return
+	}
+	assert.Equal(t, "1", procs[0].UUID, fmt.Sprintf("expected uuid 1 got %s", procs[0].UUID))
+	assert.Equal(t, "sleep 10", procs[0].Command, fmt.Sprintf("expected command sleep 10 got %s", procs[0].Command))
+
+	err = a.execKill("0")
+	assert.True(t, errors.Contains(err, errProcessNotFound), fmt.Sprintf("expected error %s got %s", errProcessNotFound, err))
+	err = a.execKill(strconv.Itoa(procs[0].PID))
+	assert.Nil(t, err, fmt.Sprintf("unexpected error killing process: %s", err))
+
+	select {
+	case err = <-done:
+		err = execError(opts, err)
+		assert.True(t, errors.Contains(err, errExecKilled), fmt.Sprintf("expected error %s got %s", errExecKilled, err))
+	case <-time.After(5 * time.Second):
+		t.Fatal("process wasn't killed")
+	}
+	list, _ := a.execList()
+	assert.Equal(t, "[]", list, fmt.Sprintf("expected no running processes got %s", list))
+}
+
+func TestStripRoute(t *testing.T) {
+	cases := []struct {
+		desc    string
+		pattern string
+		cmd     string
+		res     string
+		token   string
+	}{
+		{"token group", `^(route\d+):`, "route42:echo,hi", "echo,hi", "route42"},
+		{"whole match", `^route\d+:`, "route42:echo,hi", "echo,hi", "route42:"},
+		{"no match", `^(route\d+):`, "echo,route42:", "echo,route42:", ""},
+		{"match not at start", `(route\d+):`, "echo,route42:hi", "echo,route42:hi", ""},
+	}
+
+	for _, tc := range cases {
+		a := &agent{routeRe: regexp.MustCompile(tc.pattern)}
+		res := a.stripRoute("1", tc.cmd)
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected command %s got %s", tc.desc, tc.res, res))
+		records := a.routeRecords("1", nil)
+		token := ""
+		if len(records) > 0 {
+			token = *records[0].StringValue
+		}
+		assert.Equal(t, tc.token, token, fmt.Sprintf("%s: expected token %s got %s", tc.desc, tc.token, token))
+		a.clearRoute("1")
+		records = a.routeRecords("1", nil)
+		assert.Equal(t, 0, len(records), fmt.Sprintf("%s: expected token to be cleared", tc.desc))
+	}
+}
+
+func TestValidateExec(t *testing.T) {
+	cases := []struct {
+		desc     string
+		exec     ExecConfig
+		safeMode bool
+		cmd      string
+		valid    bool
+		code     int
+	}{
+		{"valid command", ExecConfig{}, false, "echo, hello", true, CodeSuccess},
+		{"binary not allowed", ExecConfig{Allowlist: []string{"ls"}}, false, "echo, hello", false, CodeNotAllowed},
+		{"safe mode", ExecConfig{}, true, "echo, hello", false, CodeDisabled},
+		{"missing arguments", ExecConfig{}, false, "echo", false, CodeInvalidCommand},
+		{"invalid hint", ExecConfig{}, false, "maxlines=x;echo, hello", false, CodeInvalidCommand},
+		{"binary not found", ExecConfig{}, false, "no-such-binary-agent, hello", false, CodeFailure},
+		{"shell command with spaces", ExecConfig{Shell: true}, false, "echo hello world", true, CodeSuccess},
+	}
+
+	for _, tc := range cases {
+		a := &agent{
+			config:   &Config{Exec: tc.exec},
+			safeMode: &safeMode{enabled: tc.safeMode},
+		}
+		records := a.validateExec("1", tc.cmd)
+		valid := *records[0].BoolValue
+		assert.Equal(t, tc.valid, valid, fmt.Sprintf("%s: expected valid %t got %t", tc.desc, tc.valid, valid))
+		if tc.valid {
+			assert.Equal(t, 1, len(records), fmt.Sprintf("%s: expected no reason got %d records", tc.desc, len(records)))
+			continue
+		}
+		code := int(*records[2].Value)
+		assert.Equal(t, tc.code, code, fmt.Sprintf("%s: expected reason code %d got %d", tc.desc, tc.code, code))
+	}
+}
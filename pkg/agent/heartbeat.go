@@ -1,6 +1,8 @@
 package agent
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,6 +13,13 @@ const (
 
 	service = "service"
 	device  = "device"
+
+	// TokenType maps heartbeat subject token to service type.
+	TokenType = "type"
+	// TokenVersion maps heartbeat subject token, and all the following ones, to service version.
+	TokenVersion = "version"
+	// TokenSkip ignores heartbeat subject token.
+	TokenSkip = "-"
 )
 
 // svc keeps info on service live status.
@@ -20,15 +29,21 @@ type svc struct {
 	info     Info
 	interval time.Duration
 	ticker   *time.Ticker
+	done     chan struct{}
+	notify   func(name, status string)
+	hold     func() time.Time
 	mu       sync.Mutex
 }
 
 type Info struct {
-	Name     string    `json:"name"`
-	LastSeen time.Time `json:"last_seen"`
-	Status   string    `json:"status"`
-	Type     string    `json:"type"`
-	Terminal int       `json:"terminal"`
+	Name      string            `json:"name"`
+	LastSeen  time.Time         `json:"last_seen"`
+	Status    string            `json:"status"`
+	Type      string            `json:"type"`
+	Version   string            `json:"version,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	DependsOn []string          `json:"depends_on,omitempty"`
+	Terminal  int               `json:"terminal"`
 }
 
 // Heartbeat specifies api for updating status and keeping track on services
@@ -36,11 +51,29 @@ type Info struct {
 type Heartbeat interface {
 	Update()
 	Info() Info
+	// SetVersion sets version of the service.
+	SetVersion(version string)
+	// SetLabels merges labels onto the service labels, label with
+	// empty value is removed. Returns whether labels changed.
+	SetLabels(labels map[string]string) bool
+	// SetDependencies replaces services the service depends on.
+	// Returns whether dependencies changed.
+	SetDependencies(deps []string) bool
+	// Close stops tracking service status.
+	Close()
 }
 
 // interval - duration of interval
 // if service doesnt send heartbeat during  interval it is marked offline
 func NewHeartbeat(name, svcType string, interval time.Duration) Heartbeat {
+	return newHeartbeat(name, svcType, interval, nil, nil)
+}
+
+// newHeartbeat tracks new service, notify is called with service name
+// and its new status when status changes. Service isn't marked offline
+// until interval passes after time returned by hold. Notify and hold are
+// ignored if nil.
+func newHeartbeat(name, svcType string, interval time.Duration, notify func(name, status string), hold func() time.Time) Heartbeat {
 	ticker := time.NewTicker(interval)
 	s := svc{
 		info: Info{
@@ -51,6 +84,25 @@ func NewHeartbeat(name, svcType string, interval time.Duration) Heartbeat {
 		},
 		ticker:   ticker,
 		interval: interval,
+		done:     make(chan struct{}, 1),
+		notify:   notify,
+		hold:     hold,
+	}
+	s.listen()
+	return &s
+}
+
+// restoreHeartbeat tracks previously registered service, it is
+// marked offline until the next heartbeat arrives.
+func restoreHeartbeat(info Info, interval time.Duration, notify func(name, status string), hold func() time.Time) Heartbeat {
+	info.Status = offline
+	s := svc{
+		info:     info,
+		ticker:   time.NewTicker(interval),
+		interval: interval,
+		done:     make(chan struct{}, 1),
+		notify:   notify,
+		hold:     hold,
 	}
 	s.listen()
 	return &s
@@ -64,22 +116,161 @@ func (s *svc) listen() {
 				// TODO - we can disable ticker when the status gets OFFLINE
 				// and on the next heartbeat enable it again
 				s.mu.Lock()
-				if time.Now().After(s.info.LastSeen.Add(s.interval)) {
+				changed := false
+				if s.expired(time.Now()) {
+					changed = s.info.Status != offline
 					s.info.Status = offline
 				}
 				s.mu.Unlock()
+				if changed {
+					s.changed(offline)
+				}
+			case <-s.done:
+				return
 			}
 		}
 	}()
 }
 
+// expired checks whether service didn't send heartbeat for the interval,
+// not counting the time offline detection was held. Must be called with
+// lock held.
+func (s *svc) expired(now time.Time) bool {
+	seen := s.info.LastSeen
+	if s.hold != nil {
+		if h := s.hold(); h.After(seen) {
+			seen = h
+		}
+	}
+	return now.After(seen.Add(s.interval))
+}
+
+func (s *svc) Close() {
+	s.ticker.Stop()
+	s.done <- struct{}{}
+}
+
 func (s *svc) Update() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
+	changed := s.info.Status != online
 	s.info.LastSeen = time.Now()
 	s.info.Status = online
+	s.mu.Unlock()
+	if changed {
+		s.changed(online)
+	}
+}
+
+// changed notifies status change, it must be called without lock held.
+func (s *svc) changed(status string) {
+	if s.notify != nil {
+		s.notify(s.info.Name, status)
+	}
 }
 
 func (s *svc) Info() Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.info
 }
+
+func (s *svc) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.info.Version = version
+}
+
+func (s *svc) SetLabels(labels map[string]string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	merged, changed := mergeLabels(s.info.Labels, labels)
+	s.info.Labels = merged
+	return changed
+}
+
+func (s *svc) SetDependencies(deps []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(deps) == len(s.info.DependsOn) {
+		same := true
+		for i := range deps {
+			if deps[i] != s.info.DependsOn[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return false
+		}
+	}
+	s.info.DependsOn = nil
+	if len(deps) > 0 {
+		s.info.DependsOn = append([]string{}, deps...)
+	}
+	return true
+}
+
+// heartbeatMsg holds service name and metadata parsed from heartbeat
+// subject and payload. Dependencies are nil if heartbeat doesn't report them.
+type heartbeatMsg struct {
+	name      string
+	typ       string
+	version   string
+	labels    map[string]string
+	dependsOn []string
+}
+
+// subjectParser extracts service name and metadata from heartbeat subject
+// matching the pattern. Name is the first token matched by the pattern
+// wildcard, tokens following it are mapped to metadata fields in order.
+// Version takes all the remaining tokens, i.e. `v1.2.3`.
+type subjectParser struct {
+	pattern string
+	prefix  int
+	tokens  []string
+}
+
+func newSubjectParser(pattern string, tokens []string) (subjectParser, error) {
+	for i, t := range tokens {
+		if t != TokenType && t != TokenVersion && t != TokenSkip {
+			return subjectParser{}, fmt.Errorf("unknown heartbeat token %q", t)
+		}
+		if t == TokenVersion && i != len(tokens)-1 {
+			return subjectParser{}, fmt.Errorf("heartbeat token %q must be the last one", t)
+		}
+	}
+	tok := strings.Split(pattern, ".")
+	prefix := len(tok)
+	for i, t := range tok {
+		if t == "*" || t == ">" {
+			prefix = i
+			break
+		}
+	}
+	return subjectParser{
+		pattern: pattern,
+		prefix:  prefix,
+		tokens:  tokens,
+	}, nil
+}
+
+func (p subjectParser) parse(subject string) (heartbeatMsg, error) {
+	tok := strings.Split(subject, ".")
+	if len(tok) <= p.prefix {
+		return heartbeatMsg{}, fmt.Errorf("subject %s has incorrect length for pattern %s", subject, p.pattern)
+	}
+	hb := heartbeatMsg{name: tok[p.prefix]}
+	rest := tok[p.prefix+1:]
+	for i, t := range p.tokens {
+		if i >= len(rest) {
+			break
+		}
+		switch t {
+		case TokenType:
+			hb.typ = rest[i]
+		case TokenVersion:
+			hb.version = strings.Join(rest[i:], ".")
+		}
+	}
+	return hb, nil
+}
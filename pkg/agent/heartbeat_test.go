@@ -0,0 +1,72 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubjectParser(t *testing.T) {
+	cases := []struct {
+		desc    string
+		pattern string
+		tokens  []string
+		subject string
+		hb      heartbeatMsg
+		err     bool
+	}{
+		{"name and type", "heartbeat.>", []string{TokenType}, "heartbeat.export.service", heartbeatMsg{name: "export", typ: "service"}, false},
+		{"name only", "hb.*", []string{TokenType}, "hb.duster", heartbeatMsg{name: "duster"}, false},
+		{"version", "heartbeat.>", []string{TokenVersion}, "heartbeat.export.v1.2.3", heartbeatMsg{name: "export", version: "v1.2.3"}, false},
+		{"type and version", "heartbeat.>", []string{TokenType, TokenVersion}, "heartbeat.export.service.v1.2.3", heartbeatMsg{name: "export", typ: "service", version: "v1.2.3"}, false},
+		{"skipped token", "heartbeat.>", []string{TokenSkip, TokenType}, "heartbeat.export.eu.service", heartbeatMsg{name: "export", typ: "service"}, false},
+		{"short subject", "heartbeat.>", []string{TokenType}, "heartbeat", heartbeatMsg{}, true},
+	}
+
+	for _, tc := range cases {
+		p, err := newSubjectParser(tc.pattern, tc.tokens)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error creating parser: %s", tc.desc, err))
+		hb, err := p.parse(tc.subject)
+		assert.Equal(t, tc.err, err != nil, fmt.Sprintf("%s: expected error %t got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.hb, hb, fmt.Sprintf("%s: expected %v got %v", tc.desc, tc.hb, hb))
+	}
+
+	_, err := newSubjectParser("heartbeat.>", []string{TokenVersion, TokenType})
+	assert.NotNil(t, err, "expected error when version isn't the last token")
+	_, err = newSubjectParser("heartbeat.>", []string{"owner"})
+	assert.NotNil(t, err, "expected error for unknown token")
+}
+
+func TestHeartbeatNotify(t *testing.T) {
+	notified := make(chan string, 2)
+	notify := func(name, status string) {
+		notified <- name + ":" + status
+	}
+	s := restoreHeartbeat(Info{Name: "svc", Status: online}, time.Hour, notify, nil)
+	defer s.Close()
+
+	s.Update()
+	s.Update()
+	assert.Equal(t, 1, len(notified), fmt.Sprintf("expected one transition got %d", len(notified)))
+	assert.Equal(t, "svc:online", <-notified, "expected transition to online")
+}
+
+func TestTransitionBatching(t *testing.T) {
+	a := &agent{config: &Config{Heartbeat: HeartbeatConfig{NotifyWindow: time.Hour}}}
+	a.notifyTransition("svc1", online)
+	a.notifyTransition("svc2", offline)
+	a.notifyTransition("svc1", offline)
+
+	records := transitionRecords(a.transitions)
+	assert.Equal(t, 3, len(records), fmt.Sprintf("expected 3 batched transitions got %d", len(records)))
+	expected := []string{"svc1:online", "svc2:offline", "svc1:offline"}
+	for i, r := range records {
+		got := r.Name + ":" + *r.StringValue
+		assert.Equal(t, expected[i], got, fmt.Sprintf("expected transition %s got %s", expected[i], got))
+	}
+}
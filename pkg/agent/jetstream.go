@@ -0,0 +1,118 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	jsAPITimeout   = 2 * time.Second
+	jsStreamNames  = "$JS.API.STREAM.NAMES"
+	jsConsumerInfo = "$JS.API.CONSUMER.INFO.%s.%s"
+	jsConsumerNew  = "$JS.API.CONSUMER.DURABLE.CREATE.%s.%s"
+	jsAck          = "+ACK"
+	jsDeliverTopic = "agent.%s.deliver"
+)
+
+// errJetStream indicates that JetStream durable consumer can't be used
+var errJetStream = errors.New("failed to create JetStream durable consumer")
+
+type jsStreamNamesReq struct {
+	Subject string `json:"subject"`
+}
+
+type jsConsumerConfig struct {
+	Durable        string `json:"durable_name"`
+	DeliverSubject string `json:"deliver_subject"`
+	DeliverPolicy  string `json:"deliver_policy"`
+	AckPolicy      string `json:"ack_policy"`
+	FilterSubject  string `json:"filter_subject"`
+}
+
+type jsConsumerReq struct {
+	Stream string           `json:"stream_name"`
+	Config jsConsumerConfig `json:"config"`
+}
+
+type jsAPIError struct {
+	Code        int    `json:"code"`
+	Description string `json:"description"`
+}
+
+type jsRes struct {
+	Error   *jsAPIError `json:"error"`
+	Streams []string    `json:"streams"`
+}
+
+// subscribeDurable subscribes to the subject through JetStream durable consumer,
+// so messages published while agent was disconnected are replayed on reconnect.
+// Delivered messages are acknowledged after the handler returns.
+func subscribeDurable(nc *nats.Conn, subject, durable string, cb nats.MsgHandler) (*nats.Subscription, error) {
+	var res jsRes
+	if err := jsRequest(nc, jsStreamNames, jsStreamNamesReq{Subject: subject}, &res); err != nil {
+		return nil, err
+	}
+	if len(res.Streams) == 0 {
+		return nil, errors.Wrap(errJetStream, fmt.Errorf("no stream for subject %s", subject))
+	}
+	stream := res.Streams[0]
+
+	deliver := fmt.Sprintf(jsDeliverTopic, durable)
+	sub, err := nc.Subscribe(deliver, func(msg *nats.Msg) {
+		cb(msg)
+		if msg.Reply != "" {
+			msg.Respond([]byte(jsAck))
+		}
+	})
+	if err != nil {
+		return nil, errors.Wrap(errJetStream, err)
+	}
+
+	req := jsConsumerReq{
+		Stream: stream,
+		Config: jsConsumerConfig{
+			Durable:        durable,
+			DeliverSubject: deliver,
+			DeliverPolicy:  "all",
+			AckPolicy:      "explicit",
+			FilterSubject:  subject,
+		},
+	}
+	if err := jsRequest(nc, fmt.Sprintf(jsConsumerNew, stream, durable), req, &jsRes{}); err != nil {
+		// Consumer created by previous run is reused.
+		if ierr := jsRequest(nc, fmt.Sprintf(jsConsumerInfo, stream, durable), nil, &jsRes{}); ierr != nil {
+			sub.Unsubscribe()
+			return nil, err
+		}
+	}
+	return sub, nil
+}
+
+func jsRequest(nc *nats.Conn, subject string, req, res interface{}) error {
+	var data []byte
+	if req != nil {
+		var err error
+		if data, err = json.Marshal(req); err != nil {
+			return errors.Wrap(errJetStream, err)
+		}
+	}
+	msg, err := nc.Request(subject, data, jsAPITimeout)
+	if err != nil {
+		return errors.Wrap(errJetStream, err)
+	}
+	var r jsRes
+	if err := json.Unmarshal(msg.Data, &r); err != nil {
+		return errors.Wrap(errJetStream, err)
+	}
+	if r.Error != nil {
+		return errors.Wrap(errJetStream, fmt.Errorf("%d %s", r.Error.Code, r.Error.Description))
+	}
+	return json.Unmarshal(msg.Data, res)
+}
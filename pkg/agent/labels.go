@@ -0,0 +1,103 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+// maxLabels is the maximum number of labels of a service.
+const maxLabels = 32
+
+// errInvalidLabels indicates heartbeat payload with malformed or too many labels
+var errInvalidLabels = errors.New("invalid service labels")
+
+// heartbeatPayload is optional JSON payload of heartbeat message,
+// i.e. `{"labels":{"location":"lab","role":"gateway"}}`.
+type heartbeatPayload struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// parseLabels returns labels carried by heartbeat payload,
+// nil is returned for empty payload.
+func parseLabels(data []byte) (map[string]string, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+	var p heartbeatPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errors.Wrap(errInvalidLabels, err)
+	}
+	if len(p.Labels) > maxLabels {
+		return nil, errors.Wrap(errInvalidLabels, fmt.Errorf("%d labels, at most %d allowed", len(p.Labels), maxLabels))
+	}
+	return p.Labels, nil
+}
+
+// mergeLabels returns labels with updates merged onto them, label with empty
+// value is removed. Labels aren't modified, merged labels are a new map
+// if they changed. Labels beyond maxLabels are dropped.
+func mergeLabels(labels, updates map[string]string) (map[string]string, bool) {
+	changed := false
+	for k, v := range updates {
+		if cur, ok := labels[k]; (ok && cur != v) || (!ok && v != "") {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return labels, false
+	}
+	merged := make(map[string]string, len(labels))
+	for k, v := range labels {
+		merged[k] = v
+	}
+	for k, v := range updates {
+		switch {
+		case v == "":
+			delete(merged, k)
+		case len(merged) < maxLabels:
+			merged[k] = v
+		}
+	}
+	if len(merged) == 0 {
+		merged = nil
+	}
+	return merged, true
+}
+
+// parseSelector parses `key=value` label selectors.
+func parseSelector(args []string) (map[string]string, error) {
+	selector := map[string]string{}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Wrap(ErrInvalidCommand, fmt.Errorf("label selector %s", arg))
+		}
+		selector[kv[0]] = kv[1]
+	}
+	return selector, nil
+}
+
+// servicesByLabels returns registered services having all the selector labels.
+func (a *agent) servicesByLabels(selector map[string]string) []Info {
+	services := []Info{}
+	for _, info := range a.Services() {
+		matches := true
+		for k, v := range selector {
+			if l, ok := info.Labels[k]; !ok || l != v {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			services = append(services, info)
+		}
+	}
+	return services
+}
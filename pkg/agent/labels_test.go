@@ -0,0 +1,111 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabels(t *testing.T) {
+	cases := []struct {
+		desc   string
+		data   string
+		labels map[string]string
+		err    error
+	}{
+		{"empty payload", "", nil, nil},
+		{"labels", `{"labels":{"location":"lab","role":"gateway"}}`, map[string]string{"location": "lab", "role": "gateway"}, nil},
+		{"no labels", `{"status":"ok"}`, nil, nil},
+		{"malformed payload", "ping", nil, errInvalidLabels},
+		{"non-string label", `{"labels":{"floor":2}}`, nil, errInvalidLabels},
+	}
+
+	for _, tc := range cases {
+		labels, err := parseLabels([]byte(tc.data))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.labels, labels, fmt.Sprintf("%s: expected labels %v got %v", tc.desc, tc.labels, labels))
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	current := map[string]string{"location": "lab", "role": "gateway"}
+	cases := []struct {
+		desc    string
+		updates map[string]string
+		labels  map[string]string
+		changed bool
+	}{
+		{"no updates", nil, current, false},
+		{"same labels", map[string]string{"role": "gateway"}, current, false},
+		{"updated label", map[string]string{"role": "edge"}, map[string]string{"location": "lab", "role": "edge"}, true},
+		{"added label", map[string]string{"rack": "3"}, map[string]string{"location": "lab", "role": "gateway", "rack": "3"}, true},
+		{"removed label", map[string]string{"location": ""}, map[string]string{"role": "gateway"}, true},
+		{"removed missing label", map[string]string{"rack": ""}, current, false},
+	}
+
+	for _, tc := range cases {
+		labels, changed := mergeLabels(current, tc.updates)
+		assert.Equal(t, tc.labels, labels, fmt.Sprintf("%s: expected labels %v got %v", tc.desc, tc.labels, labels))
+		assert.Equal(t, tc.changed, changed, fmt.Sprintf("%s: expected changed %t got %t", tc.desc, tc.changed, changed))
+	}
+	assert.Equal(t, map[string]string{"location": "lab", "role": "gateway"}, current, "merging modified the original labels")
+}
+
+func TestServicesByLabels(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	a := &agent{
+		config: &Config{Heartbeat: HeartbeatConfig{Interval: time.Minute, NotifyWindow: time.Hour}},
+		svcs:   map[string]Heartbeat{},
+		store:  store.NewMemory(),
+		logger: logger,
+	}
+	a.heartbeat(heartbeatMsg{name: "export-1", typ: export, labels: map[string]string{"location": "lab", "role": "export"}})
+	a.heartbeat(heartbeatMsg{name: "export-2", typ: export, labels: map[string]string{"location": "hall", "role": "export"}})
+	a.heartbeat(heartbeatMsg{name: "duster", typ: service})
+	// Labels are merged on each heartbeat.
+	a.heartbeat(heartbeatMsg{name: "duster", typ: service, labels: map[string]string{"location": "lab"}})
+	a.heartbeat(heartbeatMsg{name: "export-2", typ: export, labels: map[string]string{"location": "lab"}})
+	defer func() {
+		for _, s := range a.svcs {
+			s.Close()
+		}
+	}()
+
+	cases := []struct {
+		desc     string
+		args     []string
+		services []string
+		err      error
+	}{
+		{"single label", []string{"role=export"}, []string{"export-1", "export-2"}, nil},
+		{"merged label", []string{"location=lab"}, []string{"duster", "export-1", "export-2"}, nil},
+		{"multiple labels", []string{"location=lab", "role=export"}, []string{"export-1", "export-2"}, nil},
+		{"no match", []string{"location=roof"}, []string{}, nil},
+		{"malformed selector", []string{"location=lab", "role"}, nil, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		selector, err := parseSelector(tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		services := []string{}
+		for _, info := range a.servicesByLabels(selector) {
+			services = append(services, info.Name)
+		}
+		assert.ElementsMatch(t, tc.services, services, fmt.Sprintf("%s: expected services %v got %v", tc.desc, tc.services, services))
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	agentMaintenance = "agent-maintenance"
+
+	maintenanceOn     = "on"
+	maintenanceOff    = "off"
+	maintenanceQueued = "queued"
+
+	maintenanceBucket = "maintenance"
+	maintenanceQueue  = "maintenance_queue"
+	maintenanceState  = "state"
+
+	methodExecute = "execute"
+	methodControl = "control"
+)
+
+var (
+	// errMaintenanceQueueFull indicates that command can't be queued during maintenance
+	errMaintenanceQueueFull = errors.New("maintenance queue is full")
+
+	// errMaintenanceStream indicates that streamed command can't be queued during maintenance
+	errMaintenanceStream = errors.New("streamed commands are rejected in maintenance mode")
+
+	// errFailedMaintenanceState indicates error in persisting maintenance state or queue
+	errFailedMaintenanceState = errors.New("failed to persist maintenance state")
+)
+
+// heldCommand is command received in maintenance mode, kept to be run
+// once maintenance is turned off.
+type heldCommand struct {
+	Key    string `json:"-"`
+	Method string `json:"method"`
+	UUID   string `json:"uuid"`
+	Cmd    string `json:"cmd"`
+}
+
+// maintenance holds maintenance state and the queue of held commands,
+// both persisted in the store.
+type maintenance struct {
+	mu       sync.Mutex
+	enabled  bool
+	draining bool
+	size     int
+	seq      uint64
+	queue    []heldCommand
+	store    store.Store
+}
+
+// newMaintenance returns maintenance with the state and the queue
+// restored from the store. Queue holds up to size commands.
+func newMaintenance(st store.Store, size int) (*maintenance, error) {
+	m := &maintenance{
+		size:  size,
+		store: st,
+	}
+	state, err := st.Get(maintenanceBucket, maintenanceState)
+	switch {
+	case err == nil:
+		m.enabled = string(state) == maintenanceOn
+	case !errors.Contains(err, store.ErrNotFound):
+		return nil, errors.Wrap(errFailedMaintenanceState, err)
+	}
+
+	values, err := st.List(maintenanceQueue)
+	if err != nil {
+		return nil, errors.Wrap(errFailedMaintenanceState, err)
+	}
+	for key, data := range values {
+		var hc heldCommand
+		if err := json.Unmarshal(data, &hc); err != nil {
+			return nil, errors.Wrap(errFailedMaintenanceState, err)
+		}
+		hc.Key = key
+		m.queue = append(m.queue, hc)
+	}
+	// Keys are zero padded sequence numbers, so they sort in arrival order.
+	sort.Slice(m.queue, func(i, j int) bool {
+		return m.queue[i].Key < m.queue[j].Key
+	})
+	if n := len(m.queue); n > 0 {
+		fmt.Sscanf(m.queue[n-1].Key, "%d", &m.seq)
+	}
+	return m, nil
+}
+
+func (m *maintenance) Enabled() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.enabled
+}
+
+// Set changes and persists the state.
+func (m *maintenance) Set(enabled bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := maintenanceOff
+	if enabled {
+		state = maintenanceOn
+	}
+	if err := m.store.Put(maintenanceBucket, maintenanceState, []byte(state)); err != nil {
+		return errors.Wrap(errFailedMaintenanceState, err)
+	}
+	m.enabled = enabled
+	return nil
+}
+
+// push queues the command if maintenance is enabled and reports whether
+// the command is held.
+func (m *maintenance) push(hc heldCommand) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.enabled {
+		return false, nil
+	}
+	if len(m.queue) >= m.size {
+		return true, errMaintenanceQueueFull
+	}
+	hc.Key = fmt.Sprintf("%020d", m.seq+1)
+	data, err := json.Marshal(hc)
+	if err != nil {
+		return true, errors.Wrap(errFailedMaintenanceState, err)
+	}
+	if err := m.store.Put(maintenanceQueue, hc.Key, data); err != nil {
+		return true, errors.Wrap(errFailedMaintenanceState, err)
+	}
+	m.seq++
+	m.queue = append(m.queue, hc)
+	return true, nil
+}
+
+// pop removes and returns the oldest held command. Nothing is returned
+// while maintenance is enabled.
+func (m *maintenance) pop() (heldCommand, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.enabled || len(m.queue) == 0 {
+		return heldCommand{}, false
+	}
+	hc := m.queue[0]
+	m.queue = m.queue[1:]
+	m.store.Delete(maintenanceQueue, hc.Key)
+	return hc, true
+}
+
+// startDrain reports whether the caller should drain the queue, so that
+// only one drain runs at a time.
+func (m *maintenance) startDrain() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.draining {
+		return false
+	}
+	m.draining = true
+	return true
+}
+
+func (m *maintenance) stopDrain() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.draining = false
+}
+
+// hold queues command received in maintenance mode and publishes that it
+// is queued. Raw command, including routing token, is queued so that it
+// is handled as received once maintenance is turned off. Maintenance
+// command itself and commands pausing offline detection are never held.
+func (a *agent) hold(method, uuid, raw, cmd string) (bool, string, error) {
+	name := strings.TrimSpace(strings.SplitN(cmd, ",", 2)[0])
+	if method == methodControl && (name == agentMaintenance || name == servicesPause || name == servicesResume) {
+		return false, "", nil
+	}
+	held, err := a.maint.push(heldCommand{Method: method, UUID: uuid, Cmd: raw})
+	if !held || err != nil {
+		return held, "", err
+	}
+	res, err := a.processResponse(uuid, name, maintenanceQueued)
+	return true, res, err
+}
+
+// drain runs held commands in the order they were received until the
+// queue is empty or maintenance is turned on again.
+func (a *agent) drain() {
+	if !a.maint.startDrain() {
+		return
+	}
+	defer a.maint.stopDrain()
+
+	for {
+		hc, ok := a.maint.pop()
+		if !ok {
+			return
+		}
+		var err error
+		switch hc.Method {
+		case methodExecute:
+			_, err = a.Execute(hc.UUID, hc.Cmd)
+		case methodControl:
+			_, err = a.Control(hc.UUID, hc.Cmd)
+		}
+		if err != nil {
+			a.logger.Warn(fmt.Sprintf("Held command %s failed: %s", hc.UUID, err))
+		}
+	}
+}
+
+func (a *agent) setMaintenance(state string) (string, error) {
+	switch state {
+	case maintenanceOn:
+		if err := a.maint.Set(true); err != nil {
+			return "", err
+		}
+	case maintenanceOff:
+		if err := a.maint.Set(false); err != nil {
+			return "", err
+		}
+		go a.drain()
+	default:
+		return "", ErrInvalidCommand
+	}
+	a.logger.Warn(fmt.Sprintf("Maintenance mode turned %s", state))
+	return state, nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceQueue(t *testing.T) {
+	st := store.NewMemory()
+	m, err := newMaintenance(st, 2)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error creating maintenance: %s", err))
+
+	held, err := m.push(heldCommand{Method: methodExecute, UUID: "0", Cmd: "ls,-l"})
+	assert.False(t, held, "expected command not to be held when maintenance is off")
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+
+	err = m.Set(true)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error enabling maintenance: %s", err))
+	cases := []struct {
+		desc string
+		hc   heldCommand
+		err  error
+	}{
+		{"hold exec command", heldCommand{Method: methodExecute, UUID: "1", Cmd: "ls,-l"}, nil},
+		{"hold control command", heldCommand{Method: methodControl, UUID: "2", Cmd: "agent-stats"}, nil},
+		{"hold command with full queue", heldCommand{Method: methodExecute, UUID: "3", Cmd: "ls,-l"}, errMaintenanceQueueFull},
+	}
+	for _, tc := range cases {
+		held, err := m.push(tc.hc)
+		assert.True(t, held, fmt.Sprintf("%s: expected command to be held", tc.desc))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+
+	_, ok := m.pop()
+	assert.False(t, ok, "expected no command while maintenance is on")
+
+	// Restored maintenance keeps the state and the queue.
+	m, err = newMaintenance(st, 2)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error restoring maintenance: %s", err))
+	assert.True(t, m.Enabled(), "expected restored maintenance to be on")
+
+	err = m.Set(false)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error disabling maintenance: %s", err))
+	for _, uuid := range []string{"1", "2"} {
+		hc, ok := m.pop()
+		assert.True(t, ok, fmt.Sprintf("expected held command %s", uuid))
+		assert.Equal(t, uuid, hc.UUID, fmt.Sprintf("expected command %s got %s", uuid, hc.UUID))
+	}
+	_, ok = m.pop()
+	assert.False(t, ok, "expected empty queue")
+
+	values, err := st.List(maintenanceQueue)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error listing queue: %s", err))
+	assert.Empty(t, values, "expected drained commands to be removed from store")
+}
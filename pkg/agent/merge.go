@@ -0,0 +1,91 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+
+	exp "github.com/mainflux/export/pkg/config"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/pelletier/go-toml"
+)
+
+// merge is config command which deep-merges partial config onto
+// the existing one instead of replacing it.
+const merge = "merge"
+
+var (
+	// errInvalidMerge indicates that partial config can't be merged onto the existing one
+	errInvalidMerge = errors.New("invalid partial config")
+
+	// errNoConfigToMerge indicates that there is no existing config to merge onto
+	errNoConfigToMerge = errors.New("no config to merge onto")
+)
+
+// mergeExport deep-merges partial TOML or JSON export config onto the
+// config saved in the file and returns the merged config. Tables are
+// merged key by key, while values and arrays, such as routes, replace
+// the existing ones. Unknown keys are rejected, so that a typo doesn't
+// get silently dropped from the saved config.
+func mergeExport(file string, partial []byte) (exp.Config, error) {
+	c, err := exp.ReadFile(file)
+	if err != nil {
+		return exp.Config{}, errors.Wrap(errNoConfigToMerge, err)
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return exp.Config{}, errors.Wrap(errInvalidMerge, err)
+	}
+	current := map[string]interface{}{}
+	if err := json.Unmarshal(b, &current); err != nil {
+		return exp.Config{}, errors.Wrap(errInvalidMerge, err)
+	}
+	patch, err := partialConfig(partial)
+	if err != nil {
+		return exp.Config{}, err
+	}
+	mergeMaps(current, patch)
+
+	if b, err = json.Marshal(current); err != nil {
+		return exp.Config{}, errors.Wrap(errInvalidMerge, err)
+	}
+	merged := exp.Config{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&merged); err != nil {
+		return exp.Config{}, errors.Wrap(errInvalidMerge, err)
+	}
+	return merged, nil
+}
+
+// partialConfig parses partial config, TOML is tried first and then JSON.
+func partialConfig(partial []byte) (map[string]interface{}, error) {
+	tree, err := toml.LoadBytes(partial)
+	if err == nil {
+		return tree.ToMap(), nil
+	}
+	m := map[string]interface{}{}
+	if e := json.Unmarshal(partial, &m); e != nil {
+		return nil, errors.Wrap(errInvalidMerge, errors.Wrap(errors.New(err.Error()), e))
+	}
+	return m, nil
+}
+
+// mergeMaps merges src onto dst, nested maps are merged recursively.
+func mergeMaps(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sm, ok := v.(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		dm, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dst[k] = v
+			continue
+		}
+		mergeMaps(dm, sm)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	exp "github.com/mainflux/export/pkg/config"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "merge")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "export.toml")
+	saved := exp.Config{
+		Server: exp.Server{NatsURL: "nats://localhost:4222", LogLevel: "info", Port: "8170"},
+		Routes: []exp.Route{{MqttTopic: "export", NatsTopic: "channels", Type: "plain", Workers: 10}},
+		MQTT:   exp.MQTT{Host: "tcp://localhost:1883", QoS: 1},
+		File:   file,
+	}
+	if err := exp.Save(saved); err != nil {
+		t.Fatalf("failed to save config: %s", err)
+	}
+
+	cases := []struct {
+		desc    string
+		file    string
+		partial string
+		check   func(exp.Config) bool
+		err     error
+	}{
+		{
+			desc:    "merge TOML field",
+			file:    file,
+			partial: "[exp]\nlog_level = \"debug\"\n",
+			check: func(c exp.Config) bool {
+				return c.Server.LogLevel == "debug" && c.Server.Port == "8170" && c.MQTT.Host == saved.MQTT.Host && len(c.Routes) == 1
+			},
+		},
+		{
+			desc:    "merge JSON field",
+			file:    file,
+			partial: `{"mqtt":{"qos":2}}`,
+			check: func(c exp.Config) bool {
+				return c.MQTT.QoS == 2 && c.MQTT.Host == saved.MQTT.Host && c.Server.LogLevel == "info"
+			},
+		},
+		{
+			desc:    "replace routes",
+			file:    file,
+			partial: "[[routes]]\nmqtt_topic = \"export-2\"\nnats_topic = \"channels.>\"\nworkers = 5\n",
+			check: func(c exp.Config) bool {
+				return len(c.Routes) == 1 && c.Routes[0].MqttTopic == "export-2" && c.Routes[0].Workers == 5
+			},
+		},
+		{
+			desc:    "unknown field",
+			file:    file,
+			partial: "[exp]\nlog_levl = \"debug\"\n",
+			err:     errInvalidMerge,
+		},
+		{
+			desc:    "invalid field type",
+			file:    file,
+			partial: "[mqtt]\nqos = \"two\"\n",
+			err:     errInvalidMerge,
+		},
+		{
+			desc:    "malformed partial config",
+			file:    file,
+			partial: "[exp",
+			err:     errInvalidMerge,
+		},
+		{
+			desc:    "missing config",
+			file:    filepath.Join(dir, "missing.toml"),
+			partial: "[exp]\nlog_level = \"debug\"\n",
+			err:     errNoConfigToMerge,
+		},
+	}
+
+	for _, tc := range cases {
+		c, err := mergeExport(tc.file, []byte(tc.partial))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if tc.err == nil {
+			assert.True(t, tc.check(c), fmt.Sprintf("%s: unexpected merged config %+v", tc.desc, c))
+		}
+	}
+}
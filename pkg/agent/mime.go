@@ -0,0 +1,55 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/mainflux/senml"
+)
+
+const (
+	mimeHint   = "mime"
+	mimeRecord = "mime"
+)
+
+// parseMime validates media type given with `mime=` hint, i.e.
+// `application/json`, and returns it in canonical lower case form.
+func parseMime(v string) (string, error) {
+	mt, _, err := mime.ParseMediaType(v)
+	if err != nil {
+		return "", err
+	}
+	return mt, nil
+}
+
+// detectMime detects media type of command output. JSON objects and
+// arrays are recognized, other types are detected by content sniffing,
+// i.e. `text/plain; charset=utf-8`. Empty output has no media type.
+func detectMime(out []byte) string {
+	trimmed := bytes.TrimSpace(out)
+	if len(trimmed) == 0 {
+		return ""
+	}
+	if (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+		return "application/json"
+	}
+	return http.DetectContentType(out)
+}
+
+// mimeRecords returns record with media type of the output, the one
+// given with the hint takes precedence over the detected one.
+func mimeRecords(hint string, out []byte) []senml.Record {
+	mt := hint
+	if mt == "" {
+		mt = detectMime(out)
+	}
+	if mt == "" {
+		return nil
+	}
+	return []senml.Record{{Name: mimeRecord, StringValue: &mt}}
+}
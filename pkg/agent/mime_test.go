@@ -0,0 +1,58 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMimeRecords(t *testing.T) {
+	cases := []struct {
+		desc string
+		hint string
+		out  string
+		mime string
+	}{
+		{"json object", "", `{"temperature": 21.5}`, "application/json"},
+		{"json array", "", "[1, 2]\n", "application/json"},
+		{"plain text", "", "total 0\n", "text/plain; charset=utf-8"},
+		{"png image", "", "\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR", "image/png"},
+		{"type from hint", "text/csv", "a,b\n1,2\n", "text/csv"},
+		{"no output", "", " \n", ""},
+	}
+
+	for _, tc := range cases {
+		records := mimeRecords(tc.hint, []byte(tc.out))
+		if tc.mime == "" {
+			assert.Empty(t, records, fmt.Sprintf("%s: expected no records", tc.desc))
+			continue
+		}
+		assert.Len(t, records, 1, fmt.Sprintf("%s: expected 1 record got %d", tc.desc, len(records)))
+		assert.Equal(t, tc.mime, *records[0].StringValue, fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.mime, *records[0].StringValue))
+	}
+}
+
+func TestMimeHint(t *testing.T) {
+	cases := []struct {
+		desc string
+		cmd  string
+		mime string
+		err  error
+	}{
+		{"media type from hint", "mime=Application/JSON;echo, {}", "application/json", nil},
+		{"no hint", "echo, hello", "", nil},
+		{"invalid media type", "mime=json/;echo, {}", "", errInvalidHint},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{}}
+		_, opts, err := a.command(tc.cmd)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.mime, opts.mime, fmt.Sprintf("%s: expected media type %s got %s", tc.desc, tc.mime, opts.mime))
+	}
+}
@@ -31,3 +31,23 @@ func (ec *mockClient) FetchMetrics(cmdArr []string) (string, error) {
 func (ec *mockClient) Ping() (string, error) {
 	return string("body"), nil
 }
+
+// PingService - ping EdgeX service
+func (ec *mockClient) PingService(service string) (string, error) {
+	return string("pong"), nil
+}
+
+// DeviceCommand - invokes device command through EdgeX core command
+func (ec *mockClient) DeviceCommand(device, command, method, body string) (string, error) {
+	return string("body"), nil
+}
+
+// FetchLogs - fetches latest log entries of EdgeX service
+func (ec *mockClient) FetchLogs(service string, limit int) (string, error) {
+	return string("[]"), nil
+}
+
+// FetchReadings - fetches readings created in time range from EdgeX core data
+func (ec *mockClient) FetchReadings(start, end int64, limit int) (string, error) {
+	return string("[]"), nil
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package mocks
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+)
+
+// Executor is fake executor which runs shell script instead of the
+// requested command and records requested commands. Script sees the
+// requested arguments as positional parameters.
+type Executor struct {
+	mu     sync.Mutex
+	script string
+	calls  [][]string
+}
+
+// NewExecutor returns fake executor running the script, i.e. `echo out; exit 1`.
+func NewExecutor(script string) *Executor {
+	return &Executor{script: script}
+}
+
+// CommandContext returns command running the script. Command name is
+// kept as the first argument, so that it is reported as the requested one.
+func (e *Executor) CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	e.mu.Lock()
+	e.calls = append(e.calls, append([]string{name}, args...))
+	e.mu.Unlock()
+
+	c := exec.CommandContext(ctx, "sh", append([]string{"-c", e.script, name}, args...)...)
+	c.Args[0] = name
+	return c
+}
+
+// Calls returns binary and arguments of every requested command.
+func (e *Executor) Calls() [][]string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([][]string{}, e.calls...)
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"github.com/mainflux/mainflux/errors"
+	nats "github.com/nats-io/nats.go"
+)
+
+// errFailedConnectNATS indicates that NATS connection can't be established
+var errFailedConnectNATS = errors.New("failed to connect to NATS")
+
+// NatsOptions returns NATS connection options with credentials and TLS settings from config.
+func NatsOptions(nc NatsConfig) []nats.Option {
+	opts := []nats.Option{}
+	if nc.Credentials != "" {
+		opts = append(opts, nats.UserCredentials(nc.Credentials))
+	}
+	if nc.Token != "" {
+		opts = append(opts, nats.Token(nc.Token))
+	}
+	if nc.CACert != "" {
+		opts = append(opts, nats.RootCAs(nc.CACert))
+	}
+	if nc.ClientCert != "" {
+		opts = append(opts, nats.ClientCert(nc.ClientCert, nc.ClientKey))
+	}
+	return opts
+}
+
+// ConnectNATS validates NATS URL and connects to NATS with options from
+// config, followed by additional options such as connection handlers.
+func ConnectNATS(cfg Config, opts ...nats.Option) (*nats.Conn, error) {
+	if err := cfg.Server.Validate(); err != nil {
+		return nil, errors.Wrap(errFailedConnectNATS, err)
+	}
+	if err := cfg.Nats.Validate(); err != nil {
+		return nil, errors.Wrap(errFailedConnectNATS, err)
+	}
+	nc, err := nats.Connect(cfg.Server.NatsURL, append(NatsOptions(cfg.Nats), opts...)...)
+	if err != nil {
+		return nil, errors.Wrap(errFailedConnectNATS, err)
+	}
+	return nc, nil
+}
@@ -0,0 +1,42 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	niceHint = "nice"
+
+	minNice = -20
+	maxNice = 19
+)
+
+// errInvalidNice indicates niceness outside of the allowed range.
+var errInvalidNice = errors.New("invalid niceness")
+
+// validNice checks that niceness is within range from -20,
+// the highest priority, to 19, the lowest priority.
+func validNice(n int) error {
+	if n < minNice || n > maxNice {
+		return errors.Wrap(errInvalidNice, fmt.Errorf("%d not in range %d to %d", n, minNice, maxNice))
+	}
+	return nil
+}
+
+// renice sets niceness of the started process. Failure is logged and
+// the process keeps running, since lowering niceness needs privileges
+// which the agent doesn't necessarily have.
+func (a *agent) renice(pid, nice int) {
+	if nice == 0 {
+		return
+	}
+	if err := syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to set niceness %d of process %d: %s", nice, pid, err))
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	outputFile = "output_file"
+	outputExt  = ".out"
+)
+
+var (
+	// errOutputDisabled indicates that command outputs are not kept
+	errOutputDisabled = errors.New("command output retention disabled")
+
+	// errOutputNotFound indicates that kept output doesn't exist or is removed
+	errOutputNotFound = errors.New("command output not found")
+
+	// errFailedSaveOutput indicates error in writing command output
+	errFailedSaveOutput = errors.New("failed to save command output")
+)
+
+// outputID returns id of output kept for correlation id, characters
+// which are not safe in file names are replaced with underscore.
+func outputID(uuid string) string {
+	id := []byte(uuid)
+	for i, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			id[i] = '_'
+		}
+	}
+	if len(id) == 0 {
+		return strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	return string(id)
+}
+
+// saveOutput writes full command output to dir, prunes old outputs
+// and returns id by which the output can be fetched.
+func (a *agent) saveOutput(dir, uuid string, out []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.Wrap(errFailedSaveOutput, err)
+	}
+	id := outputID(uuid)
+	if err := ioutil.WriteFile(filepath.Join(dir, id+outputExt), out, 0600); err != nil {
+		return "", errors.Wrap(errFailedSaveOutput, err)
+	}
+	if err := a.pruneOutputs(dir, id+outputExt); err != nil {
+		return "", errors.Wrap(errFailedSaveOutput, err)
+	}
+	return id, nil
+}
+
+// pruneOutputs removes outputs in dir older than max age and the oldest outputs
+// until total size fits the limit. The output named keep is never removed.
+func (a *agent) pruneOutputs(dir, keep string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	outputs := []os.FileInfo{}
+	var total int64
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), outputExt) {
+			continue
+		}
+		outputs = append(outputs, f)
+		total += f.Size()
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].ModTime().Before(outputs[j].ModTime())
+	})
+
+	maxAge, maxSize := a.cfg().Exec.OutputMaxAge, a.cfg().Exec.OutputMaxSize
+	for _, f := range outputs {
+		if f.Name() == keep {
+			continue
+		}
+		expired := maxAge > 0 && time.Since(f.ModTime()) > maxAge
+		if !expired && (maxSize <= 0 || total <= maxSize) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		total -= f.Size()
+	}
+	return nil
+}
+
+// readOutput reads up to length bytes of kept output starting at offset,
+// the rest of the output is read if length <= 0. Read is capped to
+// MaxOutputHardCap bytes.
+func (a *agent) readOutput(id string, offset, length int64) (string, error) {
+	if a.cfg().Exec.OutputDir == "" {
+		return "", errOutputDisabled
+	}
+	if id == "" || id != outputID(id) {
+		return "", errOutputNotFound
+	}
+	f, err := os.Open(filepath.Join(a.cfg().Exec.OutputDir, id+outputExt))
+	if os.IsNotExist(err) {
+		return "", errOutputNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	if hardCap := int64(a.cfg().Exec.MaxOutputHardCap); hardCap > 0 && (length <= 0 || length > hardCap) {
+		length = hardCap
+	}
+	var r io.Reader = f
+	if length > 0 {
+		r = io.LimitReader(f, length)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// getOutput parses `file-get` arguments `<id>[,offset[,length]]` and reads kept output.
+func (a *agent) getOutput(args []string) (string, error) {
+	var offset, length int64
+	var err error
+	if len(args) > 1 {
+		if offset, err = strconv.ParseInt(args[1], 10, 64); err != nil || offset < 0 {
+			return "", ErrInvalidCommand
+		}
+	}
+	if len(args) > 2 {
+		if length, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+			return "", ErrInvalidCommand
+		}
+	}
+	return a.readOutput(args[0], offset, length)
+}
@@ -0,0 +1,208 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+// Policies applied to payloads larger than MQTT MaxPayload.
+const (
+	// OverflowTruncate replaces the payload with the pack carrying
+	// as much of it as fits and its full size.
+	OverflowTruncate = "truncate"
+
+	// OverflowCompress publishes gzip compressed payload.
+	OverflowCompress = "compress"
+
+	// OverflowChunk splits the payload into packs carrying base64
+	// encoded parts of it, published one after another.
+	OverflowChunk = "chunk"
+
+	// OverflowStore keeps the payload as an artifact and publishes
+	// the pack with its URL.
+	OverflowStore = "store"
+)
+
+const (
+	overflowRecord = "overflow"
+	payloadRecord  = "payload"
+	payloadBytes   = "payload_bytes"
+	chunkRecord    = "chunk"
+	chunksRecord   = "chunks"
+
+	// chunkMargin is room left in each chunk for encoded time and
+	// chunk numbers, which vary in length.
+	chunkMargin = 64
+)
+
+// errPayloadTooLarge indicates payload which can't be made to fit max payload size
+var errPayloadTooLarge = errors.New("payload exceeds max payload size")
+
+var overflowPolicies = map[string]bool{
+	OverflowTruncate: true,
+	OverflowCompress: true,
+	OverflowChunk:    true,
+	OverflowStore:    true,
+}
+
+// overflow returns payloads published instead of the payload which
+// exceeds max size, according to the overflow policy. Policy falls back
+// to truncation if the payload can't be compressed, chunked or stored
+// within the limit, so that something is always delivered.
+func (a *agent) overflow(payload string, max int) ([]string, error) {
+	bn := payloadBaseName(payload)
+	policy := a.cfg().MQTT.Overflow
+	a.logger.Warn(fmt.Sprintf("Payload of %s has %d bytes, more than %d, applying %s policy", bn, len(payload), max, policy))
+	switch policy {
+	case OverflowCompress:
+		p, err := gzipPayload([]byte(payload))
+		if err == nil && len(p) <= max {
+			return []string{string(p)}, nil
+		}
+	case OverflowChunk:
+		chunks, err := a.chunkPayload(bn, payload, max)
+		if err == nil {
+			return chunks, nil
+		}
+		a.logger.Warn(fmt.Sprintf("Failed to chunk payload of %s: %s", bn, err))
+	case OverflowStore:
+		p, err := a.storePayload(bn, payload)
+		if err == nil && len(p) <= max {
+			return []string{p}, nil
+		}
+		a.logger.Warn(fmt.Sprintf("Failed to store payload of %s: %v", bn, err))
+	}
+	p, err := a.truncatePayload(bn, payload, max)
+	if err != nil {
+		return nil, err
+	}
+	return []string{p}, nil
+}
+
+// truncatePayload returns pack with as much of the payload as fits
+// max size and the size of the whole payload.
+func (a *agent) truncatePayload(bn, payload string, max int) (string, error) {
+	policy, size := OverflowTruncate, float64(len(payload))
+	records := func(part string) []senml.Record {
+		return []senml.Record{
+			{Name: overflowRecord, StringValue: &policy},
+			{Name: payloadBytes, Value: &size},
+			{Name: payloadRecord, StringValue: &part},
+		}
+	}
+	p, err := a.encodeOverflow(bn, records(""))
+	if err != nil {
+		return "", err
+	}
+	budget := max - len(p)
+	if budget < 0 {
+		return "", errors.Wrap(errPayloadTooLarge, fmt.Errorf("max payload %d is too small", max))
+	}
+	// Escaping can make encoded part longer than the budget, so part
+	// is shortened by the excess until the pack fits.
+	for {
+		part := string(truncate([]byte(payload), budget))
+		p, err := a.encodeOverflow(bn, records(part))
+		if err != nil {
+			return "", err
+		}
+		if len(p) <= max || budget == 0 {
+			return string(p), nil
+		}
+		budget -= len(p) - max
+		if budget < 0 {
+			budget = 0
+		}
+	}
+}
+
+// chunkPayload splits the payload into packs of at most max size.
+func (a *agent) chunkPayload(bn, payload string, max int) ([]string, error) {
+	policy, empty, n := OverflowChunk, "", float64(0)
+	p, err := a.encodeOverflow(bn, []senml.Record{
+		{Name: overflowRecord, StringValue: &policy},
+		{Name: chunkRecord, Value: &n},
+		{Name: chunksRecord, Value: &n},
+		{Name: payloadRecord, DataValue: &empty},
+	})
+	if err != nil {
+		return nil, err
+	}
+	size := base64.StdEncoding.DecodedLen(max - len(p) - chunkMargin)
+	if size <= 0 {
+		return nil, errors.Wrap(errPayloadTooLarge, fmt.Errorf("max payload %d is too small", max))
+	}
+
+	total := float64((len(payload) + size - 1) / size)
+	chunks := []string{}
+	for i := 0; i < len(payload); i += size {
+		end := i + size
+		if end > len(payload) {
+			end = len(payload)
+		}
+		part, n := base64.StdEncoding.EncodeToString([]byte(payload[i:end])), float64(len(chunks))
+		p, err := a.encodeOverflow(bn, []senml.Record{
+			{Name: overflowRecord, StringValue: &policy},
+			{Name: chunkRecord, Value: &n},
+			{Name: chunksRecord, Value: &total},
+			{Name: payloadRecord, DataValue: &part},
+		})
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, string(p))
+	}
+	return chunks, nil
+}
+
+// storePayload keeps the payload as an artifact and returns pack with
+// its URL and size.
+func (a *agent) storePayload(bn, payload string) (string, error) {
+	if !a.cfg().Artifacts.Enabled() {
+		return "", errArtifactsDisabled
+	}
+	url, err := a.saveArtifact(bn+"-"+payloadRecord, []byte(payload))
+	if err != nil {
+		return "", err
+	}
+	policy, size := OverflowStore, float64(len(payload))
+	p, err := a.encodeOverflow(bn, []senml.Record{
+		{Name: overflowRecord, StringValue: &policy},
+		{Name: payloadBytes, Value: &size},
+		{Name: outputURL, StringValue: &url},
+	})
+	return string(p), err
+}
+
+// encodeOverflow encodes records as SenML JSON pack. Base name is taken
+// from the oversized payload as it is, so it isn't formatted again.
+func (a *agent) encodeOverflow(bn string, records []senml.Record) ([]byte, error) {
+	ts := float64(a.clk().Now().UnixNano()) / float64(time.Second)
+	for i := range records {
+		records[i].Time = ts
+	}
+	records[0].BaseName = bn
+	p, err := senml.Encode(senml.Pack{Records: records}, senml.JSON)
+	if err != nil {
+		return nil, errors.Wrap(errFailedEncode, err)
+	}
+	return p, nil
+}
+
+// payloadBaseName returns base name of SenML payload, so that packs
+// published instead of it can be correlated with the command.
+func payloadBaseName(payload string) string {
+	for _, f := range []senml.Format{senml.JSON, senml.CBOR} {
+		if p, _ := senml.Decode([]byte(payload), f); len(p.Records) > 0 {
+			return p.Records[0].BaseName
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishOverflow(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "overflow")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := strings.Repeat("line of \"quoted\" output\n", 100)
+	payload := fmt.Sprintf(`[{"bn":"1","n":"echo","vs":%q},{"n":"code","v":0}]`, out)
+	random := make([]byte, 3000)
+	rand.New(rand.NewSource(1)).Read(random)
+	noisy := fmt.Sprintf(`[{"bn":"2","n":"echo","vs":%q}]`, base64.StdEncoding.EncodeToString(random))
+	artifacts := ArtifactsConfig{Port: "9001", Root: dir, Token: "token", URL: "http://device:9001"}
+
+	cases := []struct {
+		desc      string
+		policy    string
+		max       int
+		artifacts ArtifactsConfig
+		payload   string
+		published int
+		overflow  string
+	}{
+		{"limit disabled", OverflowTruncate, 0, ArtifactsConfig{}, payload, 1, ""},
+		{"payload within limit", OverflowTruncate, len(payload), ArtifactsConfig{}, payload, 1, ""},
+		{"truncate", OverflowTruncate, 500, ArtifactsConfig{}, payload, 1, OverflowTruncate},
+		{"compress", OverflowCompress, 500, ArtifactsConfig{}, payload, 1, OverflowCompress},
+		{"incompressible payload", OverflowCompress, 500, ArtifactsConfig{}, noisy, 1, OverflowTruncate},
+		{"chunk", OverflowChunk, 500, ArtifactsConfig{}, payload, 14, OverflowChunk},
+		{"store", OverflowStore, 500, artifacts, payload, 1, OverflowStore},
+		{"store without artifact server", OverflowStore, 500, ArtifactsConfig{}, payload, 1, OverflowTruncate},
+	}
+
+	for _, tc := range cases {
+		client := &recordingClient{}
+		a := &agent{
+			config: &Config{
+				Channels:  ChanConfig{Control: "ctrl"},
+				MQTT:      MQTTConfig{MaxPayload: tc.max, Overflow: tc.policy},
+				Artifacts: tc.artifacts,
+			},
+			mqttClient: client,
+			clock:      mocks.NewClock(time.Unix(1600000000, 0)),
+			logger:     logger,
+		}
+		err := a.Publish(control, tc.payload)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error publishing: %s", tc.desc, err))
+		assert.Equal(t, tc.published, len(client.payloads), fmt.Sprintf("%s: expected %d publishes got %d", tc.desc, tc.published, len(client.payloads)))
+		for _, p := range client.payloads {
+			if tc.max > 0 {
+				assert.True(t, len(p) <= tc.max, fmt.Sprintf("%s: published %d bytes, more than %d", tc.desc, len(p), tc.max))
+			}
+		}
+
+		switch tc.overflow {
+		case "":
+			assert.Equal(t, []string{tc.payload}, client.payloads, fmt.Sprintf("%s: expected payload published as it is", tc.desc))
+		case OverflowCompress:
+			zr, err := gzip.NewReader(strings.NewReader(client.payloads[0]))
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error reading gzip: %s", tc.desc, err))
+			b, err := ioutil.ReadAll(zr)
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decompressing: %s", tc.desc, err))
+			assert.Equal(t, tc.payload, string(b), fmt.Sprintf("%s: decompressed payload differs", tc.desc))
+		default:
+			var whole bytes.Buffer
+			for i, p := range client.payloads {
+				pack, err := senml.Decode([]byte(p), senml.JSON)
+				assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding overflow pack: %s", tc.desc, err))
+				values := packValues(pack)
+				assert.Equal(t, payloadBaseName(tc.payload), pack.Records[0].BaseName, fmt.Sprintf("%s: expected base name of the payload", tc.desc))
+				assert.Equal(t, tc.overflow, values[overflowRecord], fmt.Sprintf("%s: expected %s overflow got %v", tc.desc, tc.overflow, values[overflowRecord]))
+				switch tc.overflow {
+				case OverflowTruncate:
+					assert.Equal(t, float64(len(tc.payload)), values[payloadBytes], fmt.Sprintf("%s: expected payload size", tc.desc))
+					assert.True(t, strings.HasPrefix(tc.payload, values[payloadRecord].(string)), fmt.Sprintf("%s: expected payload prefix", tc.desc))
+				case OverflowChunk:
+					assert.Equal(t, float64(i), values[chunkRecord], fmt.Sprintf("%s: expected chunk %d got %v", tc.desc, i, values[chunkRecord]))
+					assert.Equal(t, float64(tc.published), values[chunksRecord], fmt.Sprintf("%s: expected %d chunks got %v", tc.desc, tc.published, values[chunksRecord]))
+					b, err := base64.StdEncoding.DecodeString(values[payloadRecord].(string))
+					assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding chunk: %s", tc.desc, err))
+					whole.Write(b)
+				case OverflowStore:
+					assert.Equal(t, "http://device:9001/1-payload.out", values[outputURL], fmt.Sprintf("%s: unexpected output URL %v", tc.desc, values[outputURL]))
+					b, err := ioutil.ReadFile(dir + "/1-payload.out")
+					assert.Nil(t, err, fmt.Sprintf("%s: unexpected error reading stored payload: %s", tc.desc, err))
+					assert.Equal(t, tc.payload, string(b), fmt.Sprintf("%s: stored payload differs", tc.desc))
+				}
+			}
+			if tc.overflow == OverflowChunk {
+				assert.Equal(t, tc.payload, whole.String(), fmt.Sprintf("%s: reassembled chunks differ from payload", tc.desc))
+			}
+		}
+	}
+}
+
+// packValues returns values of the pack records by name.
+func packValues(pack senml.Pack) map[string]interface{} {
+	values := map[string]interface{}{}
+	for _, r := range pack.Records {
+		switch {
+		case r.Value != nil:
+			values[r.Name] = *r.Value
+		case r.StringValue != nil:
+			values[r.Name] = *r.StringValue
+		case r.DataValue != nil:
+			values[r.Name] = *r.DataValue
+		}
+	}
+	return values
+}
@@ -0,0 +1,113 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	servicesPause  = "services-pause"
+	servicesResume = "services-resume"
+
+	paused  = "paused"
+	resumed = "resumed"
+)
+
+// offlinePause holds whether offline detection of services is paused and
+// when it was resumed, so that services get full heartbeat interval after
+// the pause before they are marked offline.
+type offlinePause struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed time.Time
+	timer   Timer
+	seq     uint64
+}
+
+// pauseOffline pauses offline detection for the duration, or until it is
+// resumed if duration is 0. Pausing again replaces the previous window.
+func (a *agent) pauseOffline(d time.Duration) {
+	p := &a.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	p.paused = true
+	p.seq++
+	if d > 0 {
+		seq := p.seq
+		p.timer = a.clk().AfterFunc(d, func() {
+			a.expirePause(seq)
+		})
+	}
+	a.logger.Warn(fmt.Sprintf("Offline detection paused for %s", d))
+}
+
+// expirePause resumes offline detection once the pause window passes,
+// unless the pause was replaced or resumed meanwhile.
+func (a *agent) expirePause(seq uint64) {
+	a.pause.mu.Lock()
+	defer a.pause.mu.Unlock()
+	if a.pause.seq == seq {
+		a.resume()
+	}
+}
+
+// resumeOffline resumes offline detection.
+func (a *agent) resumeOffline() {
+	a.pause.mu.Lock()
+	defer a.pause.mu.Unlock()
+	a.resume()
+}
+
+// resume resumes offline detection, it must be called with pause lock held.
+func (a *agent) resume() {
+	p := &a.pause
+	p.seq++
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if !p.paused {
+		return
+	}
+	p.paused = false
+	p.resumed = a.clk().Now()
+	a.logger.Info("Offline detection resumed")
+}
+
+// offlineHold returns time until which services are kept online without
+// heartbeat, which is now while offline detection is paused and the time
+// it was resumed afterwards.
+func (a *agent) offlineHold() time.Time {
+	p := &a.pause
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.paused {
+		return a.clk().Now()
+	}
+	return p.resumed
+}
+
+// setPause handles `services-pause` command, optional argument is the
+// duration of the pause, configured pause is used if it is missing.
+func (a *agent) setPause(args []string) (string, error) {
+	d := a.cfg().Heartbeat.Pause
+	if len(args) > 0 && strings.TrimSpace(args[0]) != "" {
+		var err error
+		if d, err = time.ParseDuration(strings.TrimSpace(args[0])); err != nil || d < 0 {
+			return "", ErrInvalidCommand
+		}
+	}
+	a.pauseOffline(d)
+	return paused, nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseOffline(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	start := time.Unix(1588091188, 0)
+
+	cases := []struct {
+		desc    string
+		args    []string
+		advance time.Duration
+		paused  bool
+		err     error
+	}{
+		{"configured pause", nil, time.Hour, false, nil},
+		{"configured pause not over", nil, time.Minute, true, nil},
+		{"pause from argument", []string{"2h"}, time.Hour, true, nil},
+		{"pause until resumed", []string{"0s"}, 24 * time.Hour, true, nil},
+		{"invalid pause", []string{"soon"}, 0, false, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		clock := mocks.NewClock(start)
+		a := &agent{
+			config: &Config{Heartbeat: HeartbeatConfig{Pause: time.Hour}},
+			clock:  clock,
+			logger: logger,
+		}
+		_, err := a.setPause(tc.args)
+		assert.Equal(t, tc.err, err, fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		clock.Advance(tc.advance)
+		assert.Equal(t, tc.paused, a.pause.paused, fmt.Sprintf("%s: expected paused %t", tc.desc, tc.paused))
+	}
+}
+
+func TestPauseReplaced(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	clock := mocks.NewClock(time.Unix(1588091188, 0))
+	a := &agent{config: &Config{}, clock: clock, logger: logger}
+
+	a.pauseOffline(time.Minute)
+	a.pauseOffline(time.Hour)
+	clock.Advance(time.Minute)
+	assert.Equal(t, clock.Now(), a.offlineHold(), "expected replaced pause to keep detection paused")
+
+	a.resumeOffline()
+	resumed := clock.Now()
+	clock.Advance(time.Hour)
+	assert.Equal(t, resumed, a.offlineHold(), fmt.Sprintf("expected hold at resume time %s got %s", resumed, a.offlineHold()))
+}
+
+func TestHeartbeatHold(t *testing.T) {
+	now := time.Unix(1588091188, 0)
+	cases := []struct {
+		desc    string
+		seen    time.Time
+		hold    time.Time
+		expired bool
+	}{
+		{"heartbeat missed", now.Add(-2 * time.Minute), time.Time{}, true},
+		{"heartbeat in interval", now.Add(-30 * time.Second), time.Time{}, false},
+		{"detection paused", now.Add(-time.Hour), now, false},
+		{"recently resumed", now.Add(-time.Hour), now.Add(-30 * time.Second), false},
+		{"interval passed after resume", now.Add(-time.Hour), now.Add(-2 * time.Minute), true},
+	}
+
+	for _, tc := range cases {
+		hold := tc.hold
+		s := svc{
+			info:     Info{LastSeen: tc.seen},
+			interval: time.Minute,
+			hold:     func() time.Time { return hold },
+		}
+		assert.Equal(t, tc.expired, s.expired(now), fmt.Sprintf("%s: expected expired %t", tc.desc, tc.expired))
+	}
+}
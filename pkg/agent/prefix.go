@@ -0,0 +1,90 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	cmdTypeExec    = "exec"
+	cmdTypeControl = "control"
+	cmdTypeConfig  = "config"
+)
+
+// errInvalidNamePrefix indicates malformed record name prefix template.
+var errInvalidNamePrefix = errors.New("invalid SenML name prefix template")
+
+// namePrefixData is data available in record name prefix template.
+type namePrefixData struct {
+	Type    string
+	Command string
+}
+
+// namePrefixTemplate parses record name prefix template.
+func namePrefixTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("prefix").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidNamePrefix, err)
+	}
+	if err := t.Execute(&strings.Builder{}, namePrefixData{}); err != nil {
+		return nil, errors.Wrap(errInvalidNamePrefix, err)
+	}
+	return t, nil
+}
+
+// trackCommand keeps type and name of the command sent with the uuid, so
+// that records of responses to it are prefixed, until clearCommand is called.
+func (a *agent) trackCommand(uuid, typ, cmd string) {
+	if a.cfg().SenML.NamePrefix == "" {
+		return
+	}
+	a.commands.Store(uuid, namePrefixData{Type: typ, Command: commandName(cmd)})
+}
+
+func (a *agent) clearCommand(uuid string) {
+	a.commands.Delete(uuid)
+}
+
+// commandName returns name of the command, which is binary of exec command
+// and the first argument of other commands. Hints are skipped.
+func commandName(cmd string) string {
+	_, cmd = parseHints(cmd)
+	cmd = strings.TrimSpace(cmd)
+	if i := strings.IndexAny(cmd, ", "); i >= 0 {
+		cmd = cmd[:i]
+	}
+	return cmd
+}
+
+// prefixRecords prefixes names of the records with the name prefix template
+// rendered for the command sent with the uuid. Records are returned as is
+// if prefix is not configured or the command isn't tracked.
+func (a *agent) prefixRecords(uuid string, records []senml.Record) []senml.Record {
+	tmpl := a.cfg().SenML.NamePrefix
+	data, ok := a.commands.Load(uuid)
+	if tmpl == "" || !ok {
+		return records
+	}
+	t, err := namePrefixTemplate(tmpl)
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to prefix record names: %s", err))
+		return records
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to prefix record names: %s", err))
+		return records
+	}
+	prefix := sb.String()
+	for i := range records {
+		records[i].Name = prefix + records[i].Name
+	}
+	return records
+}
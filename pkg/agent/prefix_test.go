@@ -0,0 +1,64 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixRecords(t *testing.T) {
+	cases := []struct {
+		desc   string
+		prefix string
+		typ    string
+		cmd    string
+		names  []string
+	}{
+		{"prefix disabled", "", cmdTypeExec, "ls,-la", []string{"ls", "truncated_bytes"}},
+		{"type prefix", "{{.Type}}:", cmdTypeExec, "ls,-la", []string{"exec:ls", "exec:truncated_bytes"}},
+		{"command prefix", "{{.Command}}.", cmdTypeExec, "shell=true;ls -la | wc", []string{"ls.ls", "ls.truncated_bytes"}},
+		{"type and command prefix", "{{.Type}}/{{.Command}}/", cmdTypeControl, "exec-list", []string{"control/exec-list/ls", "control/exec-list/truncated_bytes"}},
+	}
+
+	for _, tc := range cases {
+		a := &agent{config: &Config{SenML: SenMLConfig{NamePrefix: tc.prefix}}}
+		a.trackCommand("1", tc.typ, tc.cmd)
+		records := a.prefixRecords("1", []senml.Record{{Name: "ls"}, {Name: "truncated_bytes"}})
+		names := []string{}
+		for _, r := range records {
+			names = append(names, r.Name)
+		}
+		assert.Equal(t, tc.names, names, fmt.Sprintf("%s: expected names %v got %v", tc.desc, tc.names, names))
+
+		a.clearCommand("1")
+		records = a.prefixRecords("1", []senml.Record{{Name: "ls"}})
+		assert.Equal(t, "ls", records[0].Name, fmt.Sprintf("%s: expected cleared command not to be prefixed, got %s", tc.desc, records[0].Name))
+	}
+}
+
+func TestSenMLConfigValidate(t *testing.T) {
+	cases := []struct {
+		desc      string
+		prefix    string
+		verbosity string
+		err       error
+	}{
+		{"no prefix", "", "", nil},
+		{"valid prefix", "{{.Type}}:{{.Command}}:", "", nil},
+		{"malformed prefix", "{{.Type", "", errInvalidNamePrefix},
+		{"unknown field", "{{.Device}}:", "", errInvalidNamePrefix},
+		{"minimal error verbosity", "", VerbosityMinimal, nil},
+		{"unknown error verbosity", "", "verbose", errInvalidVerbosity},
+	}
+
+	for _, tc := range cases {
+		err := SenMLConfig{NamePrefix: tc.prefix, ErrorVerbosity: tc.verbosity}.Validate()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+}
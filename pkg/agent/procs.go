@@ -0,0 +1,108 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	execList = "exec-list"
+	execKill = "exec-kill"
+	killed   = "killed"
+)
+
+var (
+	// errProcessNotFound indicates that process isn't running or wasn't spawned by agent
+	errProcessNotFound = errors.New("process not found")
+
+	// errExecKilled indicates that command was killed with exec-kill command
+	errExecKilled = errors.New("command killed")
+)
+
+// process is a running command spawned by the agent.
+type process struct {
+	PID     int       `json:"pid"`
+	UUID    string    `json:"uuid"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+	Elapsed string    `json:"elapsed"`
+
+	cancel func()
+}
+
+// run starts the command and tracks it as running process until it exits.
+func (a *agent) run(uuid string, c *exec.Cmd, opts execOpts) error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	a.renice(c.Process.Pid, opts.nice)
+	if opts.watch != nil {
+		opts.watch.start()
+		defer opts.watch.stop()
+	}
+
+	pid := c.Process.Pid
+	a.procsMu.Lock()
+	a.procs[pid] = &process{
+		PID:     pid,
+		UUID:    uuid,
+		Command: strings.Join(c.Args, " "),
+		Started: a.clk().Now(),
+		cancel:  opts.cancel,
+	}
+	a.procsMu.Unlock()
+
+	defer func() {
+		a.procsMu.Lock()
+		delete(a.procs, pid)
+		a.procsMu.Unlock()
+	}()
+
+	return c.Wait()
+}
+
+// execList returns JSON encoded list of running processes ordered by start time.
+func (a *agent) execList() (string, error) {
+	a.procsMu.Lock()
+	procs := []process{}
+	for _, p := range a.procs {
+		pr := *p
+		pr.Elapsed = a.clk().Now().Sub(p.Started).Round(time.Millisecond).String()
+		procs = append(procs, pr)
+	}
+	a.procsMu.Unlock()
+
+	sort.Slice(procs, func(i, j int) bool {
+		return procs[i].Started.Before(procs[j].Started)
+	})
+	b, err := json.Marshal(procs)
+	if err != nil {
+		return "", errors.Wrap(errFailedEncode, err)
+	}
+	return string(b), nil
+}
+
+// execKill terminates running process with the given pid.
+func (a *agent) execKill(id string) error {
+	pid, err := strconv.Atoi(id)
+	if err != nil {
+		return ErrInvalidCommand
+	}
+	a.procsMu.Lock()
+	p, ok := a.procs[pid]
+	a.procsMu.Unlock()
+	if !ok {
+		return errProcessNotFound
+	}
+	p.cancel()
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/senml"
+)
+
+const (
+	readyRecord   = "ready"
+	readyStartup  = "startup"
+	readyInterval = time.Second
+
+	edgexReachable = "reachable"
+	edgexDisabled  = "disabled"
+)
+
+func (a *agent) Ready() bool {
+	if a.mqttClient == nil || !a.mqttClient.IsConnectionOpen() {
+		return false
+	}
+	if a.nats == nil || !a.nats.IsConnected() {
+		return false
+	}
+	if a.edgexEnabled() {
+		if _, err := a.edgexClient.Ping(); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// edgexEnabled checks whether readiness depends on EdgeX.
+func (a *agent) edgexEnabled() bool {
+	return a.cfg().Features.Enabled(FeatureEdgex) && a.edgexClient != nil
+}
+
+// awaitReady waits until agent is ready, then logs ready line of key=value
+// pairs and publishes retained ready message if ready topic is set.
+func (a *agent) awaitReady() {
+	for !a.Ready() {
+		a.clk().Sleep(readyInterval)
+	}
+	startup := a.clk().Now().Sub(a.started)
+	edgex := edgexDisabled
+	if a.edgexEnabled() {
+		edgex = edgexReachable
+	}
+	a.logger.Info(fmt.Sprintf("ready version=%s startup=%s mqtt=%s nats=%s edgex=%s",
+		Version, startup.Round(time.Millisecond), StateConnected, StateConnected, edgex))
+
+	topic := a.cfg().Ready.Topic
+	if topic == "" {
+		return
+	}
+	payload, err := encoder.EncodeRecords(a.BaseName(""), readyRecords(startup))
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to encode ready message: %s", err))
+		return
+	}
+	if err := a.publish(topic, string(payload), true); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to publish ready message: %s", err))
+	}
+}
+
+// readyRecords returns ready message with agent version and startup time in seconds.
+func readyRecords(startup time.Duration) []senml.Record {
+	ready, version := true, Version
+	return []senml.Record{
+		{Name: readyRecord, BoolValue: &ready},
+		{Name: beaconVersion, StringValue: &version},
+		gauge(readyStartup, secondsUnit, startup.Seconds()),
+	}
+}
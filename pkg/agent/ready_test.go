@@ -0,0 +1,26 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadyRecords(t *testing.T) {
+	records := readyRecords(1500 * time.Millisecond)
+	assert.Len(t, records, 3, fmt.Sprintf("expected 3 records got %d", len(records)))
+	assert.Equal(t, readyRecord, records[0].Name, fmt.Sprintf("expected name %s got %s", readyRecord, records[0].Name))
+	assert.True(t, *records[0].BoolValue, "expected ready to be true")
+	assert.Equal(t, Version, *records[1].StringValue, fmt.Sprintf("expected version %s got %s", Version, *records[1].StringValue))
+	assert.Equal(t, 1.5, *records[2].Value, fmt.Sprintf("expected startup 1.5s got %v", *records[2].Value))
+}
+
+func TestReadyNotConnected(t *testing.T) {
+	a := &agent{config: &Config{}}
+	assert.False(t, a.Ready(), "expected agent without connections not to be ready")
+}
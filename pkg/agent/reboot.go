@@ -0,0 +1,93 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	hostReboot   = "host-reboot"
+	rebootCancel = "cancel"
+	rebooting    = "rebooting"
+	canceled     = "canceled"
+)
+
+var (
+	// errRebootScheduled indicates that reboot is already scheduled
+	errRebootScheduled = errors.New("reboot already scheduled")
+
+	// errRebootNotScheduled indicates that there is no scheduled reboot to cancel
+	errRebootNotScheduled = errors.New("reboot not scheduled")
+
+	// errRebootHook indicates that pre-reboot hook failed and reboot isn't scheduled
+	errRebootHook = errors.New("pre-reboot hook failed")
+)
+
+// rebootHost handles `host-reboot` command, `host-reboot,cancel` cancels
+// scheduled reboot. Reboot command goes through the same feature, safe
+// mode and allowlist checks as exec commands, and so does pre-reboot hook
+// which is run before reboot is scheduled. Reboot is run after the delay,
+// so that the acknowledgement is delivered before the host goes down.
+func (a *agent) rebootHost(uuid string, args []string) (string, error) {
+	if len(args) > 0 && strings.TrimSpace(args[0]) == rebootCancel {
+		return a.cancelReboot()
+	}
+
+	cfg := a.cfg().Reboot
+	_, opts, err := a.prepare(cfg.Command)
+	if err != nil {
+		return "", err
+	}
+	opts.cancel()
+
+	a.rebootMu.Lock()
+	defer a.rebootMu.Unlock()
+	if a.reboot != nil {
+		return "", errRebootScheduled
+	}
+	if strings.TrimSpace(cfg.PreHook) != "" {
+		var buf bytes.Buffer
+		if _, _, _, err := a.execute(uuid, cfg.PreHook, &buf); err != nil {
+			a.logger.Error(fmt.Sprintf("Pre-reboot hook failed: %s %s", err, strings.TrimSpace(buf.String())))
+			return "", errors.Wrap(errRebootHook, err)
+		}
+	}
+
+	a.logger.Warn(fmt.Sprintf("Host reboot requested by %s, rebooting in %s", uuid, cfg.Delay))
+	a.reboot = a.clk().AfterFunc(cfg.Delay, func() {
+		a.runReboot(uuid, cfg.Command)
+	})
+	return rebooting, nil
+}
+
+// runReboot runs reboot command. Reboot is cleared once the command
+// returns, so that failed reboot can be requested again.
+func (a *agent) runReboot(uuid, cmd string) {
+	a.logger.Warn("Rebooting host")
+	var buf bytes.Buffer
+	_, _, _, err := a.execute(uuid, cmd, &buf)
+
+	a.rebootMu.Lock()
+	a.reboot = nil
+	a.rebootMu.Unlock()
+	if err != nil {
+		a.logger.Error(fmt.Sprintf("Failed to reboot host: %s %s", err, strings.TrimSpace(buf.String())))
+	}
+}
+
+func (a *agent) cancelReboot() (string, error) {
+	a.rebootMu.Lock()
+	defer a.rebootMu.Unlock()
+	if a.reboot == nil || !a.reboot.Stop() {
+		return "", errRebootNotScheduled
+	}
+	a.reboot = nil
+	a.logger.Warn("Scheduled host reboot canceled")
+	return canceled, nil
+}
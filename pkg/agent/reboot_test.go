@@ -0,0 +1,86 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebootHost(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+
+	cases := []struct {
+		desc      string
+		safe      bool
+		allowlist []string
+		hook      string
+		res       string
+		err       error
+		scheduled bool
+	}{
+		{"reboot scheduled", false, nil, "", rebooting, nil, true},
+		{"reboot scheduled after hook", false, nil, "true,hook", rebooting, nil, true},
+		{"reboot in safe mode", true, nil, "", "", errSafeMode, false},
+		{"reboot command not allowed", false, []string{"echo"}, "", "", errCommandNotAllowed, false},
+		{"failed hook", false, nil, "false,hook", "", errRebootHook, false},
+	}
+
+	for _, tc := range cases {
+		clock := mocks.NewClock(time.Unix(1588091188, 0))
+		a := &agent{
+			config: &Config{
+				Exec:   ExecConfig{Allowlist: tc.allowlist},
+				Reboot: RebootConfig{Delay: 5 * time.Second, Command: "true,reboot", PreHook: tc.hook},
+			},
+			safeMode: &safeMode{enabled: tc.safe},
+			procs:    make(map[int]*process),
+			clock:    clock,
+			logger:   logger,
+		}
+		res, err := a.rebootHost("1", nil)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected result %s got %s", tc.desc, tc.res, res))
+		assert.Equal(t, tc.scheduled, a.reboot != nil, fmt.Sprintf("%s: expected scheduled %t", tc.desc, tc.scheduled))
+	}
+}
+
+func TestCancelReboot(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	clock := mocks.NewClock(time.Unix(1588091188, 0))
+	a := &agent{
+		config:   &Config{Reboot: RebootConfig{Delay: 5 * time.Second, Command: "true,reboot"}},
+		safeMode: &safeMode{},
+		procs:    make(map[int]*process),
+		clock:    clock,
+		logger:   logger,
+	}
+
+	_, err = a.rebootHost("1", []string{rebootCancel})
+	assert.Equal(t, errRebootNotScheduled, err, fmt.Sprintf("expected error %s got %s", errRebootNotScheduled, err))
+
+	_, err = a.rebootHost("1", nil)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	_, err = a.rebootHost("1", nil)
+	assert.Equal(t, errRebootScheduled, err, fmt.Sprintf("expected error %s got %s", errRebootScheduled, err))
+
+	res, err := a.rebootHost("1", []string{rebootCancel})
+	assert.Nil(t, err, fmt.Sprintf("unexpected error: %s", err))
+	assert.Equal(t, canceled, res, fmt.Sprintf("expected result %s got %s", canceled, res))
+	clock.Advance(time.Minute)
+	assert.Nil(t, a.reboot, "expected canceled reboot not to run")
+}
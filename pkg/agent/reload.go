@@ -0,0 +1,134 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/nats-io/nats.go"
+)
+
+// reloadRunTimeout limits how long reload command runs
+// if agent doesn't wait for services to apply config.
+const reloadRunTimeout = time.Minute
+
+var (
+	// errInvalidReload indicates malformed reload template
+	errInvalidReload = errors.New("invalid config reload template")
+
+	// errFailedReload indicates that reload command failed
+	errFailedReload = errors.New("failed to reload service")
+)
+
+// reloadData is data available in reload templates.
+type reloadData struct {
+	Service string
+	Type    string
+	File    string
+}
+
+// reloadTemplate parses reload subject, payload or command template.
+func reloadTemplate(tmpl string) (*template.Template, error) {
+	t, err := template.New("reload").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, errors.Wrap(errInvalidReload, err)
+	}
+	if err := t.Execute(&strings.Builder{}, reloadData{}); err != nil {
+		return nil, errors.Wrap(errInvalidReload, err)
+	}
+	return t, nil
+}
+
+func renderReload(tmpl string, data reloadData) (string, error) {
+	t, err := reloadTemplate(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", errors.Wrap(errInvalidReload, err)
+	}
+	return sb.String(), nil
+}
+
+// reloadConfig returns reload of the service, reload registered under
+// service name takes precedence over reload registered under its type.
+func (a *agent) reloadConfig(service, typ string) ReloadConfig {
+	reloads := a.cfg().Apply.Reload
+	if rc, ok := reloads[service]; ok {
+		return rc
+	}
+	return reloads[typ]
+}
+
+// reload notifies the service that its config is saved. If apply timeout
+// is set it waits for the service to acknowledge and returns "applied" or
+// "timeout". Services without registered reload are notified with empty
+// message on `commands.<service>.config` subject.
+func (a *agent) reload(service, typ, file string) (string, error) {
+	rc := a.reloadConfig(service, typ)
+	data := reloadData{Service: service, Type: typ, File: file}
+	if strings.TrimSpace(rc.Command) != "" {
+		return a.reloadCommand(rc.Command, data)
+	}
+
+	subject := fmt.Sprintf("%s.%s.%s", Commands, service, config)
+	if rc.Subject != "" {
+		s, err := renderReload(rc.Subject, data)
+		if err != nil {
+			return "", err
+		}
+		subject = s
+	}
+	payload, err := renderReload(rc.Payload, data)
+	if err != nil {
+		return "", err
+	}
+
+	if a.cfg().Apply.Timeout <= 0 {
+		return "", a.nats.Publish(subject, []byte(payload))
+	}
+	if _, err := a.nats.Request(subject, []byte(payload), a.cfg().Apply.Timeout); err != nil {
+		if err == nats.ErrTimeout {
+			a.logger.Warn(fmt.Sprintf("Service %s didn't acknowledge config in %s", service, a.cfg().Apply.Timeout))
+			return applyTimeout, nil
+		}
+		return "", errors.Wrap(errFailedToPublish, err)
+	}
+	return applied, nil
+}
+
+// reloadCommand runs comma separated binary and arguments of reload
+// command, i.e. `systemctl,restart,{{.Service}}`. Command is killed
+// after apply timeout and it is applied once it exits with zero status.
+func (a *agent) reloadCommand(cmd string, data reloadData) (string, error) {
+	args := strings.Split(cmd, ",")
+	for i := range args {
+		arg, err := renderReload(strings.TrimSpace(args[i]), data)
+		if err != nil {
+			return "", err
+		}
+		args[i] = arg
+	}
+
+	timeout := a.cfg().Apply.Timeout
+	if timeout <= 0 {
+		timeout = reloadRunTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	out, err := a.exe().CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		return "", errors.Wrap(errFailedReload, fmt.Errorf("%s %s", err, strings.TrimSpace(string(out))))
+	}
+	if a.cfg().Apply.Timeout <= 0 {
+		return "", nil
+	}
+	return applied, nil
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloadCommand(t *testing.T) {
+	reloads := map[string]ReloadConfig{
+		"export":   {Command: "systemctl, restart, {{.Service}}"},
+		"export-2": {Command: "kill,-HUP,{{.File}}"},
+	}
+
+	cases := []struct {
+		desc    string
+		service string
+		script  string
+		timeout time.Duration
+		call    []string
+		res     string
+		err     error
+	}{
+		{"reload registered by type", "export-1", "exit 0", 0, []string{"systemctl", "restart", "export-1"}, "", nil},
+		{"reload registered by name", "export-2", "exit 0", 0, []string{"kill", "-HUP", "export.toml"}, "", nil},
+		{"applied with apply timeout", "export-1", "exit 0", time.Second, []string{"systemctl", "restart", "export-1"}, applied, nil},
+		{"failed reload", "export-1", "echo unit not found; exit 5", 0, []string{"systemctl", "restart", "export-1"}, "", errFailedReload},
+	}
+
+	for _, tc := range cases {
+		executor := mocks.NewExecutor(tc.script)
+		a := &agent{
+			config:   &Config{Apply: ApplyConfig{Timeout: tc.timeout, Reload: reloads}},
+			executor: executor,
+		}
+		res, err := a.reload(tc.service, export, "export.toml")
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected result %s got %s", tc.desc, tc.res, res))
+		calls := executor.Calls()
+		assert.Len(t, calls, 1, fmt.Sprintf("%s: expected 1 call got %d", tc.desc, len(calls)))
+		if len(calls) == 1 {
+			assert.Equal(t, tc.call, calls[0], fmt.Sprintf("%s: expected call %v got %v", tc.desc, tc.call, calls[0]))
+		}
+	}
+}
+
+func TestApplyConfigValidate(t *testing.T) {
+	cases := []struct {
+		desc   string
+		reload ReloadConfig
+		err    error
+	}{
+		{"valid reload", ReloadConfig{Subject: "export.{{.Service}}", Payload: "{{.File}}"}, nil},
+		{"valid command", ReloadConfig{Command: "systemctl,restart,{{.Service}}"}, nil},
+		{"malformed subject", ReloadConfig{Subject: "export.{{.Service"}, errInvalidReload},
+		{"unknown field in command", ReloadConfig{Command: "systemctl,restart,{{.Name}}"}, errInvalidReload},
+	}
+
+	for _, tc := range cases {
+		ac := ApplyConfig{Reload: map[string]ReloadConfig{"export": tc.reload}}
+		err := ac.Validate()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+}
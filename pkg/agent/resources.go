@@ -0,0 +1,101 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/senml"
+)
+
+const (
+	agentResources = "agent-resources"
+
+	resRSS        = "rss"
+	resRSSPeak    = "rss_peak"
+	resCPUUser    = "cpu_user_total"
+	resCPUSystem  = "cpu_system_total"
+	resGoroutines = "goroutines"
+	resHeapAlloc  = "heap_alloc"
+	resHeapSys    = "heap_sys"
+	resMemSys     = "mem_sys"
+	resNextGC     = "gc_next"
+	resGC         = "gc_total"
+	resGCPause    = "gc_pause_total"
+
+	bytesUnit   = "B"
+	secondsUnit = "s"
+)
+
+// statmPath holds memory usage of the process in pages.
+const statmPath = "/proc/self/statm"
+
+// resources returns resource usage of the agent process itself. Memory is
+// reported in bytes, cumulative CPU and GC times in seconds. Current RSS is
+// read from procfs and omitted where it is not available.
+func (a *agent) resources() []senml.Record {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	records := []senml.Record{}
+	if rss, err := currentRSS(); err == nil {
+		records = append(records, gauge(resRSS, bytesUnit, float64(rss)))
+	}
+	// Peak RSS is reported by getrusage in kilobytes.
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err == nil {
+		records = append(records,
+			gauge(resRSSPeak, bytesUnit, float64(ru.Maxrss*1024)),
+			counter(resCPUUser, secondsUnit, time.Duration(ru.Utime.Nano()).Seconds()),
+			counter(resCPUSystem, secondsUnit, time.Duration(ru.Stime.Nano()).Seconds()),
+		)
+	}
+	return append(records,
+		gauge(resGoroutines, "", float64(runtime.NumGoroutine())),
+		gauge(resHeapAlloc, bytesUnit, float64(ms.HeapAlloc)),
+		gauge(resHeapSys, bytesUnit, float64(ms.HeapSys)),
+		gauge(resMemSys, bytesUnit, float64(ms.Sys)),
+		gauge(resNextGC, bytesUnit, float64(ms.NextGC)),
+		counter(resGC, "", float64(ms.NumGC)),
+		counter(resGCPause, secondsUnit, time.Duration(ms.PauseTotalNs).Seconds()),
+	)
+}
+
+// currentRSS returns resident set size of the process in bytes.
+func currentRSS() (int64, error) {
+	b, err := ioutil.ReadFile(statmPath)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) < 2 {
+		return 0, ErrMalformedEntity
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
+
+func gauge(name, unit string, v float64) senml.Record {
+	return senml.Record{
+		Name:  name,
+		Unit:  unit,
+		Value: &v,
+	}
+}
+
+func counter(name, unit string, total float64) senml.Record {
+	r := encoder.Counter(name, total)
+	r.Unit = unit
+	return r
+}
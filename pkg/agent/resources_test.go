@@ -0,0 +1,32 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResources(t *testing.T) {
+	a := &agent{}
+	values := map[string]float64{}
+	for _, r := range a.resources() {
+		switch {
+		case r.Value != nil:
+			values[r.Name] = *r.Value
+		case r.Sum != nil:
+			values[r.Name] = *r.Sum
+		}
+	}
+
+	for _, name := range []string{resRSSPeak, resGoroutines, resHeapAlloc, resHeapSys, resMemSys} {
+		assert.True(t, values[name] > 0, fmt.Sprintf("expected positive %s got %v", name, values[name]))
+	}
+	for _, name := range []string{resCPUUser, resCPUSystem, resGC, resGCPause} {
+		_, ok := values[name]
+		assert.True(t, ok, fmt.Sprintf("expected %s record", name))
+	}
+}
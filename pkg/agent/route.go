@@ -0,0 +1,46 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import "github.com/mainflux/senml"
+
+const routeRecord = "route"
+
+// stripRoute removes routing token matching the route pattern at the start
+// of the command. Token is the first pattern group, or the whole match if
+// pattern has no groups, and is echoed in responses to the uuid until
+// clearRoute is called.
+func (a *agent) stripRoute(uuid, cmd string) string {
+	if a.routeRe == nil {
+		return cmd
+	}
+	m := a.routeRe.FindStringSubmatchIndex(cmd)
+	if m == nil || m[0] != 0 {
+		return cmd
+	}
+	token := cmd[m[0]:m[1]]
+	if len(m) > 3 && m[2] >= 0 {
+		token = cmd[m[2]:m[3]]
+	}
+	a.routes.Store(uuid, token)
+	return cmd[m[1]:]
+}
+
+func (a *agent) clearRoute(uuid string) {
+	a.routes.Delete(uuid)
+}
+
+// routeRecords appends record with routing token stripped from the command
+// sent with the uuid, if any.
+func (a *agent) routeRecords(uuid string, records []senml.Record) []senml.Record {
+	token, ok := a.routes.Load(uuid)
+	if !ok {
+		return records
+	}
+	t := token.(string)
+	return append(records, senml.Record{
+		Name:        routeRecord,
+		StringValue: &t,
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	agentRTT = "agent-rtt"
+
+	// rttTopic is subtopic of control channel RTT probes are published to.
+	rttTopic = "rtt"
+	// rttQoS makes the broker acknowledge RTT probes.
+	rttQoS = 1
+	// maxRTTSamples is the max number of probes single command publishes.
+	maxRTTSamples = 20
+
+	rttName    = "rtt"
+	rttMinName = "rtt_min"
+	rttAvgName = "rtt_avg"
+	rttMaxName = "rtt_max"
+)
+
+// rtt handles `agent-rtt[,<samples>]` command, it publishes probes one
+// after another with QoS 1 and measures how long each takes to be
+// acknowledged by the broker. Latency of a single probe is reported as
+// `rtt` record, min, avg and max are reported for more samples.
+func (a *agent) rtt(args []string) ([]senml.Record, error) {
+	samples := 1
+	if len(args) > 0 && args[0] != "" {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > maxRTTSamples {
+			return nil, errors.Wrap(ErrInvalidCommand, fmt.Errorf("samples must be between 1 and %d", maxRTTSamples))
+		}
+		samples = n
+	}
+
+	topic := a.getTopic(rttTopic)
+	var min, max, total time.Duration
+	for i := 0; i < samples; i++ {
+		start := a.clk().Now()
+		token := a.mqttClient.Publish(topic, rttQoS, false, strconv.Itoa(i))
+		token.Wait()
+		if err := token.Error(); err != nil {
+			return nil, errors.Wrap(errFailedToPublish, errors.New(err.Error()))
+		}
+		d := a.clk().Now().Sub(start)
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		total += d
+	}
+
+	if samples == 1 {
+		return []senml.Record{gauge(rttName, secondsUnit, total.Seconds())}, nil
+	}
+	return []senml.Record{
+		gauge(rttMinName, secondsUnit, min.Seconds()),
+		gauge(rttAvgName, secondsUnit, (total / time.Duration(samples)).Seconds()),
+		gauge(rttMaxName, secondsUnit, max.Seconds()),
+	}, nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// delayClient advances the clock by the next delay on each publish,
+// or fails the publish once delays run out.
+type delayClient struct {
+	paho.Client
+	clock  *mocks.Clock
+	delays []time.Duration
+	topics []string
+	qos    []byte
+}
+
+func (c *delayClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.topics = append(c.topics, topic)
+	c.qos = append(c.qos, qos)
+	if len(c.delays) == 0 {
+		return errToken{err: errors.New("connection lost")}
+	}
+	c.clock.Advance(c.delays[0])
+	c.delays = c.delays[1:]
+	return doneToken{}
+}
+
+func TestRTT(t *testing.T) {
+	ms := func(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+	cases := []struct {
+		desc   string
+		args   []string
+		delays []time.Duration
+		values map[string]float64
+		err    error
+	}{
+		{"single sample", nil, []time.Duration{ms(20)}, map[string]float64{rttName: 0.02}, nil},
+		{"multiple samples", []string{"3"}, []time.Duration{ms(30), ms(10), ms(20)}, map[string]float64{rttMinName: 0.01, rttAvgName: 0.02, rttMaxName: 0.03}, nil},
+		{"invalid samples", []string{"many"}, nil, nil, ErrInvalidCommand},
+		{"too many samples", []string{"21"}, nil, nil, ErrInvalidCommand},
+		{"failed publish", []string{"2"}, []time.Duration{ms(10)}, nil, errFailedToPublish},
+	}
+
+	for _, tc := range cases {
+		clock := mocks.NewClock(time.Unix(0, 0))
+		client := &delayClient{clock: clock, delays: tc.delays}
+		a := &agent{
+			config:     &Config{Channels: ChanConfig{Control: "ctrl"}},
+			mqttClient: client,
+			clock:      clock,
+		}
+		records, err := a.rtt(tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		values := map[string]float64{}
+		for _, r := range records {
+			assert.Equal(t, secondsUnit, r.Unit, fmt.Sprintf("%s: expected unit %s got %s", tc.desc, secondsUnit, r.Unit))
+			values[r.Name] = *r.Value
+		}
+		assert.Equal(t, tc.values, values, fmt.Sprintf("%s: expected values %v got %v", tc.desc, tc.values, values))
+		for i := range client.topics {
+			assert.Equal(t, "channels/ctrl/messages/res/rtt", client.topics[i], fmt.Sprintf("%s: unexpected probe topic %s", tc.desc, client.topics[i]))
+			assert.Equal(t, byte(rttQoS), client.qos[i], fmt.Sprintf("%s: expected probe QoS %d got %d", tc.desc, rttQoS, client.qos[i]))
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	safeModeOn  = "on"
+	safeModeOff = "off"
+)
+
+var (
+	// errSafeMode indicates that command execution is disabled by safe mode
+	errSafeMode = errors.New("command execution disabled in safe mode")
+
+	// errFailedSafeModeState indicates error in reading or writing safe mode state file
+	errFailedSafeModeState = errors.New("failed to persist safe mode state")
+)
+
+// safeMode holds safe mode state, persisted in the state file if set.
+type safeMode struct {
+	mu      sync.Mutex
+	enabled bool
+	file    string
+}
+
+// newSafeMode returns safe mode with the state from the state
+// file if it exists, otherwise with the default state.
+func newSafeMode(enabled bool, file string) (*safeMode, error) {
+	sm := &safeMode{
+		enabled: enabled,
+		file:    file,
+	}
+	if file == "" {
+		return sm, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return sm, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errFailedSafeModeState, err)
+	}
+	switch strings.TrimSpace(string(b)) {
+	case safeModeOn:
+		sm.enabled = true
+	case safeModeOff:
+		sm.enabled = false
+	}
+	return sm, nil
+}
+
+func (sm *safeMode) Enabled() bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.enabled
+}
+
+// Set changes and persists the state.
+func (sm *safeMode) Set(enabled bool) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.file != "" {
+		state := safeModeOff
+		if enabled {
+			state = safeModeOn
+		}
+		if err := ioutil.WriteFile(sm.file, []byte(state), 0644); err != nil {
+			return errors.Wrap(errFailedSafeModeState, err)
+		}
+	}
+	sm.enabled = enabled
+	return nil
+}
+
+func (a *agent) setSafeMode(state string) (string, error) {
+	switch state {
+	case safeModeOn:
+		if err := a.safeMode.Set(true); err != nil {
+			return "", err
+		}
+	case safeModeOff:
+		if err := a.safeMode.Set(false); err != nil {
+			return "", err
+		}
+	default:
+		return "", ErrInvalidCommand
+	}
+	a.logger.Warn(fmt.Sprintf("Safe mode turned %s", state))
+	return state, nil
+}
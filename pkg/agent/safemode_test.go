@@ -0,0 +1,150 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSafeMode(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "safemode")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "safemode")
+
+	cases := []struct {
+		desc    string
+		initial bool
+		state   string
+		res     string
+		enabled bool
+		err     error
+	}{
+		{"turn safe mode on", false, safeModeOn, safeModeOn, true, nil},
+		{"turn safe mode off", true, safeModeOff, safeModeOff, false, nil},
+		{"turn enabled safe mode on", true, safeModeOn, safeModeOn, true, nil},
+		{"invalid state", true, "bad", "", true, ErrInvalidCommand},
+		{"empty state", false, "", "", false, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		os.Remove(file)
+		a := &agent{
+			safeMode: &safeMode{enabled: tc.initial, file: file},
+			logger:   logger,
+		}
+		res, err := a.setSafeMode(tc.state)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected result %s got %s", tc.desc, tc.res, res))
+		assert.Equal(t, tc.enabled, a.safeMode.Enabled(), fmt.Sprintf("%s: expected safe mode enabled %t", tc.desc, tc.enabled))
+
+		// Changed state is persisted and restored on restart.
+		restored, err := newSafeMode(!tc.enabled, file)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error restoring safe mode: %s", tc.desc, err))
+		expected := tc.enabled
+		if tc.err != nil {
+			expected = !tc.enabled
+		}
+		assert.Equal(t, expected, restored.Enabled(), fmt.Sprintf("%s: expected restored safe mode enabled %t", tc.desc, expected))
+	}
+}
+
+func TestNewSafeMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "safemode")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, state string) string {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(state), 0644); err != nil {
+			t.Fatalf("failed to write state file: %s", err)
+		}
+		return file
+	}
+	on := write("on", "on\n")
+	off := write("off", "off")
+	corrupt := write("corrupt", "\x00garbage")
+	unreadable := filepath.Join(dir, "unreadable")
+	if err := os.Mkdir(unreadable, 0755); err != nil {
+		t.Fatalf("failed to create dir: %s", err)
+	}
+
+	cases := []struct {
+		desc    string
+		enabled bool
+		file    string
+		res     bool
+		err     error
+	}{
+		{"no state file", true, "", true, nil},
+		{"missing state file", true, filepath.Join(dir, "missing"), true, nil},
+		{"state file on", false, on, true, nil},
+		{"state file off", true, off, false, nil},
+		{"corrupt state file", true, corrupt, true, nil},
+		{"corrupt state file with safe mode off", false, corrupt, false, nil},
+		{"unreadable state file", false, unreadable, false, errFailedSafeModeState},
+	}
+
+	for _, tc := range cases {
+		sm, err := newSafeMode(tc.enabled, tc.file)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, tc.res, sm.Enabled(), fmt.Sprintf("%s: expected safe mode enabled %t", tc.desc, tc.res))
+	}
+}
+
+func TestSafeModeExecute(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+
+	cases := []struct {
+		desc string
+		safe bool
+		cmd  string
+		err  error
+	}{
+		{"execute in safe mode", true, "echo,hello", errSafeMode},
+		{"execute invalid command in safe mode", true, "unknown-binary", errSafeMode},
+		{"execute out of safe mode", false, "echo,hello", nil},
+	}
+
+	for _, tc := range cases {
+		m, err := newMaintenance(store.NewMemory(), 0)
+		if err != nil {
+			t.Fatalf("unexpected error creating maintenance: %s", err)
+		}
+		client := &recordingClient{}
+		a := &agent{
+			config:     &Config{Channels: ChanConfig{Control: "ctrl"}},
+			mqttClient: client,
+			safeMode:   &safeMode{enabled: tc.safe},
+			maint:      m,
+			procs:      make(map[int]*process),
+			logger:     logger,
+		}
+		_, err = a.Execute("1", tc.cmd)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Len(t, client.payloads, 1, fmt.Sprintf("%s: expected single response", tc.desc))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	envSecretPrefix  = "${env:"
+	fileSecretPrefix = "${file:"
+	secretSuffix     = "}"
+)
+
+// errResolveSecret indicates that config references secret which can't be resolved
+var errResolveSecret = errors.New("failed to resolve config secret")
+
+// secretRef is config value referencing a secret and the resolved secret.
+type secretRef struct {
+	ref    string
+	secret string
+}
+
+// secretFields returns config values which can reference secrets, keyed by
+// their TOML path.
+func secretFields(c *Config) map[string]*string {
+	return map[string]*string{
+		"mqtt.password":      &c.MQTT.Password,
+		"mqtt.client_key":    &c.MQTT.ClientKey,
+		"nats.token":         &c.Nats.Token,
+		"artifacts.token":    &c.Artifacts.Token,
+		"exec.allowlist_key": &c.Exec.AllowlistKey,
+	}
+}
+
+// resolveSecrets replaces secret references, `${env:NAME}` and `${file:path}`,
+// with the environment variable value or the file content, and reads MQTT
+// password from PasswordFile if it's set. References are kept, so they are
+// saved instead of the secrets.
+func resolveSecrets(c *Config) error {
+	var pwdFile bool
+	if c.MQTT.PasswordFile != "" {
+		if c.MQTT.Password != "" {
+			return errors.Wrap(errResolveSecret, errors.New("mqtt.password and mqtt.password_file are both set"))
+		}
+		c.MQTT.Password = fileSecretPrefix + c.MQTT.PasswordFile + secretSuffix
+		pwdFile = true
+	}
+	for path, v := range secretFields(c) {
+		ref := *v
+		secret, ok, err := resolveSecret(ref)
+		if err != nil {
+			return errors.Wrap(errResolveSecret, errors.New(fmt.Sprintf("%s: %s", path, err)))
+		}
+		if !ok {
+			continue
+		}
+		if path == "mqtt.password" && pwdFile {
+			ref = ""
+		}
+		if c.secrets == nil {
+			c.secrets = map[string]secretRef{}
+		}
+		c.secrets[path] = secretRef{ref: ref, secret: secret}
+		*v = secret
+	}
+	return nil
+}
+
+// resolveSecret returns secret referenced by the value and whether
+// value is a reference at all.
+func resolveSecret(ref string) (string, bool, error) {
+	if !strings.HasSuffix(ref, secretSuffix) {
+		return "", false, nil
+	}
+	switch {
+	case strings.HasPrefix(ref, envSecretPrefix):
+		name := strings.TrimSuffix(strings.TrimPrefix(ref, envSecretPrefix), secretSuffix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", true, errors.New(fmt.Sprintf("environment variable %s is not set", name))
+		}
+		return secret, true, nil
+	case strings.HasPrefix(ref, fileSecretPrefix):
+		file := strings.TrimSuffix(strings.TrimPrefix(ref, fileSecretPrefix), secretSuffix)
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", true, errors.New(fmt.Sprintf("failed to read secret file: %s", err))
+		}
+		return strings.TrimRight(string(b), "\r\n"), true, nil
+	}
+	return "", false, nil
+}
+
+// unresolveSecrets puts secret references back in place of resolved
+// secrets, values changed since they were resolved are left as they are.
+func unresolveSecrets(c *Config) {
+	fields := secretFields(c)
+	for path, s := range c.secrets {
+		if *fields[path] == s.secret {
+			*fields[path] = s.ref
+		}
+	}
+}
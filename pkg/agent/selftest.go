@@ -0,0 +1,99 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mainflux/senml"
+)
+
+const (
+	agentSelftest   = "agent-selftest"
+	selftestTimeout = 5 * time.Second
+
+	pass = "pass"
+	fail = "fail"
+	skip = "skip"
+)
+
+// selftest checks MQTT publish, NATS connection, EdgeX ping and local
+// command execution and returns record with pass, fail or skip per
+// subsystem, followed by overall result record.
+func (a *agent) selftest() []senml.Record {
+	checks := []struct {
+		name  string
+		check func() (string, error)
+	}{
+		{"mqtt", a.selftestMQTT},
+		{"nats", a.selftestNATS},
+		{"edgex", a.selftestEdgex},
+		{"exec", a.selftestExec},
+	}
+
+	result := pass
+	records := []senml.Record{}
+	for _, c := range checks {
+		st, err := c.check()
+		if err != nil {
+			a.logger.Warn(fmt.Sprintf("Selftest of %s failed: %s", c.name, err))
+			st, result = fail, fail
+		}
+		records = append(records, senml.Record{
+			Name:        c.name,
+			StringValue: &st,
+		})
+	}
+	return append(records, senml.Record{
+		Name:        agentSelftest,
+		StringValue: &result,
+	})
+}
+
+func (a *agent) selftestMQTT() (string, error) {
+	mqtt := a.cfg().MQTT
+	token := a.mqttClient.Publish(a.getTopic(agentSelftest), mqtt.QoS, false, pass)
+	if !token.WaitTimeout(selftestTimeout) {
+		return "", fmt.Errorf("publish timed out after %s", selftestTimeout)
+	}
+	if err := token.Error(); err != nil {
+		return "", err
+	}
+	return pass, nil
+}
+
+func (a *agent) selftestNATS() (string, error) {
+	if err := a.nats.FlushTimeout(selftestTimeout); err != nil {
+		return "", err
+	}
+	return pass, nil
+}
+
+func (a *agent) selftestEdgex() (string, error) {
+	if a.edgexClient == nil {
+		return skip, nil
+	}
+	if _, err := a.edgexClient.Ping(); err != nil {
+		return "", err
+	}
+	return pass, nil
+}
+
+func (a *agent) selftestExec() (string, error) {
+	if a.safeMode.Enabled() || !a.cfg().Features.Enabled(FeatureExec) {
+		return skip, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), selftestTimeout)
+	defer cancel()
+	out, err := a.exe().CommandContext(ctx, "echo", pass).Output()
+	if err != nil {
+		return "", err
+	}
+	if string(out) != pass+"\n" {
+		return "", fmt.Errorf("unexpected output %q", out)
+	}
+	return pass, nil
+}
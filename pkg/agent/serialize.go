@@ -0,0 +1,37 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+// publishQueueSize is the number of publishes waiting for the writer
+// in serialized publish mode, further publishes block.
+const publishQueueSize = 100
+
+// publishReq is publish waiting for the writer, its result
+// is sent to done.
+type publishReq struct {
+	topic   string
+	payload string
+	retain  bool
+	done    chan error
+}
+
+// enqueuePublish hands publish over to the writer and waits for its result,
+// so that publishes are made in the order they were requested.
+func (a *agent) enqueuePublish(t, payload string, retain bool) error {
+	done := make(chan error, 1)
+	a.pubQueue <- publishReq{
+		topic:   t,
+		payload: payload,
+		retain:  retain,
+		done:    done,
+	}
+	return <-done
+}
+
+// publishWriter makes queued publishes one at a time.
+func (a *agent) publishWriter() {
+	for req := range a.pubQueue {
+		req.done <- a.publishNow(req.topic, req.payload, req.retain)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowClient records publishes, each of them taking a while,
+// and the highest number of publishes made at the same time.
+type slowClient struct {
+	paho.Client
+	mu       sync.Mutex
+	active   int
+	max      int
+	payloads []string
+}
+
+func (c *slowClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.mu.Lock()
+	c.active++
+	if c.active > c.max {
+		c.max = c.active
+	}
+	c.payloads = append(c.payloads, payload.(string))
+	c.mu.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	c.mu.Lock()
+	c.active--
+	c.mu.Unlock()
+	return doneToken{}
+}
+
+type doneToken struct {
+	paho.Token
+}
+
+func (doneToken) Wait() bool { return true }
+
+func (doneToken) Error() error { return nil }
+
+func TestSerializedPublish(t *testing.T) {
+	cases := []struct {
+		desc      string
+		serialize bool
+	}{
+		{"concurrent publish", false},
+		{"serialized publish", true},
+	}
+
+	for _, tc := range cases {
+		client := &slowClient{}
+		a := &agent{config: &Config{MQTT: MQTTConfig{Serialize: tc.serialize}}, mqttClient: client}
+		if tc.serialize {
+			a.pubQueue = make(chan publishReq, publishQueueSize)
+			go a.publishWriter()
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := a.Publish(control, fmt.Sprintf("%d", i))
+				assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+			}(i)
+		}
+		wg.Wait()
+
+		assert.Len(t, client.payloads, 5, fmt.Sprintf("%s: expected 5 publishes got %d", tc.desc, len(client.payloads)))
+		if tc.serialize {
+			assert.Equal(t, 1, client.max, fmt.Sprintf("%s: expected one publish at a time got %d", tc.desc, client.max))
+		}
+	}
+
+	// Publishes requested one after another are made in the same order.
+	client := &slowClient{}
+	a := &agent{config: &Config{MQTT: MQTTConfig{Serialize: true}}, mqttClient: client}
+	a.pubQueue = make(chan publishReq, publishQueueSize)
+	go a.publishWriter()
+	expected := []string{}
+	for i := 0; i < 5; i++ {
+		expected = append(expected, fmt.Sprintf("%d", i))
+		err := a.Publish(control, expected[i])
+		assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	}
+	assert.Equal(t, expected, client.payloads, fmt.Sprintf("expected publishes %v got %v", expected, client.payloads))
+}
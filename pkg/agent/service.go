@@ -4,25 +4,46 @@
 package agent
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"os/exec"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mainflux/agent/pkg/audit"
 	"github.com/mainflux/agent/pkg/edgex"
 	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/agent/pkg/store"
 	"github.com/mainflux/agent/pkg/terminal"
 
 	exp "github.com/mainflux/export/pkg/config"
 	"github.com/mainflux/mainflux/errors"
 	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
 	"github.com/nats-io/nats.go"
 )
 
+// Subsystems which can be disabled in config.
+const (
+	FeatureEdgex     = "edgex"
+	FeatureExec      = "exec"
+	FeatureTerminal  = "terminal"
+	FeatureHeartbeat = "heartbeat"
+)
+
 const (
 	Path     = "./config.toml"
 	Hearbeat = "heartbeat.>"
@@ -39,11 +60,27 @@ const (
 	data    = "data"
 
 	export = "export"
+
+	applied      = "applied"
+	applyTimeout = "timeout"
+	saved        = "saved"
+
+	agentAudit       = "agent-audit"
+	agentConfig      = "agent-config-export"
+	agentSafeMode    = "agent-safemode"
+	execHistory      = "exec-history"
+	servicesReset    = "services-reset"
+	edgexHealthcheck = "edgex-healthcheck"
+	edgexDevCommand  = "edgex-device-command"
+	fileGet          = "file-get"
+	edgexPrefix      = "edgex-"
+
+	servicesBucket = "services"
 )
 
 var (
-	// errInvalidCommand indicates malformed command
-	errInvalidCommand = errors.New("invalid command")
+	// ErrInvalidCommand indicates malformed command
+	ErrInvalidCommand = errors.New("invalid command")
 
 	// ErrMalformedEntity indicates malformed entity specification
 	ErrMalformedEntity = errors.New("malformed entity specification")
@@ -51,8 +88,8 @@ var (
 	// ErrInvalidQueryParams indicates malformed URL
 	ErrInvalidQueryParams = errors.New("invalid query params")
 
-	// errUnknownCommand indicates that command is not found
-	errUnknownCommand = errors.New("Unknown command")
+	// ErrUnknownCommand indicates that command is not found
+	ErrUnknownCommand = errors.New("Unknown command")
 
 	// errNatsSubscribing indicates problem with sub to topic for heartbeat
 	errNatsSubscribing = errors.New("failed to subscribe to heartbeat topic")
@@ -63,12 +100,31 @@ var (
 	// errFailedEncode indicates error in encoding
 	errFailedEncode = errors.New("failed to encode")
 
+	// errEncodePublished indicates that response couldn't be encoded and
+	// the encode error was published instead
+	errEncodePublished = errors.New("failed to encode response, encode error published")
+
 	// errFailedToPublish
 	errFailedToPublish = errors.New("failed to publish")
 
 	// errEdgexFailed
 	errEdgexFailed = errors.New("failed to execute edgex operation")
 
+	// errInvalidConfig indicates that config can't be applied
+	errInvalidConfig = errors.New("invalid config")
+
+	// errFailedSaveConfig indicates error in writing config file
+	errFailedSaveConfig = errors.New("failed to save config")
+
+	// errFeatureDisabled indicates that subsystem handling the command is disabled in config
+	errFeatureDisabled = errors.New("feature disabled")
+
+	// errEdgexOperationNotAllowed indicates that EdgeX operation action is not in the allowlist
+	errEdgexOperationNotAllowed = errors.New("edgex operation not allowed")
+
+	// errEdgeXNotConfigured indicates that EdgeX client is not set
+	errEdgeXNotConfigured = errors.New("edgex is not configured")
+
 	// errFailedExecute
 	errFailedExecute = errors.New("failed to execute command")
 
@@ -80,15 +136,54 @@ var (
 
 	// errNoSuchTerminalSession terminal session doesnt exist error on closing
 	errNoSuchTerminalSession = errors.New("no such terminal session")
+
+	// errAuditDisabled indicates that audit log is not configured
+	errAuditDisabled = errors.New("audit log is disabled")
+
+	// errMissingDeviceID indicates that topic prefix references device id which is not set
+	errMissingDeviceID = errors.New("topic prefix references device id which is not set")
+
+	// errHistoryDisabled indicates that execution history is not configured
+	errHistoryDisabled = errors.New("execution history is disabled")
+
+	// errInflightLimit indicates that publish failed fast because in-flight limit is reached
+	errInflightLimit = errors.New("too many in-flight publishes")
+
+	// errDecompress indicates that gzip compressed config content is invalid
+	errDecompress = errors.New("failed to decompress config content")
+
+	// gzipMagic is the header of gzip compressed content
+	gzipMagic = []byte{0x1f, 0x8b}
 )
 
+// argless holds control commands which don't take arguments.
+var argless = map[string]bool{
+	edgexHealthcheck:   true,
+	servicesReset:      true,
+	agentReloadCerts:   true,
+	agentSelftest:      true,
+	agentConfig:        true,
+	execList:           true,
+	agentStats:         true,
+	agentResources:     true,
+	agentBootstrapSync: true,
+	agentRTT:           true,
+	agentAllowlist:     true,
+	servicesTopology:   true,
+	edgexJobs:          true,
+}
+
 // Service specifies API for publishing messages and subscribing to topics.
 type Service interface {
 	// Execute command
 	Execute(string, string) (string, error)
 
+	// ExecuteStream executes command and writes its output
+	// to the writer as it is produced.
+	ExecuteStream(uuid, cmd string, w io.Writer) error
+
 	// Control command
-	Control(string, string) error
+	Control(string, string) (string, error)
 
 	// Update configuration file
 	AddConfig(Config) error
@@ -97,123 +192,743 @@ type Service interface {
 	Config() Config
 
 	// Saves config file
-	ServiceConfig(uuid, cmdStr string) error
+	ServiceConfig(uuid, cmdStr string) (string, error)
 
 	// Services returns service list
 	Services() []Info
 
+	// ServiceInfo returns info of the service with given name
+	ServiceInfo(name string) (Info, error)
+
 	// Terminal used for terminal control of gateway
 	Terminal(string, string) error
 
 	// Publish message
 	Publish(string, string) error
+
+	// ReloadCerts reloads MQTT TLS certificates from disk
+	// and reconnects MQTT client with new credentials.
+	ReloadCerts() error
+
+	// OnResponse registers hook invoked synchronously with topic
+	// and payload of every message agent publishes.
+	OnResponse(fn func(topic, payload string))
+
+	// AcceptEncoding sets encodings accepted by the sender of the command
+	// with the uuid, responses are sent plain if it is not set. Empty
+	// encoding clears it once the command is handled.
+	AcceptEncoding(uuid, encoding string)
+
+	// ResponseFormat sets format of responses to the command with the
+	// uuid, configured response format is used if it is not set. Empty
+	// format clears it once the command is handled.
+	ResponseFormat(uuid, format string)
+
+	// Ready checks whether MQTT and NATS are connected and, if EdgeX
+	// feature is enabled, EdgeX is reachable.
+	Ready() bool
+
+	// BaseName returns base name of responses to the command with the
+	// uuid, rendered with configured base name template.
+	BaseName(uuid string) string
+
+	// ErrorMessage returns message of the error sent in response to the
+	// command with the uuid, according to configured error verbosity.
+	ErrorMessage(uuid string, err error) string
 }
 
 var _ Service = (*agent)(nil)
 
 type agent struct {
+	// Counters are accessed atomically and kept first for 64-bit alignment.
+	hbDropped   uint64
+	cmdTotal    uint64
+	cmdFailed   uint64
+	hbQueue     chan heartbeatMsg
 	mqttClient  paho.Client
 	config      *Config
+	configMu    sync.RWMutex
 	edgexClient edgex.Client
+	edgexInsts  map[string]edgex.Client
 	logger      log.Logger
 	nats        *nats.Conn
 	svcs        map[string]Heartbeat
+	svcsMu      sync.RWMutex
+	store       store.Store
 	terminals   map[string]terminal.Session
+	procs       map[int]*process
+	procsMu     sync.Mutex
+	audit       audit.Log
+	history     audit.Log
+	throughput  Throughput
+	topicPrefix string
+	creds       *TLSCredentials
+	sync        ConfigSync
+	safeMode    *safeMode
+	maint       *maintenance
+	pause       offlinePause
+	stream      edgexStream
+	jobs        edgexJobRegistry
+	sent        map[string]sentRecords
+	sentMu      sync.Mutex
+	reboot      Timer
+	rebootMu    sync.Mutex
+	allowlistTS int64
+	allowlistMu sync.Mutex
+	inflight    chan struct{}
+	pubQueue    chan publishReq
+	throttle    throttle
+	routeRe     *regexp.Regexp
+	routes      sync.Map
+	encodings   sync.Map
+	formats     sync.Map
+	commands    sync.Map
+	hooksMu     sync.RWMutex
+	hooks       []func(topic, payload string)
+	transMu     sync.Mutex
+	transitions []transition
+	clock       Clock
+	executor    Executor
+	started     time.Time
 }
 
 // New returns agent service implementation.
-func New(mc paho.Client, cfg *Config, ec edgex.Client, nc *nats.Conn, logger log.Logger) (Service, error) {
+// Named EdgeX instances get clients of their own if EdgeX client ec is set.
+// Credentials are nil if MQTT client doesn't use mTLS. NATS connection
+// is created from config if nc is nil. Bootstrap sync is disabled if
+// sync is nil.
+func New(mc paho.Client, cfg *Config, ec edgex.Client, nc *nats.Conn, tp Throughput, creds *TLSCredentials, sync ConfigSync, logger log.Logger) (Service, error) {
+	if nc == nil {
+		var err error
+		if nc, err = ConnectNATS(*cfg); err != nil {
+			return nil, errors.Wrap(errFailedCreateService, err)
+		}
+	}
 	ag := &agent{
 		mqttClient:  mc,
 		edgexClient: ec,
 		config:      cfg,
 		nats:        nc,
+		throughput:  tp,
+		creds:       creds,
+		sync:        sync,
 		logger:      logger,
 		svcs:        make(map[string]Heartbeat),
 		terminals:   make(map[string]terminal.Session),
+		procs:       make(map[int]*process),
+		clock:       realClock{},
+		executor:    osExecutor{},
+		started:     time.Now(),
+	}
+
+	if cfg.Channels.RoutePattern != "" {
+		re, err := regexp.Compile(cfg.Channels.RoutePattern)
+		if err != nil {
+			return ag, errors.Wrap(errFailedCreateService, err)
+		}
+		ag.routeRe = re
+	}
+
+	if ec != nil && len(cfg.Edgex.Instances) > 0 {
+		ag.edgexInsts = make(map[string]edgex.Client, len(cfg.Edgex.Instances))
+		for name, url := range cfg.Edgex.Instances {
+			ag.edgexInsts[name] = edgex.NewClient(url, logger)
+		}
+	}
+
+	if cfg.MQTT.MaxInflight > 0 {
+		ag.inflight = make(chan struct{}, cfg.MQTT.MaxInflight)
+	}
+
+	if cfg.MQTT.Serialize {
+		ag.pubQueue = make(chan publishReq, publishQueueSize)
+		go ag.publishWriter()
 	}
 
+	prefix, err := topicPrefix(cfg.MQTT.TopicPrefix, cfg.Device.ID)
+	if err != nil {
+		return ag, errors.Wrap(errFailedCreateService, err)
+	}
+	ag.topicPrefix = prefix
+
+	st, err := store.New(cfg.Store.Backend, cfg.Store.Path)
+	if err != nil {
+		return ag, errors.Wrap(errFailedCreateService, err)
+	}
+	ag.store = st
+	if err := ag.restoreServices(); err != nil {
+		ag.logger.Warn(fmt.Sprintf("Failed to restore service registry: %s", err))
+	}
+	if err := ag.restoreAllowlistTS(); err != nil {
+		ag.logger.Warn(fmt.Sprintf("Failed to restore time of the last allowlist update: %s", err))
+	}
+
+	if cfg.Audit.Enabled {
+		al, err := audit.New(st, cfg.Audit.MaxEntries)
+		if err != nil {
+			return ag, errors.Wrap(errFailedCreateService, err)
+		}
+		ag.audit = al
+	}
+
+	if cfg.Exec.HistorySize > 0 {
+		ag.history = audit.NewMemory(cfg.Exec.HistorySize)
+	}
+
+	sm, err := newSafeMode(cfg.SafeMode.Enabled, cfg.SafeMode.File)
+	if err != nil {
+		return ag, errors.Wrap(errFailedCreateService, err)
+	}
+	ag.safeMode = sm
+
+	m, err := newMaintenance(st, cfg.Maintenance.QueueSize)
+	if err != nil {
+		return ag, errors.Wrap(errFailedCreateService, err)
+	}
+	ag.maint = m
+	// Commands held before restart are run if maintenance was turned off.
+	go ag.drain()
+
+	if cfg.Beacon.Enabled() {
+		go ag.beacon(cfg.Beacon)
+	}
+
+	ag.scheduleStartup(cfg.Startup.Commands)
+
 	if cfg.Heartbeat.Interval <= 0 {
 		ag.logger.Error(fmt.Sprintf("invalid heartbeat interval %d", cfg.Heartbeat.Interval))
 	}
 
-	_, err := ag.nats.Subscribe(Hearbeat, func(msg *nats.Msg) {
-		sub := msg.Subject
-		tok := strings.Split(sub, ".")
-		if len(tok) < 3 {
-			ag.logger.Error(fmt.Sprintf("Failed: Subject has incorrect length %s", sub))
-			return
-		}
-		svcname := tok[1]
-		svctype := tok[2]
-		// Service name is extracted from the subtopic
-		// if there is multiple instances of the same service
-		// we will have to add another distinction
-		if _, ok := ag.svcs[svcname]; !ok {
-			svc := NewHeartbeat(svcname, svctype, cfg.Heartbeat.Interval)
-			ag.svcs[svcname] = svc
-			ag.logger.Info(fmt.Sprintf("Services '%s-%s' registered", svcname, svctype))
-		}
-		serv := ag.svcs[svcname]
-		serv.Update()
-	})
+	if !cfg.Features.Enabled(FeatureHeartbeat) {
+		go ag.awaitReady()
+		return ag, nil
+	}
 
-	if err != nil {
-		return ag, errors.Wrap(errNatsSubscribing, err)
+	if cfg.Heartbeat.Workers > 0 {
+		ag.hbQueue = make(chan heartbeatMsg, cfg.Heartbeat.Buffer)
+		for i := 0; i < cfg.Heartbeat.Workers; i++ {
+			go ag.heartbeatWorker()
+		}
 	}
 
+	subjects := cfg.Heartbeat.Subjects
+	if len(subjects) == 0 {
+		subjects = []string{Hearbeat}
+	}
+	tokens := cfg.Heartbeat.Tokens
+	if len(tokens) == 0 {
+		tokens = []string{TokenType}
+	}
+	for i, subject := range subjects {
+		p, err := newSubjectParser(subject, tokens)
+		if err != nil {
+			return ag, errors.Wrap(errFailedCreateService, err)
+		}
+		hb := func(msg *nats.Msg) {
+			ag.throughput.Add(TransportNATS, DirectionReceived, len(msg.Data))
+			hb, err := p.parse(msg.Subject)
+			if err != nil {
+				ag.logger.Error(fmt.Sprintf("Failed: %s", err))
+				return
+			}
+			if hb.labels, err = parseLabels(msg.Data); err != nil {
+				ag.logger.Warn(fmt.Sprintf("Ignoring labels of %s heartbeat: %s", hb.name, err))
+			}
+			if hb.dependsOn, err = parseDependencies(msg.Data); err != nil {
+				ag.logger.Warn(fmt.Sprintf("Ignoring dependencies of %s heartbeat: %s", hb.name, err))
+			}
+			ag.enqueueHeartbeat(hb)
+		}
+
+		if cfg.Heartbeat.Durable != "" {
+			durable := cfg.Heartbeat.Durable
+			if i > 0 {
+				durable = fmt.Sprintf("%s_%d", durable, i)
+			}
+			if _, err = subscribeDurable(ag.nats, subject, durable, hb); err == nil {
+				continue
+			}
+			ag.logger.Warn(fmt.Sprintf("Falling back to plain heartbeat subscription for %s: %s", subject, err))
+		}
+
+		if _, err = ag.nats.Subscribe(subject, hb); err != nil {
+			return ag, errors.Wrap(errNatsSubscribing, err)
+		}
+	}
+
+	// Agent is ready at the earliest once heartbeat subjects are subscribed.
+	go ag.awaitReady()
 	return ag, nil
 
 }
 
-func (a *agent) Execute(uuid, cmd string) (string, error) {
-	cmdArr := strings.Split(strings.Replace(cmd, " ", "", -1), ",")
-	if len(cmdArr) < 2 {
-		return "", errInvalidCommand
+// enqueueHeartbeat hands heartbeat over to workers without blocking
+// NATS delivery. Heartbeats are dropped and counted if the queue is full.
+func (a *agent) enqueueHeartbeat(hb heartbeatMsg) {
+	if a.hbQueue == nil {
+		a.heartbeat(hb)
+		return
+	}
+	select {
+	case a.hbQueue <- hb:
+	default:
+		n := atomic.AddUint64(&a.hbDropped, 1)
+		a.logger.Debug(fmt.Sprintf("Heartbeat queue full, dropped heartbeat from %s, %d dropped in total", hb.name, n))
 	}
+}
 
-	out, err := exec.Command(cmdArr[0], cmdArr[1:]...).CombinedOutput()
+func (a *agent) heartbeatWorker() {
+	for hb := range a.hbQueue {
+		a.heartbeat(hb)
+	}
+}
+
+// heartbeat registers service if it is not registered and updates its status.
+func (a *agent) heartbeat(hb heartbeatMsg) {
+	a.svcsMu.Lock()
+	defer a.svcsMu.Unlock()
+	// Service name is extracted from the subtopic
+	// if there is multiple instances of the same service
+	// we will have to add another distinction
+	s, ok := a.svcs[hb.name]
+	if !ok {
+		s = newHeartbeat(hb.name, hb.typ, a.cfg().Heartbeat.Interval, a.notifyTransition, a.offlineHold)
+		s.SetVersion(hb.version)
+		s.SetLabels(hb.labels)
+		s.SetDependencies(hb.dependsOn)
+		a.svcs[hb.name] = s
+		a.logger.Info(fmt.Sprintf("Services '%s-%s' registered", hb.name, hb.typ))
+		a.persistService(s.Info())
+		a.notifyTransition(hb.name, online)
+	}
+	if ok && hb.version != "" && s.Info().Version != hb.version {
+		s.SetVersion(hb.version)
+		a.logger.Info(fmt.Sprintf("Service '%s' version changed to %s", hb.name, hb.version))
+		a.persistService(s.Info())
+	}
+	if ok && s.SetLabels(hb.labels) {
+		a.logger.Debug(fmt.Sprintf("Service '%s' labels changed to %v", hb.name, s.Info().Labels))
+		a.persistService(s.Info())
+	}
+	if ok && hb.dependsOn != nil && s.SetDependencies(hb.dependsOn) {
+		a.logger.Debug(fmt.Sprintf("Service '%s' dependencies changed to %v", hb.name, s.Info().DependsOn))
+		a.persistService(s.Info())
+	}
+	s.Update()
+}
+
+// persistService saves service info so the registry survives restart.
+func (a *agent) persistService(info Info) {
+	data, err := json.Marshal(info)
 	if err != nil {
-		return "", errors.Wrap(errFailedExecute, err)
+		a.logger.Warn(fmt.Sprintf("Failed to encode service %s: %s", info.Name, err))
+		return
 	}
+	if err := a.store.Put(servicesBucket, info.Name, data); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to persist service %s: %s", info.Name, err))
+	}
+}
 
-	payload, err := encoder.EncodeSenML(uuid, cmdArr[0], string(out))
+// restoreServices registers services saved in the store as offline
+// until they send heartbeat again.
+func (a *agent) restoreServices() error {
+	values, err := a.store.List(servicesBucket)
 	if err != nil {
-		return "", errors.Wrap(errFailedEncode, err)
+		return err
+	}
+	a.svcsMu.Lock()
+	defer a.svcsMu.Unlock()
+	for name, data := range values {
+		var info Info
+		if err := json.Unmarshal(data, &info); err != nil {
+			a.logger.Warn(fmt.Sprintf("Failed to decode service %s: %s", name, err))
+			continue
+		}
+		a.svcs[name] = restoreHeartbeat(info, a.cfg().Heartbeat.Interval, a.notifyTransition, a.offlineHold)
+	}
+	return nil
+}
+
+// resetServices removes all registered services and returns their number.
+func (a *agent) resetServices() int {
+	a.svcsMu.Lock()
+	defer a.svcsMu.Unlock()
+	n := len(a.svcs)
+	for name, s := range a.svcs {
+		s.Close()
+		if err := a.store.Delete(servicesBucket, name); err != nil {
+			a.logger.Warn(fmt.Sprintf("Failed to remove service %s from store: %s", name, err))
+		}
 	}
+	a.svcs = make(map[string]Heartbeat)
+	a.logger.Warn(fmt.Sprintf("Service registry reset, %d services removed", n))
+	return n
+}
 
-	if err := a.Publish(control, string(payload)); err != nil {
-		return "", errors.Wrap(errFailedToPublish, err)
+func (a *agent) Execute(uuid, cmd string) (res string, err error) {
+	start := a.clk().Now()
+	defer func() {
+		a.record(uuid, "execute", cmd, start, err)
+	}()
+	if cmd, err = a.checkLength(cmd); err != nil {
+		a.processError(uuid, cmd, err)
+		return "", err
+	}
+	raw := cmd
+	cmd = a.stripRoute(uuid, cmd)
+	defer a.clearRoute(uuid)
+	a.trackCommand(uuid, cmdTypeExec, cmd)
+	defer a.clearCommand(uuid)
+	a.ack(uuid)
+	defer func() {
+		a.processError(uuid, cmd, err)
+	}()
+	if held, res, err := a.hold(methodExecute, uuid, raw, cmd); held {
+		return res, err
 	}
 
-	return string(payload), nil
+	var buf bytes.Buffer
+	c, opts, attempts, err := a.execute(uuid, cmd, &buf)
+	if err != nil {
+		return "", err
+	}
+	out := a.transcode(buf.Bytes())
+
+	if opts.grep != nil {
+		out = filterLines(out, opts.grep)
+	}
+
+	full := out
+	out, dropped := truncateLines(out, opts.maxLines)
+	records := outputRecords(c.Args[0], out, opts.maxBytes)
+	// Output records are followed by size records if output is truncated.
+	truncated := dropped > 0 || len(records) > 1
+	if dropped > 0 {
+		d := float64(dropped)
+		records = append(records, senml.Record{
+			Name:  truncatedLines,
+			Value: &d,
+		})
+	}
+	if a.cfg().Exec.OutputHash {
+		records = append(records, outputHashRecord(full))
+	}
+	if truncated && a.cfg().Exec.OutputDir != "" {
+		id, err := a.saveOutput(a.cfg().Exec.OutputDir, uuid, full)
+		if err != nil {
+			a.logger.Warn(fmt.Sprintf("Failed to keep output of %s: %s", uuid, err))
+		} else {
+			records = append(records, senml.Record{
+				Name:        outputFile,
+				StringValue: &id,
+			})
+		}
+	}
+	if truncated && a.cfg().Artifacts.Enabled() {
+		url, err := a.saveArtifact(uuid, full)
+		if err != nil {
+			a.logger.Warn(fmt.Sprintf("Failed to store output artifact of %s: %s", uuid, err))
+		} else {
+			records = append(records, senml.Record{
+				Name:        outputURL,
+				StringValue: &url,
+			})
+		}
+	}
+
+	if opts.retries > 0 {
+		n := float64(attempts)
+		records = append(records, senml.Record{
+			Name:  execAttempts,
+			Value: &n,
+		})
+	}
+	records = append(records, mimeRecords(opts.mime, full)...)
+
+	return a.processRecords(uuid, records)
 }
 
-func (a *agent) Control(uuid, cmdStr string) error {
+func (a *agent) ExecuteStream(uuid, cmd string, w io.Writer) (err error) {
+	start := a.clk().Now()
+	defer func() {
+		a.record(uuid, "execute_stream", cmd, start, err)
+	}()
+	if cmd, err = a.checkLength(cmd); err != nil {
+		return err
+	}
+	if a.maint.Enabled() {
+		return errMaintenanceStream
+	}
+
+	c, opts, err := a.prepare(cmd)
+	if err != nil {
+		return err
+	}
+	defer opts.cancel()
+
+	if opts.grep != nil {
+		lf := &lineFilter{w: w, re: opts.grep}
+		defer lf.Flush()
+		w = lf
+	}
+	// Transcoder is closed before line filter is flushed.
+	tw := a.transcoder(w)
+	defer tw.Close()
+
+	w = opts.writer(tw)
+	c.Stdout = w
+	c.Stderr = w
+	if err := a.run(uuid, c, opts); err != nil {
+		return execError(opts, err)
+	}
+	return nil
+}
+
+func (a *agent) Control(uuid, cmdStr string) (res string, err error) {
+	start := a.clk().Now()
+	defer func() {
+		a.record(uuid, "control", cmdStr, start, err)
+	}()
+	if cmdStr, err = a.checkLength(cmdStr); err != nil {
+		a.processError(uuid, cmdStr, err)
+		return "", err
+	}
+	raw := cmdStr
+	cmdStr = a.stripRoute(uuid, cmdStr)
+	defer a.clearRoute(uuid)
+	a.trackCommand(uuid, cmdTypeControl, cmdStr)
+	defer a.clearCommand(uuid)
+	a.ack(uuid)
+	defer func() {
+		a.processError(uuid, cmdStr, err)
+	}()
+	if held, res, err := a.hold(methodControl, uuid, raw, cmdStr); held {
+		return res, err
+	}
+
 	cmdArgs := strings.Split(strings.Replace(cmdStr, " ", "", -1), ",")
-	if len(cmdArgs) < 2 {
-		return errInvalidCommand
+	if len(cmdArgs) < 2 && !argless[cmdArgs[0]] {
+		return "", ErrInvalidCommand
 	}
 
 	var resp string
-	var err error
 
 	cmd := cmdArgs[0]
+	if strings.HasPrefix(cmd, edgexPrefix) && !a.cfg().Features.Enabled(FeatureEdgex) {
+		return "", errors.Wrap(errFeatureDisabled, fmt.Errorf("%s", FeatureEdgex))
+	}
+	var ec edgex.Client
+	if strings.HasPrefix(cmd, edgexPrefix) {
+		if ec, cmdArgs = a.edgexInstance(cmdArgs); ec == nil {
+			return "", errEdgeXNotConfigured
+		}
+	}
+
 	switch cmd {
+	case edgexHealthcheck:
+		return a.processRecords(uuid, a.edgexHealthcheck(ec))
 	case "edgex-operation":
-		resp, err = a.edgexClient.PushOperation(cmdArgs[1:])
+		if len(cmdArgs) > 1 && cmdArgs[1] == asyncArg {
+			if err = a.edgexOperationAllowed(cmdArgs[2:]); err != nil {
+				return "", err
+			}
+			return a.processRecords(uuid, a.startEdgexJob(uuid, ec, cmdArgs[2:]))
+		}
+		if err = a.edgexOperationAllowed(cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		resp, err = ec.PushOperation(cmdArgs[1:])
+	case edgexStart, edgexStop, edgexRestart:
+		var op []string
+		if op, err = edgexOperation(cmd, cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		if err = a.edgexOperationAllowed(op); err != nil {
+			return "", err
+		}
+		resp, err = ec.PushOperation(op)
 	case "edgex-config":
-		resp, err = a.edgexClient.FetchConfig(cmdArgs[1:])
-	case "edgex-metrics":
-		resp, err = a.edgexClient.FetchMetrics(cmdArgs[1:])
+		resp, err = ec.FetchConfig(cmdArgs[1:])
+	case edgexMetrics:
+		var services []string
+		var filters map[string][]string
+		if services, filters, err = edgexMetricsArgs(cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		if resp, err = ec.FetchMetrics(services); err != nil {
+			return "", errors.Wrap(errEdgexFailed, err)
+		}
+		records, ok := edgexRecords(cmd, resp)
+		if !ok {
+			return a.processResponse(uuid, cmd, resp)
+		}
+		if records = filterMetrics(records, filters); len(records) == 0 {
+			return "", errEdgexMetricNotFound
+		}
+		return a.processRecords(uuid, records)
+	case edgexStreamStart:
+		if resp, err = a.startEdgexStream(cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case edgexStreamStop:
+		return a.processResponse(uuid, cmd, a.stopEdgexStream())
+	case edgexJobs:
+		if resp, err = a.edgexJobList(); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
 	case "edgex-ping":
-		resp, err = a.edgexClient.Ping()
+		resp, err = ec.Ping()
+	case edgexLogs:
+		service, lines, err := edgexLogsArgs(cmdArgs[1:], a.cfg().Edgex.MaxLogLines)
+		if err != nil {
+			return "", err
+		}
+		if resp, err = ec.FetchLogs(service, lines); err != nil {
+			return "", errors.Wrap(errEdgexFailed, err)
+		}
+		if records, ok := edgexLogRecords(service, resp); ok && len(records) > 0 {
+			return a.processRecords(uuid, records)
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case edgexDevCommand:
+		if len(cmdArgs) < 4 {
+			return "", ErrInvalidCommand
+		}
+		// Body is JSON object which can hold commas.
+		body := strings.Join(cmdArgs[4:], ",")
+		resp, err = ec.DeviceCommand(cmdArgs[1], cmdArgs[2], cmdArgs[3], body)
+	case agentAudit:
+		if resp, err = a.auditEntries(cmdArgs[1]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case execList:
+		if resp, err = a.execList(); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case execValidate:
+		// Command is validated as sent, with its spaces.
+		return a.processRecords(uuid, a.validateExec(uuid, strings.SplitN(cmdStr, ",", 2)[1]))
+	case execAssert:
+		records, err := a.assertExec(uuid, strings.SplitN(cmdStr, ",", 2)[1])
+		if err != nil {
+			return "", err
+		}
+		return a.processRecords(uuid, records)
+	case execKill:
+		if err := a.execKill(cmdArgs[1]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, killed)
+	case fileGet:
+		if resp, err = a.getOutput(cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case agentConfig:
+		if resp, err = ExportConfig(a.Config()); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case agentBootstrapSync:
+		records, err := a.bootstrapSync()
+		if err != nil {
+			return "", err
+		}
+		if len(records) == 0 {
+			return a.processResponse(uuid, cmd, unchanged)
+		}
+		return a.processRecords(uuid, records)
+	case agentSelftest:
+		return a.processRecords(uuid, a.selftest())
+	case agentStats:
+		return a.processRecords(uuid, a.stats())
+	case agentResources:
+		return a.processRecords(uuid, a.resources())
+	case agentAllowlist:
+		return a.processRecords(uuid, a.allowlist())
+	case allowlistAdd, allowlistRemove:
+		// Rule is taken as sent, with its spaces.
+		if err := a.updateAllowlist(cmd, strings.SplitN(cmdStr, ",", 2)[1]); err != nil {
+			return "", err
+		}
+		return a.processRecords(uuid, a.allowlist())
+	case agentRTT:
+		records, err := a.rtt(cmdArgs[1:])
+		if err != nil {
+			return "", err
+		}
+		return a.processRecords(uuid, records)
+	case agentReloadCerts:
+		if err := a.ReloadCerts(); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, reloaded)
+	case servicesReset:
+		if a.safeMode.Enabled() {
+			return "", errSafeMode
+		}
+		return a.processResponse(uuid, cmd, strconv.Itoa(a.resetServices()))
+	case execHistory:
+		uuidFilter := ""
+		if len(cmdArgs) > 2 {
+			uuidFilter = cmdArgs[2]
+		}
+		if resp, err = a.execHistory(cmdArgs[1], uuidFilter); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case agentUpdate:
+		if len(cmdArgs) < 3 {
+			return "", ErrInvalidCommand
+		}
+		if err := a.update(cmdArgs[1], cmdArgs[2]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, updated)
+	case agentSafeMode:
+		if resp, err = a.setSafeMode(cmdArgs[1]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case agentMaintenance:
+		if resp, err = a.setMaintenance(cmdArgs[1]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case hostReboot:
+		if resp, err = a.rebootHost(uuid, cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case servicesPause:
+		if resp, err = a.setPause(cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
+	case servicesResume:
+		a.resumeOffline()
+		return a.processResponse(uuid, cmd, resumed)
+	case servicesTopology:
+		if resp, err = a.topology(cmdArgs[1:]); err != nil {
+			return "", err
+		}
+		return a.processResponse(uuid, cmd, resp)
 	default:
-		err = errUnknownCommand
+		err = ErrUnknownCommand
 	}
 
 	if err != nil {
-		return errors.Wrap(errEdgexFailed, err)
+		return "", errors.Wrap(errEdgexFailed, err)
+	}
+
+	if cmd == "edgex-config" || cmd == edgexDevCommand {
+		if records, ok := edgexRecords(cmd, resp); ok {
+			return a.processRecords(uuid, records)
+		}
 	}
 
 	return a.processResponse(uuid, cmd, resp)
@@ -221,47 +936,90 @@ func (a *agent) Control(uuid, cmdStr string) error {
 
 // Message for this command
 // [{"bn":"1:", "n":"services", "vs":"view"}]
+// [{"bn":"1:", "n":"services", "vs":"view, service_name"}]
+// [{"bn":"1:", "n":"services", "vs":"view, label=value"}]
 // [{"bn":"1:", "n":"config", "vs":"save, export, filename, filecontent"}]
+// [{"bn":"1:", "n":"config", "vs":"save, export-*, filename, filecontent"}]
+// [{"bn":"1:", "n":"config", "vs":"merge, export, filename, filecontent"}]
 // config_file_content is base64 encoded marshaled structure representing service conf
 // Example of creation:
-// 	b, _ := toml.Marshal(cfg)
-// 	config_file_content := base64.StdEncoding.EncodeToString(b)
-func (a *agent) ServiceConfig(uuid, cmdStr string) error {
+//
+//	b, _ := toml.Marshal(cfg)
+//	config_file_content := base64.StdEncoding.EncodeToString(b)
+func (a *agent) ServiceConfig(uuid, cmdStr string) (res string, err error) {
+	start := a.clk().Now()
+	defer func() {
+		a.record(uuid, "service_config", auditedConfig(cmdStr), start, err)
+	}()
+	cmdStr = a.stripRoute(uuid, cmdStr)
+	defer a.clearRoute(uuid)
+	a.trackCommand(uuid, cmdTypeConfig, cmdStr)
+	defer a.clearCommand(uuid)
+	a.ack(uuid)
+	defer func() {
+		a.processError(uuid, cmdStr, err)
+	}()
+
 	cmdArgs := strings.Split(strings.Replace(cmdStr, " ", "", -1), ",")
 	if len(cmdArgs) < 1 {
-		return errInvalidCommand
+		return "", ErrInvalidCommand
 	}
 	resp := ""
 	cmd := cmdArgs[0]
 	switch cmd {
 	case view:
-		services, err := json.Marshal(a.Services())
+		var v interface{} = a.Services()
+		switch {
+		case len(cmdArgs) > 1 && strings.Contains(cmdArgs[1], "="):
+			selector, err := parseSelector(cmdArgs[1:])
+			if err != nil {
+				return "", err
+			}
+			v = a.servicesByLabels(selector)
+		case len(cmdArgs) > 1 && cmdArgs[1] != "":
+			info, err := a.ServiceInfo(cmdArgs[1])
+			if err != nil {
+				return "", err
+			}
+			v = info
+		}
+		services, err := json.Marshal(v)
 		if err != nil {
-			return errors.New(err.Error())
+			return "", errors.New(err.Error())
 		}
 		resp = string(services)
-	case save:
+	case save, merge:
 		if len(cmdArgs) < 4 {
-			return errInvalidCommand
+			return "", ErrInvalidCommand
 		}
 		service := cmdArgs[1]
 		fileName := cmdArgs[2]
 		fileCont := cmdArgs[3]
-		if err := a.saveConfig(service, fileName, fileCont); err != nil {
-			return err
+		if strings.ContainsAny(service, "*?[") {
+			records, err := a.saveConfigs(uuid, service, fileName, fileCont, cmd == merge)
+			if err != nil {
+				return "", err
+			}
+			return a.processRecords(uuid, records)
+		}
+		if resp, err = a.saveConfig(service, fileName, fileCont, cmd == merge); err != nil {
+			return "", err
 		}
 	}
 	return a.processResponse(uuid, cmd, resp)
 }
 
 func (a *agent) Terminal(uuid, cmdStr string) error {
+	if !a.cfg().Features.Enabled(FeatureTerminal) {
+		return errors.Wrap(errFeatureDisabled, fmt.Errorf("%s", FeatureTerminal))
+	}
 	b, err := base64.StdEncoding.DecodeString(cmdStr)
 	if err != nil {
 		return errors.New(err.Error())
 	}
 	cmdArgs := strings.Split(string(b), ",")
 	if len(cmdArgs) < 1 {
-		return errInvalidCommand
+		return ErrInvalidCommand
 	}
 
 	cmd := cmdArgs[0]
@@ -275,7 +1033,7 @@ func (a *agent) Terminal(uuid, cmdStr string) error {
 			return err
 		}
 	case open:
-		if err := a.terminalOpen(uuid, a.config.Terminal.SessionTimeout); err != nil {
+		if err := a.terminalOpen(uuid, a.cfg().Terminal.SessionTimeout); err != nil {
 			return err
 		}
 	case close:
@@ -288,7 +1046,7 @@ func (a *agent) Terminal(uuid, cmdStr string) error {
 
 func (a *agent) terminalOpen(uuid string, timeout time.Duration) error {
 	if _, ok := a.terminals[uuid]; !ok {
-		term, err := terminal.NewSession(uuid, timeout, a.Publish, a.logger)
+		term, err := terminal.NewSession(uuid, a.BaseName(uuid), timeout, a.Publish, a.logger)
 		if err != nil {
 			return errors.Wrap(errors.Wrap(errFailedToCreateTerminalSession, fmt.Errorf(" for %s", uuid)), err)
 		}
@@ -317,7 +1075,7 @@ func (a *agent) terminalClose(uuid string) error {
 }
 
 func (a *agent) terminalWrite(uuid, cmd string) error {
-	if err := a.terminalOpen(uuid, a.config.Terminal.SessionTimeout); err != nil {
+	if err := a.terminalOpen(uuid, a.cfg().Terminal.SessionTimeout); err != nil {
 		return err
 	}
 	term := a.terminals[uuid]
@@ -325,50 +1083,306 @@ func (a *agent) terminalWrite(uuid, cmd string) error {
 	return term.Send(p)
 }
 
-func (a *agent) processResponse(uuid, cmd, resp string) error {
-	payload, err := encoder.EncodeSenML(uuid, cmd, resp)
+func (a *agent) processResponse(uuid, cmd, resp string) (string, error) {
+	return a.processRecords(uuid, []senml.Record{
+		senml.Record{
+			Name:        cmd,
+			StringValue: &resp,
+		},
+	})
+}
+
+// processError publishes error response of failed command, named by the
+// first command argument, with result code of the error. Nothing is
+// published if there is no error or the error is failure to publish.
+func (a *agent) processError(uuid, cmd string, err error) {
+	if err == nil || errors.Contains(err, errFailedToPublish) || errors.Contains(err, errEncodePublished) {
+		return
+	}
+	name := strings.TrimSpace(strings.SplitN(cmd, ",", 2)[0])
+	msg, code := a.ErrorMessage(uuid, err), ResultCode(err)
+	if _, err := a.publishRecords(uuid, []senml.Record{{Name: name, StringValue: &msg}}, code); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to publish error response: %s", err))
+	}
+}
+
+func (a *agent) processRecords(uuid string, records []senml.Record) (string, error) {
+	return a.publishRecords(uuid, records, CodeSuccess)
+}
+
+// publishRecords prefixes record names, appends result code record and
+// routing token to the records and publishes them to the control channel.
+func (a *agent) publishRecords(uuid string, records []senml.Record, code int) (string, error) {
+	records = a.prefixRecords(uuid, records)
+	c := float64(code)
+	records = append(records, senml.Record{
+		Name:  codeRecord,
+		Value: &c,
+	})
+	records = a.routeRecords(uuid, records)
+	payload, err := a.encodeResponse(uuid, records)
 	if err != nil {
-		return errors.Wrap(errFailedEncode, err)
+		return a.publishEncodeError(uuid, records, err)
+	}
+	if a.duplicate(control, records) {
+		a.logger.Debug(fmt.Sprintf("Response to %s is the same as the last one, not published", uuid))
+		return string(payload), nil
 	}
 	if err := a.Publish(control, string(payload)); err != nil {
-		return errors.Wrap(errFailedToPublish, err)
+		return "", errors.Wrap(errFailedToPublish, err)
 	}
-	return nil
+	a.markSent(control, records)
+	return string(payload), nil
+}
+
+// publishEncodeError publishes minimal response describing failure to
+// encode the records, so that the sender of the command gets response
+// even if the command output can't be encoded.
+func (a *agent) publishEncodeError(uuid string, records []senml.Record, cause error) (string, error) {
+	a.logger.Warn(fmt.Sprintf("Failed to encode response to %s with %d bytes of values: %s", uuid, valuesLen(records), cause))
+	fallback := a.routeRecords(uuid, encodeErrorRecords(records, cause))
+	payload, err := encoder.Encode(a.responseFormat(uuid), a.BaseName(uuid), fallback)
+	if err != nil {
+		return "", errors.Wrap(errFailedEncode, err)
+	}
+	if err := a.Publish(control, string(payload)); err != nil {
+		return "", errors.Wrap(errFailedToPublish, err)
+	}
+	return string(payload), errors.Wrap(errEncodePublished, cause)
+}
+
+// auditedConfig replaces content of the file sent with `save` or `merge`
+// config command with its length and SHA-256, so that secrets config files
+// hold aren't written to the audit log.
+func auditedConfig(cmd string) string {
+	args := strings.SplitN(cmd, ",", 4)
+	if len(args) < 4 {
+		return cmd
+	}
+	switch strings.TrimSpace(args[0]) {
+	case save, merge:
+	default:
+		return cmd
+	}
+	content := strings.TrimSpace(args[3])
+	sum := sha256.Sum256([]byte(content))
+	args[3] = fmt.Sprintf("<%d bytes sha256:%x>", len(content), sum)
+	return strings.Join(args, ",")
+}
+
+func (a *agent) record(uuid, method, cmd string, start time.Time, err error) {
+	a.countCommand(err)
+	if a.audit == nil && a.history == nil {
+		return
+	}
+	now := a.clk().Now()
+	e := audit.Entry{
+		Time:     now,
+		UUID:     uuid,
+		Method:   method,
+		Command:  cmd,
+		Outcome:  audit.Success,
+		Duration: now.Sub(start).String(),
+	}
+	if err != nil {
+		e.Outcome = audit.Failure
+		e.Error = err.Error()
+	}
+	if a.history != nil && (method == "execute" || method == "execute_stream") {
+		a.history.Record(e)
+	}
+	if a.audit == nil {
+		return
+	}
+	if err := a.audit.Record(e); err != nil {
+		a.logger.Error(fmt.Sprintf("Failed to record audit entry: %s", err))
+	}
+}
+
+// execHistory returns last num executed commands, optionally only for given uuid.
+func (a *agent) execHistory(num, uuid string) (string, error) {
+	if a.history == nil {
+		return "", errHistoryDisabled
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		return "", ErrInvalidCommand
+	}
+	entries, err := a.history.Last(-1)
+	if err != nil {
+		return "", err
+	}
+	if uuid != "" {
+		filtered := []audit.Entry{}
+		for _, e := range entries {
+			if e.UUID == uuid {
+				filtered = append(filtered, e)
+			}
+		}
+		entries = filtered
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return "", errors.Wrap(errFailedEncode, err)
+	}
+	return string(b), nil
+}
+
+func (a *agent) auditEntries(num string) (string, error) {
+	if a.audit == nil {
+		return "", errAuditDisabled
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		return "", ErrInvalidCommand
+	}
+	entries, err := a.audit.Last(n)
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(entries)
+	if err != nil {
+		return "", errors.Wrap(errFailedEncode, err)
+	}
+	return string(b), nil
+}
+
+// saveConfigs saves config of every registered service matching glob
+// pattern, i.e. `export-*`, and returns record with result of each save
+// named by the service.
+func (a *agent) saveConfigs(uuid, pattern, fileName, fileCont string, merge bool) ([]senml.Record, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, errors.Wrap(ErrInvalidCommand, err)
+	}
+	records := []senml.Record{}
+	for _, info := range a.Services() {
+		if ok, _ := path.Match(pattern, info.Name); !ok {
+			continue
+		}
+		res, err := a.saveConfig(info.Name, fileName, fileCont, merge)
+		switch {
+		case err != nil:
+			res = a.ErrorMessage(uuid, err)
+		case res == "":
+			res = saved
+		}
+		records = append(records, senml.Record{
+			Name:        info.Name,
+			StringValue: &res,
+		})
+	}
+	if len(records) == 0 {
+		return nil, errors.Wrap(errNoSuchService, fmt.Errorf("%s", pattern))
+	}
+	return records, nil
+}
+
+// configType returns type of the service config, which is the service
+// name or the type of registered service, i.e. `export` for `export-1`.
+func (a *agent) configType(service string) string {
+	if service == export {
+		return service
+	}
+	if info, err := a.ServiceInfo(service); err == nil && info.Type == export {
+		return info.Type
+	}
+	return service
 }
 
-func (a *agent) saveConfig(service, fileName, fileCont string) error {
-	switch service {
+// saveConfig saves the service config and notifies the service with its
+// reload. If merge is set, content is partial config merged onto the
+// existing one. If apply timeout is set it waits for the service to
+// acknowledge and returns "applied" or "timeout".
+func (a *agent) saveConfig(service, fileName, fileCont string, merge bool) (string, error) {
+	typ := a.configType(service)
+	switch typ {
 	case export:
-		content, err := base64.StdEncoding.DecodeString(fileCont)
+		content, err := decodeContent(fileCont)
 		if err != nil {
-			return errors.New(err.Error())
+			return "", err
+		}
+		var c exp.Config
+		if merge {
+			c, err = mergeExport(fileName, content)
+		} else if c, err = exp.ReadBytes(content); err != nil {
+			err = errors.New(err.Error())
 		}
-		c, err := exp.ReadBytes([]byte(content))
 		if err != nil {
-			return errors.New(err.Error())
+			return "", err
 		}
 		c.File = fileName
 		if err := exp.Save(c); err != nil {
-			return errors.New(err.Error())
+			return "", errors.New(err.Error())
 		}
 
 	default:
-		return errNoSuchService
+		return "", errNoSuchService
 	}
 
-	return a.nats.Publish(fmt.Sprintf("%s.%s.%s", Commands, service, config), []byte(""))
+	return a.reload(service, typ, fileName)
 }
 
+// decodeContent decodes base64 encoded config file content,
+// gzip compressed content is detected by its header and decompressed.
+func decodeContent(fileCont string) ([]byte, error) {
+	content, err := base64.StdEncoding.DecodeString(fileCont)
+	if err != nil {
+		return nil, errors.New(err.Error())
+	}
+	if !bytes.HasPrefix(content, gzipMagic) {
+		return content, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, errors.Wrap(errDecompress, err)
+	}
+	defer r.Close()
+	content, err = ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(errDecompress, err)
+	}
+	return content, nil
+}
+
+// AddConfig validates and saves the config, and then replaces the running
+// one. Subsystems started with the old config, such as MQTT connection and
+// heartbeat subscriptions, keep their settings until restart.
 func (a *agent) AddConfig(c Config) error {
-	err := SaveConfig(c)
-	return errors.New(err.Error())
+	a.configMu.Lock()
+	defer a.configMu.Unlock()
+
+	if c.File == "" {
+		c.File = a.config.File
+	}
+	if err := c.Validate(); err != nil {
+		return errors.Wrap(errInvalidConfig, err)
+	}
+	if err := SaveConfig(c); err != nil {
+		return errors.Wrap(errFailedSaveConfig, err)
+	}
+	a.config = &c
+	return nil
 }
 
 func (a *agent) Config() Config {
-	return *a.config
+	return *a.cfg()
+}
+
+// cfg returns the running config, which must not be modified.
+func (a *agent) cfg() *Config {
+	a.configMu.RLock()
+	defer a.configMu.RUnlock()
+	return a.config
 }
 
 func (a *agent) Services() []Info {
+	a.svcsMu.RLock()
+	defer a.svcsMu.RUnlock()
+
 	svcInfos := []Info{}
 	keys := []string{}
 	for k := range a.svcs {
@@ -382,26 +1396,130 @@ func (a *agent) Services() []Info {
 	return svcInfos
 }
 
+func (a *agent) ServiceInfo(name string) (Info, error) {
+	a.svcsMu.RLock()
+	defer a.svcsMu.RUnlock()
+
+	svc, ok := a.svcs[name]
+	if !ok {
+		return Info{}, errors.Wrap(errNoSuchService, fmt.Errorf("%s", name))
+	}
+	return svc.Info(), nil
+}
+
 func (a *agent) Publish(t, payload string) error {
+	return a.publish(t, payload, a.cfg().MQTT.Retain)
+}
+
+// publish publishes payload to the topic with given retain flag.
+// Payload larger than MaxPayload bytes is replaced with payloads made
+// according to the overflow policy. In serialized publish mode the
+// publish is made by the writer.
+func (a *agent) publish(t, payload string, retain bool) error {
+	payloads := []string{payload}
+	if max := a.cfg().MQTT.MaxPayload; max > 0 && len(payload) > max {
+		var err error
+		if payloads, err = a.overflow(payload, max); err != nil {
+			return err
+		}
+	}
+	for _, p := range payloads {
+		var err error
+		if a.pubQueue != nil {
+			err = a.enqueuePublish(t, p, retain)
+		} else {
+			err = a.publishNow(t, p, retain)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// publishNow publishes payload to the topic and waits for acknowledgement.
+func (a *agent) publishNow(t, payload string, retain bool) error {
+	if err := a.acquireInflight(); err != nil {
+		return err
+	}
 	topic := a.getTopic(t)
-	mqtt := a.config.MQTT
-	token := a.mqttClient.Publish(topic, mqtt.QoS, mqtt.Retain, payload)
-	token.Wait()
-	err := token.Error()
+	err := a.publishToken(topic, payload, retain)
+	a.releaseInflight()
 	if err != nil {
-		return errors.New(err.Error())
+		return err
 	}
+	a.throughput.Add(TransportMQTT, DirectionPublished, len(payload))
+
+	a.hooksMu.RLock()
+	defer a.hooksMu.RUnlock()
+	for _, fn := range a.hooks {
+		fn(topic, payload)
+	}
+	return nil
+}
+
+// acquireInflight takes in-flight publish slot, it blocks until slot is
+// free or fails if fail fast is set and all slots are taken.
+func (a *agent) acquireInflight() error {
+	if a.inflight != nil {
+		if a.cfg().MQTT.InflightFailFast {
+			select {
+			case a.inflight <- struct{}{}:
+			default:
+				return errInflightLimit
+			}
+		} else {
+			a.inflight <- struct{}{}
+		}
+	}
+	a.throughput.AddInflight(1)
 	return nil
 }
 
+func (a *agent) releaseInflight() {
+	a.throughput.AddInflight(-1)
+	if a.inflight != nil {
+		<-a.inflight
+	}
+}
+
+func (a *agent) OnResponse(fn func(topic, payload string)) {
+	a.hooksMu.Lock()
+	defer a.hooksMu.Unlock()
+	a.hooks = append(a.hooks, fn)
+}
+
 func (a *agent) getTopic(topic string) (t string) {
 	switch topic {
 	case control:
-		t = fmt.Sprintf("channels/%s/messages/res", a.config.Channels.Control)
+		t = fmt.Sprintf("channels/%s/messages/res", a.cfg().Channels.Control)
 	case data:
-		t = fmt.Sprintf("channels/%s/messages/res", a.config.Channels.Data)
+		t = fmt.Sprintf("channels/%s/messages/res", a.cfg().Channels.Data)
 	default:
-		t = fmt.Sprintf("channels/%s/messages/res/%s", a.config.Channels.Control, topic)
+		t = fmt.Sprintf("channels/%s/messages/res/%s", a.cfg().Channels.Control, topic)
+	}
+	if a.topicPrefix != "" {
+		t = fmt.Sprintf("%s/%s", a.topicPrefix, t)
 	}
 	return t
 }
+
+// topicPrefix renders topic prefix template with the device id.
+func topicPrefix(tmpl, deviceID string) (string, error) {
+	if deviceID == "" && strings.Contains(tmpl, ".DeviceID") {
+		return "", errMissingDeviceID
+	}
+	t, err := template.New("prefix").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, struct{ DeviceID string }{deviceID}); err != nil {
+		return "", err
+	}
+	prefix := sb.String()
+	if strings.HasPrefix(prefix, "/") || strings.HasSuffix(prefix, "/") {
+		return "", errors.New(fmt.Sprintf("invalid topic prefix %q", prefix))
+	}
+	return prefix, nil
+}
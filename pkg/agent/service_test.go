@@ -0,0 +1,105 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/audit"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveConfigs(t *testing.T) {
+	a := &agent{config: &Config{}, svcs: map[string]Heartbeat{}}
+	for name, typ := range map[string]string{"export-1": "service", "export-2": "service", "duster": "service"} {
+		hb := NewHeartbeat(name, typ, time.Minute)
+		defer hb.Close()
+		a.svcs[name] = hb
+	}
+
+	cases := []struct {
+		desc     string
+		pattern  string
+		services []string
+		err      error
+	}{
+		{"services matching pattern", "export-*", []string{"export-1", "export-2"}, nil},
+		{"single character wildcard", "export-?", []string{"export-1", "export-2"}, nil},
+		{"character class", "export-[2]", []string{"export-2"}, nil},
+		{"no matching service", "emailer-*", nil, errNoSuchService},
+		{"malformed pattern", "export-[", nil, ErrInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		records, err := a.saveConfigs("1", tc.pattern, "config.toml", "", false)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		services := []string{}
+		for _, r := range records {
+			services = append(services, r.Name)
+			// Services of other types than export don't accept config.
+			assert.Equal(t, errNoSuchService.Error(), *r.StringValue, fmt.Sprintf("%s: unexpected result of %s", tc.desc, r.Name))
+		}
+		if tc.err == nil {
+			assert.Equal(t, tc.services, services, fmt.Sprintf("%s: expected services %v got %v", tc.desc, tc.services, services))
+		}
+	}
+}
+
+func TestConfigType(t *testing.T) {
+	a := &agent{svcs: map[string]Heartbeat{}}
+	hb := NewHeartbeat("export-1", export, time.Minute)
+	defer hb.Close()
+	a.svcs["export-1"] = hb
+
+	cases := []struct {
+		desc    string
+		service string
+		typ     string
+	}{
+		{"export service", export, export},
+		{"registered export instance", "export-1", export},
+		{"unknown service", "export-2", "export-2"},
+	}
+
+	for _, tc := range cases {
+		typ := a.configType(tc.service)
+		assert.Equal(t, tc.typ, typ, fmt.Sprintf("%s: expected type %s got %s", tc.desc, tc.typ, typ))
+	}
+}
+
+func TestAuditedConfig(t *testing.T) {
+	content := "W21xdHRdCnBhc3N3b3JkID0gInNlY3JldCIK"
+	hidden := fmt.Sprintf("<%d bytes sha256:%x>", len(content), sha256.Sum256([]byte(content)))
+
+	cases := []struct {
+		desc string
+		cmd  string
+		res  string
+	}{
+		{"save config", "save,export,config.toml," + content, "save,export,config.toml," + hidden},
+		{"merge config", "merge,export-*,config.toml," + content, "merge,export-*,config.toml," + hidden},
+		{"view services", "view,export", "view,export"},
+		{"save without content", "save,export", "save,export"},
+	}
+
+	for _, tc := range cases {
+		res := auditedConfig(tc.cmd)
+		assert.Equal(t, tc.res, res, fmt.Sprintf("%s: expected %s got %s", tc.desc, tc.res, res))
+	}
+
+	// Content of saved config isn't recorded in the audit log.
+	al := audit.NewMemory(10)
+	a := &agent{config: &Config{}, audit: al, mqttClient: &recordingClient{}, svcs: map[string]Heartbeat{}}
+	_, err := a.ServiceConfig("1", "save,export,config.toml,"+content)
+	assert.NotNil(t, err, "expected error saving config of unknown service")
+	entries, err := al.Last(1)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error reading audit log: %s", err))
+	if assert.Len(t, entries, 1, "expected single audit entry") {
+		assert.Equal(t, "save,export,config.toml,"+hidden, entries[0].Command, fmt.Sprintf("expected config content hidden got %s", entries[0].Command))
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+// startup is uuid prefix of responses to startup commands,
+// i.e. `startup-1` for the first configured command.
+const startup = "startup"
+
+// errInvalidStartup indicates startup command without command or with negative delay
+var errInvalidStartup = errors.New("invalid startup command")
+
+// scheduleStartup schedules each startup command to run once after its delay.
+func (a *agent) scheduleStartup(cmds []StartupCommand) {
+	for i, sc := range cmds {
+		uuid := fmt.Sprintf("%s-%d", startup, i+1)
+		cmd := sc.Command
+		a.clk().AfterFunc(sc.Delay, func() {
+			a.runStartup(uuid, cmd)
+		})
+	}
+}
+
+// runStartup executes startup command, its result is published
+// to the control channel as a response to the uuid.
+func (a *agent) runStartup(uuid, cmd string) {
+	a.logger.Info(fmt.Sprintf("Running startup command %s: %s", uuid, cmd))
+	if _, err := a.Execute(uuid, cmd); err != nil {
+		a.logger.Warn(fmt.Sprintf("Startup command %s failed: %s", uuid, err))
+	}
+}
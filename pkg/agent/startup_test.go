@@ -0,0 +1,69 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleStartup(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	clock := mocks.NewClock(time.Unix(1588091188, 0))
+	a := &agent{config: &Config{}, clock: clock, logger: logger}
+
+	a.scheduleStartup([]StartupCommand{
+		{Delay: time.Minute, Command: "echo,settled"},
+		{Delay: time.Second, Command: "echo,started"},
+	})
+	assert.Equal(t, 2, clock.Timers(), fmt.Sprintf("expected 2 scheduled commands got %d", clock.Timers()))
+	clock.Advance(time.Second / 2)
+	assert.Equal(t, 2, clock.Timers(), fmt.Sprintf("expected commands not to run before their delay, got %d scheduled", clock.Timers()))
+}
+
+func TestStartupConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startup")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "config.toml")
+	data := "[startup]\n  [[startup.commands]]\n    command = \"ls,-la\"\n    delay = \"60s\"\n"
+	if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatalf("failed to write config: %s", err)
+	}
+	c, err := ReadConfig(file)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error reading config: %s", err))
+	expected := []StartupCommand{{Delay: time.Minute, Command: "ls,-la"}}
+	assert.Equal(t, expected, c.Startup.Commands, fmt.Sprintf("expected startup commands %v got %v", expected, c.Startup.Commands))
+
+	cases := []struct {
+		desc string
+		cmd  StartupCommand
+		err  error
+	}{
+		{"valid command", StartupCommand{Delay: time.Minute, Command: "ls,-la"}, nil},
+		{"no delay", StartupCommand{Command: "ls,-la"}, nil},
+		{"empty command", StartupCommand{Delay: time.Minute}, errInvalidStartup},
+		{"negative delay", StartupCommand{Delay: -time.Second, Command: "ls,-la"}, errInvalidStartup},
+	}
+
+	for _, tc := range cases {
+		err := StartupConfig{Commands: []StartupCommand{tc.cmd}}.Validate()
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+	}
+}
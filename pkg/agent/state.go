@@ -0,0 +1,131 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+)
+
+const (
+	// SubsystemMQTT is MQTT broker connection.
+	SubsystemMQTT = "mqtt"
+
+	// SubsystemNATS is NATS server connection.
+	SubsystemNATS = "nats"
+
+	// StateConnected is reported when subsystem (re)connects.
+	StateConnected = "connected"
+
+	// StateLost is reported when subsystem connection is lost.
+	StateLost = "lost"
+
+	status = "status"
+
+	maxPendingStates = 100
+)
+
+// StateNotifier publishes connection state transitions of agent subsystems
+// to `channels/<control_channel_id>/messages/res/status` topic.
+type StateNotifier interface {
+	// Notify reports new state of the subsystem.
+	Notify(subsystem, state string)
+
+	// Start starts publishing notifications with given service.
+	// Notifications reported before start are published on start.
+	Start(svc Service)
+}
+
+var _ StateNotifier = (*stateNotifier)(nil)
+
+type stateChange struct {
+	subsystem string
+	state     string
+	time      time.Time
+}
+
+type stateNotifier struct {
+	svc       Service
+	pending   []stateChange
+	mqttLost  bool
+	observers []func(subsystem, state string)
+	logger    log.Logger
+	mu        sync.Mutex
+}
+
+// NewStateNotifier returns connection state notifier. Notifications are kept
+// while MQTT connection is lost and published together once it is restored.
+// Observers are called on every state change before it is published.
+func NewStateNotifier(logger log.Logger, observers ...func(subsystem, state string)) StateNotifier {
+	return &stateNotifier{
+		observers: observers,
+		logger:    logger,
+	}
+}
+
+func (sn *stateNotifier) Notify(subsystem, state string) {
+	sn.logger.Debug(fmt.Sprintf("Connection to %s %s", subsystem, state))
+	for _, o := range sn.observers {
+		o(subsystem, state)
+	}
+
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	if len(sn.pending) == maxPendingStates {
+		sn.pending = sn.pending[1:]
+	}
+	sn.pending = append(sn.pending, stateChange{
+		subsystem: subsystem,
+		state:     state,
+		time:      time.Now(),
+	})
+	if subsystem == SubsystemMQTT {
+		sn.mqttLost = state == StateLost
+	}
+	sn.flush()
+}
+
+func (sn *stateNotifier) Start(svc Service) {
+	sn.mu.Lock()
+	defer sn.mu.Unlock()
+
+	sn.svc = svc
+	sn.flush()
+}
+
+// flush publishes pending notifications if possible, must be called with lock held.
+func (sn *stateNotifier) flush() {
+	if sn.svc == nil || sn.mqttLost || len(sn.pending) == 0 {
+		return
+	}
+
+	records := []senml.Record{}
+	for _, sc := range sn.pending {
+		st := sc.state
+		records = append(records, senml.Record{
+			Name:        sc.subsystem,
+			Time:        float64(sc.time.UnixNano()) / float64(time.Second),
+			StringValue: &st,
+		})
+	}
+	sn.pending = nil
+
+	svc := sn.svc
+	go func() {
+		payload, err := encoder.EncodeRecords(svc.BaseName(""), records)
+		if err != nil {
+			sn.logger.Warn(fmt.Sprintf("Failed to encode connection state: %s", err))
+			return
+		}
+		if err := svc.Publish(status, string(payload)); err != nil {
+			sn.logger.Warn(fmt.Sprintf("Failed to publish connection state: %s", err))
+		}
+	}()
+}
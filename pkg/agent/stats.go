@@ -0,0 +1,36 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"sync/atomic"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/senml"
+)
+
+const (
+	agentStats = "agent-stats"
+
+	statCommands          = "commands_total"
+	statCommandsFailed    = "commands_failed_total"
+	statHeartbeatsDropped = "heartbeats_dropped_total"
+)
+
+// countCommand counts handled command and its failure.
+func (a *agent) countCommand(err error) {
+	atomic.AddUint64(&a.cmdTotal, 1)
+	if err != nil {
+		atomic.AddUint64(&a.cmdFailed, 1)
+	}
+}
+
+// stats returns cumulative counters of the agent as SenML sum records.
+func (a *agent) stats() []senml.Record {
+	return []senml.Record{
+		encoder.Counter(statCommands, float64(atomic.LoadUint64(&a.cmdTotal))),
+		encoder.Counter(statCommandsFailed, float64(atomic.LoadUint64(&a.cmdFailed))),
+		encoder.Counter(statHeartbeatsDropped, float64(atomic.LoadUint64(&a.hbDropped))),
+	}
+}
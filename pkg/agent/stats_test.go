@@ -0,0 +1,44 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStats(t *testing.T) {
+	a := &agent{hbDropped: 3}
+	a.countCommand(nil)
+	a.countCommand(errors.New("failed"))
+
+	payload, err := encoder.EncodeRecords("1", a.stats())
+	assert.Nil(t, err, fmt.Sprintf("unexpected error encoding stats: %s", err))
+	var records []map[string]interface{}
+	err = json.Unmarshal(payload, &records)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error decoding stats: %s", err))
+	sums := map[string]interface{}{}
+	for _, r := range records {
+		assert.Nil(t, r["v"], fmt.Sprintf("counter %v encoded as gauge", r["n"]))
+		sums[r["n"].(string)] = r["s"]
+	}
+
+	cases := []struct {
+		desc string
+		name string
+		sum  float64
+	}{
+		{"commands handled", statCommands, 2},
+		{"commands failed", statCommandsFailed, 1},
+		{"heartbeats dropped", statHeartbeatsDropped, 3},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.sum, sums[tc.name], fmt.Sprintf("%s: expected sum %v got %v", tc.desc, tc.sum, sums[tc.name]))
+	}
+}
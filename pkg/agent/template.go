@@ -0,0 +1,81 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+	"github.com/pelletier/go-toml"
+)
+
+const templateHeader = `# Mainflux agent config generated on the first run with default values,
+# see README for description of all the options.
+`
+
+// sectionComments describe config sections in the generated config file.
+var sectionComments = map[string]string{
+	"channels":    "Mainflux channels commands are received from and responses are published to",
+	"edgex":       "EdgeX Foundry core services and operations allowed on them",
+	"log":         "log level, one of \"debug\", \"info\", \"warn\" or \"error\"",
+	"mqtt":        "MQTT broker connection and publishing",
+	"nats":        "NATS connection heartbeats of services are received over",
+	"server":      "HTTP API server",
+	"heartbeat":   "heartbeats of services managed by the agent",
+	"terminal":    "remote terminal sessions",
+	"audit":       "audit log of handled commands kept in the store",
+	"exec":        "execution of commands on the host",
+	"safe_mode":   "safe mode disabling command execution, its state is persisted in file",
+	"device":      "identity of the device agent runs on",
+	"features":    "subsystems which can be disabled",
+	"store":       "store registered services and maintenance state and queue are persisted to",
+	"senml":       "SenML responses",
+	"grpc":        "gRPC API server",
+	"socket":      "Unix socket server for local commands",
+	"apply":       "applying config files of services",
+	"dead_man":    "dead man switch command run once MQTT connection is lost for timeout",
+	"artifacts":   "token protected HTTP server of full outputs of truncated responses",
+	"maintenance": "maintenance mode queuing commands until it is turned off",
+	"beacon":      "periodic heartbeat of the agent itself",
+	"ready":       "readiness published once agent is started",
+	"reboot":      "host reboot command",
+	"startup":     "commands run once after agent starts",
+}
+
+// InitConfig saves the config with its sections described in comments,
+// it's used to generate config file on the first run.
+func InitConfig(c Config) error {
+	unresolveSecrets(&c)
+	b, err := toml.Marshal(c)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Error marshaling toml: %s", err))
+	}
+	if err := ioutil.WriteFile(c.File, commentSections(b), 0644); err != nil {
+		return errors.New(fmt.Sprintf("Error writing toml: %s", err))
+	}
+	return nil
+}
+
+// commentSections prepends the header to marshaled config and
+// description to each of its top level sections.
+func commentSections(b []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(templateHeader)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			if c, ok := sectionComments[strings.Trim(line, "[]")]; ok {
+				fmt.Fprintf(&buf, "# %s\n", c)
+			}
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+// errPublishThrottled indicates that broker kept throttling publish until max backoff was reached
+var errPublishThrottled = errors.New("publish throttled by the broker")
+
+// throttleHints are parts of publish errors, in lower case, which brokers
+// use to tell that client exceeded their in-flight or rate limits.
+var throttleHints = []string{
+	"throttl",
+	"rate limit",
+	"rate too high",
+	"quota",
+	"too many",
+	"server busy",
+}
+
+// throttle is backoff shared by all publishes, it grows while broker
+// throttles publishes and shrinks as they succeed.
+type throttle struct {
+	mu    sync.Mutex
+	delay time.Duration
+}
+
+// isThrottled tells whether publish error is caused by broker limits.
+func isThrottled(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, h := range throttleHints {
+		if strings.Contains(msg, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *throttle) current() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.delay
+}
+
+// increase doubles the delay, starting from base and capped at max.
+func (t *throttle) increase(base, max time.Duration) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.delay *= 2
+	if t.delay < base {
+		t.delay = base
+	}
+	if t.delay > max {
+		t.delay = max
+	}
+	return t.delay
+}
+
+// relax halves the delay, dropping it once it's below base.
+func (t *throttle) relax(base time.Duration) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.delay == 0 {
+		return 0, false
+	}
+	t.delay /= 2
+	if t.delay < base {
+		t.delay = 0
+	}
+	return t.delay, true
+}
+
+// publishToken publishes payload and waits for acknowledgement. Publishes
+// are delayed by the current backoff and the ones throttled by the broker
+// are retried with growing backoff until it exceeds the max one.
+func (a *agent) publishToken(topic, payload string, retain bool) error {
+	mqtt := a.cfg().MQTT
+	base, max := mqtt.ThrottleBackoff, mqtt.ThrottleMaxBackoff
+	if max < base {
+		max = base
+	}
+	wait := base
+	for {
+		if d := a.throttle.current(); d > 0 {
+			a.clk().Sleep(d)
+		}
+		token := a.mqttClient.Publish(topic, mqtt.QoS, retain, payload)
+		token.Wait()
+		err := token.Error()
+		if err == nil {
+			if d, ok := a.throttle.relax(base); ok {
+				a.throughput.SetBackoff(d)
+			}
+			return nil
+		}
+		if base <= 0 || !isThrottled(err) {
+			return errors.New(err.Error())
+		}
+		a.throughput.AddThrottled()
+		d := a.throttle.increase(base, max)
+		a.throughput.SetBackoff(d)
+		if wait > max {
+			return errors.Wrap(errPublishThrottled, errors.New(err.Error()))
+		}
+		a.logger.Warn(fmt.Sprintf("Publish to %s throttled by the broker, retrying in %s: %s", topic, d, err))
+		wait *= 2
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/mainflux/agent/pkg/agent/mocks"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// throttlingClient fails first publishes with the given error.
+type throttlingClient struct {
+	paho.Client
+	failures  int
+	err       error
+	publishes int
+}
+
+func (c *throttlingClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.publishes++
+	if c.publishes <= c.failures {
+		return errToken{err: c.err}
+	}
+	return doneToken{}
+}
+
+type errToken struct {
+	paho.Token
+	err error
+}
+
+func (errToken) Wait() bool { return true }
+
+func (t errToken) Error() error { return t.err }
+
+func TestIsThrottled(t *testing.T) {
+	cases := []struct {
+		desc      string
+		err       error
+		throttled bool
+	}{
+		{"no error", nil, false},
+		{"throttling exception", errors.New("ThrottlingException: rate exceeded"), true},
+		{"quota exceeded", errors.New("Quota exceeded"), true},
+		{"too many requests", errors.New("too many publishes in flight"), true},
+		{"connection lost", errors.New("connection lost before publish completed"), false},
+	}
+
+	for _, tc := range cases {
+		throttled := isThrottled(tc.err)
+		assert.Equal(t, tc.throttled, throttled, fmt.Sprintf("%s: expected throttled %t got %t", tc.desc, tc.throttled, throttled))
+	}
+}
+
+func TestThrottledPublish(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	throttled := errors.New("Throttling: publish rate too high")
+
+	cases := []struct {
+		desc      string
+		backoff   time.Duration
+		failures  int
+		err       error
+		publishes int
+		slept     time.Duration
+		delay     time.Duration
+		perr      error
+	}{
+		{"publish without throttling", 100 * time.Millisecond, 0, nil, 1, 0, 0, nil},
+		{"publish throttled once", 100 * time.Millisecond, 1, throttled, 2, 100 * time.Millisecond, 0, nil},
+		{"publish throttled twice", 100 * time.Millisecond, 2, throttled, 3, 300 * time.Millisecond, 100 * time.Millisecond, nil},
+		{"publish throttled until max backoff", 100 * time.Millisecond, 10, throttled, 4, 700 * time.Millisecond, 400 * time.Millisecond, errPublishThrottled},
+		{"publish throttled with backoff disabled", 0, 1, throttled, 1, 0, 0, throttled},
+		{"publish failed", 100 * time.Millisecond, 1, errors.New("connection lost"), 1, 0, 0, errors.New("connection lost")},
+	}
+
+	for _, tc := range cases {
+		client := &throttlingClient{failures: tc.failures, err: tc.err}
+		clock := mocks.NewClock(time.Unix(0, 0))
+		a := &agent{
+			config:     &Config{MQTT: MQTTConfig{ThrottleBackoff: tc.backoff, ThrottleMaxBackoff: 400 * time.Millisecond}},
+			mqttClient: client,
+			clock:      clock,
+			logger:     logger,
+		}
+		err := a.Publish(control, "payload")
+		assert.True(t, errors.Contains(err, tc.perr), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.perr, err))
+		assert.Equal(t, tc.publishes, client.publishes, fmt.Sprintf("%s: expected %d publishes got %d", tc.desc, tc.publishes, client.publishes))
+		slept := clock.Now().Sub(time.Unix(0, 0))
+		assert.Equal(t, tc.slept, slept, fmt.Sprintf("%s: expected backoff %s got %s", tc.desc, tc.slept, slept))
+		delay := a.throttle.current()
+		assert.Equal(t, tc.delay, delay, fmt.Sprintf("%s: expected remaining backoff %s got %s", tc.desc, tc.delay, delay))
+	}
+}
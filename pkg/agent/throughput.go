@@ -0,0 +1,66 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	// TransportMQTT labels messages exchanged with MQTT broker.
+	TransportMQTT = "mqtt"
+	// TransportNATS labels messages exchanged with NATS.
+	TransportNATS = "nats"
+
+	// DirectionPublished labels messages sent by the agent.
+	DirectionPublished = "published"
+	// DirectionReceived labels messages received by the agent.
+	DirectionReceived = "received"
+)
+
+// Throughput counts messages and bytes published and received by the agent,
+// counters are labeled with `transport` and `direction`. Inflight tracks
+// number of MQTT publishes waiting for acknowledgement. Throttled counts MQTT
+// publishes throttled by the broker and Backoff tracks current backoff in
+// seconds. Nil metrics are ignored.
+type Throughput struct {
+	Messages  metrics.Counter
+	Bytes     metrics.Counter
+	Inflight  metrics.Gauge
+	Throttled metrics.Counter
+	Backoff   metrics.Gauge
+}
+
+// Add counts single message of given size.
+func (t Throughput) Add(transport, direction string, size int) {
+	if t.Messages != nil {
+		t.Messages.With("transport", transport, "direction", direction).Add(1)
+	}
+	if t.Bytes != nil {
+		t.Bytes.With("transport", transport, "direction", direction).Add(float64(size))
+	}
+}
+
+// AddInflight changes number of in-flight publishes by delta.
+func (t Throughput) AddInflight(delta float64) {
+	if t.Inflight != nil {
+		t.Inflight.Add(delta)
+	}
+}
+
+// AddThrottled counts single throttled publish.
+func (t Throughput) AddThrottled() {
+	if t.Throttled != nil {
+		t.Throttled.Add(1)
+	}
+}
+
+// SetBackoff sets current publish backoff.
+func (t Throughput) SetBackoff(d time.Duration) {
+	if t.Backoff != nil {
+		t.Backoff.Set(d.Seconds())
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	servicesTopology = "services-topology"
+
+	// maxDependencies is the maximum number of dependencies of a service.
+	maxDependencies = 32
+
+	// unknown is status of dependency which isn't registered service.
+	unknown = "unknown"
+)
+
+// errInvalidDependencies indicates heartbeat payload with malformed or too many dependencies
+var errInvalidDependencies = errors.New("invalid service dependencies")
+
+// dependenciesPayload is dependencies part of heartbeat payload,
+// i.e. `{"depends_on":["core-data","core-metadata"]}`.
+type dependenciesPayload struct {
+	DependsOn []string `json:"depends_on"`
+}
+
+// parseDependencies returns dependencies carried by heartbeat payload. Nil
+// is returned if payload doesn't report dependencies, and empty list if
+// service has none.
+func parseDependencies(data []byte) ([]string, error) {
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+	var p dependenciesPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, errors.Wrap(errInvalidDependencies, err)
+	}
+	if len(p.DependsOn) > maxDependencies {
+		return nil, errors.Wrap(errInvalidDependencies, fmt.Errorf("%d dependencies, at most %d allowed", len(p.DependsOn), maxDependencies))
+	}
+	for _, d := range p.DependsOn {
+		if d == "" {
+			return nil, errors.Wrap(errInvalidDependencies, fmt.Errorf("empty service name"))
+		}
+	}
+	return p.DependsOn, nil
+}
+
+// topologyNode is service in the dependency graph. Affected holds all the
+// services which depend on it directly or through other services.
+type topologyNode struct {
+	Status     string   `json:"status"`
+	DependsOn  []string `json:"depends_on"`
+	Dependents []string `json:"dependents"`
+	Affected   []string `json:"affected,omitempty"`
+}
+
+// topology handles `services-topology[,<service>]` command, it returns
+// dependency graph of registered services as adjacency keyed by service
+// name. Dependencies which aren't registered are included with unknown
+// status. If service is given, only its node is returned together with
+// services affected by restarting it.
+func (a *agent) topology(args []string) (string, error) {
+	graph := map[string]*topologyNode{}
+	node := func(name string) *topologyNode {
+		n, ok := graph[name]
+		if !ok {
+			n = &topologyNode{Status: unknown, DependsOn: []string{}, Dependents: []string{}}
+			graph[name] = n
+		}
+		return n
+	}
+	for _, info := range a.Services() {
+		n := node(info.Name)
+		n.Status = info.Status
+		for _, d := range info.DependsOn {
+			n.DependsOn = append(n.DependsOn, d)
+			dn := node(d)
+			dn.Dependents = append(dn.Dependents, info.Name)
+		}
+	}
+	for _, n := range graph {
+		sort.Strings(n.Dependents)
+	}
+
+	var v interface{} = graph
+	if len(args) > 0 && args[0] != "" {
+		name := args[0]
+		n, ok := graph[name]
+		if !ok {
+			return "", errors.Wrap(errNoSuchService, fmt.Errorf("%s", name))
+		}
+		n.Affected = affected(graph, name)
+		v = map[string]*topologyNode{name: n}
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", errors.New(err.Error())
+	}
+	return string(b), nil
+}
+
+// affected returns sorted services which transitively depend on the service.
+func affected(graph map[string]*topologyNode, name string) []string {
+	seen := map[string]bool{name: true}
+	queue := []string{name}
+	res := []string{}
+	for len(queue) > 0 {
+		for _, d := range graph[queue[0]].Dependents {
+			if !seen[d] {
+				seen[d] = true
+				res = append(res, d)
+				queue = append(queue, d)
+			}
+		}
+		queue = queue[1:]
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,112 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDependencies(t *testing.T) {
+	cases := []struct {
+		desc string
+		data string
+		deps []string
+		err  error
+	}{
+		{"empty payload", "", nil, nil},
+		{"dependencies", `{"depends_on":["core-data","core-metadata"]}`, []string{"core-data", "core-metadata"}, nil},
+		{"no dependencies", `{"depends_on":[]}`, []string{}, nil},
+		{"dependencies not reported", `{"labels":{"role":"export"}}`, nil, nil},
+		{"malformed payload", "ping", nil, errInvalidDependencies},
+		{"empty dependency", `{"depends_on":[""]}`, nil, errInvalidDependencies},
+	}
+
+	for _, tc := range cases {
+		deps, err := parseDependencies([]byte(tc.data))
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.deps, deps, fmt.Sprintf("%s: expected dependencies %v got %v", tc.desc, tc.deps, deps))
+	}
+}
+
+func TestTopology(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	a := &agent{
+		config: &Config{Heartbeat: HeartbeatConfig{Interval: time.Minute, NotifyWindow: time.Hour}},
+		svcs:   map[string]Heartbeat{},
+		store:  store.NewMemory(),
+		logger: logger,
+	}
+	a.heartbeat(heartbeatMsg{name: "core-data", typ: service, dependsOn: []string{"redis"}})
+	a.heartbeat(heartbeatMsg{name: "export", typ: export, dependsOn: []string{"core-data", "core-metadata"}})
+	a.heartbeat(heartbeatMsg{name: "rules", typ: service, dependsOn: []string{"export"}})
+	a.heartbeat(heartbeatMsg{name: "core-metadata", typ: service, dependsOn: []string{"mongo"}})
+	// Dependencies are kept if heartbeat doesn't report them and replaced otherwise.
+	a.heartbeat(heartbeatMsg{name: "core-data", typ: service})
+	a.heartbeat(heartbeatMsg{name: "core-metadata", typ: service, dependsOn: []string{}})
+	defer func() {
+		for _, s := range a.svcs {
+			s.Close()
+		}
+	}()
+
+	node := func(status string, deps, dependents, affected []string) *topologyNode {
+		return &topologyNode{Status: status, DependsOn: deps, Dependents: dependents, Affected: affected}
+	}
+	cases := []struct {
+		desc  string
+		args  []string
+		graph map[string]*topologyNode
+		err   error
+	}{
+		{
+			"whole topology",
+			nil,
+			map[string]*topologyNode{
+				"core-data":     node(online, []string{"redis"}, []string{"export"}, nil),
+				"core-metadata": node(online, []string{}, []string{"export"}, nil),
+				"export":        node(online, []string{"core-data", "core-metadata"}, []string{"rules"}, nil),
+				"redis":         node(unknown, []string{}, []string{"core-data"}, nil),
+				"rules":         node(online, []string{"export"}, []string{}, nil),
+			},
+			nil,
+		},
+		{
+			"affected services",
+			[]string{"core-data"},
+			map[string]*topologyNode{"core-data": node(online, []string{"redis"}, []string{"export"}, []string{"export", "rules"})},
+			nil,
+		},
+		{
+			"unregistered dependency",
+			[]string{"redis"},
+			map[string]*topologyNode{"redis": node(unknown, []string{}, []string{"core-data"}, []string{"core-data", "export", "rules"})},
+			nil,
+		},
+		{"unknown service", []string{"mongo"}, nil, errNoSuchService},
+	}
+
+	for _, tc := range cases {
+		resp, err := a.topology(tc.args)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		if err != nil {
+			continue
+		}
+		var graph map[string]*topologyNode
+		err = json.Unmarshal([]byte(resp), &graph)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding topology: %s", tc.desc, err))
+		assert.Equal(t, tc.graph, graph, fmt.Sprintf("%s: expected topology %s", tc.desc, resp))
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/senml"
+)
+
+// servicesTopic is control channel subtopic of service status transitions.
+const servicesTopic = "services"
+
+type transition struct {
+	name   string
+	status string
+	time   time.Time
+}
+
+// notifyTransition queues status transition of the service. Transitions
+// queued within notify window are published together as a single message.
+func (a *agent) notifyTransition(name, status string) {
+	a.transMu.Lock()
+	defer a.transMu.Unlock()
+
+	a.transitions = append(a.transitions, transition{
+		name:   name,
+		status: status,
+		time:   a.clk().Now(),
+	})
+	window := a.cfg().Heartbeat.NotifyWindow
+	if window <= 0 {
+		go a.flushTransitions()
+		return
+	}
+	// The first queued transition opens the window.
+	if len(a.transitions) == 1 {
+		a.clk().AfterFunc(window, a.flushTransitions)
+	}
+}
+
+// flushTransitions publishes queued transitions, one record per transition.
+func (a *agent) flushTransitions() {
+	a.transMu.Lock()
+	pending := a.transitions
+	a.transitions = nil
+	a.transMu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	records := transitionRecords(pending)
+	if a.duplicate(servicesTopic, records) {
+		return
+	}
+	payload, err := encoder.EncodeRecords(a.BaseName(""), records)
+	if err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to encode service transitions: %s", err))
+		return
+	}
+	if err := a.Publish(servicesTopic, string(payload)); err != nil {
+		a.logger.Warn(fmt.Sprintf("Failed to publish service transitions: %s", err))
+		return
+	}
+	a.markSent(servicesTopic, records)
+}
+
+// transitionRecords returns record named by the service with its new
+// status per transition, timed when the transition happened.
+func transitionRecords(transitions []transition) []senml.Record {
+	records := []senml.Record{}
+	for _, t := range transitions {
+		st := t.status
+		records = append(records, senml.Record{
+			Name:        t.name,
+			Time:        float64(t.time.UnixNano()) / float64(time.Second),
+			StringValue: &st,
+		})
+	}
+	return records
+}
@@ -0,0 +1,125 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	agentUpdate = "agent-update"
+	updated     = "updated"
+
+	// backupSuffix is appended to the replaced binary which is kept as a fallback
+	backupSuffix  = ".old"
+	updateTimeout = 5 * time.Minute
+	restartDelay  = time.Second
+)
+
+var (
+	// errFailedUpdate indicates error in downloading or replacing the binary
+	errFailedUpdate = errors.New("failed to update agent binary")
+
+	// errChecksumMismatch indicates that downloaded binary doesn't match the checksum
+	errChecksumMismatch = errors.New("checksum mismatch")
+)
+
+// restart replaces running process with the new binary.
+var restart = func(exe string) error {
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
+
+// executable returns path of the running binary.
+var executable = os.Executable
+
+// update downloads the binary from url, verifies its SHA-256 checksum and
+// replaces the running binary, keeping the old one with `.old` suffix.
+// New binary runs arbitrary code, so update is rejected if exec is disabled
+// or safe mode is on.
+func (a *agent) update(url, checksum string) error {
+	if !a.cfg().Features.Enabled(FeatureExec) {
+		return errors.Wrap(errFeatureDisabled, fmt.Errorf("%s", FeatureExec))
+	}
+	if a.safeMode.Enabled() {
+		return errSafeMode
+	}
+	exe, err := executable()
+	if err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), filepath.Base(exe))
+	if err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := download(url, checksum, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+
+	backup := exe + backupSuffix
+	if err := os.Rename(exe, backup); err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		if rerr := os.Rename(backup, exe); rerr != nil {
+			a.logger.Error(fmt.Sprintf("Failed to restore agent binary from %s: %s", backup, rerr))
+		}
+		return errors.Wrap(errFailedUpdate, err)
+	}
+
+	a.logger.Info(fmt.Sprintf("Agent binary updated from %s, previous binary kept in %s", url, backup))
+	go func(restart func(string) error) {
+		time.Sleep(restartDelay)
+		if err := restart(exe); err != nil {
+			a.logger.Error(fmt.Sprintf("Failed to restart agent: %s", err))
+		}
+	}(restart)
+	return nil
+}
+
+// download writes content from url to w and verifies its SHA-256 checksum.
+func download(url, checksum string, w io.Writer) error {
+	client := http.Client{Timeout: updateTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(errFailedUpdate, fmt.Errorf("unexpected status %s", resp.Status))
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), resp.Body); err != nil {
+		return errors.Wrap(errFailedUpdate, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(checksum) {
+		return errors.Wrap(errChecksumMismatch, fmt.Errorf("expected %s got %s", checksum, sum))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+
+	binary := []byte("new binary")
+	sum := sha256.Sum256(binary)
+	checksum := hex.EncodeToString(sum[:])
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/agent" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(binary)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "agent-update")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	exe := filepath.Join(dir, "agent")
+
+	oldExecutable, oldRestart := executable, restart
+	defer func() {
+		executable, restart = oldExecutable, oldRestart
+	}()
+	executable = func() (string, error) { return exe, nil }
+	restart = func(string) error { return nil }
+
+	cases := []struct {
+		desc     string
+		url      string
+		checksum string
+		safe     bool
+		disabled []string
+		err      error
+		replaced bool
+	}{
+		{"update binary", ts.URL + "/agent", checksum, false, nil, nil, true},
+		{"update binary with upper case checksum", ts.URL + "/agent", fmt.Sprintf("%X", sum[:]), false, nil, nil, true},
+		{"checksum mismatch", ts.URL + "/agent", "00" + checksum[2:], false, nil, errChecksumMismatch, false},
+		{"binary not found", ts.URL + "/missing", checksum, false, nil, errFailedUpdate, false},
+		{"server unreachable", "http://127.0.0.1:0/agent", checksum, false, nil, errFailedUpdate, false},
+		{"update in safe mode", ts.URL + "/agent", checksum, true, nil, errSafeMode, false},
+		{"update with exec disabled", ts.URL + "/agent", checksum, false, []string{FeatureExec}, errFeatureDisabled, false},
+	}
+
+	for _, tc := range cases {
+		os.Remove(exe + backupSuffix)
+		if err := ioutil.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+			t.Fatalf("unexpected error writing binary: %s", err)
+		}
+		a := &agent{
+			config:   &Config{Features: FeaturesConfig{Disabled: tc.disabled}},
+			safeMode: &safeMode{enabled: tc.safe},
+			logger:   logger,
+		}
+		err := a.update(tc.url, tc.checksum)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+
+		content, err := ioutil.ReadFile(exe)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error reading binary: %s", tc.desc, err))
+		backup, berr := ioutil.ReadFile(exe + backupSuffix)
+		files, err := ioutil.ReadDir(dir)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error listing dir: %s", tc.desc, err))
+		if !tc.replaced {
+			assert.Equal(t, "old binary", string(content), fmt.Sprintf("%s: expected binary to be untouched", tc.desc))
+			assert.True(t, os.IsNotExist(berr), fmt.Sprintf("%s: expected no backup binary", tc.desc))
+			assert.Len(t, files, 1, fmt.Sprintf("%s: expected temp file to be removed", tc.desc))
+			continue
+		}
+		assert.Equal(t, string(binary), string(content), fmt.Sprintf("%s: expected binary to be replaced", tc.desc))
+		assert.Equal(t, "old binary", string(backup), fmt.Sprintf("%s: expected old binary to be kept", tc.desc))
+		assert.Len(t, files, 2, fmt.Sprintf("%s: expected only binary and backup", tc.desc))
+		info, err := os.Stat(exe)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error reading binary info: %s", tc.desc, err))
+		assert.Equal(t, os.FileMode(0755), info.Mode().Perm(), fmt.Sprintf("%s: expected executable binary", tc.desc))
+	}
+}
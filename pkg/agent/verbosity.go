@@ -0,0 +1,60 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+// Error verbosity levels of responses.
+const (
+	// VerbosityFull sends error details in responses.
+	VerbosityFull = "full"
+
+	// VerbosityMinimal sends only generic message per result code
+	// in responses, while the details are only logged.
+	VerbosityMinimal = "minimal"
+)
+
+// errInvalidVerbosity indicates unknown error verbosity level
+var errInvalidVerbosity = errors.New("invalid error verbosity")
+
+// codeMessages are generic messages sent instead of error details.
+var codeMessages = map[int]string{
+	CodeFailure:        "command failed",
+	CodeInvalidCommand: "invalid command",
+	CodeUnknownCommand: "unknown command",
+	CodeNotAllowed:     "command not allowed",
+	CodeTimeout:        "command timed out",
+	CodeKilled:         "command killed",
+	CodeDisabled:       "disabled",
+	CodeNotFound:       "not found",
+}
+
+// validVerbosity checks that error verbosity level is known,
+// empty level defaults to full.
+func validVerbosity(v string) error {
+	switch v {
+	case "", VerbosityFull, VerbosityMinimal:
+		return nil
+	}
+	return errors.Wrap(errInvalidVerbosity, fmt.Errorf("%s", v))
+}
+
+// ErrorMessage returns message of the error sent in response to the command
+// of given uuid. With minimal verbosity generic message of the error result
+// code is returned and the error is logged instead.
+func (a *agent) ErrorMessage(uuid string, err error) string {
+	if a.cfg().SenML.ErrorVerbosity != VerbosityMinimal {
+		return err.Error()
+	}
+	code := ResultCode(err)
+	a.logger.Warn(fmt.Sprintf("Command %s failed with code %d: %s", uuid, code, err))
+	if msg, ok := codeMessages[code]; ok {
+		return msg
+	}
+	return codeMessages[CodeFailure]
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorMessage(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	notAllowed := errors.Wrap(errCommandNotAllowed, fmt.Errorf("/usr/local/bin/secret"))
+	failed := fmt.Errorf("open /etc/agent/config.toml: permission denied")
+
+	cases := []struct {
+		desc      string
+		verbosity string
+		err       error
+		msg       string
+	}{
+		{"default verbosity", "", notAllowed, notAllowed.Error()},
+		{"full verbosity", VerbosityFull, failed, failed.Error()},
+		{"minimal verbosity", VerbosityMinimal, notAllowed, "command not allowed"},
+		{"minimal verbosity of uncategorized error", VerbosityMinimal, failed, "command failed"},
+	}
+
+	for _, tc := range cases {
+		a := &agent{
+			config: &Config{SenML: SenMLConfig{ErrorVerbosity: tc.verbosity}},
+			logger: logger,
+		}
+		msg := a.ErrorMessage("1", tc.err)
+		assert.Equal(t, tc.msg, msg, fmt.Sprintf("%s: expected message %s got %s", tc.desc, tc.msg, msg))
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	// Success is outcome recorded for commands finished without error.
+	Success = "success"
+
+	// Failure is outcome recorded for commands finished with error.
+	Failure = "failure"
+)
+
+var (
+	// errWriteEntry indicates failure to write audit log entry
+	errWriteEntry = errors.New("failed to write audit log entry")
+
+	// errReadEntries indicates failure to read audit log entries
+	errReadEntries = errors.New("failed to read audit log entries")
+)
+
+// Entry represents single executed command.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	UUID     string    `json:"uuid"`
+	Method   string    `json:"method"`
+	Command  string    `json:"command"`
+	Outcome  string    `json:"outcome"`
+	Error    string    `json:"error,omitempty"`
+	Duration string    `json:"duration,omitempty"`
+}
+
+// Log specifies API for append-only command audit log.
+type Log interface {
+	// Record appends entry to the log.
+	Record(Entry) error
+
+	// Last returns last n entries, oldest first.
+	Last(n int) ([]Entry, error)
+}
+
+// bucket is store bucket audit entries are kept in.
+const bucket = "audit"
+
+var _ Log = (*storeLog)(nil)
+
+type storeLog struct {
+	st    store.Store
+	max   uint64
+	first uint64
+	next  uint64
+	mu    sync.Mutex
+}
+
+// New returns audit log which keeps entries as JSON in the store, keyed by
+// sequence number. Once there are more than maxEntries entries the oldest
+// ones are removed, the number of entries is unlimited if maxEntries <= 0.
+func New(st store.Store, maxEntries int) (Log, error) {
+	values, err := st.List(bucket)
+	if err != nil {
+		return nil, errors.Wrap(errReadEntries, err)
+	}
+	l := &storeLog{st: st}
+	if maxEntries > 0 {
+		l.max = uint64(maxEntries)
+	}
+	for k := range values {
+		seq, err := strconv.ParseUint(k, 10, 64)
+		if err != nil {
+			continue
+		}
+		if l.next == 0 || seq < l.first {
+			l.first = seq
+		}
+		if seq >= l.next {
+			l.next = seq + 1
+		}
+	}
+	return l, nil
+}
+
+func (l *storeLog) Record(e Entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(errWriteEntry, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.st.Put(bucket, key(l.next), b); err != nil {
+		return errors.Wrap(errWriteEntry, err)
+	}
+	l.next++
+	for l.max > 0 && l.next-l.first > l.max {
+		if err := l.st.Delete(bucket, key(l.first)); err != nil {
+			return errors.Wrap(errWriteEntry, err)
+		}
+		l.first++
+	}
+	return nil
+}
+
+func (l *storeLog) Last(n int) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := l.first
+	if n >= 0 && l.next-l.first > uint64(n) {
+		start = l.next - uint64(n)
+	}
+	entries := []Entry{}
+	for seq := start; seq < l.next; seq++ {
+		b, err := l.st.Get(bucket, key(seq))
+		if errors.Contains(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(errReadEntries, err)
+		}
+		var e Entry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, errors.Wrap(errReadEntries, fmt.Errorf("entry %d: %s", seq, err))
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// key returns zero padded sequence number, so that keys sort in order.
+func key(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
@@ -0,0 +1,93 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package audit_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/audit"
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLog(t *testing.T) {
+	cases := []struct {
+		desc       string
+		maxEntries int
+		records    int
+		last       int
+		uuids      []string
+	}{
+		{"unlimited entries", 0, 3, -1, []string{"0", "1", "2"}},
+		{"oldest entries removed", 2, 5, -1, []string{"3", "4"}},
+		{"last entries", 0, 5, 2, []string{"3", "4"}},
+		{"more entries than recorded", 10, 2, 5, []string{"0", "1"}},
+		{"no entries", 0, 3, 0, []string{}},
+	}
+
+	for _, tc := range cases {
+		l, err := audit.New(store.NewMemory(), tc.maxEntries)
+		if err != nil {
+			t.Fatalf("%s: failed to create audit log: %s", tc.desc, err)
+		}
+		for n := 0; n < tc.records; n++ {
+			err := l.Record(audit.Entry{UUID: fmt.Sprintf("%d", n), Outcome: audit.Success})
+			assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		}
+		entries, err := l.Last(tc.last)
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error %s", tc.desc, err))
+		assert.Equal(t, tc.uuids, uuids(entries), fmt.Sprintf("%s: expected entries %v got %v", tc.desc, tc.uuids, uuids(entries)))
+	}
+}
+
+func TestLogRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	st, err := store.NewFile(filepath.Join(dir, "store"))
+	if err != nil {
+		t.Fatalf("failed to create file store: %s", err)
+	}
+
+	l, err := audit.New(st, 3)
+	if err != nil {
+		t.Fatalf("failed to create audit log: %s", err)
+	}
+	for n := 0; n < 4; n++ {
+		err := l.Record(audit.Entry{UUID: fmt.Sprintf("%d", n), Outcome: audit.Success})
+		assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	}
+
+	// Restored log continues after the last entry and keeps trimming.
+	l, err = audit.New(st, 3)
+	if err != nil {
+		t.Fatalf("failed to restore audit log: %s", err)
+	}
+	entries, err := l.Last(-1)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	assert.Equal(t, []string{"1", "2", "3"}, uuids(entries), fmt.Sprintf("expected restored entries got %v", uuids(entries)))
+
+	err = l.Record(audit.Entry{UUID: "4", Outcome: audit.Success})
+	assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	entries, err = l.Last(-1)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	assert.Equal(t, []string{"2", "3", "4"}, uuids(entries), fmt.Sprintf("expected entries after restore got %v", uuids(entries)))
+	values, err := st.List("audit")
+	assert.Nil(t, err, fmt.Sprintf("unexpected error %s", err))
+	assert.Len(t, values, 3, fmt.Sprintf("expected 3 stored entries got %d", len(values)))
+}
+
+func uuids(entries []audit.Entry) []string {
+	ids := []string{}
+	for _, e := range entries {
+		ids = append(ids, e.UUID)
+	}
+	return ids
+}
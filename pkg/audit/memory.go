@@ -0,0 +1,53 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import "sync"
+
+var _ Log = (*memLog)(nil)
+
+type memLog struct {
+	entries []Entry
+	next    int
+	full    bool
+	mu      sync.Mutex
+}
+
+// NewMemory returns audit log which keeps last size entries
+// in memory ring buffer, older entries are overwritten.
+func NewMemory(size int) Log {
+	if size < 1 {
+		size = 1
+	}
+	return &memLog{
+		entries: make([]Entry, size),
+	}
+}
+
+func (l *memLog) Record(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+	return nil
+}
+
+func (l *memLog) Last(n int) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := append([]Entry{}, l.entries[:l.next]...)
+	if l.full {
+		entries = append(append([]Entry{}, l.entries[l.next:]...), entries...)
+	}
+
+	if n >= 0 && len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	return entries, nil
+}
@@ -0,0 +1,80 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package bootstrap
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mainflux/agent/pkg/agent"
+	errors "github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+)
+
+const remoteTimeout = 30 * time.Second
+
+var errFetchRemoteConfig = errors.New("failed to fetch remote config")
+
+// RemoteConfig represents the parameters for fetching config from remote URL.
+// Auth is sent as Authorization header if set.
+type RemoteConfig struct {
+	URL  string
+	Auth string
+}
+
+// FetchConfig fetches agent config in TOML format and caches it in the file,
+// so it is used on boots when the remote URL isn't reachable. The file is
+// left intact if config can't be fetched or parsed.
+func FetchConfig(cfg RemoteConfig, file string, logger log.Logger) error {
+	logger.Info(fmt.Sprintf("Requesting config from %s", cfg.URL))
+
+	req, err := http.NewRequest(http.MethodGet, cfg.URL, nil)
+	if err != nil {
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+	if cfg.Auth != "" {
+		req.Header.Set("Authorization", cfg.Auth)
+	}
+
+	client := &http.Client{Timeout: remoteTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Wrap(errFetchRemoteConfig, errors.New(http.StatusText(resp.StatusCode)))
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".config")
+	if err != nil {
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+	if _, err := agent.ReadConfig(tmp.Name()); err != nil {
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return errors.Wrap(errFetchRemoteConfig, err)
+	}
+
+	logger.Info(fmt.Sprintf("Config fetched from %s saved to %s", cfg.URL, file))
+	return nil
+}
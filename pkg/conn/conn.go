@@ -9,6 +9,8 @@ import (
 	"strings"
 
 	"github.com/mainflux/agent/pkg/agent"
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/mainflux/errors"
 	"github.com/mainflux/mainflux/logger"
 	"github.com/mainflux/senml"
 	"github.com/nats-io/nats.go"
@@ -27,6 +29,9 @@ const (
 	config  = "config"
 	service = "service"
 	term    = "term"
+
+	deadLetterPayload = "payload"
+	deadLetterError   = "error"
 )
 
 var channelPartRegExp = regexp.MustCompile(`^channels/([\w\-]+)/messages/services(/[^?]*)?(\?.*)?$`)
@@ -40,22 +45,31 @@ type MqttBroker interface {
 }
 
 type broker struct {
-	svc     agent.Service
-	client  mqtt.Client
-	logger  logger.Logger
-	nats    *nats.Conn
-	channel string
+	svc             agent.Service
+	client          mqtt.Client
+	logger          logger.Logger
+	nats            *nats.Conn
+	channel         string
+	deadLetterTopic string
+	format          string
+	throughput      agent.Throughput
 }
 
-// NewBroker returns new MQTT broker instance.
-func NewBroker(svc agent.Service, client mqtt.Client, chann string, nats *nats.Conn, log logger.Logger) MqttBroker {
+// NewBroker returns new MQTT broker instance. Commands which are malformed
+// or unknown are published to deadLetter subtopic of the control channel,
+// dead letters are not published if deadLetter is empty. Commands are
+// decoded as format, or as format set in `req/<format>` subtopic.
+func NewBroker(svc agent.Service, client mqtt.Client, chann, deadLetter, format string, nats *nats.Conn, tp agent.Throughput, log logger.Logger) MqttBroker {
 
 	return &broker{
-		svc:     svc,
-		client:  client,
-		logger:  log,
-		nats:    nats,
-		channel: chann,
+		svc:             svc,
+		client:          client,
+		logger:          log,
+		nats:            nats,
+		channel:         chann,
+		deadLetterTopic: deadLetter,
+		format:          format,
+		throughput:      tp,
 	}
 
 }
@@ -67,6 +81,10 @@ func (b *broker) Subscribe() error {
 	if err := s.Error(); s.Wait() && err != nil {
 		return err
 	}
+	s = b.client.Subscribe(topic+"/+", 0, b.handleMsg)
+	if err := s.Error(); s.Wait() && err != nil {
+		return err
+	}
 	topic = fmt.Sprintf("channels/%s/messages/%s/#", b.channel, servTopic)
 	if b.nats != nil {
 		n := b.client.Subscribe(topic, 0, b.handleNatsMsg)
@@ -80,8 +98,11 @@ func (b *broker) Subscribe() error {
 
 // handleNatsMsg triggered when new message is received on MQTT broker
 func (b *broker) handleNatsMsg(mc mqtt.Client, msg mqtt.Message) {
+	b.throughput.Add(agent.TransportMQTT, agent.DirectionReceived, len(msg.Payload()))
 	if topic := extractNatsTopic(msg.Topic()); topic != "" {
-		b.nats.Publish(topic, msg.Payload())
+		if err := b.nats.Publish(topic, msg.Payload()); err == nil {
+			b.throughput.Add(agent.TransportNATS, agent.DirectionPublished, len(msg.Payload()))
+		}
 	}
 }
 
@@ -101,46 +122,89 @@ func extractNatsTopic(topic string) string {
 
 // handleMsg triggered when new message is received on MQTT broker
 func (b *broker) handleMsg(mc mqtt.Client, msg mqtt.Message) {
-	sm, err := senml.Decode(msg.Payload(), senml.JSON)
+	b.throughput.Add(agent.TransportMQTT, agent.DirectionReceived, len(msg.Payload()))
+	format := b.format
+	if parts := strings.Split(msg.Topic(), "/"); len(parts) > 1 && parts[len(parts)-2] == reqTopic {
+		format = parts[len(parts)-1]
+	}
+	c, err := decode(format, msg.Payload())
 	if err != nil {
-		b.logger.Warn(fmt.Sprintf("SenML decode failed: %s", err))
+		b.logger.Warn(fmt.Sprintf("Failed to decode %s command: %s", format, err))
+		b.deadLetter("", msg.Payload(), err)
 		return
 	}
-
-	if len(sm.Records) == 0 {
-		b.logger.Error(fmt.Sprintf("SenML payload empty: `%s`", string(msg.Payload())))
-		return
+	cmdType, cmdStr, uuid := c.Type, c.Command, c.UUID
+	if c.AcceptEncoding != "" {
+		b.svc.AcceptEncoding(uuid, c.AcceptEncoding)
+		defer b.svc.AcceptEncoding(uuid, "")
+	}
+	if c.ResponseFormat != "" {
+		b.svc.ResponseFormat(uuid, c.ResponseFormat)
+		defer b.svc.ResponseFormat(uuid, "")
 	}
-	cmdType := sm.Records[0].Name
-	cmdStr := *sm.Records[0].StringValue
-	uuid := strings.TrimSuffix(sm.Records[0].BaseName, ":")
 
 	switch cmdType {
 	case control:
 		b.logger.Info(fmt.Sprintf("Control command for uuid %s and command string %s", uuid, cmdStr))
-		if err := b.svc.Control(uuid, cmdStr); err != nil {
+		if _, err = b.svc.Control(uuid, cmdStr); err != nil {
 			b.logger.Warn(fmt.Sprintf("Control operation failed: %s", err))
 		}
 	case exec:
 		b.logger.Info(fmt.Sprintf("Execute command for uuid %s and command string %s", uuid, cmdStr))
-		if _, err := b.svc.Execute(uuid, cmdStr); err != nil {
+		if _, err = b.svc.Execute(uuid, cmdStr); err != nil {
 			b.logger.Warn(fmt.Sprintf("Execute operation failed: %s", err))
 		}
 	case config:
 		b.logger.Info(fmt.Sprintf("Config service for uuid %s and command string %s", uuid, cmdStr))
-		if err := b.svc.ServiceConfig(uuid, cmdStr); err != nil {
+		if _, err = b.svc.ServiceConfig(uuid, cmdStr); err != nil {
 			b.logger.Warn(fmt.Sprintf("Execute operation failed: %s", err))
 		}
 	case service:
 		b.logger.Info(fmt.Sprintf("Services view for uuid %s and command string %s", uuid, cmdStr))
-		if err := b.svc.ServiceConfig(uuid, cmdStr); err != nil {
+		if _, err = b.svc.ServiceConfig(uuid, cmdStr); err != nil {
 			b.logger.Warn(fmt.Sprintf("Services view operation failed: %s", err))
 		}
 	case term:
 		b.logger.Info(fmt.Sprintf("Services view for uuid %s and command string %s", uuid, cmdStr))
-		if err := b.svc.Terminal(uuid, cmdStr); err != nil {
+		if err = b.svc.Terminal(uuid, cmdStr); err != nil {
 			b.logger.Warn(fmt.Sprintf("Services view operation failed: %s", err))
 		}
+	default:
+		err = errors.Wrap(agent.ErrUnknownCommand, fmt.Errorf("%s", cmdType))
+		b.logger.Warn(fmt.Sprintf("Unknown command type %s for uuid %s", cmdType, uuid))
+	}
+
+	if errors.Contains(err, agent.ErrInvalidCommand) ||
+		errors.Contains(err, agent.ErrUnknownCommand) ||
+		errors.Contains(err, agent.ErrMalformedEntity) {
+		b.deadLetter(uuid, msg.Payload(), err)
+	}
+}
+
+// deadLetter publishes raw payload of the command which failed
+// to be processed together with the failure reason.
+func (b *broker) deadLetter(uuid string, payload []byte, reason error) {
+	if b.deadLetterTopic == "" {
+		return
 	}
 
+	p, r := string(payload), b.svc.ErrorMessage(uuid, reason)
+	records := []senml.Record{
+		senml.Record{
+			Name:        deadLetterPayload,
+			StringValue: &p,
+		},
+		senml.Record{
+			Name:        deadLetterError,
+			StringValue: &r,
+		},
+	}
+	msg, err := encoder.EncodeRecords(b.svc.BaseName(uuid), records)
+	if err != nil {
+		b.logger.Warn(fmt.Sprintf("Failed to encode dead letter: %s", err))
+		return
+	}
+	if err := b.svc.Publish(b.deadLetterTopic, string(msg)); err != nil {
+		b.logger.Warn(fmt.Sprintf("Failed to publish dead letter: %s", err))
+	}
 }
@@ -0,0 +1,57 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package conn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/agent"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetter(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	reason := errors.Wrap(agent.ErrInvalidCommand, errors.New("unexpected token at /etc/agent/secret"))
+
+	cases := []struct {
+		desc    string
+		minimal bool
+		msg     string
+	}{
+		{"full verbosity", false, reason.Error()},
+		{"minimal verbosity", true, fmt.Sprintf("code %d", agent.CodeInvalidCommand)},
+	}
+
+	for _, tc := range cases {
+		var published []string
+		b := &broker{
+			svc:             echoService{minimal: tc.minimal, published: &published},
+			logger:          logger,
+			deadLetterTopic: "dead",
+		}
+		b.deadLetter("1", []byte("garbage"), reason)
+		if !assert.Equal(t, 1, len(published), fmt.Sprintf("%s: expected 1 dead letter got %d", tc.desc, len(published))) {
+			continue
+		}
+		pack, err := senml.Decode([]byte(published[0]), senml.JSON)
+		if !assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding dead letter: %s", tc.desc, err)) {
+			continue
+		}
+		msg := ""
+		for _, r := range pack.Records {
+			if r.Name == deadLetterError {
+				msg = *r.StringValue
+			}
+		}
+		assert.Equal(t, tc.msg, msg, fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.msg, msg))
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package conn
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mainflux/agent/pkg/agent"
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+)
+
+const (
+	// FormatSenML is SenML JSON pack, command type is the name and command
+	// the string value of the first record, uuid is its base name.
+	FormatSenML = "senml"
+
+	// FormatSenMLCBOR is SenML pack encoded as CBOR.
+	FormatSenMLCBOR = "senml-cbor"
+
+	// FormatJSON is JSON object with `uuid`, `type` and `command` fields.
+	FormatJSON = "json"
+
+	// acceptEncoding is JSON field, or SenML record following the command,
+	// with encodings of the response accepted by the sender, i.e. `gzip`.
+	acceptEncoding = "accept-encoding"
+
+	// responseFormat is JSON field, or SenML record following the command,
+	// with format of the response requested by the sender, i.e. `text`.
+	responseFormat = "response-format"
+)
+
+// ErrUnsupportedFormat indicates that command payload format has no decoder.
+var ErrUnsupportedFormat = errors.New("unsupported payload format")
+
+// command is command decoded from the message payload.
+type command struct {
+	UUID           string `json:"uuid"`
+	Type           string `json:"type"`
+	Command        string `json:"command"`
+	AcceptEncoding string `json:"accept-encoding"`
+	ResponseFormat string `json:"response-format"`
+}
+
+type decoder func([]byte) (command, error)
+
+var decoders = map[string]decoder{
+	FormatSenML:     senmlDecoder(senml.JSON),
+	FormatSenMLCBOR: senmlDecoder(senml.CBOR),
+	FormatJSON:      decodeJSON,
+}
+
+// ValidateFormat checks that there is decoder for the format.
+func ValidateFormat(format string) error {
+	if _, ok := decoders[format]; !ok {
+		return errors.Wrap(ErrUnsupportedFormat, fmt.Errorf("%s", format))
+	}
+	return nil
+}
+
+// decode decodes payload with decoder of given format.
+func decode(format string, payload []byte) (command, error) {
+	d, ok := decoders[format]
+	if !ok {
+		return command{}, errors.Wrap(ErrUnsupportedFormat, fmt.Errorf("%s", format))
+	}
+	c, err := d(payload)
+	if err != nil {
+		return command{}, err
+	}
+	if c.ResponseFormat != "" {
+		if err := encoder.ValidateFormat(c.ResponseFormat); err != nil {
+			return command{}, errors.Wrap(agent.ErrMalformedEntity, err)
+		}
+	}
+	return c, nil
+}
+
+func senmlDecoder(f senml.Format) decoder {
+	return func(payload []byte) (command, error) {
+		sm, err := senml.Decode(payload, f)
+		if err != nil {
+			return command{}, errors.Wrap(agent.ErrMalformedEntity, err)
+		}
+		if len(sm.Records) == 0 || sm.Records[0].StringValue == nil {
+			return command{}, agent.ErrMalformedEntity
+		}
+		c := command{
+			UUID:    strings.TrimSuffix(sm.Records[0].BaseName, ":"),
+			Type:    sm.Records[0].Name,
+			Command: *sm.Records[0].StringValue,
+		}
+		for _, r := range sm.Records[1:] {
+			if r.StringValue == nil {
+				continue
+			}
+			switch r.Name {
+			case acceptEncoding:
+				c.AcceptEncoding = *r.StringValue
+			case responseFormat:
+				c.ResponseFormat = *r.StringValue
+			}
+		}
+		return c, nil
+	}
+}
+
+func decodeJSON(payload []byte) (command, error) {
+	var cmd command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		return command{}, errors.Wrap(agent.ErrMalformedEntity, err)
+	}
+	if cmd.Type == "" || cmd.Command == "" {
+		return command{}, agent.ErrMalformedEntity
+	}
+	return cmd, nil
+}
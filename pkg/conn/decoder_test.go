@@ -0,0 +1,50 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package conn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/agent"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecode(t *testing.T) {
+	cmd := "ls,-la"
+	pack := senml.Pack{Records: []senml.Record{{BaseName: "1:", Name: "exec", StringValue: &cmd}}}
+	cbor, err := senml.Encode(pack, senml.CBOR)
+	if err != nil {
+		t.Fatalf("failed to encode CBOR: %s", err)
+	}
+
+	cases := []struct {
+		desc    string
+		format  string
+		payload []byte
+		cmd     command
+		err     error
+	}{
+		{"senml", FormatSenML, []byte(`[{"bn":"1:", "n":"exec", "vs":"ls,-la"}]`), command{"1", "exec", "ls,-la", "", ""}, nil},
+		{"senml without string value", FormatSenML, []byte(`[{"bn":"1:", "n":"exec", "v":1}]`), command{}, agent.ErrMalformedEntity},
+		{"senml cbor", FormatSenMLCBOR, cbor, command{"1", "exec", "ls,-la", "", ""}, nil},
+		{"json", FormatJSON, []byte(`{"uuid":"1", "type":"exec", "command":"ls,-la"}`), command{"1", "exec", "ls,-la", "", ""}, nil},
+		{"senml accepting gzip", FormatSenML, []byte(`[{"bn":"1:", "n":"exec", "vs":"ls,-la"}, {"n":"accept-encoding", "vs":"gzip"}]`), command{"1", "exec", "ls,-la", "gzip", ""}, nil},
+		{"json accepting gzip", FormatJSON, []byte(`{"uuid":"1", "type":"exec", "command":"ls,-la", "accept-encoding":"gzip"}`), command{"1", "exec", "ls,-la", "gzip", ""}, nil},
+		{"senml with response format", FormatSenML, []byte(`[{"bn":"1:", "n":"exec", "vs":"ls,-la"}, {"n":"response-format", "vs":"text"}]`), command{"1", "exec", "ls,-la", "", "text"}, nil},
+		{"json with response format", FormatJSON, []byte(`{"uuid":"1", "type":"exec", "command":"ls,-la", "response-format":"json"}`), command{"1", "exec", "ls,-la", "", "json"}, nil},
+		{"json with unknown response format", FormatJSON, []byte(`{"uuid":"1", "type":"exec", "command":"ls,-la", "response-format":"xml"}`), command{}, agent.ErrMalformedEntity},
+		{"json without command", FormatJSON, []byte(`{"uuid":"1", "type":"exec"}`), command{}, agent.ErrMalformedEntity},
+		{"senml decoded as json", FormatJSON, []byte(`[{"bn":"1:", "n":"exec", "vs":"ls,-la"}]`), command{}, agent.ErrMalformedEntity},
+		{"unknown format", "protobuf", []byte{0x0a, 0x01}, command{}, ErrUnsupportedFormat},
+	}
+
+	for _, tc := range cases {
+		c, err := decode(tc.format, tc.payload)
+		assert.True(t, errors.Contains(err, tc.err), fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.err, err))
+		assert.Equal(t, tc.cmd, c, fmt.Sprintf("%s: expected command %v got %v", tc.desc, tc.cmd, c))
+	}
+}
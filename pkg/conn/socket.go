@@ -0,0 +1,147 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package conn
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/mainflux/agent/pkg/agent"
+	"github.com/mainflux/agent/pkg/encoder"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+)
+
+const (
+	socketNetwork = "unix"
+	codeRecord    = "code"
+
+	// maxSocketCommand is the max length of command read from the socket.
+	maxSocketCommand = 1024 * 1024
+)
+
+// SocketServer serves commands sent over Unix domain socket.
+type SocketServer struct {
+	svc    agent.Service
+	format string
+	logger logger.Logger
+}
+
+// NewSocketServer returns server which decodes commands as format and
+// responds with the response of the command. Commands are newline
+// delimited, so SenML CBOR commands are read as SenML JSON.
+func NewSocketServer(svc agent.Service, format string, log logger.Logger) *SocketServer {
+	if format == FormatSenMLCBOR {
+		format = FormatSenML
+	}
+	return &SocketServer{
+		svc:    svc,
+		format: format,
+		logger: log,
+	}
+}
+
+// ListenSocket listens on Unix socket at the path, removing stale socket
+// left by the previous run, and sets socket file permissions to mode.
+func ListenSocket(path string, mode os.FileMode) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	l, err := net.Listen(socketNetwork, path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve accepts connections on the listener, each carries single command
+// line and is closed once the response is written.
+func (s *SocketServer) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(c)
+	}
+}
+
+func (s *SocketServer) serveConn(c net.Conn) {
+	defer c.Close()
+	sc := bufio.NewScanner(c)
+	sc.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxSocketCommand)
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			s.logger.Warn(fmt.Sprintf("Failed to read socket command: %s", err))
+		}
+		return
+	}
+	res := s.handle(sc.Bytes())
+	if _, err := fmt.Fprintf(c, "%s\n", res); err != nil {
+		s.logger.Warn(fmt.Sprintf("Failed to write socket response: %s", err))
+	}
+}
+
+// handle runs the command and returns its response, or the error
+// and its result code if the command fails.
+func (s *SocketServer) handle(payload []byte) string {
+	cmd, err := decode(s.format, payload)
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("Failed to decode %s socket command: %s", s.format, err))
+		return s.errorResponse("", err)
+	}
+	if cmd.ResponseFormat != "" {
+		s.svc.ResponseFormat(cmd.UUID, cmd.ResponseFormat)
+		defer s.svc.ResponseFormat(cmd.UUID, "")
+	}
+
+	var res string
+	switch cmd.Type {
+	case control:
+		s.logger.Info(fmt.Sprintf("Socket control command for uuid %s and command string %s", cmd.UUID, cmd.Command))
+		res, err = s.svc.Control(cmd.UUID, cmd.Command)
+	case exec:
+		s.logger.Info(fmt.Sprintf("Socket execute command for uuid %s and command string %s", cmd.UUID, cmd.Command))
+		res, err = s.svc.Execute(cmd.UUID, cmd.Command)
+	case config, service:
+		s.logger.Info(fmt.Sprintf("Socket config service for uuid %s and command string %s", cmd.UUID, cmd.Command))
+		res, err = s.svc.ServiceConfig(cmd.UUID, cmd.Command)
+	default:
+		err = errors.Wrap(agent.ErrUnknownCommand, fmt.Errorf("%s", cmd.Type))
+	}
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("Socket %s command failed: %s", cmd.Type, err))
+		return s.errorResponse(cmd.UUID, err)
+	}
+	return res
+}
+
+func (s *SocketServer) errorResponse(uuid string, err error) string {
+	e, code := s.svc.ErrorMessage(uuid, err), float64(agent.ResultCode(err))
+	records := []senml.Record{
+		senml.Record{
+			Name:        deadLetterError,
+			StringValue: &e,
+		},
+		senml.Record{
+			Name:  codeRecord,
+			Value: &code,
+		},
+	}
+	payload, err := encoder.EncodeRecords(s.svc.BaseName(uuid), records)
+	if err != nil {
+		s.logger.Warn(fmt.Sprintf("Failed to encode socket error response: %s", err))
+		return ""
+	}
+	return string(payload)
+}
@@ -0,0 +1,151 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package conn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/agent"
+	"github.com/mainflux/mainflux/errors"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/senml"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoService responds to exec and control commands with the command,
+// commands starting with `fail` fail with invalid command error. If
+// minimal is set, error messages carry only the result code. Published
+// messages are appended to published.
+type echoService struct {
+	agent.Service
+	minimal   bool
+	published *[]string
+}
+
+func (s echoService) respond(uuid, cmd string) (string, error) {
+	if strings.HasPrefix(cmd, "fail") {
+		return "", agent.ErrInvalidCommand
+	}
+	return fmt.Sprintf("%s:%s", uuid, cmd), nil
+}
+
+func (s echoService) Execute(uuid, cmd string) (string, error) { return s.respond(uuid, cmd) }
+
+func (s echoService) Control(uuid, cmd string) (string, error) { return s.respond(uuid, cmd) }
+
+func (s echoService) ResponseFormat(uuid, format string) {}
+
+func (s echoService) BaseName(uuid string) string { return uuid }
+
+func (s echoService) ErrorMessage(uuid string, err error) string {
+	if s.minimal {
+		return fmt.Sprintf("code %d", agent.ResultCode(err))
+	}
+	return err.Error()
+}
+
+func (s echoService) Publish(topic, payload string) error {
+	*s.published = append(*s.published, payload)
+	return nil
+}
+
+func TestSocketServer(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	dir, err := ioutil.TempDir("", "socket")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+
+	l, err := ListenSocket(path, 0600)
+	if err != nil {
+		t.Fatalf("failed to listen on socket: %s", err)
+	}
+	defer l.Close()
+	fi, err := os.Stat(path)
+	assert.Nil(t, err, fmt.Sprintf("unexpected error checking socket file: %s", err))
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), fmt.Sprintf("expected socket mode 0600 got %s", fi.Mode().Perm()))
+	go NewSocketServer(echoService{}, FormatSenMLCBOR, logger).Serve(l)
+
+	cases := []struct {
+		desc     string
+		payload  string
+		response string
+		code     int
+	}{
+		{"exec command", `[{"bn":"1:", "n":"exec", "vs":"ls,-la"}]`, "1:ls,-la", agent.CodeSuccess},
+		{"control command", `[{"bn":"2:", "n":"control", "vs":"nodes"}]`, "2:nodes", agent.CodeSuccess},
+		{"failed command", `[{"bn":"3:", "n":"exec", "vs":"fail"}]`, "", agent.CodeInvalidCommand},
+		{"unknown command", `[{"bn":"4:", "n":"reboot", "vs":"now"}]`, "", agent.CodeUnknownCommand},
+		{"malformed command", `{"uuid":"5"}`, "", agent.CodeInvalidCommand},
+	}
+
+	for _, tc := range cases {
+		c, err := net.Dial(socketNetwork, path)
+		if !assert.Nil(t, err, fmt.Sprintf("%s: unexpected error connecting to socket: %s", tc.desc, err)) {
+			continue
+		}
+		fmt.Fprintf(c, "%s\n", tc.payload)
+		res, err := ioutil.ReadAll(c)
+		c.Close()
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error reading response: %s", tc.desc, err))
+		if tc.code == agent.CodeSuccess {
+			assert.Equal(t, tc.response+"\n", string(res), fmt.Sprintf("%s: expected response %s got %s", tc.desc, tc.response, res))
+			continue
+		}
+		pack, err := senml.Decode(res, senml.JSON)
+		if !assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding response: %s", tc.desc, err)) {
+			continue
+		}
+		code := -1
+		for _, r := range pack.Records {
+			if r.Name == codeRecord {
+				code = int(*r.Value)
+			}
+		}
+		assert.Equal(t, tc.code, code, fmt.Sprintf("%s: expected code %d got %d", tc.desc, tc.code, code))
+	}
+}
+
+func TestSocketErrorResponse(t *testing.T) {
+	logger, err := log.New(ioutil.Discard, "error")
+	if err != nil {
+		t.Fatalf("unexpected error creating logger: %s", err)
+	}
+	reason := errors.Wrap(agent.ErrInvalidCommand, errors.New("unexpected token at /etc/agent/secret"))
+
+	cases := []struct {
+		desc    string
+		minimal bool
+		msg     string
+	}{
+		{"full verbosity", false, reason.Error()},
+		{"minimal verbosity", true, fmt.Sprintf("code %d", agent.CodeInvalidCommand)},
+	}
+
+	for _, tc := range cases {
+		s := NewSocketServer(echoService{minimal: tc.minimal}, FormatSenML, logger)
+		pack, err := senml.Decode([]byte(s.errorResponse("1", reason)), senml.JSON)
+		if !assert.Nil(t, err, fmt.Sprintf("%s: unexpected error decoding response: %s", tc.desc, err)) {
+			continue
+		}
+		msg := ""
+		for _, r := range pack.Records {
+			if r.Name == deadLetterError {
+				msg = *r.StringValue
+			}
+		}
+		assert.Equal(t, tc.msg, msg, fmt.Sprintf("%s: expected error %s got %s", tc.desc, tc.msg, msg))
+	}
+}
@@ -6,15 +6,56 @@ package edgex
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mainflux/mainflux/errors"
 	log "github.com/mainflux/mainflux/logger"
 
 	model "github.com/edgexfoundry/go-mod-core-contracts/models"
 )
 
+const (
+	// CoreData is EdgeX core data service.
+	CoreData = "edgex-core-data"
+
+	// CoreMetadata is EdgeX core metadata service.
+	CoreMetadata = "edgex-core-metadata"
+
+	// CoreCommand is EdgeX core command service.
+	CoreCommand = "edgex-core-command"
+
+	// SupportNotifications is EdgeX support notifications service.
+	SupportNotifications = "edgex-support-notifications"
+
+	// SupportLogging is EdgeX support logging service.
+	SupportLogging = "edgex-support-logging"
+)
+
+// servicePorts holds default ports of EdgeX services.
+var servicePorts = map[string]string{
+	CoreData:             "48080",
+	CoreMetadata:         "48081",
+	CoreCommand:          "48082",
+	SupportNotifications: "48060",
+	SupportLogging:       "48061",
+}
+
+// Services is list of EdgeX services which can be pinged.
+var Services = []string{CoreCommand, CoreData, CoreMetadata, SupportNotifications}
+
+var (
+	errUnknownService = errors.New("unknown EdgeX service")
+
+	errInvalidMethod = errors.New("device command method must be get or put")
+)
+
 type Client interface {
 
 	// PushOperation - pushes operation to EdgeX components
@@ -23,11 +64,26 @@ type Client interface {
 	// FetchConfig - fetches config from EdgeX components
 	FetchConfig([]string) (string, error)
 
-	// FetchMetrics - fetches metrics from EdgeX components
+	// FetchMetrics - fetches metrics of listed EdgeX components
 	FetchMetrics(cmdArr []string) (string, error)
 
 	// Ping - ping EdgeX SMA
 	Ping() (string, error)
+
+	// PingService - ping EdgeX service, service runs on the same host as SMA
+	PingService(service string) (string, error)
+
+	// DeviceCommand - invokes device command through EdgeX core command,
+	// method is either get or put, body is sent with put
+	DeviceCommand(device, command, method, body string) (string, error)
+
+	// FetchLogs - fetches at most limit latest log entries of EdgeX
+	// service from EdgeX support logging
+	FetchLogs(service string, limit int) (string, error)
+
+	// FetchReadings - fetches at most limit readings created between
+	// start and end, in milliseconds since epoch, from EdgeX core data
+	FetchReadings(start, end int64, limit int) (string, error)
 }
 
 type edgexClient struct {
@@ -123,3 +179,126 @@ func (ec *edgexClient) Ping() (string, error) {
 
 	return string(body), nil
 }
+
+// PingService - ping EdgeX service, service runs on the same host as SMA
+func (ec *edgexClient) PingService(service string) (string, error) {
+	port, ok := servicePorts[service]
+	if !ok {
+		return "", errors.Wrap(errUnknownService, fmt.Errorf("%s", service))
+	}
+
+	u, err := url.Parse(ec.url)
+	if err != nil {
+		return "", err
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), port)
+	u.Path = "/api/v1/ping"
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(http.StatusText(resp.StatusCode))
+	}
+
+	return string(body), nil
+}
+
+// DeviceCommand - invokes device command through EdgeX core command
+func (ec *edgexClient) DeviceCommand(device, command, method, body string) (string, error) {
+	method = strings.ToUpper(method)
+	if method != http.MethodGet && method != http.MethodPut {
+		return "", errInvalidMethod
+	}
+
+	u, err := url.Parse(ec.url)
+	if err != nil {
+		return "", err
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), servicePorts[CoreCommand])
+	u.Path = fmt.Sprintf("/api/v1/device/name/%s/command/%s", url.PathEscape(device), url.PathEscape(command))
+
+	req, err := http.NewRequest(method, u.String(), strings.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	if method == http.MethodPut {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return "", errors.Wrap(errors.New(http.StatusText(resp.StatusCode)), errors.New(string(data)))
+	}
+
+	return string(data), nil
+}
+
+// FetchLogs - fetches latest log entries of EdgeX service from EdgeX support logging
+func (ec *edgexClient) FetchLogs(service string, limit int) (string, error) {
+	u, err := url.Parse(ec.url)
+	if err != nil {
+		return "", err
+	}
+	end := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	u.Host = net.JoinHostPort(u.Hostname(), servicePorts[SupportLogging])
+	u.Path = fmt.Sprintf("/api/v1/logs/originServices/%s/0/%s/%d", url.PathEscape(service), end, limit)
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Wrap(errors.New(http.StatusText(resp.StatusCode)), errors.New(string(data)))
+	}
+
+	return string(data), nil
+}
+
+// FetchReadings - fetches readings created in time range from EdgeX core data
+func (ec *edgexClient) FetchReadings(start, end int64, limit int) (string, error) {
+	u, err := url.Parse(ec.url)
+	if err != nil {
+		return "", err
+	}
+	u.Host = net.JoinHostPort(u.Hostname(), servicePorts[CoreData])
+	u.Path = fmt.Sprintf("/api/v1/reading/%d/%d/%d", start, end, limit)
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Wrap(errors.New(http.StatusText(resp.StatusCode)), errors.New(string(data)))
+	}
+
+	return string(data), nil
+}
@@ -1,26 +1,202 @@
 package encoder
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/mainflux/senml"
 )
 
+// DefaultBaseName is base name template which uses uuid as is.
+const DefaultBaseName = "{{.UUID}}"
+
+const (
+	// FormatSenML is SenML JSON pack.
+	FormatSenML = "senml"
+
+	// FormatSenMLCBOR is SenML pack encoded as CBOR.
+	FormatSenMLCBOR = "senml-cbor"
+
+	// FormatJSON is JSON object with base name, time and values by record name.
+	FormatJSON = "json"
+
+	// FormatText is plain text with `name: value` line per record.
+	FormatText = "text"
+)
+
+var (
+	errMissingDeviceID = errors.New("base name template references device id which is not set")
+
+	// ErrUnsupportedFormat indicates that there is no encoder for the format.
+	ErrUnsupportedFormat = errors.New("unsupported response format")
+)
+
+type encoderFunc func([]senml.Record) ([]byte, error)
+
+var encoders = map[string]encoderFunc{
+	FormatSenML:     senmlEncoder(senml.JSON),
+	FormatSenMLCBOR: senmlEncoder(senml.CBOR),
+	FormatJSON:      encodeJSON,
+	FormatText:      encodeText,
+}
+
+// jsonObject is response encoded in JSON format.
+type jsonObject struct {
+	BaseName string                 `json:"bn"`
+	Time     float64                `json:"t"`
+	Records  map[string]interface{} `json:"records"`
+}
+
+// baseNameData is data available in base name template.
+type baseNameData struct {
+	UUID     string
+	DeviceID string
+}
+
+// BaseName renders base name template, i.e. `{{.DeviceID}}:{{.UUID}}:`,
+// for the uuid and device. Uuid is used as is if template is empty.
+func BaseName(tmpl, uuid, device string) (string, error) {
+	if tmpl == "" {
+		return uuid, nil
+	}
+	if device == "" && strings.Contains(tmpl, ".DeviceID") {
+		return "", errMissingDeviceID
+	}
+	t, err := template.New("bn").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, baseNameData{UUID: uuid, DeviceID: device}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// ValidateBaseName checks that base name template can be rendered for the device.
+func ValidateBaseName(tmpl, device string) error {
+	_, err := BaseName(tmpl, "", device)
+	return err
+}
+
 func EncodeSenML(bn, n, sv string) ([]byte, error) {
-	ts := float64(time.Now().UnixNano()) / float64(time.Second)
-	s := senml.Pack{
-		Records: []senml.Record{
-			senml.Record{
-				BaseName:    bn,
-				Name:        n,
-				Time:        ts,
-				StringValue: &sv,
-			},
+	return EncodeRecords(bn, []senml.Record{
+		senml.Record{
+			Name:        n,
+			StringValue: &sv,
 		},
+	})
+}
+
+// EncodeRecords sets base name and current time to records without
+// time and encodes them into SenML JSON pack. Base name is set as is,
+// callers render configured template with BaseName.
+func EncodeRecords(bn string, records []senml.Record) ([]byte, error) {
+	return Encode(FormatSenML, bn, records)
+}
+
+// Encode sets base name and current time to records without time and
+// encodes them in the given format.
+func Encode(format, bn string, records []senml.Record) ([]byte, error) {
+	enc, ok := encoders[format]
+	if !ok {
+		return nil, ErrUnsupportedFormat
 	}
-	payload, err := senml.Encode(s, senml.JSON)
-	if err != nil {
-		return nil, err
+	ts := float64(time.Now().UnixNano()) / float64(time.Second)
+	for i := range records {
+		if records[i].Time == 0 {
+			records[i].Time = ts
+		}
+	}
+	if len(records) > 0 {
+		records[0].BaseName = bn
+	}
+	return enc(records)
+}
+
+// ValidateFormat checks that there is encoder for the format.
+func ValidateFormat(format string) error {
+	if _, ok := encoders[format]; !ok {
+		return ErrUnsupportedFormat
+	}
+	return nil
+}
+
+func senmlEncoder(f senml.Format) encoderFunc {
+	return func(records []senml.Record) ([]byte, error) {
+		return senml.Encode(senml.Pack{Records: records}, f)
+	}
+}
+
+// encodeJSON encodes records into JSON object with base name, time of the
+// first record and values by record name. Values of records sharing the
+// name are collected into array.
+func encodeJSON(records []senml.Record) ([]byte, error) {
+	obj := jsonObject{Records: map[string]interface{}{}}
+	if len(records) > 0 {
+		obj.BaseName, obj.Time = records[0].BaseName, records[0].Time
+	}
+	for _, r := range records {
+		v := value(r)
+		prev, ok := obj.Records[r.Name]
+		if !ok {
+			obj.Records[r.Name] = v
+			continue
+		}
+		if vals, ok := prev.([]interface{}); ok {
+			obj.Records[r.Name] = append(vals, v)
+			continue
+		}
+		obj.Records[r.Name] = []interface{}{prev, v}
+	}
+	return json.Marshal(obj)
+}
+
+// encodeText encodes records as `name: value` lines, preceded by base name line.
+func encodeText(records []senml.Record) ([]byte, error) {
+	var sb strings.Builder
+	if len(records) > 0 {
+		fmt.Fprintf(&sb, "bn: %s\n", records[0].BaseName)
+	}
+	for _, r := range records {
+		line := fmt.Sprintf("%s:", r.Name)
+		if v := value(r); v != nil {
+			line = fmt.Sprintf("%s %v", line, v)
+		}
+		sb.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return []byte(sb.String()), nil
+}
+
+// value returns the value of the record, whichever of its values is set.
+func value(r senml.Record) interface{} {
+	switch {
+	case r.StringValue != nil:
+		return *r.StringValue
+	case r.Value != nil:
+		return *r.Value
+	case r.BoolValue != nil:
+		return *r.BoolValue
+	case r.Sum != nil:
+		return *r.Sum
+	case r.DataValue != nil:
+		return *r.DataValue
+	}
+	return nil
+}
+
+// Counter returns record of cumulative metric. Total is set as SenML sum
+// so that consumers compute rates instead of treating it as a gauge.
+func Counter(n string, total float64) senml.Record {
+	return senml.Record{
+		Name: n,
+		Sum:  &total,
 	}
-	return payload, nil
 }
@@ -0,0 +1,130 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+var _ Store = (*fileStore)(nil)
+
+var (
+	// errOpenStore indicates failure to create store directory
+	errOpenStore = errors.New("failed to open file store")
+
+	// errWrite indicates failure to write value
+	errWrite = errors.New("failed to write value")
+
+	// errRead indicates failure to read value
+	errRead = errors.New("failed to read value")
+)
+
+type fileStore struct {
+	dir string
+	mu  sync.RWMutex
+}
+
+// NewFile returns store which keeps each value in
+// `<dir>/<bucket>/<key>` file, keys are path escaped.
+func NewFile(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrap(errOpenStore, err)
+	}
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) Put(bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := s.bucket(bucket)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrap(errWrite, err)
+	}
+	tmp, err := ioutil.TempFile(dir, ".tmp")
+	if err != nil {
+		return errors.Wrap(errWrite, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return errors.Wrap(errWrite, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(errWrite, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, url.PathEscape(key))); err != nil {
+		return errors.Wrap(errWrite, err)
+	}
+	return nil
+}
+
+func (s *fileStore) Get(bucket, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, err := ioutil.ReadFile(filepath.Join(s.bucket(bucket), url.PathEscape(key)))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, errors.Wrap(errRead, err)
+	}
+	return v, nil
+}
+
+func (s *fileStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := os.Remove(filepath.Join(s.bucket(bucket), url.PathEscape(key)))
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(errWrite, err)
+	}
+	return nil
+}
+
+func (s *fileStore) List(bucket string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	values := map[string][]byte{}
+	dir := s.bucket(bucket)
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(errRead, err)
+	}
+	for _, f := range files {
+		if f.IsDir() || f.Name()[0] == '.' {
+			continue
+		}
+		key, err := url.PathUnescape(f.Name())
+		if err != nil {
+			continue
+		}
+		v, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, errors.Wrap(errRead, err)
+		}
+		values[key] = v
+	}
+	return values, nil
+}
+
+func (s *fileStore) Close() error {
+	return nil
+}
+
+func (s *fileStore) bucket(bucket string) string {
+	return filepath.Join(s.dir, url.PathEscape(bucket))
+}
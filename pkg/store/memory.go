@@ -0,0 +1,63 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package store
+
+import "sync"
+
+var _ Store = (*memoryStore)(nil)
+
+type memoryStore struct {
+	buckets map[string]map[string][]byte
+	mu      sync.RWMutex
+}
+
+// NewMemory returns store which keeps values in memory.
+func NewMemory() Store {
+	return &memoryStore{
+		buckets: map[string]map[string][]byte{},
+	}
+}
+
+func (s *memoryStore) Put(bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		b = map[string][]byte{}
+		s.buckets[bucket] = b
+	}
+	b[key] = append([]byte{}, value...)
+	return nil
+}
+
+func (s *memoryStore) Get(bucket, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.buckets[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, v...), nil
+}
+
+func (s *memoryStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+func (s *memoryStore) List(bucket string) (map[string][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	values := map[string][]byte{}
+	for k, v := range s.buckets[bucket] {
+		values[k] = append([]byte{}, v...)
+	}
+	return values, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
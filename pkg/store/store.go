@@ -0,0 +1,57 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+// Package store provides key-value persistence for agent state.
+package store
+
+import (
+	"fmt"
+
+	"github.com/mainflux/mainflux/errors"
+)
+
+const (
+	// Memory keeps values in memory, they are lost on restart.
+	Memory = "memory"
+
+	// File keeps each value in a file under bucket directory.
+	File = "file"
+)
+
+var (
+	// ErrNotFound indicates that key doesn't exist in the bucket.
+	ErrNotFound = errors.New("key not found")
+
+	// errUnsupportedBackend indicates unknown backend
+	errUnsupportedBackend = errors.New("unsupported store backend")
+)
+
+// Store specifies API for persisting values grouped in buckets.
+type Store interface {
+	// Put saves value under the key in the bucket.
+	Put(bucket, key string, value []byte) error
+
+	// Get returns value saved under the key in the bucket.
+	Get(bucket, key string) ([]byte, error)
+
+	// Delete removes the key from the bucket.
+	Delete(bucket, key string) error
+
+	// List returns all values in the bucket by their keys.
+	List(bucket string) (map[string][]byte, error)
+
+	// Close releases resources held by the store.
+	Close() error
+}
+
+// New returns store of given backend. Path is used by persistent backends.
+func New(backend, path string) (Store, error) {
+	switch backend {
+	case Memory, "":
+		return NewMemory(), nil
+	case File:
+		return NewFile(path)
+	default:
+		return nil, errors.Wrap(errUnsupportedBackend, fmt.Errorf("%s", backend))
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) Mainflux
+// SPDX-License-Identifier: Apache-2.0
+
+package store_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mainflux/agent/pkg/store"
+	"github.com/mainflux/mainflux/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs, err := store.NewFile(dir)
+	if err != nil {
+		t.Fatalf("failed to create file store: %s", err)
+	}
+	stores := map[string]store.Store{
+		store.Memory: store.NewMemory(),
+		store.File:   fs,
+	}
+
+	for name, s := range stores {
+		err := s.Put("services", "core/data", []byte("v1"))
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on put %s", name, err))
+		err = s.Put("services", "core/data", []byte("v2"))
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on overwrite %s", name, err))
+		err = s.Put("services", "export", []byte("v3"))
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on put %s", name, err))
+
+		v, err := s.Get("services", "core/data")
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on get %s", name, err))
+		assert.Equal(t, "v2", string(v), fmt.Sprintf("%s: expected v2 got %s", name, v))
+
+		_, err = s.Get("services", "none")
+		assert.True(t, errors.Contains(err, store.ErrNotFound), fmt.Sprintf("%s: expected error %s got %s", name, store.ErrNotFound, err))
+
+		values, err := s.List("services")
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on list %s", name, err))
+		assert.Equal(t, map[string][]byte{"core/data": []byte("v2"), "export": []byte("v3")}, values, fmt.Sprintf("%s: unexpected values %v", name, values))
+
+		err = s.Delete("services", "export")
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on delete %s", name, err))
+		values, err = s.List("services")
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on list %s", name, err))
+		assert.Equal(t, 1, len(values), fmt.Sprintf("%s: expected 1 value got %d", name, len(values)))
+
+		values, err = s.List("empty")
+		assert.Nil(t, err, fmt.Sprintf("%s: unexpected error on list %s", name, err))
+		assert.Equal(t, 0, len(values), fmt.Sprintf("%s: expected no values got %d", name, len(values)))
+	}
+}
@@ -27,6 +27,7 @@ var (
 
 type term struct {
 	uuid         string
+	bn           string
 	ptmx         *os.File
 	writer       io.Writer
 	done         chan bool
@@ -45,10 +46,12 @@ type Session interface {
 	io.Writer
 }
 
-func NewSession(uuid string, timeout time.Duration, publish func(channel, payload string) error, logger logger.Logger) (Session, error) {
+// NewSession starts terminal session whose output is published with base name bn.
+func NewSession(uuid, bn string, timeout time.Duration, publish func(channel, payload string) error, logger logger.Logger) (Session, error) {
 	t := &term{
 		logger:       logger,
 		uuid:         uuid,
+		bn:           bn,
 		publish:      publish,
 		timeout:      timeout,
 		resetTimeout: timeout,
@@ -109,7 +112,7 @@ func (t *term) IsDone() chan bool {
 func (t *term) Write(p []byte) (int, error) {
 	t.resetCounter(t.resetTimeout)
 	n := len(p)
-	payload, err := encoder.EncodeSenML(t.uuid, terminal, string(p))
+	payload, err := encoder.EncodeSenML(t.bn, terminal, string(p))
 	if err != nil {
 		return n, err
 	}